@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	AccessFormatJSON     = "json"
+	AccessFormatLogfmt   = "logfmt"
+	AccessFormatCombined = "combined"
+)
+
+type AccessLogger struct {
+	format string
+	mu     sync.Mutex
+	out    io.Writer
+}
+
+func NewAccessLogger(cfg LogConfig) (*AccessLogger, error) {
+	if cfg.AccessFormat == "" {
+		return nil, nil
+	}
+	var out io.Writer = os.Stdout
+	if cfg.AccessLog != "" {
+		file, err := os.OpenFile(cfg.AccessLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open access log: %w", err)
+		}
+		out = file
+	}
+	return &AccessLogger{format: cfg.AccessFormat, out: out}, nil
+}
+
+type accessLogEntry struct {
+	Time       time.Time `json:"time"`
+	RequestId  string    `json:"request_id"`
+	Remote     string    `json:"remote"`
+	Method     string    `json:"method"`
+	Url        string    `json:"url"`
+	Proto      string    `json:"proto"`
+	Route      string    `json:"route"`
+	Status     int       `json:"status"`
+	Bytes      int       `json:"bytes"`
+	DurationMs float64   `json:"duration_ms"`
+	Cache      string    `json:"cache"`
+	Tenant     string    `json:"tenant"`
+	Referer    string    `json:"referer"`
+	UserAgent  string    `json:"user_agent"`
+}
+
+func (logger *AccessLogger) Write(req *http.Request, rec *statusRecorder, startedAt time.Time, duration time.Duration) {
+	info := RequestInfoFromContext(req.Context())
+	entry := accessLogEntry{
+		Time:       startedAt,
+		RequestId:  info.Id,
+		Remote:     info.Source,
+		Method:     req.Method,
+		Url:        loggedUrl(req),
+		Proto:      req.Proto,
+		Route:      info.Route,
+		Status:     rec.Status(),
+		Bytes:      rec.bytes,
+		DurationMs: float64(duration.Microseconds()) / 1000,
+		Cache:      rec.Header().Get("X-Cache"),
+		Tenant:     info.Tenant,
+		Referer:    req.Referer(),
+		UserAgent:  req.UserAgent(),
+	}
+
+	var line []byte
+	switch logger.format {
+	case AccessFormatJSON:
+		line, _ = json.Marshal(entry)
+		line = append(line, '\n')
+	case AccessFormatLogfmt:
+		line = []byte(entry.logfmt())
+	case AccessFormatCombined:
+		line = []byte(entry.combined())
+	}
+
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	_, _ = logger.out.Write(line)
+}
+
+func logfmtValue(value string) string {
+	if value == "" {
+		return `""`
+	}
+	if strings.ContainsAny(value, " =\"\t\n") {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+func (entry accessLogEntry) logfmt() string {
+	pairs := []string{
+		"time=" + entry.Time.Format(time.RFC3339Nano),
+		"request_id=" + entry.RequestId,
+		"remote=" + logfmtValue(entry.Remote),
+		"method=" + entry.Method,
+		"url=" + logfmtValue(entry.Url),
+		"proto=" + entry.Proto,
+		"route=" + logfmtValue(entry.Route),
+		"status=" + strconv.Itoa(entry.Status),
+		"bytes=" + strconv.Itoa(entry.Bytes),
+		"duration_ms=" + strconv.FormatFloat(entry.DurationMs, 'f', 3, 64),
+		"cache=" + logfmtValue(entry.Cache),
+		"tenant=" + logfmtValue(entry.Tenant),
+		"referer=" + logfmtValue(entry.Referer),
+		"user_agent=" + logfmtValue(entry.UserAgent),
+	}
+	return strings.Join(pairs, " ") + "\n"
+}
+
+func combinedField(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// combined is the apache combined format with the cache status and the
+// duration in microseconds appended, the tenant takes the place of the user
+func (entry accessLogEntry) combined() string {
+	bytes := "-"
+	if entry.Bytes > 0 {
+		bytes = strconv.Itoa(entry.Bytes)
+	}
+	return fmt.Sprintf("%s - %s [%s] %q %d %s %q %q %q %d\n",
+		combinedField(entry.Remote),
+		combinedField(entry.Tenant),
+		entry.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		entry.Method+" "+entry.Url+" "+entry.Proto,
+		entry.Status,
+		bytes,
+		combinedField(entry.Referer),
+		combinedField(entry.UserAgent),
+		combinedField(entry.Cache),
+		int64(entry.DurationMs*1000),
+	)
+}
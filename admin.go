@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const AdminActorContextKey ctxKey = "adminActor"
+
+type AdminToken struct {
+	Name  string `yaml:"name"`
+	Token string `yaml:"token"`
+}
+
+type AdminConfig struct {
+	// Addr is the listener serving /admin, /metrics and /debug/pprof, apart from the public api
+	Addr        string       `yaml:"addr"`
+	Token       string       `yaml:"token"`
+	Tokens      []AdminToken `yaml:"tokens"`
+	MetricsAuth bool         `yaml:"metrics_auth"`
+	Pprof       bool         `yaml:"pprof"`
+}
+
+// actor returns the name of the admin owning token, or "" for unknown tokens
+func (cfg AdminConfig) actor(token string) string {
+	if token == "" {
+		return ""
+	}
+	if cfg.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(cfg.Token)) == 1 {
+		return "admin"
+	}
+	for _, candidate := range cfg.Tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(candidate.Token)) == 1 {
+			return candidate.Name
+		}
+	}
+	return ""
+}
+
+func adminActor(ctx context.Context) string {
+	actor, _ := ctx.Value(AdminActorContextKey).(string)
+	return actor
+}
+
+// AdminAuth guards the admin endpoints with the configured bearer tokens,
+// they don't exist at all while no token is set
+func (srv *Server) AdminAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		if srv.Cfg.Admin.Token == "" && len(srv.Cfg.Admin.Tokens) == 0 {
+			http.NotFound(writer, req)
+			return
+		}
+		token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if _, password, ok := req.BasicAuth(); ok {
+			// browsers can only send basic auth, the password is the token
+			token = password
+		}
+		actor := srv.Cfg.Admin.actor(token)
+		if actor == "" {
+			writer.Header().Set("WWW-Authenticate", `Basic realm="admin"`)
+			writeError(writer, http.StatusUnauthorized, "invalid admin token")
+			return
+		}
+		next(writer, req.WithContext(context.WithValue(req.Context(), AdminActorContextKey, actor)))
+	}
+}
+
+type maintenanceState struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message,omitempty"`
+}
+
+// Maintenance answers every /api request with 503 while maintenance mode is on
+func (srv *Server) Maintenance(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		if state := srv.maintenance.Load(); state != nil && state.Enabled && isApiPath(req.URL.Path) {
+			message := state.Message
+			if message == "" {
+				message = "service is under maintenance"
+			}
+			writer.Header().Set("Retry-After", "300")
+			writeError(writer, http.StatusServiceUnavailable, message)
+			return
+		}
+		next.ServeHTTP(writer, req)
+	})
+}
+
+func (srv *Server) purgeCachePrefix(ctx context.Context, prefix string) (int64, error) {
+	if srv.db == nil {
+		return 0, nil
+	}
+	escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(prefix)
+	var total int64
+	for _, db := range srv.cacheShards {
+		res, err := db.ExecContext(ctx, `DELETE FROM caches WHERE key LIKE ? ESCAPE '\'`, escaped+"%")
+		if err != nil {
+			return total, err
+		}
+		deleted, err := res.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		cacheEvictionsTotal.Add(float64(deleted), "purge")
+		total += deleted
+	}
+	return total, nil
+}
+
+// RotateAllVisitors replaces every visitor with a freshly fetched one of the same kind
+func (srv *Server) RotateAllVisitors(ctx context.Context) (int, error) {
+	if srv.sharedVisitors != nil {
+		if err := srv.sharedVisitors.Clear(ctx); err != nil {
+			return 0, fmt.Errorf("failed to clear shared visitors: %w", err)
+		}
+		if err := srv.syncSharedVisitors(ctx); err != nil {
+			return 0, err
+		}
+		srv.mu.RLock()
+		defer srv.mu.RUnlock()
+		return len(srv.visitors), nil
+	}
+
+	srv.mu.RLock()
+	kinds := make([]bool, len(srv.visitors))
+	for i, visitor := range srv.visitors {
+		kinds[i] = visitor.IsYouTube
+	}
+	srv.mu.RUnlock()
+
+	rotated := 0
+	var lastErr error
+	for i, isYouTube := range kinds {
+		visitor, err := srv.fetchInnertubeContext(ctx, isYouTube)
+		recordVisitorRotation(isYouTube, err)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		srv.mu.Lock()
+		if i < len(srv.visitors) {
+			srv.visitors[i] = visitor
+			rotated++
+		}
+		srv.mu.Unlock()
+	}
+	if rotated == 0 && lastErr != nil {
+		return 0, lastErr
+	}
+	return rotated, nil
+}
+
+// ReloadConfig re-reads the config file and applies the settings that can
+// change at runtime, the rest needs a restart
+func (srv *Server) ReloadConfig() ([]string, error) {
+	cfg, err := ReadConfig(srv.configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := []string{"logging.level"}
+	logLevel.Set(cfg.Logging.Level)
+
+	if srv.tenants != nil {
+		if err := srv.tenants.SetStatic(cfg.Auth); err != nil {
+			return applied, fmt.Errorf("failed to reload api keys: %w", err)
+		}
+		applied = append(applied, "auth.tenants", "auth.keys", "auth.default_rate_limit")
+	}
+	return applied, nil
+}
+
+func (srv *Server) MakeCachePurgeHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		prefix := req.FormValue("prefix")
+		var purged int64
+		var err error
+		if prefix == "" {
+			err = srv.clearCache(req.Context())
+			purged = -1
+		} else {
+			purged, err = srv.purgeCachePrefix(req.Context(), prefix)
+		}
+		srv.recordAudit(req, "cache_purge", map[string]any{"prefix": prefix, "purged": purged}, err)
+		if err != nil {
+			writeError(writer, http.StatusInternalServerError, fmt.Sprintf("Error purging cache: %v", err))
+			return
+		}
+		srv.writeJSON(writer, req, map[string]any{"purged": purged}, CacheStatus{})
+	}
+}
+
+func (srv *Server) MakeVisitorRotateHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		rotated, err := srv.RotateAllVisitors(req.Context())
+		srv.recordAudit(req, "visitor_rotate", map[string]any{"rotated": rotated}, err)
+		if err != nil {
+			writeError(writer, http.StatusInternalServerError, fmt.Sprintf("Error rotating visitors: %v", err))
+			return
+		}
+		srv.writeJSON(writer, req, map[string]any{"rotated": rotated}, CacheStatus{})
+	}
+}
+
+func (srv *Server) MakeConfigReloadHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		applied, err := srv.ReloadConfig()
+		srv.recordAudit(req, "config_reload", map[string]any{"applied": applied}, err)
+		if err != nil {
+			writeError(writer, http.StatusInternalServerError, fmt.Sprintf("Error reloading config: %v", err))
+			return
+		}
+		srv.writeJSON(writer, req, map[string]any{"applied": applied}, CacheStatus{})
+	}
+}
+
+func (srv *Server) MakeMaintenanceHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		enabled, err := strconv.ParseBool(req.FormValue("enabled"))
+		if err != nil {
+			writeError(writer, http.StatusBadRequest, "enabled must be true or false")
+			return
+		}
+		state := &maintenanceState{Enabled: enabled, Message: req.FormValue("message")}
+		srv.maintenance.Store(state)
+		srv.recordAudit(req, "maintenance_toggle", map[string]any{"enabled": enabled, "message": state.Message}, nil)
+		LoggerFromContext(req.Context()).Warn("Maintenance mode changed", "enabled", enabled, "actor", adminActor(req.Context()))
+		srv.writeJSON(writer, req, state, CacheStatus{})
+	}
+}
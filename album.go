@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+const INNERTUBE_MUSIC_BROWSE_API_URL = YT_MUSIC_BASE_URL + "/youtubei/v1/browse?prettyPrint=false"
+
+// parseAlbumPlaylistId finds the OLAK5uy playlist backing a YouTube Music album page
+func parseAlbumPlaylistId(data []byte) (string, error) {
+	canonical := gjson.GetBytes(data, "microformat.microformatDataRenderer.urlCanonical").String()
+	if parsed, err := url.Parse(canonical); err == nil {
+		if list := parsed.Query().Get("list"); list != "" {
+			return list, nil
+		}
+	}
+
+	var playlistId string
+	gjson.GetBytes(data, "header.musicDetailHeaderRenderer.menu.menuRenderer.topLevelButtons").
+		ForEach(func(_, button gjson.Result) bool {
+			playlistId = button.Get(
+				"buttonRenderer.navigationEndpoint.watchPlaylistEndpoint.playlistId",
+			).String()
+			return playlistId == ""
+		})
+	if playlistId == "" {
+		err := newParseError("microformatDataRenderer.urlCanonical", "missing", canonical)
+		recordParseFailure("album", err, data)
+		return "", err
+	}
+	return playlistId, nil
+}
+
+// LoadAlbum maps a YouTube Music album browse id (MPREb...) to its playlist
+// and loads the tracks through the playlist loader
+func (srv *Server) LoadAlbum(ctx context.Context, browseId string, maxTracks int) (*YouTubePlaylist, error) {
+	visitor, err := srv.pickVisitor(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := srv.innertubeRequest(ctx, "album", INNERTUBE_MUSIC_BROWSE_API_URL, visitor, map[string]any{
+		"browseId": browseId,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	playlistId, err := parseAlbumPlaylistId(respBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find album playlist: %w", err)
+	}
+	LoggerFromContext(ctx).Info("Resolved album playlist", "album", browseId, "playlist", playlistId)
+
+	album, err := srv.LoadPlaylist(ctx, playlistId, maxTracks)
+	if err != nil {
+		return nil, err
+	}
+	if title := gjson.GetBytes(respBody, "microformat.microformatDataRenderer.title").String(); title != "" {
+		album.Title = strings.TrimSuffix(title, " - YouTube Music")
+	}
+	album.Uri = YT_MUSIC_BASE_URL + "/browse/" + browseId
+	return album, nil
+}
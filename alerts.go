@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	AlertParseFailureRate  = "parse_failure_rate"
+	AlertUpstreamErrorRate = "upstream_error_rate"
+	AlertZeroResultRate    = "zero_result_rate"
+)
+
+var ErrCacheOnly = errors.New("upstream requests are disabled, serving cached results only")
+
+type AlertsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Window is how many seconds the rates are measured over
+	Window        int `yaml:"window"`
+	CheckInterval int `yaml:"check_interval"`
+	// MinSamples keeps a handful of requests from firing an alert
+	MinSamples int `yaml:"min_samples"`
+	// thresholds are shares between 0 and 1, 0 disables the alert
+	ParseFailureRate  float64 `yaml:"parse_failure_rate"`
+	UpstreamErrorRate float64 `yaml:"upstream_error_rate"`
+	ZeroResultRate    float64 `yaml:"zero_result_rate"`
+	WebhookUrl        string  `yaml:"webhook_url"`
+	// CacheOnly stops upstream requests while any alert fires
+	CacheOnly bool `yaml:"cache_only"`
+}
+
+var (
+	alertFiring   = metrics.Gauge("ytsearch_alert_firing", "Whether an alert currently fires", "alert")
+	cacheOnlyMode = metrics.Gauge(
+		"ytsearch_cache_only",
+		"Whether upstream requests are disabled and only cached results are served",
+	)
+)
+
+// alertTotals are running totals, the engine compares snapshots of them
+// to get the rates over its window
+var alertTotals struct {
+	upstreamCalls  atomic.Int64
+	upstreamErrors atomic.Int64
+	parseFailures  atomic.Int64
+	searches       atomic.Int64
+	zeroResults    atomic.Int64
+}
+
+type alertSnapshot struct {
+	at             time.Time
+	upstreamCalls  int64
+	upstreamErrors int64
+	parseFailures  int64
+	searches       int64
+	zeroResults    int64
+}
+
+func takeAlertSnapshot() alertSnapshot {
+	return alertSnapshot{
+		at:             time.Now(),
+		upstreamCalls:  alertTotals.upstreamCalls.Load(),
+		upstreamErrors: alertTotals.upstreamErrors.Load(),
+		parseFailures:  alertTotals.parseFailures.Load(),
+		searches:       alertTotals.searches.Load(),
+		zeroResults:    alertTotals.zeroResults.Load(),
+	}
+}
+
+func recordSearchResult(count int) {
+	alertTotals.searches.Add(1)
+	if count == 0 {
+		alertTotals.zeroResults.Add(1)
+	}
+}
+
+type AlertEvent struct {
+	Alert         string    `json:"alert"`
+	State         string    `json:"state"`
+	Value         float64   `json:"value"`
+	Threshold     float64   `json:"threshold"`
+	WindowSeconds int       `json:"window_seconds"`
+	CacheOnly     bool      `json:"cache_only"`
+	Time          time.Time `json:"time"`
+}
+
+func (srv *Server) notifyAlert(ctx context.Context, event AlertEvent) {
+	if event.State == "firing" {
+		slog.Warn("Alert firing", "alert", event.Alert, "value", event.Value, "threshold", event.Threshold)
+	} else {
+		slog.Info("Alert resolved", "alert", event.Alert, "value", event.Value, "threshold", event.Threshold)
+	}
+	if srv.Cfg.Alerts.WebhookUrl == "" {
+		return
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("Failed to marshal alert event", "error", err)
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, srv.Cfg.Alerts.WebhookUrl, bytes.NewReader(body))
+	if err != nil {
+		slog.Error("Failed to create alert webhook request", "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := srv.external.Do(req)
+	if err != nil {
+		slog.Error("Failed to deliver alert webhook", "alert", event.Alert, "error", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		slog.Error("Alert webhook failed", "alert", event.Alert, "status", resp.Status)
+	}
+}
+
+// evaluate returns the rate of every enabled alert with enough samples
+// between the two snapshots
+func (cfg AlertsConfig) evaluate(from alertSnapshot, to alertSnapshot) map[string]float64 {
+	rates := make(map[string]float64)
+	calls := to.upstreamCalls - from.upstreamCalls
+	if calls >= int64(cfg.MinSamples) && calls > 0 {
+		if cfg.UpstreamErrorRate > 0 {
+			rates[AlertUpstreamErrorRate] = float64(to.upstreamErrors-from.upstreamErrors) / float64(calls)
+		}
+		if cfg.ParseFailureRate > 0 {
+			rates[AlertParseFailureRate] = float64(to.parseFailures-from.parseFailures) / float64(calls)
+		}
+	}
+	searches := to.searches - from.searches
+	if cfg.ZeroResultRate > 0 && searches >= int64(cfg.MinSamples) && searches > 0 {
+		rates[AlertZeroResultRate] = float64(to.zeroResults-from.zeroResults) / float64(searches)
+	}
+	return rates
+}
+
+func (cfg AlertsConfig) threshold(alert string) float64 {
+	switch alert {
+	case AlertParseFailureRate:
+		return cfg.ParseFailureRate
+	case AlertUpstreamErrorRate:
+		return cfg.UpstreamErrorRate
+	default:
+		return cfg.ZeroResultRate
+	}
+}
+
+// RunAlerts checks the failure rates every check interval, notifying on each
+// alert that starts or stops firing. With cache_only the upstream is switched
+// off while anything fires; without upstream traffic the rates lack samples,
+// so the alert resolves after a window and the upstream is tried again.
+func (srv *Server) RunAlerts(ctx context.Context) {
+	cfg := srv.Cfg.Alerts
+	window := time.Duration(cfg.Window) * time.Second
+	ticker := time.NewTicker(time.Duration(cfg.CheckInterval) * time.Second)
+	defer ticker.Stop()
+
+	snapshots := []alertSnapshot{takeAlertSnapshot()}
+	firing := make(map[string]bool)
+	slog.Info("Started alert engine", "window", window)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		now := takeAlertSnapshot()
+		for len(snapshots) > 1 && now.at.Sub(snapshots[1].at) >= window {
+			snapshots = snapshots[1:]
+		}
+		rates := cfg.evaluate(snapshots[0], now)
+		snapshots = append(snapshots, now)
+
+		for _, alert := range []string{AlertParseFailureRate, AlertUpstreamErrorRate, AlertZeroResultRate} {
+			rate, sampled := rates[alert]
+			fires := sampled && rate > cfg.threshold(alert)
+			if fires == firing[alert] {
+				continue
+			}
+			firing[alert] = fires
+			state := "resolved"
+			if fires {
+				state = "firing"
+				alertFiring.Set(1, alert)
+			} else {
+				alertFiring.Set(0, alert)
+			}
+
+			cacheOnly := false
+			for _, active := range firing {
+				cacheOnly = cacheOnly || active
+			}
+			cacheOnly = cacheOnly && cfg.CacheOnly
+			if srv.client.CacheOnly.Swap(cacheOnly) != cacheOnly {
+				if cacheOnly {
+					cacheOnlyMode.Set(1)
+				} else {
+					cacheOnlyMode.Set(0)
+				}
+				slog.Warn("Cache only mode changed", "enabled", cacheOnly)
+			}
+
+			srv.notifyAlert(ctx, AlertEvent{
+				Alert:         alert,
+				State:         state,
+				Value:         rate,
+				Threshold:     cfg.threshold(alert),
+				WindowSeconds: cfg.Window,
+				CacheOnly:     cacheOnly,
+				Time:          now.at,
+			})
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+var unsafeArtifactChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// maxArtifactSignatures is how many failure signatures SaveOnce remembers,
+// the least recently seen are forgotten first
+const maxArtifactSignatures = 1000
+
+// DebugArtifacts stores raw upstream payloads that could not be handled, so
+// layout changes can be analysed later. Writes are rate limited per hour.
+type DebugArtifacts struct {
+	mu          sync.Mutex
+	dir         string
+	maxPerHour  int
+	windowStart time.Time
+	written     int
+	order       *list.List
+	signatures  map[string]*list.Element
+}
+
+var artifacts = NewDebugArtifacts(DebugConfig{ArtifactsDir: "debug", MaxArtifactsPerHour: 10})
+
+func NewDebugArtifacts(cfg DebugConfig) *DebugArtifacts {
+	return &DebugArtifacts{
+		dir:        cfg.ArtifactsDir,
+		maxPerHour: cfg.MaxArtifactsPerHour,
+		order:      list.New(),
+		signatures: make(map[string]*list.Element),
+	}
+}
+
+func (a *DebugArtifacts) allow() bool {
+	if a.maxPerHour < 0 {
+		return false
+	}
+	if time.Since(a.windowStart) > time.Hour {
+		a.windowStart = time.Now()
+		a.written = 0
+	}
+	if a.written >= a.maxPerHour {
+		return false
+	}
+	a.written++
+	return true
+}
+
+// Save writes the payload unless the hourly budget is used up
+func (a *DebugArtifacts) Save(kind string, payload []byte) (string, error) {
+	a.mu.Lock()
+	allowed := a.allow()
+	a.mu.Unlock()
+	if !allowed {
+		slog.Debug("Skipping debug artifact, budget exhausted", "kind", kind)
+		return "", nil
+	}
+
+	if err := os.MkdirAll(a.dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create artifacts dir: %w", err)
+	}
+	name := fmt.Sprintf(
+		"%s_%s.dump",
+		time.Now().UTC().Format("20060102T150405.000"),
+		unsafeArtifactChars.ReplaceAllString(kind, "_"),
+	)
+	path := filepath.Join(a.dir, name)
+	if err := os.WriteFile(path, payload, 0o644); err != nil {
+		return "", fmt.Errorf("failed to write debug artifact: %w", err)
+	}
+	slog.Info("Saved debug artifact", "kind", kind, "path", path)
+	return path, nil
+}
+
+// SaveOnce only keeps the first payload saved for a signature. The signature
+// is claimed before writing so concurrent failures save it once, and given up
+// again when nothing was written.
+func (a *DebugArtifacts) SaveOnce(signature string, kind string, payload []byte) {
+	a.mu.Lock()
+	if element, seen := a.signatures[signature]; seen {
+		a.order.MoveToFront(element)
+		a.mu.Unlock()
+		return
+	}
+	element := a.order.PushFront(signature)
+	a.signatures[signature] = element
+	for a.order.Len() > maxArtifactSignatures {
+		oldest := a.order.Back()
+		a.order.Remove(oldest)
+		delete(a.signatures, oldest.Value.(string))
+	}
+	a.mu.Unlock()
+
+	path, err := a.Save(kind, payload)
+	if err != nil {
+		slog.Error("Failed to save debug artifact", "kind", kind, "error", err)
+	}
+	if path == "" {
+		a.mu.Lock()
+		if a.signatures[signature] == element {
+			a.order.Remove(element)
+			delete(a.signatures, signature)
+		}
+		a.mu.Unlock()
+	}
+}
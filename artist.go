@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+var channelIdPattern = regexp.MustCompile(`^UC[a-zA-Z0-9_-]{22}$`)
+
+// ArtistSong is one of the top songs listed on an artist page
+type ArtistSong struct {
+	Identifier string      `json:"identifier"`
+	Title      string      `json:"title"`
+	Artists    []MusicRef  `json:"artists"`
+	Album      *MusicRef   `json:"album,omitempty"`
+	Images     []Thumbnail `json:"images"`
+	Uri        string      `json:"uri"`
+}
+
+// ArtistRelease is an album or single, its identifier is the MPREb browse id
+// the album loader accepts
+type ArtistRelease struct {
+	Identifier string      `json:"identifier"`
+	Title      string      `json:"title"`
+	Year       string      `json:"year,omitempty"`
+	Images     []Thumbnail `json:"images"`
+	Uri        string      `json:"uri"`
+}
+
+type YouTubeMusicArtist struct {
+	Identifier  string          `json:"identifier"`
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Subscribers string          `json:"subscribers,omitempty"`
+	Images      []Thumbnail     `json:"images"`
+	Uri         string          `json:"uri"`
+	TopSongs    []ArtistSong    `json:"top_songs"`
+	Albums      []ArtistRelease `json:"albums"`
+	Singles     []ArtistRelease `json:"singles"`
+}
+
+func parseArtistSong(item gjson.Result) (ArtistSong, error) {
+	itemRenderer := item.Get("musicResponsiveListItemRenderer")
+	if !itemRenderer.Exists() {
+		return ArtistSong{}, newParseError(rendererName(item), ParseReasonUnsupportedRenderer, "")
+	}
+	videoId := itemRenderer.Get("playlistItemData.videoId").String()
+	if videoId == "" {
+		return ArtistSong{}, newParseError("musicResponsiveListItemRenderer.playlistItemData", ParseReasonUnplayable, "")
+	}
+
+	song := ArtistSong{
+		Identifier: videoId,
+		Title:      itemRenderer.Get("flexColumns.0.musicResponsiveListItemFlexColumnRenderer.text.runs.0.text").String(),
+		Artists:    make([]MusicRef, 0),
+		Images:     parseThumbnails(itemRenderer.Get("thumbnail.musicThumbnailRenderer.thumbnail.thumbnails")),
+		Uri:        YT_MUSIC_BASE_URL + "/watch?v=" + videoId,
+	}
+	for i, column := range itemRenderer.Get("flexColumns").Array() {
+		if i == 0 {
+			continue
+		}
+		for _, run := range column.Get("musicResponsiveListItemFlexColumnRenderer.text.runs").Array() {
+			browseId := run.Get("navigationEndpoint.browseEndpoint.browseId").String()
+			switch {
+			case strings.HasPrefix(browseId, "MPRE"):
+				song.Album = &MusicRef{Id: browseId, Name: run.Get("text").String()}
+			case strings.HasPrefix(browseId, "UC"):
+				song.Artists = append(song.Artists, MusicRef{Id: browseId, Name: run.Get("text").String()})
+			}
+		}
+	}
+	return song, nil
+}
+
+func parseArtistRelease(item gjson.Result) (ArtistRelease, error) {
+	renderer := item.Get("musicTwoRowItemRenderer")
+	if !renderer.Exists() {
+		return ArtistRelease{}, newParseError(rendererName(item), ParseReasonUnsupportedRenderer, "")
+	}
+	browseId := renderer.Get("navigationEndpoint.browseEndpoint.browseId").String()
+	if !strings.HasPrefix(browseId, "MPRE") {
+		return ArtistRelease{}, newParseError("musicTwoRowItemRenderer.navigationEndpoint", "not_album", browseId)
+	}
+
+	release := ArtistRelease{
+		Identifier: browseId,
+		Title:      renderer.Get("title.runs.0.text").String(),
+		Images:     parseThumbnails(renderer.Get("thumbnailRenderer.musicThumbnailRenderer.thumbnail.thumbnails")),
+		Uri:        YT_MUSIC_BASE_URL + "/browse/" + browseId,
+	}
+	for _, run := range renderer.Get("subtitle.runs").Array() {
+		if text := strings.TrimSpace(run.Get("text").String()); yearPattern.MatchString(text) {
+			release.Year = text
+		}
+	}
+	return release, nil
+}
+
+func parseArtistPage(data []byte, channelId string) (*YouTubeMusicArtist, error) {
+	header := gjson.GetBytes(data, "header.musicImmersiveHeaderRenderer")
+	if !header.Exists() {
+		header = gjson.GetBytes(data, "header.musicVisualHeaderRenderer")
+	}
+	if !header.Exists() {
+		err := newParseError("header.musicImmersiveHeaderRenderer", "missing", "")
+		recordParseFailure("artist", err, data)
+		return nil, err
+	}
+
+	artist := &YouTubeMusicArtist{
+		Identifier:  channelId,
+		Name:        header.Get("title.runs.0.text").String(),
+		Description: header.Get("description.runs.0.text").String(),
+		Subscribers: header.Get("subscriptionButton.subscribeButtonRenderer.subscriberCountText.runs.0.text").String(),
+		Images:      parseThumbnails(header.Get("thumbnail.musicThumbnailRenderer.thumbnail.thumbnails")),
+		Uri:         YT_MUSIC_BASE_URL + "/channel/" + channelId,
+		TopSongs:    make([]ArtistSong, 0),
+		Albums:      make([]ArtistRelease, 0),
+		Singles:     make([]ArtistRelease, 0),
+	}
+
+	contents := gjson.GetBytes(
+		data,
+		"contents.singleColumnBrowseResultsRenderer.tabs.0.tabRenderer.content.sectionListRenderer.contents",
+	)
+	for _, content := range contents.Array() {
+		if shelf := content.Get("musicShelfRenderer"); shelf.Exists() {
+			for _, item := range shelf.Get("contents").Array() {
+				song, err := parseArtistSong(item)
+				if err != nil {
+					recordParseFailure("artist", err, data)
+					continue
+				}
+				artist.TopSongs = append(artist.TopSongs, song)
+			}
+			continue
+		}
+
+		carousel := content.Get("musicCarouselShelfRenderer")
+		title := strings.ToLower(
+			carousel.Get("header.musicCarouselShelfBasicHeaderRenderer.title.runs.0.text").String(),
+		)
+		var releases *[]ArtistRelease
+		switch {
+		case strings.Contains(title, "album"):
+			releases = &artist.Albums
+		case strings.Contains(title, "single"):
+			releases = &artist.Singles
+		default:
+			// videos, playlists and related artists
+			continue
+		}
+		for _, item := range carousel.Get("contents").Array() {
+			release, err := parseArtistRelease(item)
+			if err != nil {
+				recordParseFailure("artist", err, data)
+				continue
+			}
+			*releases = append(*releases, release)
+		}
+	}
+	return artist, nil
+}
+
+// LoadArtist loads the top songs, albums and singles of a YouTube Music artist
+func (srv *Server) LoadArtist(ctx context.Context, channelId string) (*YouTubeMusicArtist, error) {
+	visitor, err := srv.pickVisitor(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := srv.innertubeRequest(ctx, "artist", INNERTUBE_MUSIC_BROWSE_API_URL, visitor, map[string]any{
+		"browseId": channelId,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	artist, err := parseArtistPage(respBody, channelId)
+	if err != nil {
+		recordParse(ctx, "artist", 0, err)
+		return nil, err
+	}
+	recordParse(ctx, "artist", len(artist.TopSongs)+len(artist.Albums)+len(artist.Singles), nil)
+	return artist, nil
+}
+
+func (srv *Server) MakeArtistHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		channelId := strings.TrimSpace(req.FormValue("id"))
+		if !channelIdPattern.MatchString(channelId) {
+			writeValidationError(writer, &ValidationError{
+				Code:    "invalid_artist_id",
+				Param:   "id",
+				Message: "id must be the UC... channel id of an artist",
+			})
+			return
+		}
+
+		cacheKey := "artist:" + channelId
+		if srv.db != nil {
+			entry, err := srv.LookupCache(req.Context(), cacheKey)
+			if err != nil {
+				LoggerFromContext(req.Context()).Error("Failed to lookup cache for artist", "error", err)
+			} else if entry != nil {
+				var artist YouTubeMusicArtist
+				if err := json.Unmarshal(entry.Value, &artist); err != nil {
+					LoggerFromContext(req.Context()).Error("Failed to unmarshal cached artist", "error", err)
+				} else {
+					srv.writeJSON(writer, req, artist, CacheStatus{Hit: true, StoredAt: entry.StoredAt})
+					return
+				}
+			}
+		}
+
+		artist, err := srv.LoadArtist(req.Context(), channelId)
+		if err != nil {
+			writeError(
+				writer,
+				http.StatusInternalServerError,
+				fmt.Sprintf("Error loading artist: %v", err),
+			)
+			return
+		}
+
+		if srv.db != nil {
+			if err := srv.StoreCache(req.Context(), cacheKey, artist); err != nil {
+				LoggerFromContext(req.Context()).Error("Failed to store artist in cache", "error", err)
+			}
+		}
+		srv.writeJSON(writer, req, artist, CacheStatus{})
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const auditSchema = `
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		actor TEXT NOT NULL,
+		action TEXT NOT NULL,
+		params TEXT,
+		error TEXT DEFAULT '',
+		remote_addr TEXT,
+		created_at DATETIME NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_audit_log_action ON audit_log (action);`
+
+type AuditEntry struct {
+	Id         int64           `json:"id"`
+	Actor      string          `json:"actor"`
+	Action     string          `json:"action"`
+	Params     json.RawMessage `json:"params"`
+	Error      string          `json:"error,omitempty"`
+	RemoteAddr string          `json:"remote_addr"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// recordAudit stores an admin action, it is logged as well so nothing is
+// lost while the database is unavailable
+func (srv *Server) recordAudit(req *http.Request, action string, params map[string]any, actionErr error) {
+	actor := adminActor(req.Context())
+	errText := ""
+	if actionErr != nil {
+		errText = actionErr.Error()
+	}
+	LoggerFromContext(req.Context()).Info("Admin action", "actor", actor, "action", action, "params", params, "error", errText)
+	if srv.db == nil {
+		return
+	}
+
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		LoggerFromContext(req.Context()).Error("Failed to marshal audit params", "error", err)
+		return
+	}
+	_, err = srv.db.ExecContext(context.WithoutCancel(req.Context()),
+		`INSERT INTO audit_log (actor, action, params, error, remote_addr, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		actor, action, string(encoded), errText, req.RemoteAddr, time.Now().UTC(),
+	)
+	if err != nil {
+		LoggerFromContext(req.Context()).Error("Failed to store audit entry", "action", action, "error", err)
+	}
+}
+
+func (srv *Server) LoadAuditLog(ctx context.Context, action string, limit int) ([]AuditEntry, error) {
+	query := "SELECT id, actor, action, params, error, remote_addr, created_at FROM audit_log"
+	var args []any
+	if action != "" {
+		query += " WHERE action = ?"
+		args = append(args, action)
+	}
+	args = append(args, limit)
+	rows, err := srv.db.QueryContext(ctx, query+" ORDER BY id DESC LIMIT ?", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %w", err)
+	}
+	defer rows.Close()
+
+	entries := make([]AuditEntry, 0)
+	for rows.Next() {
+		var entry AuditEntry
+		var params string
+		if err := rows.Scan(
+			&entry.Id, &entry.Actor, &entry.Action, &params, &entry.Error, &entry.RemoteAddr, &entry.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		entry.Params = json.RawMessage(params)
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (srv *Server) MakeAuditLogHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		if srv.db == nil {
+			writeError(writer, http.StatusServiceUnavailable, "the audit log requires caching to be enabled")
+			return
+		}
+
+		limit := 100
+		if value := req.FormValue("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed <= 0 {
+				writeError(writer, http.StatusBadRequest, "limit must be a positive integer")
+				return
+			}
+			limit = min(parsed, 1000)
+		}
+
+		entries, err := srv.LoadAuditLog(req.Context(), req.FormValue("action"), limit)
+		if err != nil {
+			writeError(writer, http.StatusInternalServerError, fmt.Sprintf("Error loading audit log: %v", err))
+			return
+		}
+		srv.writeJSON(writer, req, entries, CacheStatus{NoStore: true})
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+type VideoAvailability struct {
+	VideoId            string   `json:"video_id"`
+	Available          bool     `json:"available"`
+	Status             string   `json:"status"`
+	Reason             string   `json:"reason,omitempty"`
+	PlayableInEmbed    bool     `json:"playable_in_embed"`
+	AvailableCountries []string `json:"available_countries,omitempty"`
+	Source             string   `json:"source"`
+}
+
+func parseAvailability(videoId string, data []byte) *VideoAvailability {
+	status := gjson.GetBytes(data, "playabilityStatus")
+	availability := &VideoAvailability{
+		VideoId:         videoId,
+		Status:          status.Get("status").String(),
+		Reason:          status.Get("reason").String(),
+		PlayableInEmbed: status.Get("playableInEmbed").Bool(),
+		Source:          "player",
+	}
+	if availability.Reason == "" {
+		availability.Reason = status.Get("errorScreen.playerErrorMessageRenderer.reason.simpleText").String()
+	}
+	availability.Available = availability.Status == "OK"
+	for _, country := range gjson.GetBytes(data, "microformat.playerMicroformatRenderer.availableCountries").Array() {
+		availability.AvailableCountries = append(availability.AvailableCountries, country.String())
+	}
+	return availability
+}
+
+// CheckAvailability reports whether a video can be played. With useOEmbed the
+// much cheaper oembed endpoint is asked first, settling missing and private
+// videos without a player request.
+func (srv *Server) CheckAvailability(ctx context.Context, videoId string, useOEmbed bool) (*VideoAvailability, error) {
+	if useOEmbed {
+		_, status, err := srv.fetchOEmbed(ctx, videoId)
+		if err == nil && (status == http.StatusNotFound || status == http.StatusBadRequest) {
+			return &VideoAvailability{
+				VideoId: videoId,
+				Status:  "ERROR",
+				Reason:  "Video unavailable",
+				Source:  "oembed",
+			}, nil
+		}
+	}
+
+	respBody, err := srv.playerRequest(ctx, videoId)
+	if err != nil {
+		return nil, err
+	}
+	return parseAvailability(videoId, respBody), nil
+}
+
+func (srv *Server) MakeAvailabilityHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		videoId := strings.TrimSpace(req.FormValue("videoId"))
+		if !DirectVideoIDPattern.MatchString(videoId) {
+			writeError(writer, http.StatusBadRequest, "a valid videoId parameter is required")
+			return
+		}
+
+		availability, err := srv.CheckAvailability(req.Context(), videoId, req.FormValue("oembed") == "true")
+		if err != nil {
+			writeError(
+				writer,
+				http.StatusInternalServerError,
+				fmt.Sprintf("Error checking availability: %v", err),
+			)
+			return
+		}
+		srv.writeJSON(writer, req, availability, CacheStatus{})
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const UpstreamCounterContextKey ctxKey = "upstreamCounter"
+
+const (
+	BatchItemSuccess = "success"
+	BatchItemError   = "error"
+)
+
+var errInvalidBatchItem = errors.New("invalid batch item")
+
+type BatchItem struct {
+	Type  string `json:"type"`
+	Query string `json:"query"`
+	// DurationMs is the expected length of an ISRC query's recording
+	DurationMs int `json:"duration_ms,omitempty"`
+}
+
+type BatchRequest struct {
+	Items []BatchItem `json:"items"`
+}
+
+type BatchItemResult struct {
+	Index         int    `json:"index"`
+	Status        string `json:"status"`
+	Code          int    `json:"code"`
+	Error         string `json:"error,omitempty"`
+	Data          any    `json:"data,omitempty"`
+	TookMs        int64  `json:"took_ms"`
+	UpstreamCalls int64  `json:"upstream_calls"`
+}
+
+type BatchResponse struct {
+	TookMs        int64             `json:"took_ms"`
+	UpstreamCalls int64             `json:"upstream_calls"`
+	Succeeded     int               `json:"succeeded"`
+	Failed        int               `json:"failed"`
+	Results       []BatchItemResult `json:"results"`
+}
+
+// withUpstreamCounter makes every upstream request issued with the returned
+// context increment counter, along with the counters of the parent context
+func withUpstreamCounter(ctx context.Context, counter *atomic.Int64) context.Context {
+	parents, _ := ctx.Value(UpstreamCounterContextKey).([]*atomic.Int64)
+	counters := append(slices.Clip(parents), counter)
+	return context.WithValue(ctx, UpstreamCounterContextKey, counters)
+}
+
+func countUpstreamCall(ctx context.Context) {
+	counters, _ := ctx.Value(UpstreamCounterContextKey).([]*atomic.Int64)
+	for _, counter := range counters {
+		counter.Add(1)
+	}
+}
+
+func (srv *Server) runBatchItem(ctx context.Context, item BatchItem) (any, error) {
+	query := strings.TrimSpace(item.Query)
+	if query == "" {
+		return nil, fmt.Errorf("%w: query is required", errInvalidBatchItem)
+	}
+	if err := validateText("query", query, srv.Cfg.Validation.MaxQueryLength); err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidBatchItem, err)
+	}
+
+	switch item.Type {
+	case "youtube", "youtubemusic":
+		searchType := SearchTypeYouTube
+		if item.Type == "youtubemusic" {
+			searchType = SearchTypeYouTubeMusic
+		}
+		if isrcPattern.MatchString(strings.ToUpper(query)) {
+			tracks, _, _, err := srv.searchISRC(ctx, strings.ToUpper(query), item.DurationMs)
+			return tracks, err
+		}
+		tracks, _, _, err := srv.searchFromYouTube(ctx, searchType, query, srv.defaultSearchOptions())
+		return tracks, err
+	case "playlist":
+		playlistId, err := parsePlaylistId(query)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errInvalidBatchItem, err)
+		}
+		return srv.LoadPlaylist(ctx, playlistId, srv.Cfg.Playlist.MaxTracks)
+	case "resolve":
+		return srv.Resolve(ctx, query)
+	case "isrc":
+		isrc := strings.ToUpper(query)
+		if !isrcPattern.MatchString(isrc) {
+			return nil, fmt.Errorf("%w: invalid isrc", errInvalidBatchItem)
+		}
+		return srv.resolveISRC(ctx, isrc, item.DurationMs)
+	case "available":
+		if !DirectVideoIDPattern.MatchString(query) {
+			return nil, fmt.Errorf("%w: invalid video id", errInvalidBatchItem)
+		}
+		return srv.CheckAvailability(ctx, query, true)
+	}
+	return nil, fmt.Errorf("%w: unsupported type %q", errInvalidBatchItem, item.Type)
+}
+
+func batchErrorCode(err error) int {
+	switch {
+	case errors.Is(err, errInvalidBatchItem), errors.Is(err, ErrUnsupportedUrl):
+		return http.StatusBadRequest
+	case errors.Is(err, errNoISRCMatch), errors.Is(err, errFilteredOut):
+		return http.StatusNotFound
+	case errors.Is(err, errCallRateLimited), errors.Is(err, errCallConcurrency), errors.Is(err, errCallQuota):
+		return http.StatusTooManyRequests
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+// RunBatch executes the items concurrently, each under its own timeout, and
+// reports a result per item instead of failing the batch on the first error.
+// progress, when set, is called with the number of finished items.
+func (srv *Server) RunBatch(ctx context.Context, items []BatchItem, progress func(done int)) BatchResponse {
+	started := time.Now()
+	results := make([]BatchItemResult, len(items))
+	timeout := time.Duration(srv.Cfg.Batch.ItemTimeout) * time.Second
+
+	var total, finished atomic.Int64
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, srv.Cfg.Batch.MaxConcurrency)
+	for i, item := range items {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			var calls atomic.Int64
+			itemCtx, cancel := context.WithTimeout(withUpstreamCounter(ctx, &calls), timeout)
+			defer cancel()
+
+			itemStarted := time.Now()
+			var data any
+			release, err := srv.chargeCall(itemCtx)
+			if err == nil {
+				data, err = srv.runBatchItem(itemCtx, item)
+				release()
+			}
+			if err == nil && data != nil {
+				if data = applyTenantFilters(itemCtx, data); data == nil {
+					err = errFilteredOut
+				}
+			}
+			result := BatchItemResult{
+				Index:         i,
+				Status:        BatchItemSuccess,
+				Code:          http.StatusOK,
+				Data:          data,
+				TookMs:        time.Since(itemStarted).Milliseconds(),
+				UpstreamCalls: calls.Load(),
+			}
+			if err != nil {
+				result.Status = BatchItemError
+				result.Code = batchErrorCode(err)
+				result.Error = err.Error()
+				result.Data = nil
+				LoggerFromContext(ctx).Warn("Batch item failed", "index", i, "type", item.Type, "error", err)
+			}
+			total.Add(calls.Load())
+			results[i] = result
+			if done := finished.Add(1); progress != nil {
+				progress(int(done))
+			}
+		}()
+	}
+	wg.Wait()
+
+	response := BatchResponse{
+		TookMs:        time.Since(started).Milliseconds(),
+		UpstreamCalls: total.Load(),
+		Results:       results,
+	}
+	for _, result := range results {
+		if result.Status == BatchItemSuccess {
+			response.Succeeded++
+		} else {
+			response.Failed++
+		}
+	}
+	return response
+}
+
+func (srv *Server) MakeBatchHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			writeError(writer, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			writeValidationError(writer, &ValidationError{Code: "invalid_body", Message: err.Error()})
+			return
+		}
+		var batch BatchRequest
+		if err := json.Unmarshal(body, &batch); err != nil {
+			writeValidationError(writer, &ValidationError{Code: "invalid_body", Message: err.Error()})
+			return
+		}
+		if len(batch.Items) == 0 {
+			writeValidationError(writer, &ValidationError{
+				Code:    "empty_batch",
+				Param:   "items",
+				Message: "items must not be empty",
+			})
+			return
+		}
+		if len(batch.Items) > srv.Cfg.Batch.MaxItems {
+			writeValidationError(writer, &ValidationError{
+				Code:    "too_many_items",
+				Param:   "items",
+				Message: fmt.Sprintf("a batch holds at most %d items", srv.Cfg.Batch.MaxItems),
+			})
+			return
+		}
+
+		idempotent, handled := srv.claimIdempotencyKey(writer, req, "batch", body)
+		if handled {
+			return
+		}
+
+		response := srv.RunBatch(req.Context(), batch.Items, nil)
+		LoggerFromContext(req.Context()).Info(
+			"Finished batch",
+			"items", len(batch.Items),
+			"failed", response.Failed,
+			"took_ms", response.TookMs,
+			"upstream_calls", response.UpstreamCalls,
+		)
+
+		encoded, err := json.Marshal(response)
+		if err != nil {
+			idempotent.Release(req.Context())
+			LoggerFromContext(req.Context()).Error("Failed to encode batch response", "error", err)
+			writeError(writer, http.StatusInternalServerError, "Error encoding batch response")
+			return
+		}
+		encoded = append(encoded, '\n')
+		idempotent.Complete(req.Context(), http.StatusOK, "", encoded)
+
+		writer.Header().Set("Content-Type", "application/json")
+		_, _ = writer.Write(encoded)
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+type benchResult struct {
+	latency time.Duration
+	status  int
+	cache   string
+	err     error
+}
+
+type benchReport struct {
+	results  []benchResult
+	elapsed  time.Duration
+	dropped  int
+	statuses map[int]int
+}
+
+func RunBench(args []string) error {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	target := flags.String("target", "http://localhost:8080", "Base URL of the API server")
+	endpoint := flags.String("endpoint", "youtube", "Search endpoint to drive (youtube or youtubemusic)")
+	qps := flags.Int("qps", 10, "Requests per second")
+	duration := flags.Duration("duration", 60*time.Second, "How long to run the benchmark")
+	queriesPath := flags.String("queries", "", "File with one search query per line")
+	maxInFlight := flags.Int("concurrency", 64, "Maximum requests in flight")
+	timeout := flags.Duration("timeout", 30*time.Second, "Per-request timeout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *queriesPath == "" {
+		return errors.New("-queries is required")
+	}
+	if *qps <= 0 || *maxInFlight <= 0 {
+		return errors.New("-qps and -concurrency must be positive")
+	}
+	if *endpoint != "youtube" && *endpoint != "youtubemusic" {
+		return fmt.Errorf("unsupported endpoint: %s", *endpoint)
+	}
+
+	queries, err := readBenchQueries(*queriesPath)
+	if err != nil {
+		return err
+	}
+
+	searchURL := strings.TrimRight(*target, "/") + "/api/" + *endpoint + "/search"
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	ctx, cancelRun := context.WithTimeout(ctx, *duration)
+	defer cancelRun()
+
+	fmt.Printf(
+		"Benchmarking %s at %d qps for %s with %d queries\n",
+		searchURL,
+		*qps,
+		*duration,
+		len(queries),
+	)
+
+	report := runBench(ctx, &http.Client{Timeout: *timeout}, searchURL, queries, *qps, *maxInFlight)
+	report.Print(os.Stdout)
+	return nil
+}
+
+func readBenchQueries(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open queries file: %w", err)
+	}
+	defer file.Close()
+
+	var queries []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if query := strings.TrimSpace(scanner.Text()); query != "" {
+			queries = append(queries, query)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read queries file: %w", err)
+	}
+	if len(queries) == 0 {
+		return nil, errors.New("queries file is empty")
+	}
+	return queries, nil
+}
+
+func runBench(
+	ctx context.Context,
+	client *http.Client,
+	searchURL string,
+	queries []string,
+	qps int,
+	maxInFlight int,
+) *benchReport {
+	ticker := time.NewTicker(time.Second / time.Duration(qps))
+	defer ticker.Stop()
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results []benchResult
+		dropped int
+	)
+	inFlight := make(chan struct{}, maxInFlight)
+	startedAt := time.Now()
+
+	for i := 0; ; i++ {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return newBenchReport(results, time.Since(startedAt), dropped)
+		case <-ticker.C:
+		}
+
+		select {
+		case inFlight <- struct{}{}:
+		default:
+			// the server can't keep up, count it instead of queueing unbounded work
+			dropped++
+			continue
+		}
+
+		query := queries[i%len(queries)]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-inFlight }()
+			result := benchRequest(client, searchURL, query)
+			mu.Lock()
+			results = append(results, result)
+			mu.Unlock()
+		}()
+	}
+}
+
+func benchRequest(client *http.Client, searchURL string, query string) benchResult {
+	startedAt := time.Now()
+	resp, err := client.Get(searchURL + "?query=" + url.QueryEscape(query))
+	if err != nil {
+		return benchResult{latency: time.Since(startedAt), err: err}
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(io.Discard, resp.Body)
+	return benchResult{
+		latency: time.Since(startedAt),
+		status:  resp.StatusCode,
+		cache:   resp.Header.Get("X-Cache"),
+		err:     err,
+	}
+}
+
+func newBenchReport(results []benchResult, elapsed time.Duration, dropped int) *benchReport {
+	report := &benchReport{
+		results:  results,
+		elapsed:  elapsed,
+		dropped:  dropped,
+		statuses: make(map[int]int),
+	}
+	for _, result := range results {
+		if result.err == nil {
+			report.statuses[result.status]++
+		}
+	}
+	return report
+}
+
+func (report *benchReport) percentile(latencies []time.Duration, p float64) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+	idx := int(float64(len(latencies)-1) * p)
+	return latencies[idx]
+}
+
+func (report *benchReport) Print(w io.Writer) {
+	total := len(report.results)
+	if total == 0 {
+		fmt.Fprintln(w, "No requests completed")
+		return
+	}
+
+	latencies := make([]time.Duration, 0, total)
+	var failed, hits, misses int
+	for _, result := range report.results {
+		latencies = append(latencies, result.latency)
+		if result.err != nil || result.status >= 400 {
+			failed++
+		}
+		switch result.cache {
+		case "HIT":
+			hits++
+		case "MISS":
+			misses++
+		}
+	}
+	slices.Sort(latencies)
+
+	fmt.Fprintf(w, "\nRequests:     %d in %s (%.1f req/s)\n",
+		total, report.elapsed.Round(time.Millisecond), float64(total)/report.elapsed.Seconds())
+	fmt.Fprintf(w, "Dropped:      %d (concurrency limit reached)\n", report.dropped)
+	fmt.Fprintf(w, "Errors:       %d (%.2f%%)\n", failed, 100*float64(failed)/float64(total))
+
+	statusCodes := make([]int, 0, len(report.statuses))
+	for code := range report.statuses {
+		statusCodes = append(statusCodes, code)
+	}
+	slices.Sort(statusCodes)
+	for _, code := range statusCodes {
+		fmt.Fprintf(w, "  HTTP %d:   %d\n", code, report.statuses[code])
+	}
+	if transportErrs := total - sumStatuses(report.statuses); transportErrs > 0 {
+		fmt.Fprintf(w, "  transport:  %d\n", transportErrs)
+	}
+
+	if hits+misses > 0 {
+		fmt.Fprintf(w, "Cache hits:   %d/%d (%.2f%%)\n", hits, hits+misses, 100*float64(hits)/float64(hits+misses))
+	}
+
+	fmt.Fprintln(w, "Latency:")
+	for _, p := range []float64{0.5, 0.9, 0.95, 0.99} {
+		fmt.Fprintf(w, "  p%-3v       %s\n", p*100, report.percentile(latencies, p).Round(time.Microsecond))
+	}
+	fmt.Fprintf(w, "  max        %s\n", latencies[len(latencies)-1].Round(time.Microsecond))
+}
+
+func sumStatuses(statuses map[int]int) int {
+	total := 0
+	for _, count := range statuses {
+		total += count
+	}
+	return total
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const CacheBypassContextKey ctxKey = "cacheBypass"
+
+var errUnrefreshableKey = errors.New("cache key can't be refreshed")
+
+var cacheRefreshesTotal = metrics.Counter(
+	"ytsearch_cache_refreshes_total",
+	"Hot cache entries re-resolved before they expired",
+	"result",
+)
+
+type CacheRefreshConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Interval is how many seconds pass between two refresh runs
+	Interval int `yaml:"interval"`
+	// BeforeExpiry is how many seconds before its cache_ttl runs out an entry is refreshed
+	BeforeExpiry int `yaml:"before_expiry"`
+	// MinHits is how often an entry has to be served from cache to count as hot
+	MinHits int `yaml:"min_hits"`
+	// MaxPerRun caps the upstream lookups of a single run
+	MaxPerRun int `yaml:"max_per_run"`
+}
+
+// cacheHitCounter counts cache hits in memory. They are written to the hits
+// column in batches by the refresher, so serving a hit never waits for the
+// database writer.
+type cacheHitCounter struct {
+	counts sync.Map // key -> *atomic.Int64
+}
+
+func (counter *cacheHitCounter) Add(key string) {
+	count, ok := counter.counts.Load(key)
+	if !ok {
+		count, _ = counter.counts.LoadOrStore(key, new(atomic.Int64))
+	}
+	count.(*atomic.Int64).Add(1)
+}
+
+// take removes the hits counted so far and returns them
+func (counter *cacheHitCounter) take() map[string]int64 {
+	hits := make(map[string]int64)
+	counter.counts.Range(func(key, _ any) bool {
+		if count, ok := counter.counts.LoadAndDelete(key); ok {
+			hits[key.(string)] = count.(*atomic.Int64).Load()
+		}
+		return true
+	})
+	return hits
+}
+
+// flushCacheHits adds the hits counted in memory to the hits column, in one
+// transaction per shard
+func (srv *Server) flushCacheHits(ctx context.Context) {
+	byShard := make(map[*sql.DB]map[string]int64)
+	for key, hits := range srv.cacheHits.take() {
+		db := srv.cacheDb(key)
+		if byShard[db] == nil {
+			byShard[db] = make(map[string]int64)
+		}
+		byShard[db][key] = hits
+	}
+	for db, hits := range byShard {
+		if err := addCacheHits(ctx, db, hits); err != nil {
+			slog.Error("Failed to flush cache hits", "keys", len(hits), "error", err)
+		}
+	}
+}
+
+func addCacheHits(ctx context.Context, db *sql.DB, hits map[string]int64) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, "UPDATE caches SET hits = hits + ? WHERE key = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for key, count := range hits {
+		if _, err := stmt.ExecContext(ctx, count, key); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// withCacheBypass makes cache lookups miss so the loaders fetch and store fresh values
+func withCacheBypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, CacheBypassContextKey, true)
+}
+
+func cacheBypassed(ctx context.Context) bool {
+	bypass, _ := ctx.Value(CacheBypassContextKey).(bool)
+	return bypass
+}
+
+// refreshCacheEntry resolves a cache key again the way the request that stored
+// it did, entries of tenants with a cache namespace are never refreshed since
+// their tenant settings are unknown here
+func (srv *Server) refreshCacheEntry(ctx context.Context, key string) error {
+	ctx = withCacheBypass(ctx)
+	switch {
+	case strings.HasPrefix(key, "video:"):
+		track, err := srv.LoadVideoMetadata(ctx, strings.TrimPrefix(key, "video:"))
+		if err != nil {
+			return err
+		}
+		if track.Partial {
+			return fmt.Errorf("only partial metadata available")
+		}
+		return srv.StoreCache(ctx, key, []YouTubeTrack{track})
+	case strings.HasPrefix(key, "song:"):
+		song, err := srv.LoadMusicSong(ctx, strings.TrimPrefix(key, "song:"))
+		if err != nil {
+			return err
+		}
+		if song.Partial {
+			return fmt.Errorf("only partial metadata available")
+		}
+		return srv.StoreCache(ctx, key, song)
+	case strings.HasPrefix(key, "related:"):
+		tracks, err := srv.LoadRelated(ctx, strings.TrimPrefix(key, "related:"))
+		if err != nil {
+			return err
+		}
+		return srv.StoreCache(ctx, key, tracks)
+	case strings.HasPrefix(key, "captions:"):
+		videoId, lang, ok := strings.Cut(strings.TrimPrefix(key, "captions:"), ":")
+		if !ok {
+			return errUnrefreshableKey
+		}
+		captions, err := srv.LoadCaptions(ctx, videoId, lang)
+		if err != nil {
+			return err
+		}
+		if captions == nil {
+			return fmt.Errorf("caption track %s is gone", lang)
+		}
+		return srv.StoreCache(ctx, key, captions)
+	case strings.HasPrefix(key, "artist:"):
+		artist, err := srv.LoadArtist(ctx, strings.TrimPrefix(key, "artist:"))
+		if err != nil {
+			return err
+		}
+		return srv.StoreCache(ctx, key, artist)
+	case strings.HasPrefix(key, "explore:"):
+		explore, err := srv.LoadExplore(ctx, strings.TrimPrefix(key, "explore:"))
+		if err != nil {
+			return err
+		}
+		return srv.StoreCache(ctx, key, explore)
+	case strings.HasPrefix(key, "isrc:"):
+		isrc, hint, _ := strings.Cut(strings.TrimPrefix(key, "isrc:"), ":")
+		hintMs, _ := strconv.Atoi(hint)
+		// stores the match itself
+		_, err := srv.resolveISRC(ctx, isrc, hintMs)
+		return err
+	case strings.HasPrefix(key, "playlist:"):
+		sep := strings.LastIndex(key, ":")
+		maxTracks, err := strconv.Atoi(key[sep+1:])
+		if err != nil {
+			return errUnrefreshableKey
+		}
+		playlist, err := srv.LoadPlaylist(ctx, key[len("playlist:"):sep], maxTracks)
+		if err != nil {
+			return err
+		}
+		return srv.StoreCache(ctx, key, playlist)
+	}
+
+	values, err := url.ParseQuery(key)
+	if err != nil || !values.Has("search_type") || !values.Has("query") {
+		return errUnrefreshableKey
+	}
+	searchType, err := strconv.Atoi(values.Get("search_type"))
+	if err != nil {
+		return errUnrefreshableKey
+	}
+	// only searches with the default options, searches with others would need
+	// their request parameters back
+	opts := srv.defaultSearchOptions()
+	if srv.createCacheKey(SearchType(searchType), values.Get("query"), opts.cacheOptions()) != key {
+		return errUnrefreshableKey
+	}
+	// stores the results itself
+	_, _, _, err = srv.searchFromYouTube(ctx, SearchType(searchType), values.Get("query"), opts)
+	return err
+}
+
+func (srv *Server) refreshHotEntries(ctx context.Context) {
+	cfg := srv.Cfg.Caching
+	age := max(cfg.CacheTTL-cfg.Refresh.BeforeExpiry, 0)
+	type hotEntry struct {
+		key  string
+		hits int
+	}
+	var entries []hotEntry
+	for _, db := range srv.cacheShards {
+		rows, err := db.QueryContext(ctx, `SELECT key, hits FROM caches
+			WHERE hits >= ? AND timestamp <= datetime('now', ?)
+			ORDER BY hits DESC LIMIT ?`,
+			cfg.Refresh.MinHits, fmt.Sprintf("-%d seconds", age), cfg.Refresh.MaxPerRun)
+		if err != nil {
+			slog.Error("Failed to select hot cache entries", "error", err)
+			return
+		}
+		for rows.Next() {
+			var entry hotEntry
+			if err := rows.Scan(&entry.key, &entry.hits); err == nil {
+				entries = append(entries, entry)
+			}
+		}
+		rows.Close()
+	}
+	// the hottest entries of all shards
+	slices.SortStableFunc(entries, func(a, b hotEntry) int {
+		return cmp.Compare(b.hits, a.hits)
+	})
+	keys := make([]string, 0, cfg.Refresh.MaxPerRun)
+	for _, entry := range entries[:min(len(entries), cfg.Refresh.MaxPerRun)] {
+		keys = append(keys, entry.key)
+	}
+
+	for _, key := range keys {
+		err := srv.refreshCacheEntry(ctx, key)
+		switch {
+		case errors.Is(err, errUnrefreshableKey):
+			cacheRefreshesTotal.Inc("skipped")
+		case err != nil:
+			cacheRefreshesTotal.Inc("failed")
+			slog.Error("Failed to refresh cache entry", "key", key, "error", err)
+			continue
+		default:
+			cacheRefreshesTotal.Inc("refreshed")
+		}
+		// halve the hits so entries that cooled down stop being refreshed
+		if _, err := srv.cacheDb(key).ExecContext(ctx, "UPDATE caches SET hits = hits / 2 WHERE key = ?", key); err != nil {
+			slog.Error("Failed to decay cache hits", "key", key, "error", err)
+		}
+	}
+	if len(keys) > 0 {
+		slog.Info("Refreshed hot cache entries", "count", len(keys))
+	}
+}
+
+// RefreshHotEntries keeps the most requested cache entries warm by resolving
+// them again shortly before cache_ttl would expire them
+func (srv *Server) RefreshHotEntries(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(srv.Cfg.Caching.Refresh.Interval) * time.Second)
+	defer ticker.Stop()
+	slog.Info("Started hot cache entry refresher")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			srv.flushCacheHits(ctx)
+			if srv.maintainsDatabase() {
+				srv.refreshHotEntries(ctx)
+			}
+		}
+	}
+}
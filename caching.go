@@ -5,18 +5,40 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"log/slog"
 	"net/url"
+	"path/filepath"
 	"strings"
 	"time"
 )
 
-func (srv *Server) createCacheKey(searchType SearchType, query string) string {
+var (
+	cacheEntries  = metrics.Gauge("ytsearch_cache_entries", "Entries stored in the cache")
+	cacheBytes    = metrics.Gauge("ytsearch_cache_bytes", "Total size of the stored cache values")
+	cacheEntryAge = metrics.Gauge(
+		"ytsearch_cache_entry_age_seconds",
+		"Age of the oldest and newest cache entry",
+		"entry",
+	)
+	cacheEvictionsTotal = metrics.Counter(
+		"ytsearch_cache_evictions_total",
+		"Cache entries removed by the size limit or an admin purge",
+		"reason",
+	)
+)
+
+func (srv *Server) createCacheKey(searchType SearchType, query string, options map[string]string) string {
 	query = strings.ToLower(strings.TrimSpace(query))
 	data := map[string]any{
 		"search_type": searchType,
 		"query":       query,
 	}
+	for k, v := range options {
+		if v != "" {
+			data[k] = v
+		}
+	}
 	encoded := url.Values{}
 	for k, v := range data {
 		encoded.Set(k, fmt.Sprintf("%v", v))
@@ -24,12 +46,33 @@ func (srv *Server) createCacheKey(searchType SearchType, query string) string {
 	return encoded.Encode()
 }
 
+// cacheShardPath is the file of a cache shard, cache.db holds the first shard,
+// cache.shard-1.db the second and so on
+func cacheShardPath(base string, index int) string {
+	if index == 0 {
+		return base
+	}
+	ext := filepath.Ext(base)
+	return fmt.Sprintf("%s.shard-%d%s", strings.TrimSuffix(base, ext), index, ext)
+}
+
+// cacheDb is the shard storing a cache key
+func (srv *Server) cacheDb(key string) *sql.DB {
+	if len(srv.cacheShards) <= 1 {
+		return srv.db
+	}
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(key))
+	return srv.cacheShards[hash.Sum32()%uint32(len(srv.cacheShards))]
+}
+
 func (srv *Server) EnforceCacheLimit(ctx context.Context) error {
 	if srv.db != nil {
 		ticker := time.NewTicker(1 * time.Minute)
 		defer ticker.Stop()
 
 		slog.Info("Started cache cleanup ticker")
+		srv.refreshCacheGauges(ctx)
 		for {
 			select {
 			case <-ctx.Done():
@@ -37,32 +80,10 @@ func (srv *Server) EnforceCacheLimit(ctx context.Context) error {
 				return nil
 
 			case <-ticker.C:
-				var count int
-				err := srv.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM caches").Scan(&count)
-				if err != nil {
-					slog.Error("Failed to get cache count", "error", err)
-					continue
-				}
-				slog.Info("Current cache count", "count", count)
-				if srv.Cfg.Caching.CacheMaxLimit < 0 {
-					continue
-				}
-				if int64(count) <= srv.Cfg.Caching.CacheMaxLimit {
-					continue
-				}
-				toDelete := int64(count) - srv.Cfg.Caching.CacheMaxLimit
-				slog.Info("Deleting old cache", "to_delete", toDelete)
-
-				_, err = srv.db.ExecContext(
-					ctx,
-					`DELETE FROM caches WHERE key IN (SELECT key FROM caches ORDER BY timestamp ASC LIMIT ?)`,
-					toDelete,
-				)
-				if err != nil {
-					slog.Error("Failed to delete old cache entries", "error", err)
-					continue
+				if srv.maintainsDatabase() {
+					srv.trimCache(ctx)
 				}
-
+				srv.refreshCacheGauges(ctx)
 			}
 		}
 
@@ -70,21 +91,107 @@ func (srv *Server) EnforceCacheLimit(ctx context.Context) error {
 	return nil
 }
 
-func (srv *Server) StoreCache(ctx context.Context, key string, data []YouTubeTrack) error {
+// trimCache enforces cache_max_limit, split evenly between the shards
+func (srv *Server) trimCache(ctx context.Context) {
+	limit := srv.Cfg.Caching.CacheMaxLimit
+	if limit >= 0 {
+		shards := int64(len(srv.cacheShards))
+		limit = (limit + shards - 1) / shards
+	}
+	for i, db := range srv.cacheShards {
+		srv.trimCacheShard(ctx, db, i, limit)
+	}
+}
+
+func (srv *Server) trimCacheShard(ctx context.Context, db *sql.DB, shard int, limit int64) {
+	var count int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM caches").Scan(&count)
+	if err != nil {
+		slog.Error("Failed to get cache count", "shard", shard, "error", err)
+		return
+	}
+	slog.Info("Current cache count", "shard", shard, "count", count)
+	if limit < 0 {
+		return
+	}
+	if int64(count) <= limit {
+		return
+	}
+	toDelete := int64(count) - limit
+	slog.Info("Deleting old cache", "shard", shard, "to_delete", toDelete)
+
+	res, err := db.ExecContext(
+		ctx,
+		`DELETE FROM caches WHERE key IN (SELECT key FROM caches ORDER BY timestamp ASC LIMIT ?)`,
+		toDelete,
+	)
+	if err != nil {
+		slog.Error("Failed to delete old cache entries", "error", err)
+		return
+	}
+	if deleted, err := res.RowsAffected(); err == nil {
+		cacheEvictionsTotal.Add(float64(deleted), "limit")
+	}
+}
+
+// refreshCacheGauges exports the size and age range of the cache, run by the
+// cleanup ticker so scrapes never touch the database
+func (srv *Server) refreshCacheGauges(ctx context.Context) {
+	var totalCount, totalBytes int64
+	var oldest, newest sql.NullInt64
+	for _, db := range srv.cacheShards {
+		var (
+			count       int64
+			bytes       int64
+			shardOldest sql.NullInt64
+			shardNewest sql.NullInt64
+		)
+		err := db.QueryRowContext(ctx, `SELECT COUNT(*), COALESCE(SUM(LENGTH(value)), 0),
+			CAST(strftime('%s', MIN(timestamp)) AS INTEGER), CAST(strftime('%s', MAX(timestamp)) AS INTEGER)
+			FROM caches`).Scan(&count, &bytes, &shardOldest, &shardNewest)
+		if err != nil {
+			slog.Error("Failed to collect cache stats", "error", err)
+			return
+		}
+		totalCount += count
+		totalBytes += bytes
+		if shardOldest.Valid && (!oldest.Valid || shardOldest.Int64 < oldest.Int64) {
+			oldest = shardOldest
+		}
+		if shardNewest.Valid && (!newest.Valid || shardNewest.Int64 > newest.Int64) {
+			newest = shardNewest
+		}
+	}
+	cacheEntries.Set(float64(totalCount))
+	cacheBytes.Set(float64(totalBytes))
+	now := time.Now().Unix()
+	if oldest.Valid {
+		cacheEntryAge.Set(float64(now-oldest.Int64), "oldest")
+		cacheEntryAge.Set(float64(now-newest.Int64), "newest")
+	} else {
+		cacheEntryAge.Set(0, "oldest")
+		cacheEntryAge.Set(0, "newest")
+	}
+}
+
+func (srv *Server) StoreCache(ctx context.Context, key string, data any) error {
+	key = tenantCacheKey(ctx, key)
 	value, err := json.Marshal(data)
 	if err != nil {
 		return err
 	}
 	if srv.db != nil {
-		_, err := srv.db.ExecContext(ctx,
-			"INSERT OR REPLACE INTO caches (key, value) VALUES (?, ?)",
+		_, err := srv.cacheDb(key).ExecContext(ctx,
+			`INSERT INTO caches (key, value) VALUES (?, ?)
+			ON CONFLICT (key) DO UPDATE SET value = excluded.value, timestamp = CURRENT_TIMESTAMP`,
 			key,
 			value,
 		)
 		if err != nil {
 			return err
 		}
-		slog.Info("Stored cache entry", "key", key)
+		RequestInfoFromContext(ctx).addCacheDecision(key, "stored")
+		LoggerFromContext(ctx).Info("Stored cache entry", "key", key)
 		return nil
 
 	}
@@ -92,30 +199,58 @@ func (srv *Server) StoreCache(ctx context.Context, key string, data []YouTubeTra
 
 }
 
-func (srv *Server) LookupCache(ctx context.Context, key string) ([]byte, error) {
-	if srv.db != nil {
-		var data []byte
-		err := srv.db.QueryRowContext(ctx, "SELECT value FROM caches WHERE key = ?", key).
-			Scan(&data)
+type CacheEntry struct {
+	Value    []byte
+	StoredAt time.Time
+}
+
+func (srv *Server) LookupCache(ctx context.Context, key string) (*CacheEntry, error) {
+	if srv.db != nil && cacheBypassed(ctx) {
+		RequestInfoFromContext(ctx).addCacheDecision(tenantCacheKey(ctx, key), "bypass")
+	}
+	if srv.db != nil && !cacheBypassed(ctx) {
+		key = tenantCacheKey(ctx, key)
+		var entry CacheEntry
+		err := srv.cacheDb(key).QueryRowContext(ctx, "SELECT value, timestamp FROM caches WHERE key = ?", key).
+			Scan(&entry.Value, &entry.StoredAt)
 		if err != nil {
 			if err == sql.ErrNoRows {
+				RequestInfoFromContext(ctx).addCacheDecision(key, "miss")
+				recordCacheLookup(ctx, false)
 				return nil, nil
 			}
 			return nil, err
 		}
-		slog.Info("Cache hit", "key", key)
-		return data, nil
+		ttl := time.Duration(srv.cacheTTL(ctx)) * time.Second
+		if ttl > 0 && time.Since(entry.StoredAt) > ttl {
+			LoggerFromContext(ctx).Debug("Cache entry expired", "key", key, "stored_at", entry.StoredAt)
+			RequestInfoFromContext(ctx).addCacheDecision(key, "expired")
+			recordCacheLookup(ctx, false)
+			return nil, nil
+		}
+		RequestInfoFromContext(ctx).addCacheDecision(key, "hit")
+		recordCacheLookup(ctx, true)
+		if srv.Cfg.Caching.Refresh.Enabled {
+			srv.cacheHits.Add(key)
+		}
+		LoggerFromContext(ctx).Info("Cache hit", "key", key)
+		return &entry, nil
 	}
 	return nil, nil
 }
+
 func (srv *Server) clearCache(ctx context.Context) error {
-	if srv.db != nil {
-		_, err := srv.db.ExecContext(ctx, "DELETE FROM caches")
+	for _, db := range srv.cacheShards {
+		res, err := db.ExecContext(ctx, "DELETE FROM caches")
 		if err != nil {
 			return err
 		}
-		slog.Info("Cleared all cache entries")
-		return nil
+		if deleted, err := res.RowsAffected(); err == nil {
+			cacheEvictionsTotal.Add(float64(deleted), "purge")
+		}
+	}
+	if srv.db != nil {
+		LoggerFromContext(ctx).Info("Cleared all cache entries")
 	}
 	return nil
 }
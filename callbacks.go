@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const maxCallbackAttempts = 3
+
+var errPrivateCallbackAddr = errors.New("callback_url must not point at a loopback, link-local or private address")
+
+// sharedAddressSpace is the carrier-grade NAT range, private like RFC 1918
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// isPublicAddr reports whether callbacks may be posted to addr, keeping them
+// away from the admin listener, cloud metadata endpoints and internal hosts
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() &&
+		!addr.IsLoopback() &&
+		!addr.IsPrivate() &&
+		!addr.IsUnspecified() &&
+		!addr.IsLinkLocalUnicast() &&
+		!addr.IsLinkLocalMulticast() &&
+		!addr.IsInterfaceLocalMulticast() &&
+		!addr.IsMulticast() &&
+		!sharedAddressSpace.Contains(addr)
+}
+
+// validateCallbackUrl accepts absolute http(s) urls whose host resolves to
+// public addresses only. The addresses are checked again when the callback is
+// dialed, the host may resolve differently by then.
+func validateCallbackUrl(ctx context.Context, rawUrl string) error {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return fmt.Errorf("invalid callback_url: %w", err)
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return errors.New("callback_url must be an absolute http(s) url")
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", parsed.Hostname())
+	if err != nil {
+		return fmt.Errorf("failed to resolve callback_url host: %w", err)
+	}
+	for _, addr := range addrs {
+		if !isPublicAddr(addr) {
+			return errPrivateCallbackAddr
+		}
+	}
+	return nil
+}
+
+// NewCallbackHttpClient is the client callbacks are posted with. It refuses to
+// connect to addresses validateCallbackUrl rejects, whatever the host resolves
+// to at dial time, and doesn't follow redirects, which could lead anywhere.
+func NewCallbackHttpClient(timeoutSeconds int) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network string, address string, conn syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !isPublicAddr(addrPort.Addr()) {
+				return errPrivateCallbackAddr
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   time.Duration(timeoutSeconds) * time.Second,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// signCallback signs "<timestamp>.<body>" so a captured callback can't be replayed later
+func signCallback(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (srv *Server) postCallback(ctx context.Context, callbackUrl string, job *Job, body []byte) error {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackUrl, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create callback request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Job-Id", job.Id)
+	req.Header.Set("X-Signature-Timestamp", timestamp)
+	req.Header.Set("X-Signature", signCallback(srv.Cfg.Jobs.CallbackSecret, timestamp, body))
+
+	resp, err := srv.callbacks.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to perform callback request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("callback failed with status: %s", resp.Status)
+	}
+	return nil
+}
+
+// deliverJobCallback posts the finished job to its callback url, retrying with
+// backoff. A delivered job is removed as if its result had been fetched.
+func (srv *Server) deliverJobCallback(ctx context.Context, callbackUrl string, jobId string) {
+	job, err := srv.LookupJob(ctx, jobId)
+	if err != nil || job == nil {
+		LoggerFromContext(ctx).Error("Failed to load job for callback", "job", jobId, "error", err)
+		return
+	}
+	body, err := json.Marshal(job)
+	if err != nil {
+		LoggerFromContext(ctx).Error("Failed to marshal job for callback", "job", jobId, "error", err)
+		return
+	}
+
+	backoff := time.Second
+	for attempt := 1; attempt <= maxCallbackAttempts; attempt++ {
+		err = srv.postCallback(ctx, callbackUrl, job, body)
+		if err == nil {
+			LoggerFromContext(ctx).Info("Delivered job callback", "job", jobId, "attempt", attempt)
+			srv.deleteJob(ctx, jobId)
+			return
+		}
+		LoggerFromContext(ctx).Warn("Job callback failed", "job", jobId, "attempt", attempt, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 4
+	}
+	LoggerFromContext(ctx).Error("Giving up on job callback, result stays available for polling", "job", jobId, "error", err)
+}
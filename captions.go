@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+const (
+	CaptionFormatJSON = "json"
+	CaptionFormatSRT  = "srt"
+	CaptionFormatVTT  = "vtt"
+)
+
+type CaptionTrack struct {
+	LanguageCode  string `json:"language_code"`
+	Name          string `json:"name"`
+	VssId         string `json:"vss_id"`
+	AutoGenerated bool   `json:"auto_generated"`
+	Translatable  bool   `json:"translatable"`
+	baseUrl       string
+}
+
+type CaptionTracks struct {
+	VideoId string         `json:"video_id"`
+	Tracks  []CaptionTrack `json:"tracks"`
+}
+
+type CaptionCue struct {
+	StartMs    int64  `json:"start_ms"`
+	DurationMs int64  `json:"duration_ms"`
+	Text       string `json:"text"`
+}
+
+type Captions struct {
+	VideoId       string       `json:"video_id"`
+	LanguageCode  string       `json:"language_code"`
+	Name          string       `json:"name"`
+	AutoGenerated bool         `json:"auto_generated"`
+	Cues          []CaptionCue `json:"cues"`
+}
+
+func parseCaptionTracks(videoId string, data []byte) (*CaptionTracks, error) {
+	if status := gjson.GetBytes(data, "playabilityStatus.status").String(); status != "OK" {
+		return nil, fmt.Errorf(
+			"video is not playable: %s",
+			gjson.GetBytes(data, "playabilityStatus.reason").String(),
+		)
+	}
+
+	captions := &CaptionTracks{VideoId: videoId, Tracks: make([]CaptionTrack, 0)}
+	// videos without any captions have no captions object at all
+	for _, track := range gjson.GetBytes(data, "captions.playerCaptionsTracklistRenderer.captionTracks").Array() {
+		name := track.Get("name.simpleText").String()
+		if name == "" {
+			name = track.Get("name.runs.0.text").String()
+		}
+		captions.Tracks = append(captions.Tracks, CaptionTrack{
+			LanguageCode:  track.Get("languageCode").String(),
+			Name:          name,
+			VssId:         track.Get("vssId").String(),
+			AutoGenerated: track.Get("kind").String() == "asr",
+			Translatable:  track.Get("isTranslatable").Bool(),
+			baseUrl:       track.Get("baseUrl").String(),
+		})
+	}
+	return captions, nil
+}
+
+// pick finds the track for lang, which is either a vss id or a language code.
+// Uploaded captions win over the auto-generated ones of the same language.
+func (captions *CaptionTracks) pick(lang string) (CaptionTrack, bool) {
+	var found CaptionTrack
+	ok := false
+	for _, track := range captions.Tracks {
+		if track.VssId == lang {
+			return track, true
+		}
+		if track.LanguageCode == lang && (!ok || found.AutoGenerated && !track.AutoGenerated) {
+			found, ok = track, true
+		}
+	}
+	return found, ok
+}
+
+// parseCaptionCues reads a timedtext response in the json3 format, window and
+// line break events carry no text and are skipped
+func parseCaptionCues(data []byte) ([]CaptionCue, error) {
+	events := gjson.GetBytes(data, "events")
+	if !events.Exists() {
+		return nil, newParseError("events", "missing", "")
+	}
+	cues := make([]CaptionCue, 0, len(events.Array()))
+	for _, event := range events.Array() {
+		var text strings.Builder
+		for _, seg := range event.Get("segs").Array() {
+			text.WriteString(seg.Get("utf8").String())
+		}
+		cue := CaptionCue{
+			StartMs:    event.Get("tStartMs").Int(),
+			DurationMs: event.Get("dDurationMs").Int(),
+			Text:       strings.TrimSpace(text.String()),
+		}
+		if cue.Text != "" {
+			cues = append(cues, cue)
+		}
+	}
+	return cues, nil
+}
+
+func (srv *Server) LoadCaptionTracks(ctx context.Context, videoId string) (*CaptionTracks, error) {
+	respBody, err := srv.playerRequest(ctx, videoId)
+	if err != nil {
+		return nil, err
+	}
+	return parseCaptionTracks(videoId, respBody)
+}
+
+// LoadCaptions fetches the cues of a caption track, the track urls are signed
+// and expire, so the track list is always taken from a fresh player response
+func (srv *Server) LoadCaptions(ctx context.Context, videoId string, lang string) (*Captions, error) {
+	tracks, err := srv.LoadCaptionTracks(ctx, videoId)
+	if err != nil {
+		return nil, err
+	}
+	track, ok := tracks.pick(lang)
+	if !ok {
+		return nil, nil
+	}
+
+	timedtextUrl, err := url.Parse(track.baseUrl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid caption url: %w", err)
+	}
+	query := timedtextUrl.Query()
+	query.Set("fmt", "json3")
+	timedtextUrl.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, timedtextUrl.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create captions request: %w", err)
+	}
+	resp, err := srv.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to perform captions request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("captions request failed with status %d", resp.StatusCode)
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read captions response: %w", err)
+	}
+
+	cues, err := parseCaptionCues(respBody)
+	recordParse(ctx, "captions", len(cues), err)
+	if err != nil {
+		recordParseFailure("captions", err, respBody)
+		return nil, err
+	}
+	return &Captions{
+		VideoId:       videoId,
+		LanguageCode:  track.LanguageCode,
+		Name:          track.Name,
+		AutoGenerated: track.AutoGenerated,
+		Cues:          cues,
+	}, nil
+}
+
+// captionTimestamp formats milliseconds as hh:mm:ss followed by the
+// millisecond separator, a comma for SRT and a dot for WebVTT
+func captionTimestamp(ms int64, separator string) string {
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, separator, ms%1000)
+}
+
+func (captions *Captions) SRT() string {
+	var out strings.Builder
+	for i, cue := range captions.Cues {
+		fmt.Fprintf(&out, "%d\n%s --> %s\n%s\n\n",
+			i+1,
+			captionTimestamp(cue.StartMs, ","),
+			captionTimestamp(cue.StartMs+cue.DurationMs, ","),
+			cue.Text,
+		)
+	}
+	return out.String()
+}
+
+func (captions *Captions) VTT() string {
+	var out strings.Builder
+	out.WriteString("WEBVTT\n")
+	if captions.LanguageCode != "" {
+		out.WriteString("Language: " + captions.LanguageCode + "\n")
+	}
+	out.WriteString("\n")
+	for _, cue := range captions.Cues {
+		fmt.Fprintf(&out, "%s --> %s\n%s\n\n",
+			captionTimestamp(cue.StartMs, "."),
+			captionTimestamp(cue.StartMs+cue.DurationMs, "."),
+			cue.Text,
+		)
+	}
+	return out.String()
+}
+
+func (srv *Server) writeCaptions(
+	writer http.ResponseWriter,
+	req *http.Request,
+	captions *Captions,
+	format string,
+	status CacheStatus,
+) {
+	var body, contentType string
+	switch format {
+	case CaptionFormatSRT:
+		body, contentType = captions.SRT(), "application/x-subrip; charset=utf-8"
+	case CaptionFormatVTT:
+		body, contentType = captions.VTT(), "text/vtt; charset=utf-8"
+	default:
+		srv.writeJSON(writer, req, captions, status)
+		return
+	}
+	if status.Hit {
+		writer.Header().Set("X-Cache", "HIT")
+	} else {
+		writer.Header().Set("X-Cache", "MISS")
+	}
+	writer.Header().Set("Content-Type", contentType)
+	_, _ = io.WriteString(writer, body)
+}
+
+func (srv *Server) MakeCaptionsHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		videoId := strings.TrimSpace(req.FormValue("videoId"))
+		if !DirectVideoIDPattern.MatchString(videoId) {
+			writeValidationError(writer, &ValidationError{
+				Code:    "invalid_video_id",
+				Param:   "videoId",
+				Message: "a valid videoId parameter is required",
+			})
+			return
+		}
+		lang := strings.TrimSpace(req.FormValue("lang"))
+		format := strings.ToLower(strings.TrimSpace(req.FormValue("format")))
+		if format == "" {
+			format = CaptionFormatJSON
+		}
+		if format != CaptionFormatJSON && format != CaptionFormatSRT && format != CaptionFormatVTT {
+			writeValidationError(writer, &ValidationError{
+				Code:    "invalid_format",
+				Param:   "format",
+				Message: "format must be one of json, srt or vtt",
+			})
+			return
+		}
+
+		if lang == "" {
+			// the track list holds signed urls only used internally, the
+			// list itself is cheap to fetch again
+			tracks, err := srv.LoadCaptionTracks(req.Context(), videoId)
+			if err != nil {
+				writeError(writer, http.StatusInternalServerError, fmt.Sprintf("Error loading captions: %v", err))
+				return
+			}
+			srv.writeJSON(writer, req, tracks, CacheStatus{})
+			return
+		}
+
+		cacheKey := "captions:" + videoId + ":" + lang
+		if srv.db != nil {
+			entry, err := srv.LookupCache(req.Context(), cacheKey)
+			if err != nil {
+				LoggerFromContext(req.Context()).Error("Failed to lookup cache for captions", "error", err)
+			} else if entry != nil {
+				var captions Captions
+				if err := json.Unmarshal(entry.Value, &captions); err != nil {
+					LoggerFromContext(req.Context()).Error("Failed to unmarshal cached captions", "error", err)
+				} else {
+					srv.writeCaptions(writer, req, &captions, format, CacheStatus{Hit: true, StoredAt: entry.StoredAt})
+					return
+				}
+			}
+		}
+
+		captions, err := srv.LoadCaptions(req.Context(), videoId, lang)
+		if err != nil {
+			writeError(writer, http.StatusInternalServerError, fmt.Sprintf("Error loading captions: %v", err))
+			return
+		}
+		if captions == nil {
+			writeRequestError(writer, http.StatusNotFound, &ValidationError{
+				Code:    "caption_track_not_found",
+				Param:   "lang",
+				Message: fmt.Sprintf("video %s has no caption track %q", videoId, lang),
+			})
+			return
+		}
+
+		if srv.db != nil {
+			if err := srv.StoreCache(req.Context(), cacheKey, captions); err != nil {
+				LoggerFromContext(req.Context()).Error("Failed to store captions in cache", "error", err)
+			}
+		}
+		srv.writeCaptions(writer, req, captions, format, CacheStatus{})
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// MakeChannelHandler returns the uploads of a channel as a playlist, the
+// channel given by its id, handle or a link to it
+func (srv *Server) MakeChannelHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		id := strings.TrimSpace(req.FormValue("id"))
+		if id == "" {
+			writeError(writer, http.StatusBadRequest, "id parameter is required")
+			return
+		}
+		format, validationErr := parseFeedFormat(req)
+		if validationErr != nil {
+			writeValidationError(writer, validationErr)
+			return
+		}
+
+		channelUrl := id
+		if channelIdPattern.MatchString(id) {
+			channelUrl = YT_BASE_URL + "/channel/" + id
+		} else if strings.HasPrefix(id, "@") {
+			channelUrl = YT_BASE_URL + "/" + id
+		}
+		// the resolver loads channels with their uploads and caches them
+		result, cacheStatus, err := srv.resolveCached(req.Context(), channelUrl)
+		if errors.Is(err, ErrUnsupportedUrl) || (err == nil && result.Type != ResolveTypeChannel) {
+			writeValidationError(writer, &ValidationError{
+				Code:    "invalid_channel_id",
+				Param:   "id",
+				Message: "id must be a channel id, a handle or a link to a channel",
+			})
+			return
+		}
+		if err != nil {
+			writeError(
+				writer,
+				http.StatusInternalServerError,
+				fmt.Sprintf("Error loading channel: %v", err),
+			)
+			return
+		}
+
+		if format != "" {
+			srv.writeFeed(writer, req, format, result.Playlist, result.Channel.Uri, cacheStatus)
+			return
+		}
+		srv.writeJSON(writer, req, result.Playlist, cacheStatus)
+	}
+}
@@ -2,9 +2,10 @@ package main
 
 import (
 	"fmt"
-	"gopkg.in/yaml.v3"
 	"log/slog"
+	"net/http"
 	"os"
+	"strings"
 )
 
 type LogConfig struct {
@@ -12,43 +13,179 @@ type LogConfig struct {
 	Format    string     `yaml:"format"`
 	AddSource bool       `yaml:"add_source"`
 	NoColor   bool       `yaml:"no_color"`
+	// AccessFormat writes one access log line per request instead of the
+	// request log records: json, logfmt or combined
+	AccessFormat string `yaml:"access_format"`
+	// AccessLog is the file access log lines are appended to, stdout when empty
+	AccessLog string `yaml:"access_log"`
+	// SlowRequestMs logs a warning for every request taking longer, 0 disables it
+	SlowRequestMs int `yaml:"slow_request_ms"`
 }
 
 type CacheConfig struct {
 	Enabled       bool   `yaml:"enabled"`
 	CacheDir      string `yaml:"cache_dir"`
 	CacheMaxLimit int64  `yaml:"cache_max_limit"`
+	CacheTTL      int    `yaml:"cache_ttl"`
+	ClientMaxAge  int    `yaml:"client_max_age"`
+	// Shards spreads the cache over this many database files by key hash
+	Shards int `yaml:"shards"`
+
+	Refresh      CacheRefreshConfig `yaml:"refresh"`
+	CacheControl CacheControlConfig `yaml:"cache_control"`
+}
+
+// CacheControlConfig sets the Cache-Control max-age of api responses per route,
+// so CDNs and reverse proxies in front of the server cache each for as long as
+// it stays good
+type CacheControlConfig struct {
+	// Routes maps an /api path to the max-age of its responses in seconds, a
+	// path ending in / covers every path below it. 0 makes caches revalidate
+	// every time, routes left out get the cache_ttl.
+	Routes map[string]int `yaml:"routes"`
+	// VideoMaxAge is the max-age of video lookups by id or url on the search
+	// routes, 0 leaves them to Routes
+	VideoMaxAge int `yaml:"video_max_age"`
+	// LiveMaxAge is the max-age of responses holding a live or upcoming
+	// stream, 0 keeps them out of caches altogether
+	LiveMaxAge int `yaml:"live_max_age"`
+}
+
+func validateCacheControl(cfg CacheControlConfig) error {
+	for path, maxAge := range cfg.Routes {
+		if !strings.HasPrefix(path, "/api/") {
+			return fmt.Errorf("caching.cache_control: route %s must start with /api/", path)
+		}
+		if maxAge < 0 {
+			return fmt.Errorf("caching.cache_control: negative max-age for route %s", path)
+		}
+	}
+	return nil
+}
+
+type FixtureConfig struct {
+	Mode string `yaml:"mode"`
+	Dir  string `yaml:"dir"`
+}
+
+type DebugConfig struct {
+	ArtifactsDir        string `yaml:"artifacts_dir"`
+	MaxArtifactsPerHour int    `yaml:"max_artifacts_per_hour"`
+}
+
+type MusicBrainzConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	UserAgent string `yaml:"user_agent"`
+}
+
+type ISRCConfig struct {
+	// DurationDeltaMs is how far a candidate's length may deviate from the expected one
+	DurationDeltaMs int `yaml:"duration_delta_ms"`
+	// MaxBulkItems caps the ISRCs of one bulk lookup
+	MaxBulkItems int `yaml:"max_bulk_items"`
+}
+
+type SearchConfig struct {
+	// MaxResults caps the limit parameter of searches
+	MaxResults int `yaml:"max_results"`
+	// SafeSearch searches in restricted mode unless a request passes safeSearch=false
+	SafeSearch bool `yaml:"safe_search"`
+}
+
+type PlaylistConfig struct {
+	MaxTracks          int `yaml:"max_tracks"`
+	MaxConcurrentLoads int `yaml:"max_concurrent_loads"`
+}
+
+type MixConfig struct {
+	DefaultTracks int `yaml:"default_tracks"`
+	MaxTracks     int `yaml:"max_tracks"`
+}
+
+type BatchConfig struct {
+	MaxItems       int `yaml:"max_items"`
+	MaxConcurrency int `yaml:"max_concurrency"`
+	ItemTimeout    int `yaml:"item_timeout"`
+}
+
+type JobsConfig struct {
+	MaxRunning        int    `yaml:"max_running"`
+	Timeout           int    `yaml:"timeout"`
+	ResultTTL         int    `yaml:"result_ttl"`
+	MaxBatchItems     int    `yaml:"max_batch_items"`
+	MaxPlaylistTracks int    `yaml:"max_playlist_tracks"`
+	CallbackSecret    string `yaml:"callback_secret"`
+}
+
+type AnonymousRateLimitConfig struct {
+	Enabled           bool `yaml:"enabled"`
+	RequestsPerMinute int  `yaml:"requests_per_minute"`
+	Burst             int  `yaml:"burst"`
+	MaxTrackedClients int  `yaml:"max_tracked_clients"`
+	// Ipv6Prefix is the prefix length ipv6 clients share a bucket on, a single
+	// client usually holds a whole /64
+	Ipv6Prefix int `yaml:"ipv6_prefix"`
 }
 
 type Config struct {
-	Ipv6Subnet      string      `yaml:"ipv6_subnet"`
-	MaxVisitorCount int         `yaml:"max_visitor_count"`
-	RequestTimeout  int         `yaml:"request_timeout"`
-	ServerAddr      string      `yaml:"server_addr"`
-	Logging         LogConfig   `yaml:"logging"`
-	Caching         CacheConfig `yaml:"caching"`
+	Ipv6Subnet             string                       `yaml:"ipv6_subnet"`
+	MaxVisitorCount        int                          `yaml:"max_visitor_count"`
+	RequestTimeout         int                          `yaml:"request_timeout"`
+	MaxUpstreamConcurrency int                          `yaml:"max_upstream_concurrency"`
+	ServerAddr             string                       `yaml:"server_addr"`
+	Logging                LogConfig                    `yaml:"logging"`
+	Tracing                TracingConfig                `yaml:"tracing"`
+	Health                 HealthConfig                 `yaml:"health"`
+	Alerts                 AlertsConfig                 `yaml:"alerts"`
+	Metrics                MetricsConfig                `yaml:"metrics"`
+	Redis                  RedisConfig                  `yaml:"redis"`
+	VisitorPool            VisitorPoolConfig            `yaml:"visitor_pool"`
+	LeaderElection         LeaderElectionConfig         `yaml:"leader_election"`
+	RouteProfiles          []RouteProfile               `yaml:"route_profiles"`
+	RetryBudget            RetryBudgetConfig            `yaml:"retry_budget"`
+	Idempotency            IdempotencyConfig            `yaml:"idempotency"`
+	Caching                CacheConfig                  `yaml:"caching"`
+	Fixtures               FixtureConfig                `yaml:"fixtures"`
+	Debug                  DebugConfig                  `yaml:"debug"`
+	MusicBrainz            MusicBrainzConfig            `yaml:"musicbrainz"`
+	ISRC                   ISRCConfig                   `yaml:"isrc"`
+	Locale                 Locale                       `yaml:"locale"`
+	Search                 SearchConfig                 `yaml:"search"`
+	Playlist               PlaylistConfig               `yaml:"playlist"`
+	Mix                    MixConfig                    `yaml:"mix"`
+	Batch                  BatchConfig                  `yaml:"batch"`
+	Jobs                   JobsConfig                   `yaml:"jobs"`
+	Auth                   AuthConfig                   `yaml:"auth"`
+	Admin                  AdminConfig                  `yaml:"admin"`
+	Grpc                   GrpcConfig                   `yaml:"grpc"`
+	OpenAPI                OpenAPIConfig                `yaml:"openapi"`
+	CORS                   CORSConfig                   `yaml:"cors"`
+	Validation             ValidationConfig             `yaml:"validation"`
+	AnonymousRateLimit     AnonymousRateLimitConfig     `yaml:"anonymous_rate_limit"`
+	TrustedProxies         []string                     `yaml:"trusted_proxies"`
+	UpstreamHeaders        map[string]map[string]string `yaml:"upstream_headers"`
 }
 
 func (cfg Config) String() string {
 	return fmt.Sprintf(
-		"Config{Ipv6Subnet: %s, MaxVisitorCount: %d, RequestTimeout: %d, ServerAddr: %s, Logging: %+v}",
+		"Config{Ipv6Subnet: %s, MaxVisitorCount: %d, RequestTimeout: %d, MaxUpstreamConcurrency: %d, ServerAddr: %s, Logging: %+v}",
 		cfg.Ipv6Subnet,
 		cfg.MaxVisitorCount,
 		cfg.RequestTimeout,
+		cfg.MaxUpstreamConcurrency,
 		cfg.ServerAddr,
 		cfg.Logging,
 	)
 }
 
 func ReadConfig(filePath string) (*Config, error) {
-	file, err := os.Open(filePath)
+	data, err := os.ReadFile(filePath)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
 
 	var cfg Config
-	if err := yaml.NewDecoder(file).Decode(&cfg); err != nil {
+	if err := decodeYAMLWithSecrets(data, &cfg); err != nil {
 		return nil, err
 	}
 
@@ -60,6 +197,38 @@ func ReadConfig(filePath string) (*Config, error) {
 		cfg.Caching.CacheMaxLimit = -1 // no limit
 	}
 
+	if cfg.Caching.Refresh.Enabled && cfg.Caching.CacheTTL <= 0 {
+		return nil, fmt.Errorf("caching.refresh requires a caching.cache_ttl")
+	}
+
+	if cfg.Caching.Refresh.Interval <= 0 {
+		cfg.Caching.Refresh.Interval = 60
+	}
+
+	if cfg.Caching.Refresh.BeforeExpiry <= 0 {
+		cfg.Caching.Refresh.BeforeExpiry = 120
+	}
+
+	if cfg.Caching.Refresh.MinHits <= 0 {
+		cfg.Caching.Refresh.MinHits = 5
+	}
+
+	if cfg.Caching.Refresh.MaxPerRun <= 0 {
+		cfg.Caching.Refresh.MaxPerRun = 20
+	}
+
+	if cfg.Caching.Shards <= 0 {
+		cfg.Caching.Shards = 1
+	}
+
+	if cfg.Caching.ClientMaxAge <= 0 {
+		cfg.Caching.ClientMaxAge = 300
+	}
+
+	if err := validateCacheControl(cfg.Caching.CacheControl); err != nil {
+		return nil, err
+	}
+
 	if cfg.MaxVisitorCount <= 0 {
 		cfg.MaxVisitorCount = 2
 	}
@@ -68,10 +237,260 @@ func ReadConfig(filePath string) (*Config, error) {
 		cfg.ServerAddr = ":8080"
 	}
 
+	if cfg.Health.ProbeVideoId == "" {
+		cfg.Health.ProbeVideoId = "dQw4w9WgXcQ"
+	}
+
+	if cfg.Health.ProbeInterval <= 0 {
+		cfg.Health.ProbeInterval = 60
+	}
+
+	if err := validatePushConfig(cfg.Metrics.Push); err != nil {
+		return nil, err
+	}
+
+	if cfg.Metrics.Push.Interval <= 0 {
+		cfg.Metrics.Push.Interval = 15
+	}
+
+	if cfg.Metrics.Push.Job == "" {
+		cfg.Metrics.Push.Job = "youtube-search"
+	}
+
+	switch cfg.VisitorPool.Backend {
+	case "", VisitorPoolMemory:
+	case VisitorPoolRedis:
+		if cfg.Redis.Addr == "" {
+			return nil, fmt.Errorf("visitor_pool.backend redis requires redis.addr")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported visitor pool backend: %s", cfg.VisitorPool.Backend)
+	}
+
+	if cfg.VisitorPool.KeyPrefix == "" {
+		cfg.VisitorPool.KeyPrefix = "ytsearch:visitors:"
+	}
+
+	if cfg.VisitorPool.SyncInterval <= 0 {
+		cfg.VisitorPool.SyncInterval = 30
+	}
+
+	if cfg.VisitorPool.FetchLease <= 0 {
+		cfg.VisitorPool.FetchLease = 30
+	}
+
+	if cfg.ISRC.DurationDeltaMs <= 0 {
+		cfg.ISRC.DurationDeltaMs = 7000
+	}
+
+	if cfg.ISRC.MaxBulkItems <= 0 {
+		cfg.ISRC.MaxBulkItems = 1000
+	}
+
+	if len(cfg.CORS.AllowedMethods) == 0 {
+		cfg.CORS.AllowedMethods = []string{"GET", "POST"}
+	}
+
+	if len(cfg.CORS.AllowedHeaders) == 0 {
+		cfg.CORS.AllowedHeaders = []string{"Authorization", "Content-Type", "X-API-Key", "Idempotency-Key", "If-None-Match", "X-Request-ID"}
+	}
+
+	if cfg.CORS.MaxAge <= 0 {
+		cfg.CORS.MaxAge = 600
+	}
+
+	if cfg.Idempotency.TTL <= 0 {
+		cfg.Idempotency.TTL = 86400
+	}
+
+	if cfg.RetryBudget.PerRequest <= 0 {
+		cfg.RetryBudget.PerRequest = 1
+	}
+
+	if cfg.RetryBudget.PerMinute <= 0 {
+		cfg.RetryBudget.PerMinute = 60
+	}
+
+	if err := validateRouteProfiles(cfg.RouteProfiles); err != nil {
+		return nil, err
+	}
+
+	if cfg.LeaderElection.Backend == "" {
+		cfg.LeaderElection.Backend = LeaderBackendRedis
+	}
+
+	// the sqlite lease lives in the cache database, so the replicas share it
+	if cfg.LeaderElection.Backend == LeaderBackendSQLite {
+		cfg.LeaderElection.SharedCache = true
+	}
+
+	if cfg.LeaderElection.Key == "" {
+		cfg.LeaderElection.Key = "ytsearch:leader"
+	}
+
+	if cfg.LeaderElection.Lease <= 0 {
+		cfg.LeaderElection.Lease = 30
+	}
+
+	if cfg.Metrics.MaxTenantLabels <= 0 {
+		cfg.Metrics.MaxTenantLabels = 20
+	}
+
+	if cfg.Alerts.Window <= 0 {
+		cfg.Alerts.Window = 300
+	}
+
+	if cfg.Alerts.CheckInterval <= 0 {
+		cfg.Alerts.CheckInterval = 30
+	}
+
+	if cfg.Alerts.MinSamples <= 0 {
+		cfg.Alerts.MinSamples = 20
+	}
+
+	if cfg.Tracing.SampleRate <= 0 {
+		cfg.Tracing.SampleRate = 1
+	}
+
+	if cfg.Admin.Addr == "" {
+		cfg.Admin.Addr = "127.0.0.1:8081"
+	}
+
 	if cfg.RequestTimeout <= 0 {
 		cfg.RequestTimeout = 10
 	}
 
+	if cfg.MaxUpstreamConcurrency <= 0 {
+		cfg.MaxUpstreamConcurrency = 16
+	}
+
+	switch cfg.Logging.AccessFormat {
+	case "", AccessFormatJSON, AccessFormatLogfmt, AccessFormatCombined:
+	default:
+		return nil, fmt.Errorf("unsupported access log format: %s", cfg.Logging.AccessFormat)
+	}
+
+	switch cfg.Fixtures.Mode {
+	case "", FixtureModeRecord, FixtureModeReplay:
+	default:
+		return nil, fmt.Errorf("unsupported fixtures mode: %s", cfg.Fixtures.Mode)
+	}
+
+	if cfg.Fixtures.Dir == "" {
+		cfg.Fixtures.Dir = "fixtures"
+	}
+
+	if cfg.Debug.ArtifactsDir == "" {
+		cfg.Debug.ArtifactsDir = "debug"
+	}
+
+	if cfg.Debug.MaxArtifactsPerHour == 0 {
+		cfg.Debug.MaxArtifactsPerHour = 10
+	}
+
+	if cfg.MusicBrainz.UserAgent == "" {
+		cfg.MusicBrainz.UserAgent = "youtube-searchapi/1.0 ( https://github.com/munishkhatri720/youtube-search )"
+	}
+
+	if err := cfg.Locale.validate(); err != nil {
+		return nil, fmt.Errorf("locale: %w", err)
+	}
+
+	if cfg.Search.MaxResults <= 0 {
+		cfg.Search.MaxResults = 100
+	}
+
+	if cfg.Playlist.MaxTracks <= 0 {
+		cfg.Playlist.MaxTracks = 1000
+	}
+
+	if cfg.Playlist.MaxConcurrentLoads <= 0 {
+		cfg.Playlist.MaxConcurrentLoads = 4
+	}
+
+	if cfg.Mix.DefaultTracks <= 0 {
+		cfg.Mix.DefaultTracks = 25
+	}
+
+	if cfg.Mix.MaxTracks <= 0 {
+		cfg.Mix.MaxTracks = 200
+	}
+
+	if cfg.Batch.MaxItems <= 0 {
+		cfg.Batch.MaxItems = 50
+	}
+
+	if cfg.Batch.MaxConcurrency <= 0 {
+		cfg.Batch.MaxConcurrency = 8
+	}
+
+	if cfg.Batch.ItemTimeout <= 0 {
+		cfg.Batch.ItemTimeout = 15
+	}
+
+	if cfg.Jobs.MaxRunning <= 0 {
+		cfg.Jobs.MaxRunning = 2
+	}
+
+	if cfg.Jobs.Timeout <= 0 {
+		cfg.Jobs.Timeout = 600
+	}
+
+	if cfg.Jobs.ResultTTL <= 0 {
+		cfg.Jobs.ResultTTL = 3600
+	}
+
+	if cfg.Jobs.MaxBatchItems <= 0 {
+		cfg.Jobs.MaxBatchItems = 500
+	}
+
+	if cfg.Jobs.MaxPlaylistTracks <= 0 {
+		cfg.Jobs.MaxPlaylistTracks = 5000
+	}
+
+	if cfg.Auth.ReloadInterval <= 0 {
+		cfg.Auth.ReloadInterval = 10
+	}
+
+	if cfg.Validation.MaxQueryLength <= 0 {
+		cfg.Validation.MaxQueryLength = 200
+	}
+
+	if cfg.Validation.MaxParamLength <= 0 {
+		cfg.Validation.MaxParamLength = 2048
+	}
+
+	if cfg.Validation.MaxBodyBytes <= 0 {
+		cfg.Validation.MaxBodyBytes = 1 << 20
+	}
+
+	if cfg.AnonymousRateLimit.RequestsPerMinute <= 0 {
+		cfg.AnonymousRateLimit.RequestsPerMinute = 60
+	}
+
+	if cfg.AnonymousRateLimit.MaxTrackedClients <= 0 {
+		cfg.AnonymousRateLimit.MaxTrackedClients = 10000
+	}
+
+	if cfg.AnonymousRateLimit.Ipv6Prefix == 0 {
+		cfg.AnonymousRateLimit.Ipv6Prefix = 64
+	}
+	if cfg.AnonymousRateLimit.Ipv6Prefix < 0 || cfg.AnonymousRateLimit.Ipv6Prefix > 128 {
+		return nil, fmt.Errorf("anonymous_rate_limit.ipv6_prefix must be between 1 and 128")
+	}
+
+	if _, err := parseTrustedProxies(cfg.TrustedProxies); err != nil {
+		return nil, err
+	}
+
+	for host, headers := range cfg.UpstreamHeaders {
+		for name := range headers {
+			if http.CanonicalHeaderKey(name) == "Host" || strings.ContainsAny(name, " :\r\n") {
+				return nil, fmt.Errorf("invalid upstream header %q for %s", name, host)
+			}
+		}
+	}
+
 	if cfg.Logging.Format == "" {
 		cfg.Logging.Format = "text"
 	}
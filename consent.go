@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	VisitorCookieContextKey ctxKey = "visitorCookie"
+	NoRedirectContextKey    ctxKey = "noRedirect"
+)
+
+// the cookie sent by visitors that never went through a consent page
+const defaultConsentCookie = "SOCS=CAI;"
+
+var (
+	consentFormPattern  = regexp.MustCompile(`(?s)<form[^>]*action="([^"]*consent\.(?:youtube|google)\.com/save[^"]*)"[^>]*>(.*?)</form>`)
+	consentInputPattern = regexp.MustCompile(`<input[^>]*type="hidden"[^>]*>`)
+	inputNamePattern    = regexp.MustCompile(`name="([^"]*)"`)
+	inputValuePattern   = regexp.MustCompile(`value="([^"]*)"`)
+)
+
+// isConsentPage detects the consent interstitial google shows to EU egress addresses
+func isConsentPage(resp *http.Response, body []byte) bool {
+	if resp.Request != nil && strings.HasPrefix(resp.Request.URL.Host, "consent.") {
+		return true
+	}
+	return consentFormPattern.Match(body)
+}
+
+// parseConsentForm returns the target and hidden fields of the form that
+// rejects all optional cookies, or the first consent form when there is none
+func parseConsentForm(body []byte) (string, url.Values, error) {
+	forms := consentFormPattern.FindAllSubmatch(body, -1)
+	if len(forms) == 0 {
+		return "", nil, fmt.Errorf("no consent form found")
+	}
+	var action string
+	var values url.Values
+	for _, form := range forms {
+		fields := url.Values{}
+		for _, input := range consentInputPattern.FindAll(form[2], -1) {
+			name := inputNamePattern.FindSubmatch(input)
+			if name == nil {
+				continue
+			}
+			value := inputValuePattern.FindSubmatch(input)
+			if value == nil {
+				fields.Add(html.UnescapeString(string(name[1])), "")
+			} else {
+				fields.Add(html.UnescapeString(string(name[1])), html.UnescapeString(string(value[1])))
+			}
+		}
+		if values == nil || fields.Get("set_eom") == "true" {
+			action, values = html.UnescapeString(string(form[1])), fields
+		}
+	}
+	return action, values, nil
+}
+
+// acceptConsent submits the consent form of a consent page and returns the
+// cookies it sets, which the visitor then sends with all its requests
+func (srv *Server) acceptConsent(ctx context.Context, body []byte) (string, error) {
+	action, values, err := parseConsentForm(body)
+	if err != nil {
+		return "", err
+	}
+	// the cookies come with the redirect back to youtube, stop right there
+	ctx = context.WithValue(ctx, NoRedirectContextKey, true)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, action, strings.NewReader(values.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create consent request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := srv.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to submit consent form: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	var cookies []string
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "SOCS" || cookie.Name == "CONSENT" {
+			cookies = append(cookies, cookie.Name+"="+cookie.Value)
+		}
+	}
+	if len(cookies) == 0 {
+		return "", fmt.Errorf("consent form returned no consent cookie (status %d)", resp.StatusCode)
+	}
+	LoggerFromContext(ctx).Info("Accepted consent page", "action", action)
+	return strings.Join(cookies, "; ") + ";", nil
+}
+
+// withVisitorCookie makes upstream requests of the context send the consent cookie of a visitor
+func withVisitorCookie(ctx context.Context, cookie string) context.Context {
+	if cookie == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, VisitorCookieContextKey, cookie)
+}
+
+func visitorCookie(ctx context.Context) string {
+	if cookie, ok := ctx.Value(VisitorCookieContextKey).(string); ok {
+		return cookie
+	}
+	return defaultConsentCookie
+}
+
+// consentRedirectPolicy stops at the first redirect for requests that need its cookies
+func consentRedirectPolicy(req *http.Request, via []*http.Request) error {
+	if noRedirect, _ := req.Context().Value(NoRedirectContextKey).(bool); noRedirect {
+		return http.ErrUseLastResponse
+	}
+	if len(via) >= 10 {
+		return fmt.Errorf("stopped after 10 redirects")
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type CORSConfig struct {
+	// AllowedOrigins are the origins browsers may call the api from, * allows
+	// any. Empty leaves CORS off.
+	AllowedOrigins []string `yaml:"allowed_origins"`
+	AllowedMethods []string `yaml:"allowed_methods"`
+	AllowedHeaders []string `yaml:"allowed_headers"`
+	// MaxAge is how long browsers may keep a preflight response, in seconds
+	MaxAge int `yaml:"max_age"`
+}
+
+// corsExposedHeaders are the response headers scripts of other origins may
+// read, the ones the api answers with besides the safelisted ones
+var corsExposedHeaders = []string{
+	"ETag", "Age", "Location", "Retry-After", "X-Request-ID",
+	"X-API-Version", "X-Cache", "X-Corrected-Query", "X-Suggested-Query",
+	"X-Total-Estimated", "X-Duration-Filter", "X-Stream-Error", "Idempotent-Replayed",
+	"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset",
+	"X-Quota-Daily-Limit", "X-Quota-Daily-Remaining",
+	"X-Quota-Monthly-Limit", "X-Quota-Monthly-Remaining",
+}
+
+func (cfg CORSConfig) allowsOrigin(origin string) bool {
+	return slices.Contains(cfg.AllowedOrigins, "*") || slices.Contains(cfg.AllowedOrigins, origin)
+}
+
+// CORS lets browser frontends on the allowed origins call the api directly. It
+// answers preflight requests itself, before api keys are checked, as browsers
+// send those without credentials. Every other response of an allowed origin,
+// errors included, says so to the browser.
+func (srv *Server) CORS(next http.Handler) http.Handler {
+	cfg := srv.Cfg.CORS
+	if len(cfg.AllowedOrigins) == 0 {
+		return next
+	}
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	exposed := strings.Join(corsExposedHeaders, ", ")
+	maxAge := strconv.Itoa(cfg.MaxAge)
+	anyOrigin := slices.Contains(cfg.AllowedOrigins, "*")
+
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		origin := req.Header.Get("Origin")
+		header := writer.Header()
+		if !anyOrigin {
+			header.Add("Vary", "Origin")
+		}
+		if origin == "" || !cfg.allowsOrigin(origin) {
+			next.ServeHTTP(writer, req)
+			return
+		}
+		if anyOrigin {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+
+		if req.Method == http.MethodOptions && req.Header.Get("Access-Control-Request-Method") != "" {
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+			header.Set("Access-Control-Allow-Methods", methods)
+			header.Set("Access-Control-Allow-Headers", headers)
+			header.Set("Access-Control-Max-Age", maxAge)
+			writer.WriteHeader(http.StatusNoContent)
+			return
+		}
+		header.Set("Access-Control-Expose-Headers", exposed)
+		next.ServeHTTP(writer, req)
+	})
+}
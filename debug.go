@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+const DebugContextKey ctxKey = "debug"
+
+// CacheDecision is one cache lookup or store made while serving a request
+type CacheDecision struct {
+	Key    string `json:"key"`
+	Result string `json:"result"`
+}
+
+// ParseTrace is one upstream response parsed while serving a request
+type ParseTrace struct {
+	Parser string `json:"parser"`
+	Parsed int    `json:"parsed"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Diagnostics is the debug block added to responses of ?debug=true requests
+type Diagnostics struct {
+	RequestId string           `json:"request_id"`
+	Route     string           `json:"route"`
+	Tenant    string           `json:"tenant,omitempty"`
+	ElapsedMs float64          `json:"elapsed_ms"`
+	Cache     []CacheDecision  `json:"cache"`
+	Upstream  []UpstreamTiming `json:"upstream"`
+	Retries   map[string]int   `json:"retry_budget_spent,omitempty"`
+	Parsers   []ParseTrace     `json:"parsers"`
+}
+
+// DebugResponse wraps the regular response of a ?debug=true request
+type DebugResponse struct {
+	Data  any          `json:"data"`
+	Debug *Diagnostics `json:"debug"`
+}
+
+func (info *RequestInfo) addCacheDecision(key string, result string) {
+	info.mu.Lock()
+	defer info.mu.Unlock()
+	info.cache = append(info.cache, CacheDecision{Key: key, Result: result})
+}
+
+func (info *RequestInfo) addParse(trace ParseTrace) {
+	info.mu.Lock()
+	defer info.mu.Unlock()
+	info.parsers = append(info.parsers, trace)
+}
+
+// recordParse notes which parser handled an upstream response and how many items it produced
+func recordParse(ctx context.Context, parser string, parsed int, err error) {
+	trace := ParseTrace{Parser: parser, Parsed: parsed}
+	if err != nil {
+		trace.Error = err.Error()
+	}
+	RequestInfoFromContext(ctx).addParse(trace)
+}
+
+func (info *RequestInfo) Diagnostics() *Diagnostics {
+	info.mu.Lock()
+	defer info.mu.Unlock()
+	diagnostics := &Diagnostics{
+		RequestId: info.Id,
+		Route:     info.Route,
+		Tenant:    info.Tenant,
+		ElapsedMs: float64(time.Since(info.startedAt).Microseconds()) / 1000,
+		Cache:     append([]CacheDecision{}, info.cache...),
+		Upstream:  append([]UpstreamTiming{}, info.upstream...),
+		Parsers:   append([]ParseTrace{}, info.parsers...),
+	}
+	if len(info.retries) > 0 {
+		diagnostics.Retries = make(map[string]int, len(info.retries))
+		for endpoint, count := range info.retries {
+			diagnostics.Retries[endpoint] = count
+		}
+	}
+	return diagnostics
+}
+
+func debugEnabled(ctx context.Context) bool {
+	enabled, _ := ctx.Value(DebugContextKey).(bool)
+	return enabled
+}
+
+// DebugIntrospection enables the diagnostics block for ?debug=true requests of
+// api key holders and admins, who send their token in X-Admin-Token since
+// Authorization carries the api key
+func (srv *Server) DebugIntrospection(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("debug") != "true" {
+			next.ServeHTTP(writer, req)
+			return
+		}
+		if TenantFromContext(req.Context()) == nil && srv.Cfg.Admin.actor(req.Header.Get("X-Admin-Token")) == "" {
+			writeRequestError(writer, http.StatusForbidden, &ValidationError{
+				Code:    "debug_not_allowed",
+				Param:   "debug",
+				Message: "debug output requires an api key or an admin token",
+			})
+			return
+		}
+		next.ServeHTTP(writer, req.WithContext(context.WithValue(req.Context(), DebugContextKey, true)))
+	})
+}
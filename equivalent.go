@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// two recordings of the same song rarely differ by more than an intro or outro
+const equivalentDurationToleranceMs = 10000
+
+const equivalentThreshold = 0.75
+
+type EquivalentRequest struct {
+	A string `json:"a"`
+	B string `json:"b"`
+}
+
+type EquivalentResponse struct {
+	Equivalent bool               `json:"equivalent"`
+	Confidence float64            `json:"confidence"`
+	Signals    map[string]float64 `json:"signals"`
+	A          *YouTubeMusicSong  `json:"a"`
+	B          *YouTubeMusicSong  `json:"b"`
+}
+
+// artistsOverlap reports whether two songs share an artist, by channel or by name
+func artistsOverlap(a *YouTubeMusicSong, b *YouTubeMusicSong) bool {
+	if a.ChannelId != "" && a.ChannelId == b.ChannelId {
+		return true
+	}
+	ids := map[string]bool{a.ChannelId: true}
+	names := map[string]bool{normalizeMatchText(a.Author): true}
+	for _, artist := range a.Artists {
+		ids[artist.Id] = true
+		names[normalizeMatchText(artist.Name)] = true
+	}
+	delete(ids, "")
+	delete(names, "")
+	if ids[b.ChannelId] || names[normalizeMatchText(b.Author)] {
+		return true
+	}
+	for _, artist := range b.Artists {
+		if ids[artist.Id] || names[normalizeMatchText(artist.Name)] {
+			return true
+		}
+	}
+	return false
+}
+
+// compareSongs rates how likely two songs are the same recording, e.g. the
+// official video and the YouTube Music upload of a track
+func compareSongs(a *YouTubeMusicSong, b *YouTubeMusicSong) (float64, map[string]float64) {
+	signals := map[string]float64{
+		"title": max(
+			containsSimilarity(a.Title, b.Title),
+			containsSimilarity(b.Title, a.Title),
+		),
+		"duration": durationCloseness(a.Length, b.Length, equivalentDurationToleranceMs),
+	}
+	if artistsOverlap(a, b) {
+		signals["artist"] = 1
+	} else {
+		signals["artist"] = textSimilarity(a.Author, b.Author)
+	}
+	confidence := 0.45*signals["title"] + 0.3*signals["duration"] + 0.25*signals["artist"]
+
+	// a matching title on the same album settles it, a different album speaks against it
+	if a.Album != nil && b.Album != nil && a.Album.Id != "" && b.Album.Id != "" {
+		if a.Album.Id == b.Album.Id {
+			signals["album"] = 1
+			if signals["title"] >= 0.8 {
+				confidence = max(confidence, 0.95)
+			}
+		} else {
+			signals["album"] = 0
+			confidence *= 0.9
+		}
+	}
+	for name, value := range signals {
+		signals[name] = math.Round(value*1000) / 1000
+	}
+	return math.Round(confidence*1000) / 1000, signals
+}
+
+func (srv *Server) MakeEquivalentHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		var body EquivalentRequest
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			writeValidationError(writer, &ValidationError{Code: "invalid_body", Message: err.Error()})
+			return
+		}
+		body.A, body.B = strings.TrimSpace(body.A), strings.TrimSpace(body.B)
+		for _, id := range []string{body.A, body.B} {
+			if !DirectVideoIDPattern.MatchString(id) {
+				writeValidationError(writer, &ValidationError{
+					Code:    "invalid_video_id",
+					Message: fmt.Sprintf("%q is not a video id", id),
+				})
+				return
+			}
+		}
+
+		var (
+			wg    sync.WaitGroup
+			songs [2]*YouTubeMusicSong
+			errs  [2]error
+		)
+		for i, id := range []string{body.A, body.B} {
+			wg.Add(1)
+			go func(ctx context.Context) {
+				defer wg.Done()
+				songs[i], _, errs[i] = srv.loadMusicSongCached(ctx, id)
+			}(req.Context())
+		}
+		wg.Wait()
+		for i, err := range errs {
+			if err != nil {
+				writeError(
+					writer,
+					http.StatusInternalServerError,
+					fmt.Sprintf("Error loading %s: %v", []string{body.A, body.B}[i], err),
+				)
+				return
+			}
+		}
+
+		response := EquivalentResponse{A: songs[0], B: songs[1]}
+		if body.A == body.B {
+			response.Confidence = 1
+			response.Signals = map[string]float64{"identical": 1}
+		} else {
+			response.Confidence, response.Signals = compareSongs(songs[0], songs[1])
+		}
+		response.Equivalent = response.Confidence >= equivalentThreshold
+		srv.writeJSON(writer, req, response, CacheStatus{})
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+const (
+	exploreBrowseId         = "FEmusic_moods_and_genres"
+	exploreCategoryBrowseId = "FEmusic_moods_and_genres_category"
+)
+
+// browse params are base64, sometimes url escaped
+var exploreParamsPattern = regexp.MustCompile(`^[A-Za-z0-9_%=+/-]{1,200}$`)
+
+// ExploreCategory is a mood or genre, its params select it on the explore endpoint
+type ExploreCategory struct {
+	Title  string `json:"title"`
+	Params string `json:"params"`
+	Color  string `json:"color,omitempty"`
+}
+
+type ExplorePlaylist struct {
+	Identifier string      `json:"identifier"`
+	Title      string      `json:"title"`
+	Subtitle   string      `json:"subtitle"`
+	Images     []Thumbnail `json:"images"`
+	Uri        string      `json:"uri"`
+}
+
+// ExploreSection groups categories on the overview and playlists on a category page
+type ExploreSection struct {
+	Title      string            `json:"title"`
+	Categories []ExploreCategory `json:"categories,omitempty"`
+	Playlists  []ExplorePlaylist `json:"playlists,omitempty"`
+}
+
+type YouTubeMusicExplore struct {
+	Title    string           `json:"title"`
+	Category string           `json:"category,omitempty"`
+	Sections []ExploreSection `json:"sections"`
+}
+
+// parseStripeColor turns the ARGB integer of a category button into #rrggbb
+func parseStripeColor(value gjson.Result) string {
+	if !value.Exists() {
+		return ""
+	}
+	return fmt.Sprintf("#%06x", value.Uint()&0xffffff)
+}
+
+func parseExplorePlaylist(item gjson.Result) (ExplorePlaylist, error) {
+	renderer := item.Get("musicTwoRowItemRenderer")
+	if !renderer.Exists() {
+		return ExplorePlaylist{}, newParseError(rendererName(item), ParseReasonUnsupportedRenderer, "")
+	}
+	browseId := renderer.Get("navigationEndpoint.browseEndpoint.browseId").String()
+	if !strings.HasPrefix(browseId, "VL") {
+		return ExplorePlaylist{}, newParseError("musicTwoRowItemRenderer.navigationEndpoint", "not_playlist", browseId)
+	}
+	playlistId := strings.TrimPrefix(browseId, "VL")
+
+	var subtitle strings.Builder
+	for _, run := range renderer.Get("subtitle.runs").Array() {
+		subtitle.WriteString(run.Get("text").String())
+	}
+	return ExplorePlaylist{
+		Identifier: playlistId,
+		Title:      renderer.Get("title.runs.0.text").String(),
+		Subtitle:   subtitle.String(),
+		Images:     parseThumbnails(renderer.Get("thumbnailRenderer.musicThumbnailRenderer.thumbnail.thumbnails")),
+		Uri:        YT_MUSIC_BASE_URL + "/playlist?list=" + playlistId,
+	}, nil
+}
+
+// parseExploreSection reads a grid of category buttons or a grid or carousel of playlists
+func parseExploreSection(content gjson.Result, data []byte) (ExploreSection, bool) {
+	var section ExploreSection
+	var items []gjson.Result
+	switch {
+	case content.Get("gridRenderer").Exists():
+		section.Title = content.Get("gridRenderer.header.gridHeaderRenderer.title.runs.0.text").String()
+		items = content.Get("gridRenderer.items").Array()
+	case content.Get("musicCarouselShelfRenderer").Exists():
+		section.Title = content.Get(
+			"musicCarouselShelfRenderer.header.musicCarouselShelfBasicHeaderRenderer.title.runs.0.text",
+		).String()
+		items = content.Get("musicCarouselShelfRenderer.contents").Array()
+	default:
+		return section, false
+	}
+
+	for _, item := range items {
+		if button := item.Get("musicNavigationButtonRenderer"); button.Exists() {
+			section.Categories = append(section.Categories, ExploreCategory{
+				Title:  button.Get("buttonText.runs.0.text").String(),
+				Params: button.Get("clickCommand.browseEndpoint.params").String(),
+				Color:  parseStripeColor(button.Get("solid.leftStripeColor")),
+			})
+			continue
+		}
+		playlist, err := parseExplorePlaylist(item)
+		if err != nil {
+			recordParseFailure("explore", err, data)
+			continue
+		}
+		section.Playlists = append(section.Playlists, playlist)
+	}
+	return section, len(section.Categories) > 0 || len(section.Playlists) > 0
+}
+
+func parseExplorePage(data []byte) (*YouTubeMusicExplore, error) {
+	contents := gjson.GetBytes(
+		data,
+		"contents.singleColumnBrowseResultsRenderer.tabs.0.tabRenderer.content.sectionListRenderer.contents",
+	)
+	if !contents.IsArray() {
+		err := newParseError("sectionListRenderer.contents", "missing", "")
+		recordParseFailure("explore", err, data)
+		return nil, err
+	}
+
+	explore := &YouTubeMusicExplore{
+		Title:    gjson.GetBytes(data, "header.musicHeaderRenderer.title.runs.0.text").String(),
+		Sections: make([]ExploreSection, 0),
+	}
+	for _, content := range contents.Array() {
+		if section, ok := parseExploreSection(content, data); ok {
+			explore.Sections = append(explore.Sections, section)
+		}
+	}
+	return explore, nil
+}
+
+// LoadExplore loads the moods & genres overview of YouTube Music, or the
+// playlists of one category when params are given
+func (srv *Server) LoadExplore(ctx context.Context, params string) (*YouTubeMusicExplore, error) {
+	visitor, err := srv.pickVisitor(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := map[string]any{"browseId": exploreBrowseId}
+	if params != "" {
+		payload = map[string]any{"browseId": exploreCategoryBrowseId, "params": params}
+	}
+	respBody, err := srv.innertubeRequest(ctx, "explore", INNERTUBE_MUSIC_BROWSE_API_URL, visitor, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	explore, err := parseExplorePage(respBody)
+	if err != nil {
+		recordParse(ctx, "explore", 0, err)
+		return nil, err
+	}
+	recordParse(ctx, "explore", len(explore.Sections), nil)
+	explore.Category = params
+	return explore, nil
+}
+
+func (srv *Server) MakeExploreHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		params := strings.TrimSpace(req.FormValue("category"))
+		if params != "" && !exploreParamsPattern.MatchString(params) {
+			writeValidationError(writer, &ValidationError{
+				Code:    "invalid_category",
+				Param:   "category",
+				Message: "category must be the params of a category from the explore overview",
+			})
+			return
+		}
+
+		cacheKey := "explore:" + params
+		if srv.db != nil {
+			entry, err := srv.LookupCache(req.Context(), cacheKey)
+			if err != nil {
+				LoggerFromContext(req.Context()).Error("Failed to lookup cache for explore", "error", err)
+			} else if entry != nil {
+				var explore YouTubeMusicExplore
+				if err := json.Unmarshal(entry.Value, &explore); err != nil {
+					LoggerFromContext(req.Context()).Error("Failed to unmarshal cached explore page", "error", err)
+				} else {
+					srv.writeJSON(writer, req, explore, CacheStatus{Hit: true, StoredAt: entry.StoredAt})
+					return
+				}
+			}
+		}
+
+		explore, err := srv.LoadExplore(req.Context(), params)
+		if err != nil {
+			writeError(
+				writer,
+				http.StatusInternalServerError,
+				fmt.Sprintf("Error loading explore page: %v", err),
+			)
+			return
+		}
+
+		if srv.db != nil && len(explore.Sections) > 0 {
+			if err := srv.StoreCache(req.Context(), cacheKey, explore); err != nil {
+				LoggerFromContext(req.Context()).Error("Failed to store explore page in cache", "error", err)
+			}
+		}
+		srv.writeJSON(writer, req, explore, CacheStatus{})
+	}
+}
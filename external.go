@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SPOTIFY_BASE_URL = "https://open.spotify.com"
+	DEEZER_API_URL   = "https://api.deezer.com"
+)
+
+var (
+	spotifyTrackPattern = regexp.MustCompile(`^/(?:intl-[a-z-]+/)?track/([a-zA-Z0-9]{22})`)
+	deezerTrackPattern  = regexp.MustCompile(`^/(?:[a-z]{2}/)?track/([0-9]+)`)
+	metaTagPattern      = regexp.MustCompile(`<meta\s+(?:name|property)="([^"]+)"\s+content="([^"]*)"`)
+)
+
+// ExternalTrack is the metadata of a track on another streaming service
+type ExternalTrack struct {
+	Service  string `json:"service"`
+	Url      string `json:"url"`
+	Title    string `json:"title"`
+	Artist   string `json:"artist"`
+	LengthMs int    `json:"length"`
+	ISRC     string `json:"isrc,omitempty"`
+}
+
+func (track *ExternalTrack) MatchReference() MatchReference {
+	return MatchReference{Title: track.Title, Artist: track.Artist, LengthMs: track.LengthMs}
+}
+
+func NewExternalHttpClient(timeoutSeconds int) *http.Client {
+	return &http.Client{Timeout: time.Duration(timeoutSeconds) * time.Second}
+}
+
+func fetchExternal(ctx context.Context, client *http.Client, reqUrl string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqUrl, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept-Language", "en")
+	req.Header.Set(
+		"User-Agent",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/142.0.0.0 Safari/537.36",
+	)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to perform request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("request to %s failed with status: %s", req.URL.Host, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	return body, nil
+}
+
+func parseMetaTags(page []byte) map[string]string {
+	tags := make(map[string]string)
+	for _, match := range metaTagPattern.FindAllSubmatch(page, -1) {
+		name := string(match[1])
+		if _, ok := tags[name]; !ok {
+			tags[name] = html.UnescapeString(string(match[2]))
+		}
+	}
+	return tags
+}
+
+func fetchSpotifyTrack(ctx context.Context, client *http.Client, trackId string) (*ExternalTrack, error) {
+	trackUrl := SPOTIFY_BASE_URL + "/track/" + trackId
+	track := &ExternalTrack{Service: "spotify", Url: trackUrl}
+
+	page, err := fetchExternal(ctx, client, trackUrl)
+	if err == nil {
+		tags := parseMetaTags(page)
+		track.Title = tags["og:title"]
+		track.Artist = tags["music:musician_description"]
+		if seconds, err := strconv.Atoi(tags["music:duration"]); err == nil {
+			track.LengthMs = seconds * 1000
+		}
+	}
+
+	if track.Title == "" {
+		body, err := fetchExternal(ctx, client, SPOTIFY_BASE_URL+"/oembed?url="+url.QueryEscape(trackUrl))
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch spotify metadata: %w", err)
+		}
+		var oembed struct {
+			Title string `json:"title"`
+		}
+		if err := json.Unmarshal(body, &oembed); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal spotify oembed: %w", err)
+		}
+		track.Title = oembed.Title
+	}
+
+	if track.Title == "" {
+		return nil, fmt.Errorf("spotify track %s not found", trackId)
+	}
+	return track, nil
+}
+
+func fetchDeezerTrack(ctx context.Context, client *http.Client, trackId string) (*ExternalTrack, error) {
+	body, err := fetchExternal(ctx, client, DEEZER_API_URL+"/track/"+trackId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch deezer metadata: %w", err)
+	}
+
+	var respdata struct {
+		Title    string `json:"title"`
+		Duration int    `json:"duration"`
+		ISRC     string `json:"isrc"`
+		Link     string `json:"link"`
+		Artist   struct {
+			Name string `json:"name"`
+		} `json:"artist"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &respdata); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal deezer track: %w", err)
+	}
+	if respdata.Error != nil {
+		return nil, fmt.Errorf("deezer track %s: %s", trackId, respdata.Error.Message)
+	}
+
+	return &ExternalTrack{
+		Service:  "deezer",
+		Url:      respdata.Link,
+		Title:    respdata.Title,
+		Artist:   respdata.Artist.Name,
+		LengthMs: respdata.Duration * 1000,
+		ISRC:     strings.ToUpper(respdata.ISRC),
+	}, nil
+}
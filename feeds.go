@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	FeedFormatRSS  = "rss"
+	FeedFormatAtom = "atom"
+)
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Guid        rssGuid `xml:"guid"`
+	Description string  `xml:"description,omitempty"`
+}
+
+type rssGuid struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Id      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Author  *atomAuthor `xml:"author,omitempty"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr"`
+	Href string `xml:"href,attr"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	Id      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Author  *atomAuthor `xml:"author,omitempty"`
+	Summary string      `xml:"summary,omitempty"`
+}
+
+// parseFeedFormat reads the format parameter of the endpoints that can answer
+// with a feed, empty for JSON
+func parseFeedFormat(req *http.Request) (string, *ValidationError) {
+	switch format := strings.ToLower(strings.TrimSpace(req.FormValue("format"))); format {
+	case "", "json":
+		return "", nil
+	case FeedFormatRSS, FeedFormatAtom:
+		return format, nil
+	}
+	return "", &ValidationError{
+		Code:    "invalid_format",
+		Param:   "format",
+		Message: "format must be one of json, rss or atom",
+	}
+}
+
+// feedItemSummary describes a track in a feed item, its author and length
+func feedItemSummary(track YouTubeTrack) string {
+	parts := make([]string, 0, 2)
+	if track.Author != "" {
+		parts = append(parts, track.Author)
+	}
+	if track.LengthText != "" {
+		parts = append(parts, track.LengthText)
+	}
+	return strings.Join(parts, " • ")
+}
+
+// encodeFeed writes the tracks of a playlist as an RSS 2.0 or Atom feed. The
+// tracks carry no publish dates, so Atom's updated times are the time the
+// playlist was loaded.
+func encodeFeed(format string, playlist *YouTubePlaylist, link string, loadedAt time.Time) ([]byte, error) {
+	var feed any
+	switch format {
+	case FeedFormatRSS:
+		channel := rssChannel{
+			Title:       playlist.Title,
+			Link:        link,
+			Description: fmt.Sprintf("%s by %s", playlist.Title, playlist.Author),
+			Items:       make([]rssItem, 0, len(playlist.Tracks)),
+		}
+		for _, track := range playlist.Tracks {
+			channel.Items = append(channel.Items, rssItem{
+				Title:       track.Title,
+				Link:        track.Uri,
+				Guid:        rssGuid{Value: "yt:video:" + track.Identifier},
+				Description: feedItemSummary(track),
+			})
+		}
+		feed = rssFeed{Version: "2.0", Channel: channel}
+	case FeedFormatAtom:
+		updated := loadedAt.UTC().Format(time.RFC3339)
+		atom := atomFeed{
+			Id:      link,
+			Title:   playlist.Title,
+			Updated: updated,
+			Link:    atomLink{Rel: "alternate", Href: link},
+			Entries: make([]atomEntry, 0, len(playlist.Tracks)),
+		}
+		if playlist.Author != "" {
+			atom.Author = &atomAuthor{Name: playlist.Author}
+		}
+		for _, track := range playlist.Tracks {
+			entry := atomEntry{
+				Id:      "yt:video:" + track.Identifier,
+				Title:   track.Title,
+				Updated: updated,
+				Link:    atomLink{Rel: "alternate", Href: track.Uri},
+				Summary: feedItemSummary(track),
+			}
+			if track.Author != "" {
+				entry.Author = &atomAuthor{Name: track.Author}
+			}
+			atom.Entries = append(atom.Entries, entry)
+		}
+		feed = atom
+	default:
+		return nil, fmt.Errorf("unknown feed format %q", format)
+	}
+
+	var body bytes.Buffer
+	body.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&body)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(feed); err != nil {
+		return nil, err
+	}
+	body.WriteString("\n")
+	return body.Bytes(), nil
+}
+
+// writeFeed answers with a playlist as a feed, link is the page the feed is of
+func (srv *Server) writeFeed(
+	writer http.ResponseWriter,
+	req *http.Request,
+	format string,
+	playlist *YouTubePlaylist,
+	link string,
+	status CacheStatus,
+) {
+	filtered := applyTenantFilters(req.Context(), playlist).(*YouTubePlaylist)
+	// a cached playlist keeps its time, so the feed and its ETag stay the same
+	// until the entry expires
+	loadedAt := status.StoredAt
+	if loadedAt.IsZero() {
+		loadedAt = time.Now()
+	}
+	body, err := encodeFeed(format, filtered, link, loadedAt)
+	if err != nil {
+		writeError(
+			writer,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Error encoding feed: %v", err),
+		)
+		return
+	}
+	contentType := "application/rss+xml; charset=utf-8"
+	if format == FeedFormatAtom {
+		contentType = "application/atom+xml; charset=utf-8"
+	}
+	srv.writeBody(writer, req, body, contentType, status)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+const FieldsContextKey ctxKey = "fields"
+
+// trackFields are the json names of the YouTubeTrack fields, the ones the
+// fields parameter can pick
+var trackFields = func() []string {
+	var fields []string
+	trackType := reflect.TypeFor[YouTubeTrack]()
+	for i := 0; i < trackType.NumField(); i++ {
+		name, _, _ := strings.Cut(trackType.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}()
+
+// FieldsFromContext returns the track fields a request asked for, nil for all
+func FieldsFromContext(ctx context.Context) []string {
+	fields, _ := ctx.Value(FieldsContextKey).([]string)
+	return fields
+}
+
+// Fields attaches the fields parameter of a request to its context, the
+// tracks of its response only carry those fields
+func (srv *Server) Fields(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		param := req.URL.Query().Get("fields")
+		if strings.TrimSpace(param) == "" {
+			next.ServeHTTP(writer, req)
+			return
+		}
+		var fields []string
+		for _, field := range strings.Split(param, ",") {
+			field = strings.ToLower(strings.TrimSpace(field))
+			if field == "" || slices.Contains(fields, field) {
+				continue
+			}
+			if !slices.Contains(trackFields, field) {
+				writeValidationError(writer, &ValidationError{
+					Code:    "invalid_fields",
+					Param:   "fields",
+					Message: fmt.Sprintf("unknown field %q, fields are %s", field, strings.Join(trackFields, ", ")),
+				})
+				return
+			}
+			fields = append(fields, field)
+		}
+		next.ServeHTTP(writer, req.WithContext(context.WithValue(req.Context(), FieldsContextKey, fields)))
+	})
+}
+
+// selectTrackFields encodes a track with only the given fields
+func selectTrackFields(track YouTubeTrack, fields []string) (map[string]json.RawMessage, error) {
+	encoded, err := json.Marshal(track)
+	if err != nil {
+		return nil, err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &all); err != nil {
+		return nil, err
+	}
+	selected := make(map[string]json.RawMessage, len(fields))
+	for _, field := range fields {
+		// fields left out as empty stay left out
+		if value, ok := all[field]; ok {
+			selected[field] = value
+		}
+	}
+	return selected, nil
+}
+
+// applyFields cuts the tracks of a response value down to the fields the
+// request asked for. Values without tracks are left alone.
+func applyFields(ctx context.Context, value any) (any, error) {
+	fields := FieldsFromContext(ctx)
+	if fields == nil {
+		return value, nil
+	}
+	selectTracks := func(tracks []YouTubeTrack) ([]map[string]json.RawMessage, error) {
+		selected := make([]map[string]json.RawMessage, 0, len(tracks))
+		for _, track := range tracks {
+			fieldsOfTrack, err := selectTrackFields(track, fields)
+			if err != nil {
+				return nil, err
+			}
+			selected = append(selected, fieldsOfTrack)
+		}
+		return selected, nil
+	}
+	switch typed := value.(type) {
+	case YouTubeTrack:
+		return selectTrackFields(typed, fields)
+	case *YouTubeTrack:
+		return selectTrackFields(*typed, fields)
+	case []YouTubeTrack:
+		return selectTracks(typed)
+	case *YouTubePlaylist:
+		// the playlist keeps its own fields, only its tracks are cut down
+		tracks, err := selectTracks(typed.Tracks)
+		if err != nil {
+			return nil, err
+		}
+		return struct {
+			*YouTubePlaylist
+			Tracks []map[string]json.RawMessage `json:"tracks"`
+		}{typed, tracks}, nil
+	}
+	return value, nil
+}
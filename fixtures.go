@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	FixtureModeRecord = "record"
+	FixtureModeReplay = "replay"
+)
+
+var visitorDataPattern = regexp.MustCompile(`("visitorData"\s*:\s*")[^"]*(")`)
+
+// streamIpPattern matches the ip parameter stream urls are bound to, plain
+// or percent encoded as within a signatureCipher
+var streamIpPattern = regexp.MustCompile(
+	`((?:[?&]|%3F|%253F|%26|%2526)ip(?:=|%3D|%253D))(?:[0-9]{1,3}(?:\.[0-9]{1,3}){3}|[0-9a-fA-F]{0,4}(?:(?::|%3A|%253A)[0-9a-fA-F]{0,4}){2,7})`,
+)
+
+type Fixture struct {
+	Method      string `json:"method"`
+	Url         string `json:"url"`
+	RequestBody string `json:"request_body,omitempty"`
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type"`
+	Body        string `json:"body"`
+}
+
+// FixtureTransport captures upstream responses into fixture files or serves
+// them back without touching the network.
+type FixtureTransport struct {
+	Mode string
+	Dir  string
+	next http.RoundTripper
+}
+
+func NewFixtureTransport(cfg FixtureConfig, next http.RoundTripper) *FixtureTransport {
+	return &FixtureTransport{Mode: cfg.Mode, Dir: cfg.Dir, next: next}
+}
+
+// sanitizeFixtureBody strips what ties a recorded response to the machine
+// that recorded it: the visitor data and the client ip of stream urls
+func sanitizeFixtureBody(body []byte) []byte {
+	body = visitorDataPattern.ReplaceAll(body, []byte("${1}REDACTED${2}"))
+	return streamIpPattern.ReplaceAll(body, []byte("${1}0.0.0.0"))
+}
+
+// fixtureKey identifies a request independent of the visitor context it was sent with
+func fixtureKey(req *http.Request, body []byte) string {
+	hasher := sha256.New()
+	hasher.Write([]byte(req.Method + " " + req.URL.Host + req.URL.Path))
+
+	var payload map[string]any
+	if len(body) > 0 && json.Unmarshal(body, &payload) == nil {
+		delete(payload, "context")
+		stable, _ := json.Marshal(payload)
+		hasher.Write(stable)
+	} else {
+		hasher.Write(body)
+	}
+
+	endpoint := strings.Trim(strings.TrimPrefix(req.URL.Path, "/youtubei/v1/"), "/")
+	if endpoint == "" {
+		endpoint = "home"
+	}
+	name := strings.ReplaceAll(req.URL.Host+"_"+endpoint, "/", "_")
+	return name + "_" + hex.EncodeToString(hasher.Sum(nil))[:16]
+}
+
+func (transport *FixtureTransport) fixturePath(key string) string {
+	return filepath.Join(transport.Dir, key+".json")
+}
+
+func (transport *FixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	key := fixtureKey(req, body)
+
+	if transport.Mode == FixtureModeReplay {
+		return transport.replay(req, key)
+	}
+
+	resp, err := transport.next.RoundTrip(req)
+	if err != nil || transport.Mode != FixtureModeRecord {
+		return resp, err
+	}
+	return transport.record(req, resp, body, key)
+}
+
+func (transport *FixtureTransport) replay(req *http.Request, key string) (*http.Response, error) {
+	data, err := os.ReadFile(transport.fixturePath(key))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("no fixture recorded for %s %s (%s)", req.Method, req.URL, key)
+		}
+		return nil, fmt.Errorf("failed to read fixture: %w", err)
+	}
+
+	var fixture Fixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal fixture %s: %w", key, err)
+	}
+	LoggerFromContext(req.Context()).Debug("Replaying fixture", "key", key)
+	return fixture.Response(req), nil
+}
+
+func (transport *FixtureTransport) record(
+	req *http.Request,
+	resp *http.Response,
+	reqBody []byte,
+	key string,
+) (*http.Response, error) {
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	fixture := Fixture{
+		Method:      req.Method,
+		Url:         req.URL.String(),
+		RequestBody: string(sanitizeFixtureBody(reqBody)),
+		Status:      resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Body:        string(sanitizeFixtureBody(respBody)),
+	}
+	if err := fixture.Save(transport.fixturePath(key)); err != nil {
+		LoggerFromContext(req.Context()).Error("Failed to record fixture", "key", key, "error", err)
+	} else {
+		LoggerFromContext(req.Context()).Info("Recorded fixture", "key", key)
+	}
+	return resp, nil
+}
+
+func (fixture *Fixture) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(fixture, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+func (fixture *Fixture) Response(req *http.Request) *http.Response {
+	header := make(http.Header)
+	if fixture.ContentType != "" {
+		header.Set("Content-Type", fixture.ContentType)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", fixture.Status, http.StatusText(fixture.Status)),
+		StatusCode:    fixture.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(fixture.Body)),
+		ContentLength: int64(len(fixture.Body)),
+		Request:       req,
+	}
+}
+
+func LoadFixture(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var fixture Fixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, err
+	}
+	return &fixture, nil
+}
+
+func parseFixture(fixture *Fixture) ([]YouTubeTrack, error) {
+	body := []byte(fixture.Body)
+	switch {
+	case strings.HasSuffix(fixture.Url, "/player") || strings.Contains(fixture.Url, "/player?"):
+		var resp YouTubePlayerResponse
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return nil, err
+		}
+		return []YouTubeTrack{resp.VideoDetails.ToYouTubeTrack()}, nil
+	case bytes.Contains(body, []byte("tabbedSearchResultsRenderer")):
+		return parseYouTubeMusicSearchResults(body)
+	case bytes.Contains(body, []byte("twoColumnSearchResultsRenderer")):
+		return parseYouTubeSearchResults(body)
+	// the same next response answers mix and related requests, the mix asks for a playlist
+	case strings.Contains(fixture.Url, "/next") && strings.Contains(fixture.RequestBody, `"playlistId"`):
+		_, tracks, err := parseMixPage(body)
+		return tracks, err
+	case strings.Contains(fixture.Url, "/next"):
+		return parseRelatedVideos(body)
+	case strings.Contains(fixture.Url, "/browse") && bytes.Contains(body, []byte("onResponseReceivedActions")):
+		tracks, _, err := parsePlaylistContinuation(body)
+		return tracks, err
+	case strings.Contains(fixture.Url, "/browse"):
+		playlist, _, err := parsePlaylistPage(body)
+		if err != nil {
+			return nil, err
+		}
+		return playlist.Tracks, nil
+	}
+	return nil, fmt.Errorf("no parser for fixture of %s", fixture.Url)
+}
+
+// RunParseFixtures runs the response parsers against recorded fixtures so
+// layout changes can be checked without hitting YouTube.
+func RunParseFixtures(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: parse <fixture.json|dir>...")
+	}
+
+	var paths []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			paths = append(paths, arg)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(arg, "*.json"))
+		if err != nil {
+			return err
+		}
+		paths = append(paths, matches...)
+	}
+
+	failed := 0
+	for _, path := range paths {
+		fixture, err := LoadFixture(path)
+		if err != nil {
+			return fmt.Errorf("failed to load fixture %s: %w", path, err)
+		}
+		if strings.HasSuffix(strings.SplitN(fixture.Url, "?", 2)[0], "/") {
+			// homepage captures only feed the visitor context
+			continue
+		}
+		tracks, err := parseFixture(fixture)
+		switch {
+		case err != nil:
+			failed++
+			fmt.Printf("FAIL %s: %v\n", path, err)
+		case len(tracks) == 0:
+			failed++
+			fmt.Printf("FAIL %s: no tracks parsed\n", path)
+		default:
+			fmt.Printf("ok   %s: %d tracks\n", path, len(tracks))
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d fixtures failed to parse", failed, len(paths))
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+)
+
+// parserCase runs a parser against a fixture recorded under testdata/fixtures
+// and checks what it made of the first track
+type parserCase struct {
+	fixture    string
+	parse      func(body []byte) ([]YouTubeTrack, error)
+	tracks     int
+	identifier string
+	title      string
+	lengthMs   int
+}
+
+func loadTestFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	fixture, err := LoadFixture(filepath.Join("testdata", "fixtures", name))
+	if err != nil {
+		t.Fatalf("failed to load fixture %s: %v", name, err)
+	}
+	if fixture.Status != 200 {
+		t.Fatalf("fixture %s was recorded with status %d", name, fixture.Status)
+	}
+	return []byte(fixture.Body)
+}
+
+func runParserCases(t *testing.T, cases []parserCase) {
+	for _, tc := range cases {
+		t.Run(tc.fixture, func(t *testing.T) {
+			tracks, err := tc.parse(loadTestFixture(t, tc.fixture))
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			if len(tracks) != tc.tracks {
+				t.Fatalf("got %d tracks, want %d", len(tracks), tc.tracks)
+			}
+			first := tracks[0]
+			if first.Identifier != tc.identifier {
+				t.Errorf("identifier = %q, want %q", first.Identifier, tc.identifier)
+			}
+			if first.Title != tc.title {
+				t.Errorf("title = %q, want %q", first.Title, tc.title)
+			}
+			if tc.lengthMs != 0 && first.Length != tc.lengthMs {
+				t.Errorf("length = %d, want %d", first.Length, tc.lengthMs)
+			}
+			for i, track := range tracks {
+				if track.Identifier == "" || track.Title == "" {
+					t.Errorf("track %d has no identifier or title: %+v", i, track)
+				}
+			}
+		})
+	}
+}
+
+func TestParseSearch(t *testing.T) {
+	runParserCases(t, []parserCase{
+		{
+			fixture:    "search_youtube.json",
+			parse:      parseYouTubeSearchResults,
+			tracks:     6,
+			identifier: "jfKfPfyJRdk",
+			title:      "lofi hip hop radio - beats to relax/study to",
+		},
+		{
+			fixture:    "search_music.json",
+			parse:      parseYouTubeMusicSearchResults,
+			tracks:     2,
+			identifier: "lYBUbBu4W08",
+			title:      "Never Gonna Give You Up",
+			lengthMs:   214000,
+		},
+	})
+}
+
+func TestParsePlaylist(t *testing.T) {
+	runParserCases(t, []parserCase{
+		{
+			fixture: "playlist.json",
+			parse: func(body []byte) ([]YouTubeTrack, error) {
+				playlist, continuation, err := parsePlaylistPage(body)
+				if err != nil {
+					return nil, err
+				}
+				if playlist.Title != "Mock Playlist" {
+					t.Errorf("playlist title = %q", playlist.Title)
+				}
+				if continuation == "" {
+					t.Error("first page lost its continuation")
+				}
+				return playlist.Tracks, nil
+			},
+			tracks:     2,
+			identifier: "dQw4w9WgXcQ",
+			title:      "Never Gonna Give You Up",
+		},
+		{
+			fixture: "playlist_continuation.json",
+			parse: func(body []byte) ([]YouTubeTrack, error) {
+				tracks, _, err := parsePlaylistContinuation(body)
+				return tracks, err
+			},
+			tracks:     1,
+			identifier: "kJQP7kiw5Fk",
+			title:      "Despacito",
+		},
+	})
+}
+
+func TestParsePlayer(t *testing.T) {
+	runParserCases(t, []parserCase{
+		{
+			fixture: "player.json",
+			parse: func(body []byte) ([]YouTubeTrack, error) {
+				var resp YouTubePlayerResponse
+				if err := json.Unmarshal(body, &resp); err != nil {
+					return nil, err
+				}
+				return []YouTubeTrack{resp.VideoDetails.ToYouTubeTrack()}, nil
+			},
+			tracks:     1,
+			identifier: "dQw4w9WgXcQ",
+			title:      "Mock video dQw4w9WgXcQ",
+			lengthMs:   213000,
+		},
+	})
+}
+
+func TestParseNext(t *testing.T) {
+	runParserCases(t, []parserCase{
+		{
+			fixture:    "next_related.json",
+			parse:      parseRelatedVideos,
+			tracks:     2,
+			identifier: "yPYZpwSpKmA",
+			title:      "Rick Astley - Together Forever",
+		},
+		{
+			fixture: "next_mix.json",
+			parse: func(body []byte) ([]YouTubeTrack, error) {
+				title, tracks, err := parseMixPage(body)
+				if title != "Mix - Mock" {
+					t.Errorf("mix title = %q", title)
+				}
+				return tracks, err
+			},
+			tracks:     3,
+			identifier: "dQw4w9WgXcQ",
+			title:      "Never Gonna Give You Up",
+		},
+	})
+}
+
+func TestSanitizeFixtureBody(t *testing.T) {
+	for body, want := range map[string]string{
+		`{"visitorData": "CgtBQk"}`: `{"visitorData": "REDACTED"}`,
+		`"url": "https://rr1.googlevideo.com/videoplayback?expire=1&ip=203.0.113.7&id=o"`:                    `"url": "https://rr1.googlevideo.com/videoplayback?expire=1&ip=0.0.0.0&id=o"`,
+		`"url": "https://rr1.googlevideo.com/videoplayback?ip=2001:db8::1&expire=1"`:                         `"url": "https://rr1.googlevideo.com/videoplayback?ip=0.0.0.0&expire=1"`,
+		`"signatureCipher": "s=x&url=https%3A%2F%2Frr1.googlevideo.com%2Fv%3Fip%3D203.0.113.7%26expire%3D1"`: `"signatureCipher": "s=x&url=https%3A%2F%2Frr1.googlevideo.com%2Fv%3Fip%3D0.0.0.0%26expire%3D1"`,
+		`"url": "https://example.com/?zip=12345&ip=2001%3Adb8%3A%3A1%26expire"`:                              `"url": "https://example.com/?zip=12345&ip=0.0.0.0%26expire"`,
+	} {
+		if got := string(sanitizeFixtureBody([]byte(body))); got != want {
+			t.Errorf("sanitize(%s) = %s, want %s", body, got, want)
+		}
+	}
+}
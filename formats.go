@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+type StreamFormat struct {
+	Itag            int    `json:"itag"`
+	MimeType        string `json:"mime_type"`
+	Codecs          string `json:"codecs"`
+	Bitrate         int    `json:"bitrate"`
+	AverageBitrate  int    `json:"average_bitrate,omitempty"`
+	Width           int    `json:"width,omitempty"`
+	Height          int    `json:"height,omitempty"`
+	Fps             int    `json:"fps,omitempty"`
+	QualityLabel    string `json:"quality_label,omitempty"`
+	AudioQuality    string `json:"audio_quality,omitempty"`
+	AudioSampleRate int    `json:"audio_sample_rate,omitempty"`
+	AudioChannels   int    `json:"audio_channels,omitempty"`
+	ContentLength   int64  `json:"content_length"`
+	SizeEstimated   bool   `json:"size_estimated"`
+	DurationMs      int64  `json:"duration_ms"`
+	Adaptive        bool   `json:"adaptive"`
+	AudioOnly       bool   `json:"audio_only"`
+	Ciphered        bool   `json:"ciphered"`
+	InitRange       string `json:"init_range,omitempty"`
+	IndexRange      string `json:"index_range,omitempty"`
+	Url             string `json:"url,omitempty"`
+	// Throttled urls carry an n parameter that was not transformed, they play
+	// but youtube limits their download speed
+	Throttled bool `json:"throttled,omitempty"`
+}
+
+type StreamFormats struct {
+	VideoId          string         `json:"video_id"`
+	ExpiresInSeconds int            `json:"expires_in_seconds"`
+	HasAudioOnly     bool           `json:"has_audio_only"`
+	HlsManifestUrl   string         `json:"hls_manifest_url,omitempty"`
+	Formats          []StreamFormat `json:"formats"`
+}
+
+// byteRange formats a {start, end} range of a format as start-end
+func byteRange(value gjson.Result) string {
+	if !value.Exists() {
+		return ""
+	}
+	return value.Get("start").String() + "-" + value.Get("end").String()
+}
+
+func parseStreamFormat(format gjson.Result, adaptive bool) StreamFormat {
+	mimeType, codecs, _ := strings.Cut(format.Get("mimeType").String(), ";")
+	codecs = strings.Trim(strings.TrimPrefix(strings.TrimSpace(codecs), "codecs="), `"`)
+
+	parsed := StreamFormat{
+		Itag:            int(format.Get("itag").Int()),
+		MimeType:        mimeType,
+		Codecs:          codecs,
+		Bitrate:         int(format.Get("bitrate").Int()),
+		AverageBitrate:  int(format.Get("averageBitrate").Int()),
+		Width:           int(format.Get("width").Int()),
+		Height:          int(format.Get("height").Int()),
+		Fps:             int(format.Get("fps").Int()),
+		QualityLabel:    format.Get("qualityLabel").String(),
+		AudioQuality:    format.Get("audioQuality").String(),
+		AudioSampleRate: int(format.Get("audioSampleRate").Int()),
+		AudioChannels:   int(format.Get("audioChannels").Int()),
+		ContentLength:   format.Get("contentLength").Int(),
+		DurationMs:      format.Get("approxDurationMs").Int(),
+		Adaptive:        adaptive,
+		AudioOnly:       strings.HasPrefix(mimeType, "audio/"),
+		Ciphered:        !format.Get("url").Exists(),
+		InitRange:       byteRange(format.Get("initRange")),
+		IndexRange:      byteRange(format.Get("indexRange")),
+	}
+
+	if parsed.ContentLength == 0 && parsed.DurationMs > 0 {
+		bitrate := parsed.AverageBitrate
+		if bitrate == 0 {
+			bitrate = parsed.Bitrate
+		}
+		parsed.ContentLength = int64(bitrate) * parsed.DurationMs / 8000
+		parsed.SizeEstimated = true
+	}
+	return parsed
+}
+
+// withStreamUrl fills in the playable url of a format. The n parameter stays
+// as it is: solving it means running the player's generated javascript, which
+// needs a javascript engine, so such urls are only flagged as throttled.
+func (parsed *StreamFormat) withStreamUrl(format gjson.Result, script *PlayerScript) error {
+	streamUrl, err := script.streamUrl(format.Get("url").String(), format.Get("signatureCipher").String())
+	if err != nil {
+		return err
+	}
+	parsed.Url = streamUrl
+	if parsedUrl, err := url.Parse(streamUrl); err == nil {
+		parsed.Throttled = parsedUrl.Query().Has("n")
+	}
+	return nil
+}
+
+// parseStreamFormats parses the formats of a player response, with a player
+// script the formats also carry their playable urls
+func parseStreamFormats(data []byte, script *PlayerScript) (*StreamFormats, error) {
+	if status := gjson.GetBytes(data, "playabilityStatus.status").String(); status != "OK" {
+		return nil, fmt.Errorf(
+			"video is not playable: %s",
+			gjson.GetBytes(data, "playabilityStatus.reason").String(),
+		)
+	}
+
+	streamingData := gjson.GetBytes(data, "streamingData")
+	if !streamingData.Exists() {
+		err := newParseError("streamingData", "missing", "")
+		recordParseFailure("player", err, data)
+		return nil, err
+	}
+
+	formats := &StreamFormats{
+		VideoId:          gjson.GetBytes(data, "videoDetails.videoId").String(),
+		ExpiresInSeconds: int(streamingData.Get("expiresInSeconds").Int()),
+		HlsManifestUrl:   streamingData.Get("hlsManifestUrl").String(),
+		Formats:          make([]StreamFormat, 0),
+	}
+	add := func(format gjson.Result, adaptive bool) {
+		parsed := parseStreamFormat(format, adaptive)
+		if script != nil {
+			if err := parsed.withStreamUrl(format, script); err != nil {
+				recordParseFailure("player", newParseError("signatureCipher", "invalid", err.Error()), data)
+			}
+		}
+		formats.HasAudioOnly = formats.HasAudioOnly || parsed.AudioOnly
+		formats.Formats = append(formats.Formats, parsed)
+	}
+	for _, format := range streamingData.Get("formats").Array() {
+		add(format, false)
+	}
+	for _, format := range streamingData.Get("adaptiveFormats").Array() {
+		add(format, true)
+	}
+	return formats, nil
+}
+
+// LoadStreamFormats lists the formats of a video, with playable set the
+// player script is loaded first so every format gets a url that plays
+func (srv *Server) LoadStreamFormats(ctx context.Context, videoId string, playable bool) (*StreamFormats, error) {
+	if !playable {
+		respBody, err := srv.playerRequest(ctx, videoId)
+		if err != nil {
+			return nil, err
+		}
+		return parseStreamFormats(respBody, nil)
+	}
+
+	script, err := srv.LoadPlayerScript(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load player script: %w", err)
+	}
+	respBody, err := srv.playerRequestWithTimestamp(ctx, videoId, script.SignatureTimestamp)
+	if err != nil {
+		return nil, err
+	}
+	return parseStreamFormats(respBody, script)
+}
+
+func (srv *Server) MakeFormatsHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		videoId := strings.TrimSpace(req.FormValue("videoId"))
+		if !DirectVideoIDPattern.MatchString(videoId) {
+			writeError(writer, http.StatusBadRequest, "a valid videoId parameter is required")
+			return
+		}
+
+		// stream urls expire within hours, so formats are never cached, here
+		// or by clients
+		formats, err := srv.LoadStreamFormats(req.Context(), videoId, req.FormValue("playable") == "true")
+		if err != nil {
+			writeError(
+				writer,
+				http.StatusInternalServerError,
+				fmt.Sprintf("Error loading formats: %v", err),
+			)
+			return
+		}
+		srv.writeJSON(writer, req, formats, CacheStatus{NoStore: true})
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFormatsAreNotStored(t *testing.T) {
+	srv := newMockServer(t, "")
+	for _, target := range []string{
+		"/api/youtube/formats?videoId=dQw4w9WgXcQ",
+		"/api/youtube/formats?videoId=dQw4w9WgXcQ&playable=true",
+	} {
+		recorder := serve(srv.MakeFormatsHandler(), httptest.NewRequest(http.MethodGet, target, nil))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("%s = %d %s", target, recorder.Code, recorder.Body)
+		}
+		if cacheControl := recorder.Header().Get("Cache-Control"); cacheControl != "no-store" {
+			t.Errorf("%s Cache-Control = %q, want no-store", target, cacheControl)
+		}
+	}
+}
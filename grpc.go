@@ -0,0 +1,473 @@
+package main
+
+//go:generate sh -c "cd proto && protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative youtubesearch.proto"
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+
+	youtubesearchpb "youtubesearchapi/proto"
+)
+
+type GrpcConfig struct {
+	// Addr is the listener of the gRPC service, empty leaves the service off
+	Addr string `yaml:"addr"`
+	// Reflection lets clients like grpcurl list the service and its messages
+	Reflection bool `yaml:"reflection"`
+}
+
+// grpcEndpoints are the HTTP endpoints the methods stand for, the allowed
+// endpoints of a tenant are matched against them
+var grpcEndpoints = map[string]string{
+	youtubesearchpb.YouTubeSearch_Search_FullMethodName:         "/api/youtube/search",
+	youtubesearchpb.YouTubeSearch_GetVideo_FullMethodName:       "/api/youtube/search",
+	youtubesearchpb.YouTubeSearch_GetPlaylist_FullMethodName:    "/api/youtube/playlist",
+	youtubesearchpb.YouTubeSearch_StreamPlaylist_FullMethodName: "/api/youtube/playlist/stream",
+}
+
+func grpcEndpoint(method string, req any) string {
+	if search, ok := req.(*youtubesearchpb.SearchRequest); ok &&
+		search.GetSource() == youtubesearchpb.SearchSource_SEARCH_SOURCE_YOUTUBE_MUSIC {
+		return "/api/youtubemusic/search"
+	}
+	return grpcEndpoints[method]
+}
+
+func grpcApiKey(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if keys := md.Get("x-api-key"); len(keys) > 0 && keys[0] != "" {
+		return keys[0]
+	}
+	if auth := md.Get("authorization"); len(auth) > 0 && strings.HasPrefix(auth[0], "Bearer ") {
+		return strings.TrimPrefix(auth[0], "Bearer ")
+	}
+	return ""
+}
+
+// setGrpcHeader sends the rate limit and quota headers as header metadata
+func setGrpcHeader(ctx context.Context, header http.Header) {
+	md := metadata.MD{}
+	for name, values := range header {
+		md.Set(strings.ToLower(name), values...)
+	}
+	if len(md) > 0 {
+		_ = grpc.SetHeader(ctx, md)
+	}
+}
+
+// grpcAuthorize does for a gRPC call what RequestContext, Maintenance and
+// TenantAuth do for an /api request. done records the usage of the call and
+// frees its concurrency slot once the call returns.
+func (srv *Server) grpcAuthorize(ctx context.Context, method string, endpoint string) (context.Context, func(), error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var clientId string
+	if ids := md.Get("x-request-id"); len(ids) > 0 {
+		clientId = ids[0]
+	}
+	info := &RequestInfo{
+		Id:        requestId(clientId),
+		Route:     method,
+		startedAt: time.Now(),
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		host, _, err := net.SplitHostPort(p.Addr.String())
+		if err != nil {
+			host = p.Addr.String()
+		}
+		info.Source = host
+	}
+	logger := slog.Default().With(
+		"request_id", info.Id,
+		"route", info.Route,
+		"source", info.Source,
+	)
+	ctx = context.WithValue(withLogger(ctx, logger), RequestInfoContextKey, info)
+	_ = grpc.SetHeader(ctx, metadata.Pairs("x-request-id", info.Id))
+
+	if state := srv.maintenance.Load(); state != nil && state.Enabled {
+		message := state.Message
+		if message == "" {
+			message = "service is under maintenance"
+		}
+		return nil, nil, status.Error(codes.Unavailable, message)
+	}
+
+	header := http.Header{}
+	defer setGrpcHeader(ctx, header)
+	key := grpcApiKey(ctx)
+	if srv.tenants == nil || (key == "" && srv.Cfg.Auth.AllowAnonymous) {
+		if srv.anonymousLimiter != nil {
+			limit := srv.anonymousLimiter.Take(clientBucketKey(info.Source, srv.Cfg.AnonymousRateLimit.Ipv6Prefix))
+			limit.WriteHeaders(header)
+			if !limit.Allowed {
+				return nil, nil, status.Error(codes.ResourceExhausted, "rate limit exceeded")
+			}
+		}
+		return ctx, func() {}, nil
+	}
+	if key == "" {
+		return nil, nil, status.Error(codes.Unauthenticated, errMissingApiKey.Error())
+	}
+	tenant := srv.tenants.Lookup(key)
+	if tenant == nil {
+		return nil, nil, status.Error(codes.Unauthenticated, "invalid api key")
+	}
+	if !tenant.Allows(endpoint) {
+		return nil, nil, status.Error(codes.PermissionDenied, "endpoint not allowed for this api key")
+	}
+	if tenant.limiter != nil {
+		limit := tenant.limiter.Take()
+		limit.WriteHeaders(header)
+		if !limit.Allowed {
+			return nil, nil, status.Error(codes.ResourceExhausted, "rate limit exceeded")
+		}
+	}
+
+	release := func() {}
+	if tenant.inFlight != nil {
+		if !tenant.inFlight.Acquire(ctx) {
+			return nil, nil, status.Error(codes.ResourceExhausted, "too many concurrent requests for this api key")
+		}
+		release = tenant.inFlight.Release
+	}
+	if !srv.reserveRequest(ctx, header, tenant) {
+		release()
+		return nil, nil, status.Error(codes.ResourceExhausted, "quota exceeded")
+	}
+
+	info.Tenant = tenant.Name
+	var upstreamCalls atomic.Int64
+	ctx = withUpstreamCounter(context.WithValue(ctx, TenantContextKey, tenant), &upstreamCalls)
+	ctx = withLogger(ctx, LoggerFromContext(ctx).With("tenant", tenant.Name))
+	done := func() {
+		release()
+		srv.recordUsage(context.WithoutCancel(ctx), tenant, upstreamCalls.Load())
+	}
+	return ctx, done, nil
+}
+
+func logGrpcCall(ctx context.Context, err error) {
+	duration := time.Duration(0)
+	if info := RequestInfoFromContext(ctx); info != nil {
+		duration = time.Since(info.startedAt)
+	}
+	LoggerFromContext(ctx).Info("gRPC call", "code", status.Code(err).String(), "duration", duration)
+}
+
+func (srv *Server) grpcUnaryAuth(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	ctx, done, err := srv.grpcAuthorize(ctx, info.FullMethod, grpcEndpoint(info.FullMethod, req))
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	resp, err := handler(ctx, req)
+	logGrpcCall(ctx, err)
+	return resp, err
+}
+
+// grpcContextStream hands the context of the call to a stream handler
+type grpcContextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (stream *grpcContextStream) Context() context.Context {
+	return stream.ctx
+}
+
+func (srv *Server) grpcStreamAuth(
+	service any,
+	stream grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	ctx, done, err := srv.grpcAuthorize(stream.Context(), info.FullMethod, grpcEndpoint(info.FullMethod, nil))
+	if err != nil {
+		return err
+	}
+	defer done()
+	err = handler(service, &grpcContextStream{ServerStream: stream, ctx: ctx})
+	logGrpcCall(ctx, err)
+	return err
+}
+
+// grpcError turns the error of a load into a status, failures of YouTube are
+// internal ones
+func grpcError(ctx context.Context, message string, err error) error {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+	LoggerFromContext(ctx).Error(message, "error", err)
+	return status.Errorf(codes.Internal, "%s: %v", message, err)
+}
+
+func toProtoTrack(track YouTubeTrack) *youtubesearchpb.Track {
+	converted := &youtubesearchpb.Track{
+		Identifier:    track.Identifier,
+		Title:         track.Title,
+		Author:        track.Author,
+		Images:        make([]*youtubesearchpb.Thumbnail, 0, len(track.Images)),
+		LengthMs:      int64(track.Length),
+		LengthText:    track.LengthText,
+		Uri:           track.Uri,
+		Type:          track.Type,
+		Views:         track.Views,
+		ChannelId:     track.ChannelId,
+		IsLive:        track.IsLive,
+		IsUpcoming:    track.IsUpcoming,
+		MusicbrainzId: track.MusicBrainzId,
+		Encoded:       encodedTrack(track, ""),
+	}
+	for _, image := range track.Images {
+		converted.Images = append(converted.Images, &youtubesearchpb.Thumbnail{
+			Url:    image.Url,
+			Width:  int32(image.Width),
+			Height: int32(image.Height),
+		})
+	}
+	for _, artist := range track.Artists {
+		converted.Artists = append(converted.Artists, &youtubesearchpb.Artist{Name: artist.Name, ChannelId: artist.ChannelId})
+	}
+	if track.Album != nil {
+		converted.Album = &youtubesearchpb.Album{Name: track.Album.Name, BrowseId: track.Album.BrowseId}
+	}
+	return converted
+}
+
+func toProtoTracks(tracks []YouTubeTrack) []*youtubesearchpb.Track {
+	converted := make([]*youtubesearchpb.Track, 0, len(tracks))
+	for _, track := range tracks {
+		converted = append(converted, toProtoTrack(track))
+	}
+	return converted
+}
+
+// grpcService serves the YouTubeSearch service of proto/youtubesearch.proto
+// with the loads behind the HTTP endpoints, sharing their cache entries
+type grpcService struct {
+	youtubesearchpb.UnimplementedYouTubeSearchServer
+	srv *Server
+}
+
+func (service *grpcService) Search(
+	ctx context.Context,
+	req *youtubesearchpb.SearchRequest,
+) (*youtubesearchpb.SearchResponse, error) {
+	srv := service.srv
+	query := strings.TrimSpace(req.GetQuery())
+	if query == "" {
+		return nil, status.Error(codes.InvalidArgument, "query is required")
+	}
+	var searchType SearchType
+	switch req.GetSource() {
+	case youtubesearchpb.SearchSource_SEARCH_SOURCE_YOUTUBE:
+		searchType = SearchTypeYouTube
+	case youtubesearchpb.SearchSource_SEARCH_SOURCE_YOUTUBE_MUSIC:
+		searchType = SearchTypeYouTubeMusic
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown source %d", req.GetSource())
+	}
+	if req.GetLimit() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "limit must be a positive integer")
+	}
+
+	opts := srv.defaultSearchOptions()
+	opts.Exact = req.GetExact()
+	if req.SafeSearch != nil {
+		opts.SafeSearch = req.GetSafeSearch()
+	}
+	if req.GetLimit() > 0 {
+		opts.Limit = min(int(req.GetLimit()), srv.Cfg.Search.MaxResults)
+	}
+
+	tracks, correction, _, err := srv.searchFromYouTube(ctx, searchType, query, opts)
+	if err != nil {
+		return nil, grpcError(ctx, "Error searching YouTube", err)
+	}
+	tracks = limitResults(rerankTracks(ctx, tracks, query), opts.Limit)
+	resp := &youtubesearchpb.SearchResponse{
+		Tracks: toProtoTracks(applyTenantFilters(ctx, tracks).([]YouTubeTrack)),
+	}
+	if correction != nil {
+		resp.CorrectedQuery = correction.Query
+		resp.CorrectionApplied = correction.Applied
+	}
+	return resp, nil
+}
+
+func (service *grpcService) GetVideo(
+	ctx context.Context,
+	req *youtubesearchpb.GetVideoRequest,
+) (*youtubesearchpb.Track, error) {
+	match := DirectVideoIDPattern.FindStringSubmatch(strings.TrimSpace(req.GetVideoId()))
+	if match == nil {
+		return nil, status.Error(codes.InvalidArgument, "video_id must be a YouTube video id or url")
+	}
+	videoId := match[1][:min(len(match[1]), 11)]
+
+	track, _, err := service.srv.loadVideoCached(ctx, videoId)
+	if err != nil {
+		return nil, grpcError(ctx, "Error loading video metadata", err)
+	}
+	tracks := applyTenantFilters(ctx, []YouTubeTrack{track}).([]YouTubeTrack)
+	if len(tracks) == 0 {
+		return nil, status.Error(codes.NotFound, "video is filtered out for this api key")
+	}
+	return toProtoTrack(tracks[0]), nil
+}
+
+// grpcPlaylistRequest reads the playlist id and track limit of a request
+func (srv *Server) grpcPlaylistRequest(req *youtubesearchpb.GetPlaylistRequest) (string, int, error) {
+	playlistId, err := parsePlaylistId(req.GetId())
+	if err != nil {
+		return "", 0, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if req.GetLimit() < 0 {
+		return "", 0, status.Error(codes.InvalidArgument, "limit must be a positive integer")
+	}
+	maxTracks := srv.Cfg.Playlist.MaxTracks
+	if req.GetLimit() > 0 {
+		maxTracks = min(int(req.GetLimit()), maxTracks)
+	}
+	return playlistId, maxTracks, nil
+}
+
+func toProtoPlaylist(playlist *YouTubePlaylist, tracks []YouTubeTrack) *youtubesearchpb.Playlist {
+	return &youtubesearchpb.Playlist{
+		Identifier: playlist.Identifier,
+		Title:      playlist.Title,
+		Author:     playlist.Author,
+		Uri:        playlist.Uri,
+		TotalCount: int32(playlist.TotalCount),
+		Truncated:  playlist.Truncated,
+		Tracks:     toProtoTracks(tracks),
+	}
+}
+
+func (service *grpcService) GetPlaylist(
+	ctx context.Context,
+	req *youtubesearchpb.GetPlaylistRequest,
+) (*youtubesearchpb.Playlist, error) {
+	playlistId, maxTracks, err := service.srv.grpcPlaylistRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	playlist, _, err := service.srv.loadPlaylistCached(ctx, playlistId, maxTracks)
+	if err != nil {
+		return nil, grpcError(ctx, "Error loading playlist", err)
+	}
+	return toProtoPlaylist(playlist, applyTenantFilters(ctx, playlist.Tracks).([]YouTubeTrack)), nil
+}
+
+// StreamPlaylist sends the tracks of each page as it loads, a cached playlist
+// is sent at once
+func (service *grpcService) StreamPlaylist(
+	req *youtubesearchpb.GetPlaylistRequest,
+	stream grpc.ServerStreamingServer[youtubesearchpb.Track],
+) error {
+	srv := service.srv
+	ctx := stream.Context()
+	playlistId, maxTracks, err := srv.grpcPlaylistRequest(req)
+	if err != nil {
+		return err
+	}
+	send := func(tracks []YouTubeTrack) error {
+		for _, track := range applyTenantFilters(ctx, tracks).([]YouTubeTrack) {
+			if err := stream.Send(toProtoTrack(track)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// shares its cache entries with the playlist endpoints
+	cacheKey := fmt.Sprintf("playlist:%s:%d", playlistId, maxTracks)
+	if srv.db != nil {
+		entry, err := srv.LookupCache(ctx, cacheKey)
+		if err != nil {
+			LoggerFromContext(ctx).Error("Failed to lookup cache for playlist", "error", err)
+		} else if entry != nil {
+			var playlist YouTubePlaylist
+			if err := json.Unmarshal(entry.Value, &playlist); err != nil {
+				LoggerFromContext(ctx).Error("Failed to unmarshal cached playlist", "error", err)
+			} else {
+				return send(playlist.Tracks)
+			}
+		}
+	}
+
+	playlist, err := srv.loadPlaylistPages(ctx, playlistId, maxTracks, func(_ *YouTubePlaylist, tracks []YouTubeTrack) error {
+		return send(tracks)
+	})
+	if err != nil {
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		return grpcError(ctx, "Error loading playlist", err)
+	}
+	if srv.db != nil && len(playlist.Tracks) > 0 {
+		if err := srv.StoreCache(ctx, cacheKey, playlist); err != nil {
+			LoggerFromContext(ctx).Error("Failed to store playlist in cache", "error", err)
+		}
+	}
+	return nil
+}
+
+// startGrpc serves the gRPC service on its own listener
+func (srv *Server) startGrpc() {
+	listener, err := net.Listen("tcp", srv.Cfg.Grpc.Addr)
+	if err != nil {
+		panic(err)
+	}
+	srv.grpcSrv = grpc.NewServer(
+		grpc.ChainUnaryInterceptor(srv.grpcUnaryAuth),
+		grpc.ChainStreamInterceptor(srv.grpcStreamAuth),
+	)
+	youtubesearchpb.RegisterYouTubeSearchServer(srv.grpcSrv, &grpcService{srv: srv})
+	if srv.Cfg.Grpc.Reflection {
+		reflection.Register(srv.grpcSrv)
+	}
+	go func() {
+		if err := srv.grpcSrv.Serve(listener); err != nil {
+			panic(err)
+		}
+	}()
+}
+
+// stopGrpc lets the calls in flight finish, streams still running when ctx
+// ends are cut off
+func (srv *Server) stopGrpc(ctx context.Context) {
+	stopped := make(chan struct{})
+	go func() {
+		srv.grpcSrv.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		srv.grpcSrv.Stop()
+	}
+}
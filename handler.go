@@ -1,15 +1,14 @@
 package main
 
 import (
-	"bytes"
+	"cmp"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log/slog"
 	"net/http"
-	"os"
 	"regexp"
+	"strconv"
 	"strings"
 	"unicode/utf8"
 )
@@ -32,11 +31,12 @@ var isrcPattern = regexp.MustCompile(`^[A-Z]{2}[A-Z0-9]{3}[0-9]{2}[0-9]{5}$`)
 
 const (
 	VideoIDRegex    = `(?P<v>[a-zA-Z0-9_-]{11})`
-	PlaylistIDRegex = `(?P<list>(PL|UU)[a-zA-Z0-9_-]+)`
+	PlaylistIDRegex = `(?P<list>(PL|UU|OLAK5uy_|RDCLAK5uy_)[a-zA-Z0-9_-]+)`
 )
 
 var (
-	DirectVideoIDPattern = regexp.MustCompile("^" + VideoIDRegex + "$")
+	DirectVideoIDPattern    = regexp.MustCompile("^" + VideoIDRegex + "$")
+	DirectPlaylistIDPattern = regexp.MustCompile("^" + PlaylistIDRegex + "$")
 )
 
 const YT_VIDEO_FILTER_PARAM = "EgWKAQIQAWoQEAMQBRAEEAkQChAVEBAQEQ%3D%3D"
@@ -49,100 +49,155 @@ func (srv *Server) MakeSearchHandler(searchType SearchType) http.HandlerFunc {
 	return func(writer http.ResponseWriter, req *http.Request) {
 		query := req.FormValue("query")
 		if strings.TrimSpace(query) == "" {
-			http.Error(writer, "query parameter is required", http.StatusBadRequest)
+			writeError(writer, http.StatusBadRequest, "query parameter is required")
 			return
 		}
 
+		scoreRef, err := parseScoreReference(req, query)
+		if err != nil {
+			writeError(writer, http.StatusBadRequest, err.Error())
+			return
+		}
+		opts, validationErr := parseSearchOptions(req, srv.Cfg.Search)
+		if validationErr != nil {
+			writeValidationError(writer, validationErr)
+			return
+		}
+		if param := opts.youtubeOnlyParam(); param != "" && searchType == SearchTypeYouTubeMusic {
+			writeValidationError(writer, &ValidationError{
+				Code:    "unsupported_param",
+				Param:   param,
+				Message: param + " is only supported by the YouTube search",
+			})
+			return
+		}
+		if param := opts.musicOnlyParam(); param != "" && searchType == SearchTypeYouTube {
+			writeValidationError(writer, &ValidationError{
+				Code:    "unsupported_param",
+				Param:   param,
+				Message: param + " is only supported by the YouTube Music search",
+			})
+			return
+		}
+
+		// text searches of a route profile add its query prefix and suffix
+		searchQuery := query
+		if profile := RouteProfileFromContext(req.Context()); profile != nil {
+			searchQuery = profile.Query(query)
+		}
+
 		if isrcPattern.MatchString(query) || strings.HasPrefix(strings.ToLower(query), "isrc:") {
 			if strings.HasPrefix(strings.ToLower(query), "isrc:") {
 				query = strings.TrimSpace(query[5:])
 			}
-			searchType = SearchTypeYouTubeMusic
+			hintMs := 0
+			if hint := req.FormValue("duration_ms"); hint != "" {
+				hintMs, err = strconv.Atoi(hint)
+				if err != nil || hintMs <= 0 {
+					writeError(writer, http.StatusBadRequest, "duration_ms must be a positive integer")
+					return
+				}
+			}
+			results, filter, cacheStatus, err := srv.searchISRC(req.Context(), strings.ToUpper(query), hintMs)
+			if err != nil {
+				writeError(
+					writer,
+					http.StatusInternalServerError,
+					fmt.Sprintf("Error searching YouTube: %v", err),
+				)
+				return
+			}
+			writer.Header().Set("X-Duration-Filter", filter.Header())
+			srv.writeJSON(writer, req, withScores(limitResults(results, opts.Limit), scoreRef), cacheStatus)
+			return
 		}
 
-		if DirectVideoIDPattern.MatchString(query) {
-			videoId := DirectVideoIDPattern.FindStringSubmatch(query)[1]
-			if utf8.RuneCountInString(videoId) > 11 {
-				videoId = videoId[:11]
+		types := req.FormValue("types")
+		if types == "" {
+			types = req.FormValue("type")
+		}
+		if searchType == SearchTypeYouTube && types != "" {
+			kinds, err := parseSearchKinds(types)
+			if err != nil {
+				writeError(writer, http.StatusBadRequest, err.Error())
+				return
 			}
-
-			slog.Info("Direct video ID detected", "videoId", videoId)
-
-			// Check cache for direct video ID
-			cacheKey := "video:" + videoId
-			if srv.db != nil {
-				cachedData, err := srv.LookupCache(req.Context(), cacheKey)
+			if len(kinds) > 0 {
+				items, correction, cacheStatus, err := srv.searchYouTubeKinds(
+					req.Context(),
+					searchQuery,
+					kinds,
+					opts,
+				)
 				if err != nil {
-					slog.Error("Failed to lookup cache for video ID", "error", err)
-				} else if cachedData != nil {
-					var result []YouTubeTrack
-					if err := json.Unmarshal(cachedData, &result); err != nil {
-						slog.Error("Failed to unmarshal cached video metadata", "error", err)
-					} else {
-						slog.Info("Returning cached video metadata", "videoId", videoId)
-						writer.Header().Set("Content-Type", "application/json")
-						if err := json.NewEncoder(writer).Encode(result); err != nil {
-							http.Error(
-								writer,
-								fmt.Sprintf("Error encoding response: %v", err),
-								http.StatusInternalServerError,
-							)
-						}
-						return
-					}
+					writeError(
+						writer,
+						http.StatusInternalServerError,
+						fmt.Sprintf("Error searching YouTube: %v", err),
+					)
+					return
 				}
+				correction.Header(writer.Header())
+				srv.writeJSON(writer, req, limitResults(items, opts.Limit), cacheStatus)
+				return
 			}
+		}
 
-			track, err := srv.LoadVideoMetadata(req.Context(), videoId)
-			if err != nil || track.Identifier == "" {
-				http.Error(
+		if searchType == SearchTypeYouTubeMusic && isMusicCollectionCategory(opts.Category) {
+			items, correction, cacheStatus, err := srv.searchMusicCollections(req.Context(), searchQuery, opts)
+			if err != nil {
+				writeError(
 					writer,
-					fmt.Sprintf("Error loading video metadata: %v", err),
 					http.StatusInternalServerError,
+					fmt.Sprintf("Error searching YouTube: %v", err),
 				)
 				return
 			}
+			correction.Header(writer.Header())
+			srv.writeJSON(writer, req, limitResults(items, opts.Limit), cacheStatus)
+			return
+		}
 
-			// Store in cache
-			if srv.db != nil {
-				if err := srv.StoreCache(req.Context(), cacheKey, []YouTubeTrack{track}); err != nil {
-					slog.Error("Failed to store video metadata in cache", "error", err)
-				}
+		if DirectVideoIDPattern.MatchString(query) {
+			videoId := DirectVideoIDPattern.FindStringSubmatch(query)[1]
+			if utf8.RuneCountInString(videoId) > 11 {
+				videoId = videoId[:11]
 			}
 
-			writer.Header().Set("Content-Type", "application/json")
-			if err := json.NewEncoder(writer).Encode([]YouTubeTrack{track}); err != nil {
-				http.Error(
+			LoggerFromContext(req.Context()).Info("Direct video ID detected", "videoId", videoId)
+
+			track, cacheStatus, err := srv.loadVideoCached(req.Context(), videoId)
+			if err != nil {
+				writeError(
 					writer,
-					fmt.Sprintf("Error encoding response: %v", err),
 					http.StatusInternalServerError,
+					fmt.Sprintf("Error loading video metadata: %v", err),
 				)
 				return
 			}
+			srv.writeJSON(writer, req, withScores([]YouTubeTrack{track}, scoreRef), cacheStatus)
 			return
 
 		}
 
-		results, err := srv.searchFromYouTube(req.Context(), searchType, query)
+		results, correction, cacheStatus, err := srv.searchFromYouTube(
+			req.Context(),
+			searchType,
+			searchQuery,
+			opts,
+		)
 		if err != nil {
-			http.Error(
+			writeError(
 				writer,
-				fmt.Sprintf("Error searching YouTube: %v", err),
-				http.StatusInternalServerError,
-			)
-			return
-		}
-
-		writer.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(writer).Encode(results); err != nil {
-			http.Error(
-				writer,
-				fmt.Sprintf("Error encoding response: %v", err),
 				http.StatusInternalServerError,
+				fmt.Sprintf("Error searching YouTube: %v", err),
 			)
 			return
 		}
 
+		results = limitResults(rerankTracks(req.Context(), results, query), opts.Limit)
+		correction.Header(writer.Header())
+		srv.writeJSON(writer, req, withScores(results, scoreRef), cacheStatus)
 	}
 }
 
@@ -154,35 +209,28 @@ func (srv *Server) fetchInnertubeContext(
 	if isYouTube {
 		url = YT_BASE_URL
 	}
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	resp, err := srv.client.Do(req)
+	resp, respBody, err := srv.fetchVisitorPage(ctx, url)
 	if err != nil {
-		return nil, fmt.Errorf("failed to perform request: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+	cookies := ""
+	if isConsentPage(resp, respBody) {
+		LoggerFromContext(ctx).Info("Visitor fetch hit a consent page", "url", resp.Request.URL.String())
+		cookies, err = srv.acceptConsent(ctx, respBody)
+		if err != nil {
+			return nil, fmt.Errorf("failed to pass consent page: %w", err)
+		}
+		_, respBody, err = srv.fetchVisitorPage(withVisitorCookie(ctx, cookies), url)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	matches := innertubeContextPattern.FindSubmatch(respBody)
 	if len(matches) < 2 {
-		file, err := os.Create("resp.html")
-		if err == nil {
-			defer file.Close()
-			_, err := file.Write(respBody)
-			if err != nil {
-				slog.Error("failed to dump response body", "error", err)
-			} else {
-				slog.Info("dumped problematic response to resp.html for analysis")
-			}
-		} else {
-			slog.Error("failed to create dump.txt for writing", "error", err)
+		if _, err := artifacts.Save("innertube_context", respBody); err != nil {
+			LoggerFromContext(ctx).Error("failed to dump response body", "error", err)
 		}
 		return nil, fmt.Errorf("failed to find INNERTUBE_CONTEXT in response")
 	}
@@ -193,17 +241,42 @@ func (srv *Server) fetchInnertubeContext(
 	if err := json.Unmarshal([]byte(contextString), &contextData); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal INNERTUBE_CONTEXT: %w", err)
 	}
-	return NewYouTubeVisitor(contextData, isYouTube), nil
+	visitor := NewYouTubeVisitor(contextData, isYouTube)
+	visitor.Cookies = cookies
+	return visitor, nil
 }
 
-func (srv *Server) LoadVideoMetadata(ctx context.Context, videoID string) (YouTubeTrack, error) {
-	visitor := srv.RandomVisitor(ctx, true)
+func (srv *Server) fetchVisitorPage(ctx context.Context, url string) (*http.Response, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create request: %w", err)
+	}
 
-	vCtx := context.WithValue(
-		ctx,
-		VisitorDataContextKey,
-		visitor.VisitorID(),
-	)
+	resp, err := srv.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to perform request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	return resp, respBody, nil
+}
+
+func (srv *Server) playerRequest(ctx context.Context, videoID string) ([]byte, error) {
+	return srv.playerRequestWithTimestamp(ctx, videoID, 0)
+}
+
+// playerRequestWithTimestamp passes the signature timestamp of the player
+// script, the deciphered stream urls are only valid for the player they were
+// asked for with
+func (srv *Server) playerRequestWithTimestamp(ctx context.Context, videoID string, signatureTimestamp int) ([]byte, error) {
+	visitor, err := srv.pickVisitor(ctx, true)
+	if err != nil {
+		return nil, err
+	}
 
 	clientContext := map[string]any{
 		"clientName":    "TVHTML5_SIMPLY",
@@ -218,138 +291,246 @@ func (srv *Server) LoadVideoMetadata(ctx context.Context, videoID string) (YouTu
 		"context": context,
 		"videoId": videoID,
 	}
-
-	reqBody, err := json.Marshal(payload)
-	if err != nil {
-		return YouTubeTrack{}, fmt.Errorf("failed to marshal video metadata payload: %w", err)
+	if signatureTimestamp > 0 {
+		payload["playbackContext"] = map[string]any{
+			"contentPlaybackContext": map[string]any{"signatureTimestamp": signatureTimestamp},
+		}
 	}
 
-	req, err := http.NewRequestWithContext(
-		vCtx,
-		http.MethodPost,
+	return srv.innertubeRequest(
+		ctx,
+		"video metadata",
 		YT_BASE_URL+"/youtubei/v1/player",
-		bytes.NewReader(reqBody),
+		visitor,
+		payload,
 	)
+}
+
+// loadEmbeddedMetadata asks the player as the embedded TV client, which
+// answers with the metadata of age restricted videos without a login
+func (srv *Server) loadEmbeddedMetadata(ctx context.Context, videoID string) (YouTubeTrack, error) {
+	if !srv.spendRetry(ctx, RetryEmbeddedPlayer) {
+		return YouTubeTrack{}, fmt.Errorf("retry budget used up")
+	}
+	visitor, err := srv.pickVisitor(ctx, true)
 	if err != nil {
-		return YouTubeTrack{}, fmt.Errorf("failed to create video metadata request: %w", err)
+		return YouTubeTrack{}, err
+	}
+	payload := map[string]any{
+		"context": map[string]any{
+			"client": map[string]any{
+				"clientName":    "TVHTML5_SIMPLY_EMBEDDED_PLAYER",
+				"clientVersion": "2.0",
+			},
+			"thirdParty": map[string]any{
+				"embedUrl": YT_BASE_URL + "/",
+			},
+		},
+		"videoId": videoID,
+	}
+	respBody, err := srv.innertubeRequest(ctx, "embedded video metadata", YT_BASE_URL+"/youtubei/v1/player", visitor, payload)
+	if err != nil {
+		return YouTubeTrack{}, err
 	}
 
-	resp, err := srv.client.Do(req)
+	var respdata YouTubePlayerResponse
+	if err := json.Unmarshal(respBody, &respdata); err != nil {
+		recordParseFailure("player", newParseError("response", "invalid_json", err.Error()), respBody)
+		recordParse(ctx, "embedded_player", 0, err)
+		return YouTubeTrack{}, fmt.Errorf("failed to unmarshal embedded video metadata response: %w", err)
+	}
+	track := respdata.VideoDetails.ToYouTubeTrack()
+	if track.Identifier == "" {
+		err := fmt.Errorf("embedded player returned no metadata: %v", respdata.PlaybilityStatus.Reason)
+		recordParse(ctx, "embedded_player", 0, err)
+		return YouTubeTrack{}, err
+	}
+	recordParse(ctx, "embedded_player", 1, nil)
+	track.AgeRestricted = true
+	return track, nil
+}
+
+// loadVideoCached loads the metadata of a video through the cache
+func (srv *Server) loadVideoCached(ctx context.Context, videoId string) (YouTubeTrack, CacheStatus, error) {
+	cacheKey := "video:" + videoId
+	if srv.db != nil {
+		entry, err := srv.LookupCache(ctx, cacheKey)
+		if err != nil {
+			LoggerFromContext(ctx).Error("Failed to lookup cache for video ID", "error", err)
+		} else if entry != nil {
+			var result []YouTubeTrack
+			if err := json.Unmarshal(entry.Value, &result); err != nil || len(result) == 0 {
+				LoggerFromContext(ctx).Error("Failed to unmarshal cached video metadata", "error", err)
+			} else {
+				LoggerFromContext(ctx).Info("Returning cached video metadata", "videoId", videoId)
+				return result[0], CacheStatus{Hit: true, StoredAt: entry.StoredAt, Video: true}, nil
+			}
+		}
+	}
+
+	track, err := srv.LoadVideoMetadata(ctx, videoId)
 	if err != nil {
-		return YouTubeTrack{}, fmt.Errorf("failed to perform video metadata request: %w", err)
+		return YouTubeTrack{}, CacheStatus{}, err
+	}
+	if track.Identifier == "" {
+		return YouTubeTrack{}, CacheStatus{}, fmt.Errorf("no metadata for video %s", videoId)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return YouTubeTrack{}, fmt.Errorf(
-			"video metadata request failed with status: %s",
-			resp.Status,
-		)
+	// Store in cache, live streams are not cached as their viewer count changes constantly
+	// and premieres as they go live soon
+	if srv.db != nil && !track.Partial && track.Live == nil && !track.IsUpcoming {
+		if err := srv.StoreCache(ctx, cacheKey, []YouTubeTrack{track}); err != nil {
+			LoggerFromContext(ctx).Error("Failed to store video metadata in cache", "error", err)
+		}
 	}
+	// partial metadata is looked up again soon, so it isn't kept for long either
+	return track, CacheStatus{Video: !track.Partial}, nil
+}
 
-	respBody, err := io.ReadAll(resp.Body)
+func (srv *Server) LoadVideoMetadata(ctx context.Context, videoID string) (YouTubeTrack, error) {
+	respBody, err := srv.playerRequest(ctx, videoID)
 	if err != nil {
-		return YouTubeTrack{}, fmt.Errorf("failed to read video metadata response body: %w", err)
+		return srv.loadOEmbedTrack(ctx, videoID, err)
 	}
 
 	var respdata YouTubePlayerResponse
 
 	if err := json.Unmarshal(respBody, &respdata); err != nil {
-		return YouTubeTrack{}, fmt.Errorf("failed to unmarshal video metadata response: %w", err)
+		recordParseFailure("player", newParseError("response", "invalid_json", err.Error()), respBody)
+		recordParse(ctx, "player", 0, err)
+		return srv.loadOEmbedTrack(
+			ctx,
+			videoID,
+			fmt.Errorf("failed to unmarshal video metadata response: %w", err),
+		)
 	}
 
 	track := respdata.VideoDetails.ToYouTubeTrack()
+	if track.Identifier != "" {
+		recordParse(ctx, "player", 1, nil)
+	} else {
+		recordParse(ctx, "player", 0, fmt.Errorf("%s: %s", respdata.PlaybilityStatus.Status, respdata.PlaybilityStatus.Reason))
+	}
+	if respdata.PlaybilityStatus.IsAgeGated() {
+		if track.Identifier != "" {
+			track.AgeRestricted = true
+			return track, nil
+		}
+		embedded, err := srv.loadEmbeddedMetadata(ctx, videoID)
+		if err == nil {
+			LoggerFromContext(ctx).Info("Loaded age restricted video through the embedded player", "videoId", videoID)
+			return embedded, nil
+		}
+		LoggerFromContext(ctx).Warn("Failed to load age restricted video", "videoId", videoID, "error", err)
+	}
+	if scheduled, upcoming := parseScheduledStart(respBody); upcoming {
+		if track.Identifier == "" {
+			track, _ = srv.loadOEmbedTrack(ctx, videoID, nil)
+			track.Identifier = videoID
+			track.Uri = YT_BASE_URL + "/watch?v=" + videoID
+			track.Partial = true
+		}
+		LoggerFromContext(ctx).Info("Video is an upcoming premiere", "videoId", videoID, "scheduled_start", scheduled)
+		track.IsLive = false
+		markUpcoming(&track, scheduled)
+		return track, nil
+	}
 	if track.Identifier == "" && respdata.PlaybilityStatus.Status != "OK" {
 		return YouTubeTrack{}, fmt.Errorf("failed to fetch metadata due to : %v", respdata.PlaybilityStatus.Reason)
 	}
+	if track.Live = parseLiveDetails(respBody); track.Live != nil {
+		track.IsLive = true
+		viewers, err := srv.loadConcurrentViewers(ctx, videoID)
+		if err != nil {
+			LoggerFromContext(ctx).Warn("Failed to load concurrent viewers", "videoId", videoID, "error", err)
+		}
+		track.Live.ConcurrentViewers = viewers
+	}
 	return track, nil
 }
 
+// searchFromYouTube runs a text search, the spelling correction YouTube made
+// or suggested is cached next to the results under the correction: prefix.
+// The results hold at least opts.Limit tracks if the search has that many,
+// cutting them down is up to the caller.
 func (srv *Server) searchFromYouTube(
 	ctx context.Context,
 	searchType SearchType,
 	query string,
-) ([]YouTubeTrack, error) {
+	opts SearchOptions,
+) ([]YouTubeTrack, *SpellingCorrection, CacheStatus, error) {
+	cacheKey := srv.createCacheKey(searchType, query, opts.cacheOptions())
 	if srv.db != nil {
-		cacheKey := srv.createCacheKey(searchType, query)
-		cachedData, err := srv.LookupCache(ctx, cacheKey)
+		entry, err := srv.LookupCache(ctx, cacheKey)
 		if err != nil {
-			slog.Error("Failed to lookup cache", "error", err)
-		} else if cachedData != nil {
+			LoggerFromContext(ctx).Error("Failed to lookup cache", "error", err)
+		} else if entry != nil {
 			var result []YouTubeTrack
-			if err := json.Unmarshal(cachedData, &result); err != nil {
-				slog.Error("Failed to unmarshal cached search results", "error", err)
+			if err := json.Unmarshal(entry.Value, &result); err != nil {
+				LoggerFromContext(ctx).Error("Failed to unmarshal cached search results", "error", err)
 			} else {
-				slog.Info("Returning cached search results", "key", cacheKey)
-				return result, nil
+				LoggerFromContext(ctx).Info("Returning cached search results", "key", cacheKey)
+				return result, srv.cachedCorrection(ctx, cacheKey), CacheStatus{Hit: true, StoredAt: entry.StoredAt}, nil
 			}
 		}
 	}
-	visitor := srv.RandomVisitor(ctx, searchType == SearchTypeYouTube)
-
-	vCtx := context.WithValue(
-		ctx,
-		VisitorDataContextKey,
-		visitor.VisitorID(),
-	)
+	visitor, err := srv.pickVisitor(ctx, searchType == SearchTypeYouTube)
+	if err != nil {
+		return nil, nil, CacheStatus{}, err
+	}
 
 	payload := map[string]any{
-		"context": visitor.Context,
+		"context": opts.innertubeContext(visitor.Context),
 		"query":   query,
 	}
 
 	if searchType == SearchTypeYouTubeMusic {
-		payload["params"] = YT_SONG_FILTER_PARAM
+		payload["params"] = opts.params(cmp.Or(musicCategoryParams[opts.Category], YT_SONG_FILTER_PARAM))
 	} else {
-		payload["params"] = YT_VIDEO_FILTER_PARAM
-	}
-
-	reqBody, err := json.Marshal(payload)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal search payload: %w", err)
+		payload["params"] = opts.params(YT_VIDEO_FILTER_PARAM)
 	}
 
-	req, err := http.NewRequestWithContext(
-		vCtx,
-		http.MethodPost,
-		INNERTUBE_SEARCH_API_URL,
-		bytes.NewReader(reqBody),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create search request: %w", err)
-	}
-
-	resp, err := srv.client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to perform search request: %w", err)
+	var parsed []YouTubeTrack
+	respBody, parseErr := srv.searchPages(ctx, searchType, visitor, payload, opts.Limit, func(page []byte) (int, error) {
+		var tracks []YouTubeTrack
+		var err error
+		switch searchType {
+		case SearchTypeYouTube:
+			tracks, err = parseYouTubeSearchResults(page)
+			if !opts.Extended {
+				for i := range tracks {
+					trimExtendedMetadata(&tracks[i])
+				}
+			}
+		case SearchTypeYouTubeMusic:
+			tracks, err = parseYouTubeMusicSearchResults(page)
+		}
+		parsed = append(parsed, tracks...)
+		return len(tracks), err
+	})
+	if respBody == nil {
+		return nil, nil, CacheStatus{}, parseErr
 	}
-	defer resp.Body.Close()
+	correction := parseSpellingCorrection(respBody)
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("search request failed with status: %s", resp.Status)
+	if searchType == SearchTypeYouTube {
+		recordParse(ctx, "youtube_search", len(parsed), parseErr)
+	} else {
+		recordParse(ctx, "youtubemusic_search", len(parsed), parseErr)
 	}
-
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read search response body: %w", err)
+	if parseErr == nil {
+		recordSearchResult(len(parsed))
 	}
-
-	var parsed []YouTubeTrack
-	var parseErr error
-
-	switch searchType {
-	case SearchTypeYouTube:
-		parsed, parseErr = parseYouTubeSearchResults(respBody)
-	case SearchTypeYouTubeMusic:
-		parsed, parseErr = parseYouTubeMusicSearchResults(respBody)
-	}
-
 	if parseErr == nil && len(parsed) > 0 && srv.db != nil {
-		cacheKey := srv.createCacheKey(searchType, query)
-		if err := srv.StoreCache(vCtx, cacheKey, parsed); err != nil {
-			slog.Error("Failed to store search results in cache", "error", err)
+		if err := srv.StoreCache(ctx, cacheKey, parsed); err != nil {
+			LoggerFromContext(ctx).Error("Failed to store search results in cache", "error", err)
 		} else {
-			slog.Info("Stored search results in cache", "key", cacheKey)
+			LoggerFromContext(ctx).Info("Stored search results in cache", "key", cacheKey)
+		}
+		if correction != nil {
+			if err := srv.StoreCache(ctx, "correction:"+cacheKey, correction); err != nil {
+				LoggerFromContext(ctx).Error("Failed to store spelling correction in cache", "error", err)
+			}
 		}
 	}
 	if searchType == SearchTypeYouTube && len(parsed) != 0 {
@@ -357,5 +538,17 @@ func (srv *Server) searchFromYouTube(
 			item.Uri = "https://www.youtube.com/watch?v=" + item.Identifier
 		}
 	}
-	return parsed, parseErr
+	return parsed, correction, CacheStatus{}, parseErr
+}
+
+func (srv *Server) cachedCorrection(ctx context.Context, cacheKey string) *SpellingCorrection {
+	entry, err := srv.LookupCache(ctx, "correction:"+cacheKey)
+	if err != nil || entry == nil {
+		return nil
+	}
+	var correction SpellingCorrection
+	if err := json.Unmarshal(entry.Value, &correction); err != nil {
+		return nil
+	}
+	return &correction
 }
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type HealthConfig struct {
+	// ProbeVideoId is a long lived public video fetched by the deep health check
+	ProbeVideoId string `yaml:"probe_video_id"`
+	// ProbeInterval is how many seconds a probe result is reused, so monitors
+	// can't turn the check into upstream load
+	ProbeInterval int `yaml:"probe_interval"`
+}
+
+type HealthCheck struct {
+	Ok        bool   `json:"ok"`
+	LatencyMs int64  `json:"latency_ms,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+type DeepHealth struct {
+	Status    string                 `json:"status"`
+	CheckedAt time.Time              `json:"checked_at"`
+	Checks    map[string]HealthCheck `json:"checks"`
+}
+
+type deepHealthState struct {
+	mu     sync.Mutex
+	result *DeepHealth
+}
+
+// probeUpstream fetches the probe video through the player endpoint without
+// the oEmbed fallback, so both a failing upstream and a changed response
+// format show up
+func (srv *Server) probeUpstream(ctx context.Context) (HealthCheck, HealthCheck) {
+	started := time.Now()
+	respBody, err := srv.playerRequest(ctx, srv.Cfg.Health.ProbeVideoId)
+	upstream := HealthCheck{Ok: err == nil, LatencyMs: time.Since(started).Milliseconds()}
+	if err != nil {
+		upstream.Error = err.Error()
+		return upstream, HealthCheck{Error: "skipped, upstream request failed"}
+	}
+
+	var respdata YouTubePlayerResponse
+	if err := json.Unmarshal(respBody, &respdata); err != nil {
+		return upstream, HealthCheck{Error: fmt.Sprintf("invalid player response: %v", err)}
+	}
+	track := respdata.VideoDetails.ToYouTubeTrack()
+	switch {
+	case track.Identifier != srv.Cfg.Health.ProbeVideoId:
+		err = fmt.Errorf("expected video %s, got %q (playability: %s)",
+			srv.Cfg.Health.ProbeVideoId, track.Identifier, respdata.PlaybilityStatus.Status)
+	case track.Title == "":
+		err = errors.New("video has no title")
+	case track.Length <= 0 && !track.IsLive:
+		err = errors.New("video has no length")
+	}
+	if err != nil {
+		return upstream, HealthCheck{Error: err.Error()}
+	}
+	return upstream, HealthCheck{Ok: true}
+}
+
+// DeepHealth runs the end to end probe at most once per probe interval,
+// concurrent callers wait for the running probe and share its result
+func (srv *Server) DeepHealth(ctx context.Context) *DeepHealth {
+	srv.deepHealth.mu.Lock()
+	defer srv.deepHealth.mu.Unlock()
+	interval := time.Duration(srv.Cfg.Health.ProbeInterval) * time.Second
+	if last := srv.deepHealth.result; last != nil && time.Since(last.CheckedAt) < interval {
+		return last
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Duration(srv.Cfg.RequestTimeout)*time.Second)
+	defer cancel()
+	upstream, parse := srv.probeUpstream(ctx)
+
+	srv.mu.RLock()
+	visitors := HealthCheck{Ok: len(srv.visitors) > 0 && srv.faultCount < srv.Cfg.MaxVisitorCount*4}
+	if !visitors.Ok {
+		visitors.Error = fmt.Sprintf("%d visitors, fault count %d", len(srv.visitors), srv.faultCount)
+	}
+	srv.mu.RUnlock()
+
+	result := &DeepHealth{
+		Status:    "ok",
+		CheckedAt: time.Now(),
+		Checks:    map[string]HealthCheck{"upstream": upstream, "parse": parse, "visitors": visitors},
+	}
+	switch {
+	case !upstream.Ok || !parse.Ok:
+		result.Status = "fail"
+	case !visitors.Ok:
+		result.Status = "degraded"
+	}
+	srv.deepHealth.result = result
+	return result
+}
+
+func (srv *Server) MakeDeepHealthHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		result := srv.DeepHealth(req.Context())
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Header().Set("Cache-Control", "no-store")
+		if result.Status == "fail" {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if err := json.NewEncoder(writer).Encode(result); err != nil {
+			LoggerFromContext(req.Context()).Error("Failed to encode health result", "error", err)
+		}
+	}
+}
@@ -3,11 +3,14 @@ package main
 import (
 	"context"
 	"crypto/rand"
+	"fmt"
+	"io"
 	"log/slog"
 	"net"
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -21,41 +24,147 @@ type HttpClient struct {
 	Ipv6Block string
 	cache     map[string]ipv6SupportCache
 	mu        sync.RWMutex
+	slots     chan struct{}
+
+	// StaticHeaders are added to every request for a host, keyed by host name
+	StaticHeaders map[string]map[string]string
+	// CacheOnly refuses every upstream request, set by the alert engine
+	CacheOnly atomic.Bool
 }
 
-func (client *HttpClient) OnRequest(req *http.Request) {
-	if strings.Contains(req.URL.String(), "youtubei/v1/") {
-		req.Header.Set("Content-Type", "application/json")
+// releasingBody gives the upstream slot back once the caller is done with the
+// body: when it is read to the end or fails, or at the latest when it is closed
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+	read    int
+	span    *Span
+}
+
+func (body *releasingBody) Read(p []byte) (int, error) {
+	n, err := body.ReadCloser.Read(p)
+	body.read += n
+	if err != nil {
+		body.done()
+	}
+	return n, err
+}
+
+func (body *releasingBody) Close() error {
+	err := body.ReadCloser.Close()
+	body.done()
+	return err
+}
+
+func (body *releasingBody) done() {
+	body.once.Do(func() {
+		body.release()
+		body.span.SetAttr(slog.Int("http.response_bytes", body.read))
+		body.span.End(nil)
+	})
+}
+
+// request headers that may be carried over from the original request, every
+// other header is dropped before a request leaves for youtube
+var upstreamHeaderWhitelist = []string{"Accept", "Accept-Language", "Content-Type", "Range", "X-Request-ID"}
+
+// buildHeaders constructs the outbound headers from scratch so nothing but
+// whitelisted and computed headers ever reaches the upstream host
+func (client *HttpClient) buildHeaders(req *http.Request) http.Header {
+	header := make(http.Header)
+	for _, name := range upstreamHeaderWhitelist {
+		if value := req.Header.Get(name); value != "" {
+			header.Set(name, value)
+		}
+	}
+
+	host := req.URL.Hostname()
+	if strings.HasPrefix(req.URL.Path, "/youtubei/v1/") {
+		header.Set("Content-Type", "application/json")
 		ivs, ok := req.Context().Value(VisitorDataContextKey).(string)
 		if ok && ivs != "" {
-			req.Header.Set("x-goog-visitor-id", ivs)
+			header.Set("x-goog-visitor-id", ivs)
 			if len(ivs) > 50 {
 				ivs = ivs[:50]
 			}
-			slog.Debug("Setting x-goog-visitor-id", "visitor_id", ivs)
+			LoggerFromContext(req.Context()).Debug("Setting x-goog-visitor-id", "visitor_id", ivs)
 
 		}
 	}
-	if strings.Contains(req.URL.String(), "music.youtube.com") {
-		req.Header.Set("x-origin", "https://music.youtube.com")
+	if host == "music.youtube.com" {
+		header.Set("x-origin", "https://music.youtube.com")
 	} else {
-		req.Header.Set("origin", "https://www.youtube.com")
+		header.Set("origin", "https://www.youtube.com")
 	}
 
 	// close the tcp connection after request to rotate the ipv6 address
-	req.Header.Set("Connection", "close")
-	req.Header.Set("Cookie", "SOCS=CAI;")
-	req.Header.Set(
+	header.Set("Connection", "close")
+	header.Set("Cookie", visitorCookie(req.Context()))
+	header.Set(
 		"User-Agent",
 		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/142.0.0.0 Safari/537.36",
 	)
+
+	for name, value := range client.StaticHeaders[host] {
+		header.Set(name, value)
+	}
+	return header
+}
+
+func (client *HttpClient) OnRequest(req *http.Request) {
+	req.Header = client.buildHeaders(req)
+}
+
+func (client *HttpClient) acquireSlot(ctx context.Context) error {
+	select {
+	case client.slots <- struct{}{}:
+		return nil
+	default:
+	}
+	LoggerFromContext(ctx).Debug("Waiting for a free upstream slot", "in_flight", len(client.slots))
+	select {
+	case client.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for upstream slot: %w", ctx.Err())
+	}
+}
+
+func (client *HttpClient) releaseSlot() {
+	<-client.slots
 }
 
 func (client *HttpClient) Do(req *http.Request) (*http.Response, error) {
-	if req != nil {
-		client.OnRequest(req)
+	if req == nil {
+		return client.Client.Do(req)
 	}
-	return client.Client.Do(req)
+	if client.CacheOnly.Load() {
+		return nil, ErrCacheOnly
+	}
+	client.OnRequest(req)
+
+	if err := client.acquireSlot(req.Context()); err != nil {
+		return nil, err
+	}
+	countUpstreamCall(req.Context())
+	ctx, span := client.startUpstreamSpan(req)
+	ctx, localAddr := withLocalAddrMarker(ctx)
+	started := time.Now()
+	resp, err := client.Client.Do(req.WithContext(ctx))
+	ipv6Addr := localAddr.Load()
+	recordUpstreamCall(req, resp, err, ipv6Addr, started)
+	if ipv6Addr != nil {
+		span.SetAttr(slog.String("net.local_prefix", localPrefix(*ipv6Addr)))
+	}
+	if err != nil {
+		client.releaseSlot()
+		span.End(err)
+		return nil, err
+	}
+	span.SetAttr(slog.Int("http.status_code", resp.StatusCode))
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: client.releaseSlot, span: span}
+	return resp, nil
 }
 
 func (client *HttpClient) IsIpv6Supported(network, addr string) bool {
@@ -144,7 +253,7 @@ func (client *HttpClient) TransportDialContext(
 	network string,
 	addr string,
 ) (net.Conn, error) {
-	slog.Debug("Connecting to Address", "addr", addr, "network", network)
+	LoggerFromContext(ctx).Debug("Connecting to Address", "addr", addr, "network", network)
 
 	// Try read lock first to check cache
 	client.mu.RLock()
@@ -161,43 +270,62 @@ func (client *HttpClient) TransportDialContext(
 			supported:   fetched,
 		}
 		client.mu.Unlock()
-		slog.Debug("ipv6 support cache updated", "addr", addr, "supported", fetched)
+		LoggerFromContext(ctx).Debug("ipv6 support cache updated", "addr", addr, "supported", fetched)
 		ipv6Supported = fetched
 	} else {
 		ipv6Supported = cached.supported
-		slog.Debug("using cached ipv6 support value", "addr", addr, "supported", cached.supported)
+		LoggerFromContext(ctx).Debug("using cached ipv6 support value", "addr", addr, "supported", cached.supported)
 	}
 
 	dialer := &net.Dialer{
 		Timeout:   30 * time.Second,
 		KeepAlive: 30 * time.Second,
 	}
+	subnet := "default"
 	if ipv6Supported && client.Ipv6Block != "" {
 		randomIpv6 := client.GenerateRandomIpV6()
 		if randomIpv6 != "" {
-			slog.Debug("selected outgoing ip address", slog.String("ipv6", randomIpv6))
+			LoggerFromContext(ctx).Debug("selected outgoing ip address", slog.String("ipv6", randomIpv6))
+			markLocalAddr(ctx, randomIpv6)
+			sourceAddresses.Add(randomIpv6)
+			subnet = client.Ipv6Block
 			dialer.LocalAddr = &net.TCPAddr{
 				IP:   net.ParseIP(randomIpv6),
 				Port: 0,
 			}
 		} else {
 			dialer.LocalAddr = nil
-			slog.Debug("failed to generate random ipv6 address, using default local address")
+			dialsWithoutRotationTotal.Inc("generate_failed")
+			LoggerFromContext(ctx).Debug("failed to generate random ipv6 address, using default local address")
 		}
 
 	} else {
 		dialer.LocalAddr = nil
+		if client.Ipv6Block == "" {
+			dialsWithoutRotationTotal.Inc("no_subnet")
+		} else {
+			dialsWithoutRotationTotal.Inc("ipv6_unsupported")
+		}
+	}
+	conn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		dialFailuresTotal.Inc(subnet)
 	}
-	return dialer.DialContext(ctx, network, addr)
+	return conn, err
 }
 
-func NewHttpClient(timeoutSeconds int, ipv6Subnet string) *HttpClient {
+func NewHttpClient(timeoutSeconds int, ipv6Subnet string, maxConcurrency int) *HttpClient {
 	transport := http.DefaultTransport.(*http.Transport).Clone()
-	client := &HttpClient{Ipv6Block: ipv6Subnet, cache: make(map[string]ipv6SupportCache)}
+	client := &HttpClient{
+		Ipv6Block: ipv6Subnet,
+		cache:     make(map[string]ipv6SupportCache),
+		slots:     make(chan struct{}, maxConcurrency),
+	}
 	transport.DialContext = client.TransportDialContext
 	client.Client = &http.Client{
-		Timeout:   time.Duration(timeoutSeconds) * time.Second,
-		Transport: transport,
+		Timeout:       time.Duration(timeoutSeconds) * time.Second,
+		Transport:     transport,
+		CheckRedirect: consentRedirectPolicy,
 	}
 	return client
 }
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+)
+
+const idempotencySchema = `
+	CREATE TABLE IF NOT EXISTS idempotency_keys (
+		key TEXT PRIMARY KEY,
+		fingerprint TEXT NOT NULL,
+		status INTEGER NOT NULL DEFAULT 0,
+		location TEXT NOT NULL DEFAULT '',
+		response BLOB,
+		expires_at DATETIME NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys (expires_at);`
+
+const maxIdempotencyKeyLength = 255
+
+type IdempotencyConfig struct {
+	// TTL is how many seconds a key replays the response of its first request
+	TTL int `yaml:"ttl"`
+}
+
+// IdempotentRequest is a submission carrying an Idempotency-Key, reserved
+// until its response is stored or the request fails
+type IdempotentRequest struct {
+	srv *Server
+	key string
+}
+
+// claimIdempotencyKey reserves the Idempotency-Key of a submission. When the
+// key was used before, the earlier response is replayed or the conflict
+// answered and handled is true. Without a key or database it returns nil.
+func (srv *Server) claimIdempotencyKey(
+	writer http.ResponseWriter,
+	req *http.Request,
+	scope string,
+	body []byte,
+) (idempotent *IdempotentRequest, handled bool) {
+	key := req.Header.Get("Idempotency-Key")
+	if key == "" || srv.db == nil {
+		return nil, false
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		writeValidationError(writer, &ValidationError{
+			Code:    "invalid_idempotency_key",
+			Param:   "Idempotency-Key",
+			Message: "Idempotency-Key must be at most 255 characters",
+		})
+		return nil, true
+	}
+
+	// keys of different tenants never collide
+	owner := "anonymous"
+	if tenant := TenantFromContext(req.Context()); tenant != nil {
+		owner = tenant.Name
+	}
+	storageKey := scope + ":" + owner + ":" + key
+	sum := sha256.Sum256(body)
+	fingerprint := hex.EncodeToString(sum[:])
+	ctx := req.Context()
+
+	now := time.Now().UTC()
+	res, err := srv.db.ExecContext(ctx,
+		`INSERT INTO idempotency_keys (key, fingerprint, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET fingerprint = excluded.fingerprint, status = 0, location = '',
+			response = NULL, expires_at = excluded.expires_at
+		WHERE idempotency_keys.expires_at <= ?`,
+		storageKey, fingerprint, now.Add(time.Duration(srv.Cfg.Idempotency.TTL)*time.Second), now,
+	)
+	if err != nil {
+		LoggerFromContext(ctx).Error("Failed to claim idempotency key", "error", err)
+		writeError(writer, http.StatusInternalServerError, "Error storing idempotency key")
+		return nil, true
+	}
+	if claimed, _ := res.RowsAffected(); claimed > 0 {
+		return &IdempotentRequest{srv: srv, key: storageKey}, false
+	}
+
+	var (
+		storedFingerprint string
+		status            int
+		location          string
+		response          []byte
+	)
+	err = srv.db.QueryRowContext(ctx,
+		"SELECT fingerprint, status, location, response FROM idempotency_keys WHERE key = ?", storageKey,
+	).Scan(&storedFingerprint, &status, &location, &response)
+	if errors.Is(err, sql.ErrNoRows) {
+		// expired and deleted in between, the retry can safely run again
+		return srv.claimIdempotencyKey(writer, req, scope, body)
+	}
+	if err != nil {
+		LoggerFromContext(ctx).Error("Failed to load idempotency key", "error", err)
+		writeError(writer, http.StatusInternalServerError, "Error loading idempotency key")
+		return nil, true
+	}
+
+	switch {
+	case storedFingerprint != fingerprint:
+		writeRequestError(writer, http.StatusUnprocessableEntity, &ValidationError{
+			Code:    "idempotency_key_reused",
+			Param:   "Idempotency-Key",
+			Message: "Idempotency-Key was already used for a different request",
+		})
+	case status == 0:
+		writeRequestError(writer, http.StatusConflict, &ValidationError{
+			Code:    "idempotency_key_in_progress",
+			Param:   "Idempotency-Key",
+			Message: "a request with this Idempotency-Key is still in progress",
+		})
+	default:
+		LoggerFromContext(ctx).Info("Replaying idempotent request", "scope", scope)
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Header().Set("Idempotent-Replayed", "true")
+		if location != "" {
+			writer.Header().Set("Location", location)
+		}
+		writer.WriteHeader(status)
+		_, _ = writer.Write(response)
+	}
+	return nil, true
+}
+
+// Complete stores the response replayed for later requests with the same key
+func (idempotent *IdempotentRequest) Complete(ctx context.Context, status int, location string, response []byte) {
+	if idempotent == nil {
+		return
+	}
+	_, err := idempotent.srv.db.ExecContext(context.WithoutCancel(ctx),
+		"UPDATE idempotency_keys SET status = ?, location = ?, response = ? WHERE key = ?",
+		status, location, response, idempotent.key,
+	)
+	if err != nil {
+		LoggerFromContext(ctx).Error("Failed to store idempotent response", "error", err)
+	}
+}
+
+// Release frees the key of a request that failed, so a retry runs it again
+func (idempotent *IdempotentRequest) Release(ctx context.Context) {
+	if idempotent == nil {
+		return
+	}
+	_, err := idempotent.srv.db.ExecContext(context.WithoutCancel(ctx),
+		"DELETE FROM idempotency_keys WHERE key = ?", idempotent.key,
+	)
+	if err != nil {
+		LoggerFromContext(ctx).Error("Failed to release idempotency key", "error", err)
+	}
+}
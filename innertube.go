@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const INNERTUBE_BROWSE_API_URL = YT_BASE_URL + "/youtubei/v1/browse?prettyPrint=false"
+
+var ErrNoVisitor = errors.New("no visitor data available")
+
+func (srv *Server) pickVisitor(ctx context.Context, isYouTube bool) (*YouTubeVisitorData, error) {
+	visitor := srv.RandomVisitor(ctx, isYouTube)
+	if visitor == nil {
+		return nil, ErrNoVisitor
+	}
+	return visitor, nil
+}
+
+// innertubeRequest posts the payload to an innertube endpoint on behalf of the
+// visitor, filling in the visitor context unless the payload brings its own.
+// Either is set to the locale of the request.
+const InnertubeClientContextKey ctxKey = "innertubeClient"
+
+func innertubeClientName(payload map[string]any) string {
+	context, _ := payload["context"].(map[string]any)
+	client, _ := context["client"].(map[string]any)
+	name, _ := client["clientName"].(string)
+	return name
+}
+
+func (srv *Server) innertubeRequest(
+	ctx context.Context,
+	name string,
+	endpointUrl string,
+	visitor *YouTubeVisitorData,
+	payload map[string]any,
+) ([]byte, error) {
+	if visitor != nil {
+		ctx = context.WithValue(ctx, VisitorDataContextKey, visitor.VisitorID())
+		ctx = withVisitorCookie(ctx, visitor.Cookies)
+		if _, ok := payload["context"]; !ok {
+			payload["context"] = visitor.Context
+		}
+	}
+	if innertubeContext, ok := payload["context"].(map[string]any); ok {
+		payload["context"] = localizedInnertubeContext(innertubeContext, srv.innertubeLocale(ctx))
+	}
+
+	reqBody, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s payload: %w", name, err)
+	}
+
+	ctx = context.WithValue(ctx, InnertubeClientContextKey, innertubeClientName(payload))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpointUrl, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s request: %w", name, err)
+	}
+	// the id of the request being served, so the call can be traced back to it
+	if id := RequestInfoFromContext(ctx).Id; id != "" {
+		req.Header.Set("X-Request-ID", id)
+	}
+
+	resp, err := srv.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to perform %s request: %w", name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s request failed with status: %s", name, resp.Status)
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s response body: %w", name, err)
+	}
+	return respBody, nil
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const isrcMatchThreshold = 0.6
+
+var errNoISRCMatch = errors.New("no match for isrc")
+
+// ISRCMatch is the track an ISRC resolves to, the best of its candidates
+type ISRCMatch struct {
+	ISRC  string       `json:"isrc"`
+	Track YouTubeTrack `json:"track"`
+}
+
+type BulkISRCItem struct {
+	ISRC string `json:"isrc"`
+	// DurationMs is the expected length of the recording
+	DurationMs int `json:"duration_ms,omitempty"`
+}
+
+type BulkISRCRequest struct {
+	Items []BulkISRCItem `json:"items"`
+}
+
+func (srv *Server) musicBrainzRecording(ctx context.Context, isrc string) (*MusicBrainzRecording, error) {
+	cacheKey := "musicbrainz:isrc:" + isrc
+	if srv.db != nil {
+		entry, err := srv.LookupCache(ctx, cacheKey)
+		if err != nil {
+			LoggerFromContext(ctx).Error("Failed to lookup musicbrainz cache", "error", err)
+		} else if entry != nil {
+			var recording MusicBrainzRecording
+			if err := json.Unmarshal(entry.Value, &recording); err == nil {
+				if recording.Id == "" {
+					return nil, nil
+				}
+				return &recording, nil
+			}
+		}
+	}
+
+	recordings, err := srv.musicbrainz.LookupISRC(ctx, isrc)
+	if err != nil {
+		return nil, err
+	}
+
+	// an empty recording remembers that musicbrainz doesn't know this isrc
+	recording := MusicBrainzRecording{}
+	if len(recordings) > 0 {
+		recording = recordings[0]
+	}
+	if srv.db != nil {
+		if err := srv.StoreCache(ctx, cacheKey, recording); err != nil {
+			LoggerFromContext(ctx).Error("Failed to store musicbrainz recording in cache", "error", err)
+		}
+	}
+	if recording.Id == "" {
+		return nil, nil
+	}
+	return &recording, nil
+}
+
+// DurationFilter records which ISRC candidates were rejected for deviating
+// from the expected length
+type DurationFilter struct {
+	// Source of the reference length: hint, musicbrainz, consensus or none
+	Source      string
+	ReferenceMs int
+	DeltaMs     int
+	Rejected    []string
+}
+
+// Header is the X-Duration-Filter value describing the decision
+func (filter *DurationFilter) Header() string {
+	if filter.Source == DurationSourceNone {
+		return "source=none"
+	}
+	return fmt.Sprintf(
+		"source=%s; reference_ms=%d; delta_ms=%d; rejected=%s",
+		filter.Source, filter.ReferenceMs, filter.DeltaMs, strings.Join(filter.Rejected, ","),
+	)
+}
+
+const (
+	DurationSourceHint        = "hint"
+	DurationSourceMusicBrainz = "musicbrainz"
+	DurationSourceConsensus   = "consensus"
+	DurationSourceNone        = "none"
+)
+
+// durationConsensus is the median length of the largest group of candidates
+// within deltaMs of each other, 0 when no two candidates agree
+func durationConsensus(tracks []YouTubeTrack, deltaMs int) int {
+	var best []int
+	for _, track := range tracks {
+		if track.Length <= 0 {
+			continue
+		}
+		var group []int
+		for _, other := range tracks {
+			if other.Length > 0 && abs(other.Length-track.Length) <= deltaMs {
+				group = append(group, other.Length)
+			}
+		}
+		if len(group) > len(best) {
+			best = group
+		}
+	}
+	if len(best) < 2 {
+		return 0
+	}
+	slices.Sort(best)
+	return best[len(best)/2]
+}
+
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
+
+// filterISRCDuration drops candidates whose length deviates more than the
+// configured delta from the reference, taken from the caller's hint, the
+// musicbrainz recording or else the candidates' consensus. Sped up and
+// nightcore uploads otherwise win ISRC matches far too often.
+func (srv *Server) filterISRCDuration(
+	tracks []YouTubeTrack,
+	hintMs int,
+	recording *MusicBrainzRecording,
+) ([]YouTubeTrack, *DurationFilter) {
+	filter := &DurationFilter{Source: DurationSourceNone, DeltaMs: srv.Cfg.ISRC.DurationDeltaMs}
+	switch {
+	case hintMs > 0:
+		filter.Source, filter.ReferenceMs = DurationSourceHint, hintMs
+	case recording != nil && recording.Length > 0:
+		filter.Source, filter.ReferenceMs = DurationSourceMusicBrainz, recording.Length
+	default:
+		if consensus := durationConsensus(tracks, filter.DeltaMs); consensus > 0 {
+			filter.Source, filter.ReferenceMs = DurationSourceConsensus, consensus
+		}
+	}
+	if filter.Source == DurationSourceNone {
+		return tracks, filter
+	}
+
+	kept := make([]YouTubeTrack, 0, len(tracks))
+	for _, track := range tracks {
+		if track.Length > 0 && abs(track.Length-filter.ReferenceMs) > filter.DeltaMs {
+			filter.Rejected = append(filter.Rejected, track.Identifier)
+			continue
+		}
+		kept = append(kept, track)
+	}
+	return kept, filter
+}
+
+// searchISRC searches youtube music for an ISRC, validating the candidates against
+// musicbrainz when enabled and dropping those outside the duration window
+func (srv *Server) searchISRC(
+	ctx context.Context,
+	isrc string,
+	hintMs int,
+) ([]YouTubeTrack, *DurationFilter, CacheStatus, error) {
+	tracks, _, cacheStatus, err := srv.searchFromYouTube(ctx, SearchTypeYouTubeMusic, isrc, srv.defaultSearchOptions())
+	if err != nil {
+		return nil, nil, cacheStatus, err
+	}
+
+	var recording *MusicBrainzRecording
+	if srv.musicbrainz != nil && len(tracks) > 0 {
+		recording, err = srv.musicBrainzRecording(ctx, isrc)
+		if errors.Is(err, errMusicBrainzBusy) {
+			LoggerFromContext(ctx).Debug("Skipped musicbrainz validation, ranking by consensus", "isrc", isrc)
+		} else if err != nil {
+			LoggerFromContext(ctx).Warn("Failed to lookup isrc on musicbrainz", "isrc", isrc, "error", err)
+		} else if recording == nil {
+			LoggerFromContext(ctx).Debug("ISRC not known to musicbrainz", "isrc", isrc)
+		}
+	}
+
+	tracks, filter := srv.filterISRCDuration(tracks, hintMs, recording)
+	if len(filter.Rejected) > 0 {
+		LoggerFromContext(ctx).Info(
+			"Rejected isrc candidates outside the duration window",
+			"isrc", isrc,
+			"source", filter.Source,
+			"reference_ms", filter.ReferenceMs,
+			"rejected", filter.Rejected,
+		)
+	}
+	if len(tracks) == 0 {
+		return tracks, filter, cacheStatus, nil
+	}
+
+	tracks = rankISRCCandidates(tracks, hintMs, recording)
+	if recording == nil {
+		return tracks, filter, cacheStatus, nil
+	}
+	for i := range tracks {
+		if *tracks[i].MatchConfidence >= isrcMatchThreshold {
+			tracks[i].MusicBrainzId = recording.Id
+		}
+	}
+	LoggerFromContext(ctx).Info(
+		"Validated isrc matches against musicbrainz",
+		"isrc", isrc,
+		"recording", recording.Id,
+		"best_score", *tracks[0].MatchConfidence,
+	)
+	return tracks, filter, cacheStatus, nil
+}
+
+// rankISRCCandidates sets the match confidence of the candidates and sorts
+// them best first. They are scored against the musicbrainz recording, or else
+// against each other: a search for an ISRC finds its song a few times over,
+// while the unrelated songs matching the ISRC as plain text don't agree with
+// them. A lone candidate can only be checked against the length hint.
+func rankISRCCandidates(tracks []YouTubeTrack, hintMs int, recording *MusicBrainzRecording) []YouTubeTrack {
+	ranked := slices.Clone(tracks)
+	for i, track := range ranked {
+		var confidence float64
+		switch {
+		case recording != nil:
+			confidence = scoreTrack(track, recording.MatchReference())
+		case len(ranked) > 1:
+			for j, other := range ranked {
+				if j != i {
+					confidence += scoreTrack(track, MatchReference{
+						Title:    other.Title,
+						Artist:   other.Author,
+						LengthMs: cmp.Or(hintMs, other.Length),
+					})
+				}
+			}
+			confidence /= float64(len(ranked) - 1)
+		case hintMs > 0:
+			confidence = scoreTrack(track, MatchReference{LengthMs: hintMs})
+		default:
+			return ranked
+		}
+		confidence = math.Round(confidence*1000) / 1000
+		ranked[i].MatchConfidence = &confidence
+	}
+	slices.SortStableFunc(ranked, func(a, b YouTubeTrack) int {
+		return cmp.Compare(*b.MatchConfidence, *a.MatchConfidence)
+	})
+	return ranked
+}
+
+// resolveISRC picks the best candidate of an ISRC search, cached per ISRC and
+// length hint
+func (srv *Server) resolveISRC(ctx context.Context, isrc string, hintMs int) (*ISRCMatch, error) {
+	cacheKey := "isrc:" + isrc
+	if hintMs > 0 {
+		cacheKey += ":" + strconv.Itoa(hintMs)
+	}
+	if srv.db != nil {
+		entry, err := srv.LookupCache(ctx, cacheKey)
+		if err != nil {
+			LoggerFromContext(ctx).Error("Failed to lookup cache for isrc", "error", err)
+		} else if entry != nil {
+			var match ISRCMatch
+			if err := json.Unmarshal(entry.Value, &match); err != nil {
+				LoggerFromContext(ctx).Error("Failed to unmarshal cached isrc match", "error", err)
+			} else {
+				return &match, nil
+			}
+		}
+	}
+
+	tracks, _, _, err := srv.searchISRC(ctx, isrc, hintMs)
+	if err != nil {
+		return nil, err
+	}
+	if len(tracks) == 0 {
+		return nil, fmt.Errorf("%w %s", errNoISRCMatch, isrc)
+	}
+	match := &ISRCMatch{ISRC: isrc, Track: tracks[0]}
+	if srv.db != nil {
+		if err := srv.StoreCache(ctx, cacheKey, match); err != nil {
+			LoggerFromContext(ctx).Error("Failed to store isrc match in cache", "error", err)
+		}
+	}
+	return match, nil
+}
+
+// MakeBulkISRCHandler resolves many ISRCs at once, running them as a batch of
+// isrc items
+func (srv *Server) MakeBulkISRCHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			writeValidationError(writer, &ValidationError{Code: "invalid_body", Message: err.Error()})
+			return
+		}
+		var bulk BulkISRCRequest
+		if err := json.Unmarshal(body, &bulk); err != nil {
+			writeValidationError(writer, &ValidationError{Code: "invalid_body", Message: err.Error()})
+			return
+		}
+		if len(bulk.Items) == 0 {
+			writeValidationError(writer, &ValidationError{
+				Code:    "empty_batch",
+				Param:   "items",
+				Message: "items must not be empty",
+			})
+			return
+		}
+		if len(bulk.Items) > srv.Cfg.ISRC.MaxBulkItems {
+			writeValidationError(writer, &ValidationError{
+				Code:    "too_many_items",
+				Param:   "items",
+				Message: fmt.Sprintf("a bulk lookup holds at most %d items", srv.Cfg.ISRC.MaxBulkItems),
+			})
+			return
+		}
+
+		idempotent, handled := srv.claimIdempotencyKey(writer, req, "isrc", body)
+		if handled {
+			return
+		}
+
+		items := make([]BatchItem, len(bulk.Items))
+		for i, item := range bulk.Items {
+			items[i] = BatchItem{Type: "isrc", Query: item.ISRC, DurationMs: item.DurationMs}
+		}
+		response := srv.RunBatch(req.Context(), items, nil)
+		LoggerFromContext(req.Context()).Info(
+			"Finished bulk isrc lookup",
+			"items", len(items),
+			"failed", response.Failed,
+			"took_ms", response.TookMs,
+			"upstream_calls", response.UpstreamCalls,
+		)
+
+		encoded, err := json.Marshal(response)
+		if err != nil {
+			idempotent.Release(req.Context())
+			LoggerFromContext(req.Context()).Error("Failed to encode bulk isrc response", "error", err)
+			writeError(writer, http.StatusInternalServerError, "Error encoding bulk isrc response")
+			return
+		}
+		encoded = append(encoded, '\n')
+		idempotent.Complete(req.Context(), http.StatusOK, "", encoded)
+
+		writer.Header().Set("Content-Type", "application/json")
+		_, _ = writer.Write(encoded)
+	}
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	JobTypePlaylist = "playlist"
+	JobTypeBatch    = "batch"
+)
+
+const (
+	JobStatusPending = "pending"
+	JobStatusRunning = "running"
+	JobStatusDone    = "done"
+	JobStatusFailed  = "failed"
+)
+
+type JobRequest struct {
+	Type        string      `json:"type"`
+	Id          string      `json:"id,omitempty"`
+	Limit       int         `json:"limit,omitempty"`
+	Items       []BatchItem `json:"items,omitempty"`
+	CallbackUrl string      `json:"callback_url,omitempty"`
+}
+
+type Job struct {
+	Id string `json:"id"`
+	// Owner is the tenant that submitted the job, only it may fetch the result
+	Owner     string          `json:"-"`
+	Type      string          `json:"type"`
+	Status    string          `json:"status"`
+	Done      int             `json:"done"`
+	Total     int             `json:"total"`
+	Error     string          `json:"error,omitempty"`
+	Result    json.RawMessage `json:"result,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+	ExpiresAt time.Time       `json:"expires_at"`
+}
+
+const jobsSchema = `
+	CREATE TABLE IF NOT EXISTS jobs (
+		id TEXT PRIMARY KEY,
+		owner TEXT NOT NULL DEFAULT '',
+		type TEXT NOT NULL,
+		request BLOB,
+		status TEXT NOT NULL,
+		done INTEGER DEFAULT 0,
+		total INTEGER DEFAULT 0,
+		error TEXT DEFAULT '',
+		result BLOB,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL,
+		expires_at DATETIME NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_jobs_expires_at ON jobs (expires_at);`
+
+func newJobId() string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+func (srv *Server) validateJobRequest(ctx context.Context, jobReq *JobRequest) error {
+	if jobReq.CallbackUrl != "" {
+		if srv.Cfg.Jobs.CallbackSecret == "" {
+			return errors.New("callbacks are disabled, jobs.callback_secret is not configured")
+		}
+		if err := validateCallbackUrl(ctx, jobReq.CallbackUrl); err != nil {
+			return err
+		}
+	}
+
+	switch jobReq.Type {
+	case JobTypePlaylist:
+		if strings.TrimSpace(jobReq.Id) == "" {
+			return errors.New("id is required for playlist jobs")
+		}
+		playlistId, err := parsePlaylistId(jobReq.Id)
+		if err != nil {
+			return err
+		}
+		jobReq.Id = playlistId
+		if jobReq.Limit <= 0 || jobReq.Limit > srv.Cfg.Jobs.MaxPlaylistTracks {
+			jobReq.Limit = srv.Cfg.Jobs.MaxPlaylistTracks
+		}
+	case JobTypeBatch:
+		if len(jobReq.Items) == 0 {
+			return errors.New("items must not be empty")
+		}
+		if len(jobReq.Items) > srv.Cfg.Jobs.MaxBatchItems {
+			return fmt.Errorf("a batch job holds at most %d items", srv.Cfg.Jobs.MaxBatchItems)
+		}
+	default:
+		return fmt.Errorf("unsupported job type: %q", jobReq.Type)
+	}
+	return nil
+}
+
+func (srv *Server) CreateJob(ctx context.Context, jobReq JobRequest) (*Job, error) {
+	request, err := json.Marshal(jobReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal job request: %w", err)
+	}
+
+	now := time.Now().UTC()
+	job := &Job{
+		Id:        newJobId(),
+		Owner:     jobOwner(ctx),
+		Type:      jobReq.Type,
+		Status:    JobStatusPending,
+		Total:     len(jobReq.Items),
+		CreatedAt: now,
+		UpdatedAt: now,
+		ExpiresAt: now.Add(time.Duration(srv.Cfg.Jobs.ResultTTL) * time.Second),
+	}
+	if jobReq.Type == JobTypePlaylist {
+		job.Total = 1
+	}
+
+	_, err = srv.db.ExecContext(ctx,
+		`INSERT INTO jobs (id, owner, type, request, status, total, created_at, updated_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		job.Id, job.Owner, job.Type, request, job.Status, job.Total, job.CreatedAt, job.UpdatedAt, job.ExpiresAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store job: %w", err)
+	}
+
+	go srv.runJob(srv.jobContext(ctx), job.Id, jobReq)
+	return job, nil
+}
+
+// jobOwner is the name of the tenant of a request, empty without api keys
+func jobOwner(ctx context.Context) string {
+	if tenant := TenantFromContext(ctx); tenant != nil {
+		return tenant.Name
+	}
+	return ""
+}
+
+// jobContext carries over what shapes the results of the submitting request:
+// the tenant with its filters, cache namespace and region, the route profile,
+// the locale and the logger. It isn't canceled with the request.
+func (srv *Server) jobContext(ctx context.Context) context.Context {
+	jobCtx := withLogger(srv.baseCtx, LoggerFromContext(ctx))
+	for _, key := range []ctxKey{TenantContextKey, RouteProfileContextKey, LocaleContextKey} {
+		if value := ctx.Value(key); value != nil {
+			jobCtx = context.WithValue(jobCtx, key, value)
+		}
+	}
+	return jobCtx
+}
+
+func (srv *Server) updateJob(ctx context.Context, id string, query string, args ...any) {
+	args = append(args, time.Now().UTC(), id)
+	if _, err := srv.db.ExecContext(ctx, "UPDATE jobs SET "+query+", updated_at = ? WHERE id = ?", args...); err != nil {
+		LoggerFromContext(ctx).Error("Failed to update job", "job", id, "error", err)
+	}
+}
+
+func (srv *Server) runJob(jobCtx context.Context, id string, jobReq JobRequest) {
+	select {
+	case srv.jobSlots <- struct{}{}:
+	case <-jobCtx.Done():
+		return
+	}
+	func() {
+		defer func() { <-srv.jobSlots }()
+		srv.executeJob(jobCtx, id, jobReq)
+	}()
+
+	// the slot is free again before the callback, whose retries take a while
+	if jobReq.CallbackUrl != "" {
+		srv.deliverJobCallback(jobCtx, jobReq.CallbackUrl, id)
+	}
+}
+
+func (srv *Server) executeJob(jobCtx context.Context, id string, jobReq JobRequest) {
+	var upstreamCalls atomic.Int64
+	ctx, cancel := context.WithTimeout(withUpstreamCounter(jobCtx, &upstreamCalls), time.Duration(srv.Cfg.Jobs.Timeout)*time.Second)
+	defer cancel()
+
+	started := time.Now()
+	srv.updateJob(ctx, id, "status = ?", JobStatusRunning)
+	slog.Info("Started job", "job", id, "type", jobReq.Type)
+
+	var result any
+	var err error
+	switch jobReq.Type {
+	case JobTypePlaylist:
+		var playlist *YouTubePlaylist
+		if playlist, err = srv.LoadPlaylist(ctx, jobReq.Id, jobReq.Limit); err == nil {
+			result = applyTenantFilters(ctx, playlist)
+		}
+	case JobTypeBatch:
+		result = srv.RunBatch(ctx, jobReq.Items, func(done int) {
+			srv.updateJob(ctx, id, "done = ?", done)
+		})
+	}
+
+	// the job context may have expired, the outcome still has to be recorded
+	storeCtx := context.WithoutCancel(ctx)
+	if tenant := TenantFromContext(ctx); tenant != nil {
+		srv.addUsage(storeCtx, tenant, 0, upstreamCalls.Load())
+	}
+	if err != nil {
+		srv.updateJob(storeCtx, id, "status = ?, error = ?", JobStatusFailed, err.Error())
+		slog.Error("Job failed", "job", id, "type", jobReq.Type, "error", err)
+		return
+	}
+
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		srv.updateJob(storeCtx, id, "status = ?, error = ?", JobStatusFailed, err.Error())
+		return
+	}
+	srv.updateJob(storeCtx, id, "status = ?, done = total, result = ?", JobStatusDone, encoded)
+	slog.Info("Finished job", "job", id, "type", jobReq.Type, "took", time.Since(started))
+}
+
+func (srv *Server) LookupJob(ctx context.Context, id string) (*Job, error) {
+	var job Job
+	var result []byte
+	err := srv.db.QueryRowContext(ctx,
+		`SELECT id, owner, type, status, done, total, error, result, created_at, updated_at, expires_at
+		FROM jobs WHERE id = ? AND expires_at > ?`,
+		id, time.Now().UTC(),
+	).Scan(
+		&job.Id, &job.Owner, &job.Type, &job.Status, &job.Done, &job.Total, &job.Error, &result,
+		&job.CreatedAt, &job.UpdatedAt, &job.ExpiresAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if len(result) > 0 {
+		job.Result = result
+	}
+	return &job, nil
+}
+
+func (srv *Server) deleteJob(ctx context.Context, id string) {
+	if _, err := srv.db.ExecContext(ctx, "DELETE FROM jobs WHERE id = ?", id); err != nil {
+		LoggerFromContext(ctx).Error("Failed to delete job", "job", id, "error", err)
+	}
+}
+
+// recoverJobs fails jobs that were still queued or running when the server stopped
+func (srv *Server) recoverJobs(ctx context.Context) error {
+	_, err := srv.db.ExecContext(ctx,
+		"UPDATE jobs SET status = ?, error = ?, updated_at = ? WHERE status IN (?, ?)",
+		JobStatusFailed, "interrupted by server restart", time.Now().UTC(), JobStatusPending, JobStatusRunning,
+	)
+	return err
+}
+
+func (srv *Server) ExpireJobs(ctx context.Context) {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !srv.maintainsDatabase() {
+				continue
+			}
+			now := time.Now().UTC()
+			res, err := srv.db.ExecContext(ctx, "DELETE FROM jobs WHERE expires_at <= ?", now)
+			if err != nil {
+				slog.Error("Failed to delete expired jobs", "error", err)
+				continue
+			}
+			if count, _ := res.RowsAffected(); count > 0 {
+				slog.Info("Deleted expired jobs", "count", count)
+			}
+			if _, err := srv.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE expires_at <= ?", now); err != nil {
+				slog.Error("Failed to delete expired idempotency keys", "error", err)
+			}
+		}
+	}
+}
+
+func (srv *Server) MakeCreateJobHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		if srv.db == nil {
+			writeError(writer, http.StatusServiceUnavailable, "jobs require caching to be enabled")
+			return
+		}
+
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			writeValidationError(writer, &ValidationError{Code: "invalid_body", Message: err.Error()})
+			return
+		}
+		var jobReq JobRequest
+		if err := json.Unmarshal(body, &jobReq); err != nil {
+			writeValidationError(writer, &ValidationError{Code: "invalid_body", Message: err.Error()})
+			return
+		}
+		if err := srv.validateJobRequest(req.Context(), &jobReq); err != nil {
+			writeValidationError(writer, &ValidationError{Code: "invalid_job", Message: err.Error()})
+			return
+		}
+
+		idempotent, handled := srv.claimIdempotencyKey(writer, req, "job", body)
+		if handled {
+			return
+		}
+
+		job, err := srv.CreateJob(req.Context(), jobReq)
+		if err != nil {
+			idempotent.Release(req.Context())
+			writeError(writer, http.StatusInternalServerError, fmt.Sprintf("Error creating job: %v", err))
+			return
+		}
+
+		// a replayed submission returns the job as it was created, its status is polled as usual
+		encoded, _ := json.Marshal(job)
+		encoded = append(encoded, '\n')
+		location := "/api/jobs/" + job.Id
+		idempotent.Complete(req.Context(), http.StatusAccepted, location, encoded)
+
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Header().Set("Location", location)
+		writer.WriteHeader(http.StatusAccepted)
+		_, _ = writer.Write(encoded)
+	}
+}
+
+func (srv *Server) MakeJobStatusHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		if srv.db == nil {
+			writeError(writer, http.StatusServiceUnavailable, "jobs require caching to be enabled")
+			return
+		}
+
+		job, err := srv.LookupJob(req.Context(), req.PathValue("id"))
+		if err != nil {
+			writeError(writer, http.StatusInternalServerError, fmt.Sprintf("Error loading job: %v", err))
+			return
+		}
+		// jobs of other tenants are answered as if they didn't exist
+		if job == nil || job.Owner != jobOwner(req.Context()) {
+			writeError(writer, http.StatusNotFound, "job not found")
+			return
+		}
+
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Header().Set("Cache-Control", "no-store")
+		if err := json.NewEncoder(writer).Encode(job); err != nil {
+			LoggerFromContext(req.Context()).Error("Failed to encode job", "error", err)
+			return
+		}
+		// finished results are handed out once
+		if job.Status == JobStatusDone || job.Status == JobStatusFailed {
+			srv.deleteJob(req.Context(), job.Id)
+		}
+	}
+}
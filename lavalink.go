@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// the load types of a Lavalink v4 loadtracks response
+const (
+	LavalinkLoadTrack    = "track"
+	LavalinkLoadPlaylist = "playlist"
+	LavalinkLoadSearch   = "search"
+	LavalinkLoadEmpty    = "empty"
+	LavalinkLoadError    = "error"
+)
+
+// LavalinkLoadResult is the loadType/data envelope a Lavalink node answers
+// /v4/loadtracks with, data depends on the load type
+type LavalinkLoadResult struct {
+	LoadType string `json:"loadType"`
+	Data     any    `json:"data"`
+}
+
+type LavalinkTrack struct {
+	Encoded    string            `json:"encoded"`
+	Info       LavalinkTrackInfo `json:"info"`
+	PluginInfo map[string]any    `json:"pluginInfo"`
+	UserData   map[string]any    `json:"userData"`
+}
+
+type LavalinkTrackInfo struct {
+	Identifier string  `json:"identifier"`
+	IsSeekable bool    `json:"isSeekable"`
+	Author     string  `json:"author"`
+	Length     int64   `json:"length"`
+	IsStream   bool    `json:"isStream"`
+	Position   int     `json:"position"`
+	Title      string  `json:"title"`
+	Uri        string  `json:"uri"`
+	ArtworkUrl *string `json:"artworkUrl"`
+	Isrc       *string `json:"isrc"`
+	SourceName string  `json:"sourceName"`
+}
+
+type LavalinkPlaylist struct {
+	Info       LavalinkPlaylistInfo `json:"info"`
+	PluginInfo map[string]any       `json:"pluginInfo"`
+	Tracks     []LavalinkTrack      `json:"tracks"`
+}
+
+type LavalinkPlaylistInfo struct {
+	Name string `json:"name"`
+	// SelectedTrack is the index of the track the link was opened at, -1 for none
+	SelectedTrack int `json:"selectedTrack"`
+}
+
+type LavalinkException struct {
+	Message string `json:"message"`
+	// Severity is common for errors of the request, fault for ones of the server
+	Severity string `json:"severity"`
+	Cause    string `json:"cause"`
+}
+
+func lavalinkTrackInfo(track YouTubeTrack, isrc string) LavalinkTrackInfo {
+	info := LavalinkTrackInfo{
+		Identifier: track.Identifier,
+		IsSeekable: !track.IsLive,
+		Author:     track.Author,
+		Length:     int64(track.Length),
+		IsStream:   track.IsLive,
+		Title:      track.Title,
+		Uri:        track.Uri,
+		SourceName: "youtube",
+	}
+	if track.IsLive {
+		// Lavaplayer's length of streams, which have none
+		info.Length = math.MaxInt64
+	}
+	// the largest thumbnail is listed last
+	if len(track.Images) > 0 {
+		info.ArtworkUrl = &track.Images[len(track.Images)-1].Url
+	}
+	if isrc != "" {
+		info.Isrc = &isrc
+	}
+	return info
+}
+
+func toLavalinkTrack(track YouTubeTrack, isrc string) LavalinkTrack {
+	info := lavalinkTrackInfo(track, isrc)
+	// a track that can't be encoded can't be played by Lavalink either, it is
+	// still listed like Lavalink lists unplayable results
+	encoded, _ := encodeLavaplayerTrack(info)
+	return LavalinkTrack{Encoded: encoded, Info: info, PluginInfo: map[string]any{}, UserData: map[string]any{}}
+}
+
+func toLavalinkTracks(tracks []YouTubeTrack) []LavalinkTrack {
+	converted := make([]LavalinkTrack, 0, len(tracks))
+	for _, track := range tracks {
+		converted = append(converted, toLavalinkTrack(track, ""))
+	}
+	return converted
+}
+
+// lavalinkSelectedTrack finds the video a playlist link was opened at
+func lavalinkSelectedTrack(rawUrl string, tracks []YouTubeTrack) int {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return -1
+	}
+	if videoId := parsed.Query().Get("v"); videoId != "" {
+		for i, track := range tracks {
+			if track.Identifier == videoId {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func lavalinkError(message string, severity string, err error) LavalinkLoadResult {
+	return LavalinkLoadResult{
+		LoadType: LavalinkLoadError,
+		Data:     LavalinkException{Message: message, Severity: severity, Cause: err.Error()},
+	}
+}
+
+// lavalinkSearch runs a ytsearch: or ytmsearch: identifier
+func (srv *Server) lavalinkSearch(ctx context.Context, searchType SearchType, query string) (LavalinkLoadResult, CacheStatus) {
+	if query == "" {
+		return LavalinkLoadResult{LoadType: LavalinkLoadEmpty, Data: map[string]any{}}, CacheStatus{}
+	}
+	tracks, _, cacheStatus, err := srv.searchFromYouTube(ctx, searchType, query, srv.defaultSearchOptions())
+	if err != nil {
+		return lavalinkError("Failed to search YouTube", "fault", err), CacheStatus{}
+	}
+	tracks = applyTenantFilters(ctx, tracks).([]YouTubeTrack)
+	if len(tracks) == 0 {
+		return LavalinkLoadResult{LoadType: LavalinkLoadEmpty, Data: map[string]any{}}, cacheStatus
+	}
+	return LavalinkLoadResult{LoadType: LavalinkLoadSearch, Data: toLavalinkTracks(tracks)}, cacheStatus
+}
+
+// lavalinkResolve loads a link or a bare video or playlist id, anything the
+// resolver doesn't know is empty like it is for Lavalink
+func (srv *Server) lavalinkResolve(ctx context.Context, identifier string) (LavalinkLoadResult, CacheStatus) {
+	result, cacheStatus, err := srv.resolveCached(ctx, identifier)
+	if errors.Is(err, ErrUnsupportedUrl) {
+		return LavalinkLoadResult{LoadType: LavalinkLoadEmpty, Data: map[string]any{}}, CacheStatus{}
+	}
+	if err != nil {
+		return lavalinkError("Failed to load the track", "common", err), CacheStatus{}
+	}
+
+	if result.Track != nil {
+		isrc := ""
+		if result.Source != nil {
+			isrc = result.Source.ISRC
+		}
+		return LavalinkLoadResult{LoadType: LavalinkLoadTrack, Data: toLavalinkTrack(*result.Track, isrc)}, cacheStatus
+	}
+	if result.Playlist == nil {
+		return LavalinkLoadResult{LoadType: LavalinkLoadEmpty, Data: map[string]any{}}, cacheStatus
+	}
+	tracks := applyTenantFilters(ctx, result.Playlist.Tracks).([]YouTubeTrack)
+	name := result.Playlist.Title
+	if result.Channel != nil {
+		// the uploads of a channel go by the channel's name
+		name = result.Channel.Title
+	}
+	return LavalinkLoadResult{
+		LoadType: LavalinkLoadPlaylist,
+		Data: LavalinkPlaylist{
+			Info:       LavalinkPlaylistInfo{Name: name, SelectedTrack: lavalinkSelectedTrack(identifier, tracks)},
+			PluginInfo: map[string]any{},
+			Tracks:     toLavalinkTracks(tracks),
+		},
+	}, cacheStatus
+}
+
+// MakeLavalinkLoadTracksHandler answers like the /v4/loadtracks route of a
+// Lavalink node, so Lavalink plugins can load tracks from this server without
+// translating its responses. Load failures are reported in the envelope with
+// status 200, as Lavalink does.
+func (srv *Server) MakeLavalinkLoadTracksHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		identifier := strings.TrimSpace(req.FormValue("identifier"))
+		if identifier == "" {
+			writeValidationError(writer, &ValidationError{
+				Code:    "missing_identifier",
+				Param:   "identifier",
+				Message: "identifier parameter is required",
+			})
+			return
+		}
+
+		var result LavalinkLoadResult
+		var cacheStatus CacheStatus
+		if query, ok := strings.CutPrefix(identifier, "ytsearch:"); ok {
+			result, cacheStatus = srv.lavalinkSearch(req.Context(), SearchTypeYouTube, strings.TrimSpace(query))
+		} else if query, ok := strings.CutPrefix(identifier, "ytmsearch:"); ok {
+			result, cacheStatus = srv.lavalinkSearch(req.Context(), SearchTypeYouTubeMusic, strings.TrimSpace(query))
+		} else {
+			result, cacheStatus = srv.lavalinkResolve(req.Context(), identifier)
+		}
+		srv.writeJSON(writer, req, result, cacheStatus)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"unicode/utf16"
+)
+
+// lavaplayerTrackVersion is the version of the track info written, the
+// version Lavalink v4 writes itself: 2 added the uri, 3 the artwork url and
+// the ISRC
+const lavaplayerTrackVersion = 3
+
+// the flag of a message header telling the message starts with a version byte
+const lavaplayerVersionedFlag = 1
+
+// lavaplayerWriter writes like the java DataOutput Lavaplayer encodes tracks
+// with: numbers big endian and strings as modified UTF-8
+type lavaplayerWriter struct {
+	buf []byte
+	err error
+}
+
+func (writer *lavaplayerWriter) writeBool(value bool) {
+	if value {
+		writer.buf = append(writer.buf, 1)
+	} else {
+		writer.buf = append(writer.buf, 0)
+	}
+}
+
+func (writer *lavaplayerWriter) writeLong(value int64) {
+	writer.buf = binary.BigEndian.AppendUint64(writer.buf, uint64(value))
+}
+
+// writeUTF writes a string the way DataOutput.writeUTF does: a two byte length,
+// then the UTF-16 code units of the string, with 0 and the surrogates of
+// characters outside the BMP taking two and three bytes
+func (writer *lavaplayerWriter) writeUTF(value string) {
+	var encoded []byte
+	for _, unit := range utf16.Encode([]rune(value)) {
+		switch {
+		case unit >= 0x01 && unit <= 0x7f:
+			encoded = append(encoded, byte(unit))
+		case unit <= 0x7ff:
+			encoded = append(encoded, 0xc0|byte(unit>>6), 0x80|byte(unit&0x3f))
+		default:
+			encoded = append(encoded, 0xe0|byte(unit>>12), 0x80|byte(unit>>6&0x3f), 0x80|byte(unit&0x3f))
+		}
+	}
+	if len(encoded) > 0xffff {
+		writer.err = fmt.Errorf("string of %d bytes is too long to encode", len(encoded))
+		return
+	}
+	writer.buf = binary.BigEndian.AppendUint16(writer.buf, uint16(len(encoded)))
+	writer.buf = append(writer.buf, encoded...)
+}
+
+// writeNullableUTF writes whether the string is set before the string itself
+func (writer *lavaplayerWriter) writeNullableUTF(value *string) {
+	writer.writeBool(value != nil)
+	if value != nil {
+		writer.writeUTF(*value)
+	}
+}
+
+// encodeLavaplayerTrack encodes a track the way Lavaplayer's encodeTrack does,
+// the encoded string Lavalink nodes accept to play a track without loading it
+// again. The message is the track info followed by the start position, behind
+// a header holding its size and the versioned flag. YouTube tracks carry no
+// source specific fields.
+func encodeLavaplayerTrack(info LavalinkTrackInfo) (string, error) {
+	writer := &lavaplayerWriter{}
+	writer.buf = append(writer.buf, lavaplayerTrackVersion)
+	writer.writeUTF(info.Title)
+	writer.writeUTF(info.Author)
+	writer.writeLong(info.Length)
+	writer.writeUTF(info.Identifier)
+	writer.writeBool(info.IsStream)
+	writer.writeNullableUTF(&info.Uri)
+	writer.writeNullableUTF(info.ArtworkUrl)
+	writer.writeNullableUTF(info.Isrc)
+	writer.writeUTF(info.SourceName)
+	writer.writeLong(int64(info.Position))
+	if writer.err != nil {
+		return "", writer.err
+	}
+
+	header := uint32(len(writer.buf)) | lavaplayerVersionedFlag<<30
+	message := binary.BigEndian.AppendUint32(nil, header)
+	return base64.StdEncoding.EncodeToString(append(message, writer.buf...)), nil
+}
+
+// encodedTrack returns the encoded string of a track, empty when it can't be
+// encoded
+func encodedTrack(track YouTubeTrack, isrc string) string {
+	encoded, err := encodeLavaplayerTrack(lavalinkTrackInfo(track, isrc))
+	if err != nil {
+		return ""
+	}
+	return encoded
+}
+
+// encodeTracks sets the encoded string on the tracks of a response value, on
+// copies as the tracks may be shared
+func encodeTracks(value any) any {
+	encode := func(tracks []YouTubeTrack) []YouTubeTrack {
+		encoded := slices.Clone(tracks)
+		for i := range encoded {
+			encoded[i].Encoded = encodedTrack(encoded[i], "")
+		}
+		return encoded
+	}
+	switch typed := value.(type) {
+	case YouTubeTrack:
+		typed.Encoded = encodedTrack(typed, "")
+		return typed
+	case *YouTubeTrack:
+		track := *typed
+		track.Encoded = encodedTrack(track, "")
+		return &track
+	case []YouTubeTrack:
+		return encode(typed)
+	case *YouTubePlaylist:
+		playlist := *typed
+		playlist.Tracks = encode(typed.Tracks)
+		return &playlist
+	case *ResolveResult:
+		result := *typed
+		if typed.Track != nil {
+			isrc := ""
+			if typed.Source != nil {
+				isrc = typed.Source.ISRC
+			}
+			track := *typed.Track
+			track.Encoded = encodedTrack(track, isrc)
+			result.Track = &track
+		}
+		if typed.Playlist != nil {
+			playlist := *typed.Playlist
+			playlist.Tracks = encode(typed.Playlist.Tracks)
+			result.Playlist = &playlist
+		}
+		return &result
+	}
+	return value
+}
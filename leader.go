@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	LeaderBackendRedis  = "redis"
+	LeaderBackendSQLite = "sqlite"
+)
+
+const leasesSchema = `
+	CREATE TABLE IF NOT EXISTS leases (
+		name TEXT PRIMARY KEY,
+		owner TEXT NOT NULL,
+		expires_at DATETIME NOT NULL
+	);`
+
+var leaderGauge = metrics.Gauge("ytsearch_leader", "1 when this replica runs the background maintenance jobs")
+
+type LeaderElectionConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Backend is redis or sqlite, sqlite only works for replicas sharing the cache database file
+	Backend string `yaml:"backend"`
+	Key     string `yaml:"key"`
+	// Lease is how many seconds a leader keeps its role without renewing it
+	Lease int `yaml:"lease"`
+	// SharedCache is set when the replicas share one cache database, always
+	// with the sqlite backend. Without it every replica maintains its own.
+	SharedCache bool `yaml:"shared_cache"`
+}
+
+// leaderLock acquires or renews a named lease for an owner
+type leaderLock interface {
+	acquire(ctx context.Context, owner string, ttl time.Duration) (bool, error)
+	release(ctx context.Context, owner string) error
+}
+
+type redisLeaderLock struct {
+	redis *RedisClient
+	key   string
+	held  bool
+}
+
+func (lock *redisLeaderLock) acquire(ctx context.Context, owner string, ttl time.Duration) (bool, error) {
+	var err error
+	if lock.held {
+		lock.held, err = lock.redis.Renew(ctx, lock.key, owner, ttl)
+	}
+	if !lock.held && err == nil {
+		lock.held, err = lock.redis.SetNX(ctx, lock.key, owner, ttl)
+	}
+	return lock.held, err
+}
+
+func (lock *redisLeaderLock) release(ctx context.Context, owner string) error {
+	lock.held = false
+	return lock.redis.Release(ctx, lock.key, owner)
+}
+
+type sqliteLeaderLock struct {
+	db  *sql.DB
+	key string
+}
+
+func (lock *sqliteLeaderLock) acquire(ctx context.Context, owner string, ttl time.Duration) (bool, error) {
+	now := time.Now().UTC()
+	res, err := lock.db.ExecContext(ctx, `INSERT INTO leases (name, owner, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET owner = excluded.owner, expires_at = excluded.expires_at
+		WHERE leases.owner = excluded.owner OR leases.expires_at <= ?`,
+		lock.key, owner, now.Add(ttl), now)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
+
+func (lock *sqliteLeaderLock) release(ctx context.Context, owner string) error {
+	_, err := lock.db.ExecContext(ctx, "DELETE FROM leases WHERE name = ? AND owner = ?", lock.key, owner)
+	return err
+}
+
+// LeaderElector decides which replica runs cache cleanup and other jobs that
+// would race when every replica ran them against the same storage
+type LeaderElector struct {
+	lock   leaderLock
+	owner  string
+	lease  time.Duration
+	leader atomic.Bool
+}
+
+func NewLeaderElector(cfg LeaderElectionConfig, redis *RedisClient, db *sql.DB) (*LeaderElector, error) {
+	elector := &LeaderElector{
+		owner: randomHex(8),
+		lease: time.Duration(cfg.Lease) * time.Second,
+	}
+	switch cfg.Backend {
+	case LeaderBackendRedis:
+		if redis == nil {
+			return nil, fmt.Errorf("leader election with redis requires redis.addr")
+		}
+		elector.lock = &redisLeaderLock{redis: redis, key: cfg.Key}
+	case LeaderBackendSQLite:
+		if db == nil {
+			return nil, fmt.Errorf("leader election with sqlite requires caching to be enabled")
+		}
+		elector.lock = &sqliteLeaderLock{db: db, key: cfg.Key}
+	default:
+		return nil, fmt.Errorf("unsupported leader election backend: %s", cfg.Backend)
+	}
+	return elector, nil
+}
+
+func (elector *LeaderElector) IsLeader() bool {
+	return elector.leader.Load()
+}
+
+func (elector *LeaderElector) tick(ctx context.Context) {
+	acquired, err := elector.lock.acquire(ctx, elector.owner, elector.lease)
+	if err != nil {
+		// step down, another replica may take over once the lease runs out
+		slog.Error("Failed to renew leadership", "error", err)
+		acquired = false
+	}
+	if elector.leader.Swap(acquired) != acquired {
+		slog.Info("Leadership changed", "leader", acquired, "owner", elector.owner)
+	}
+	if acquired {
+		leaderGauge.Set(1)
+	} else {
+		leaderGauge.Set(0)
+	}
+}
+
+// Run renews the lease three times per lease period and hands it back on shutdown
+func (elector *LeaderElector) Run(ctx context.Context) {
+	elector.tick(ctx)
+	ticker := time.NewTicker(elector.lease / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if elector.leader.Swap(false) {
+				if err := elector.lock.release(context.WithoutCancel(ctx), elector.owner); err != nil {
+					slog.Error("Failed to release leadership", "error", err)
+				}
+			}
+			return
+		case <-ticker.C:
+			elector.tick(ctx)
+		}
+	}
+}
+
+// IsLeader reports whether this replica should run the background jobs that
+// touch shared state, always true without leader election
+func (srv *Server) IsLeader() bool {
+	return srv.leader == nil || srv.leader.IsLeader()
+}
+
+// maintainsDatabase reports whether this replica trims, expires and refreshes
+// the cache database: always when the database is its own, only as leader
+// when the replicas share it
+func (srv *Server) maintainsDatabase() bool {
+	return !srv.Cfg.LeaderElection.SharedCache || srv.IsLeader()
+}
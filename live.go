@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// LiveDetails describes a stream that is live right now
+type LiveDetails struct {
+	ConcurrentViewers int        `json:"concurrent_viewers"`
+	ActualStartTime   *time.Time `json:"actual_start_time,omitempty"`
+	// LatencyClass is normal, low or ultra_low
+	LatencyClass string `json:"latency_class,omitempty"`
+	DvrEnabled   bool   `json:"dvr_enabled"`
+}
+
+// parseLatencyClass turns MDE_STREAM_OPTIMIZATIONS_RENDERER_LATENCY_ULTRA_LOW into ultra_low
+func parseLatencyClass(value string) string {
+	_, class, found := strings.Cut(value, "_LATENCY_")
+	if !found {
+		return ""
+	}
+	return strings.ToLower(class)
+}
+
+// parseLiveDetails reads the live stream fields of a player response, nil
+// when the video is not live
+func parseLiveDetails(data []byte) *LiveDetails {
+	details := gjson.GetBytes(data, "videoDetails")
+	if !details.Get("isLive").Bool() {
+		return nil
+	}
+	live := &LiveDetails{
+		LatencyClass: parseLatencyClass(details.Get("latencyClass").String()),
+		DvrEnabled:   details.Get("isLiveDvrEnabled").Bool(),
+	}
+	broadcast := gjson.GetBytes(data, "microformat.playerMicroformatRenderer.liveBroadcastDetails")
+	if started, err := time.Parse(time.RFC3339, broadcast.Get("startTimestamp").String()); err == nil {
+		started = started.UTC()
+		live.ActualStartTime = &started
+	}
+	return live
+}
+
+// parseScheduledStart reports whether a player response is a premiere or
+// stream that has not started yet and when it is scheduled to
+func parseScheduledStart(data []byte) (*time.Time, bool) {
+	slate := gjson.GetBytes(data,
+		"playabilityStatus.liveStreamability.liveStreamabilityRenderer.offlineSlate.liveStreamOfflineSlateRenderer")
+	upcoming := gjson.GetBytes(data, "videoDetails.isUpcoming").Bool() || slate.Exists()
+	if !upcoming {
+		return nil, false
+	}
+	if seconds := slate.Get("scheduledStartTime").Int(); seconds > 0 {
+		scheduled := time.Unix(seconds, 0).UTC()
+		return &scheduled, true
+	}
+	broadcast := gjson.GetBytes(data, "microformat.playerMicroformatRenderer.liveBroadcastDetails")
+	if scheduled, err := time.Parse(time.RFC3339, broadcast.Get("startTimestamp").String()); err == nil {
+		scheduled = scheduled.UTC()
+		return &scheduled, true
+	}
+	return nil, true
+}
+
+// parseUpcomingEvent reads the upcomingEventData of a search or related
+// result, set on premieres and scheduled streams that have not started
+func parseUpcomingEvent(itemRenderer gjson.Result) (*time.Time, bool) {
+	event := itemRenderer.Get("upcomingEventData")
+	if !event.Exists() {
+		return nil, false
+	}
+	if seconds := event.Get("startTime").Int(); seconds > 0 {
+		scheduled := time.Unix(seconds, 0).UTC()
+		return &scheduled, true
+	}
+	return nil, true
+}
+
+// markUpcoming turns a parsed result into a premiere, search results only
+// know the length of premieres once they aired
+func markUpcoming(track *YouTubeTrack, scheduled *time.Time) {
+	track.Type = "upcoming"
+	track.IsUpcoming = true
+	track.ScheduledStartTime = scheduled
+}
+
+// parseConcurrentViewers reads texts like "1,234 watching now"
+func parseConcurrentViewers(text string) int {
+	if !strings.Contains(strings.ToLower(text), "watching") {
+		return 0
+	}
+	return parseCount(text)
+}
+
+// loadConcurrentViewers reads the viewer count of a live stream from its watch page,
+// the player only reports the total views
+func (srv *Server) loadConcurrentViewers(ctx context.Context, videoID string) (int, error) {
+	visitor, err := srv.pickVisitor(ctx, true)
+	if err != nil {
+		return 0, err
+	}
+	respBody, err := srv.innertubeRequest(ctx, "live viewers", INNERTUBE_NEXT_API_URL, visitor, map[string]any{
+		"videoId": videoID,
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, content := range gjson.GetBytes(respBody, "contents.twoColumnWatchNextResults.results.results.contents").Array() {
+		viewCount := content.Get("videoPrimaryInfoRenderer.viewCount.videoViewCountRenderer")
+		if !viewCount.Exists() {
+			continue
+		}
+		text := viewCount.Get("viewCount.simpleText").String()
+		if text == "" {
+			for _, run := range viewCount.Get("viewCount.runs").Array() {
+				text += run.Get("text").String()
+			}
+		}
+		return parseConcurrentViewers(text), nil
+	}
+	return 0, newParseError("videoPrimaryInfoRenderer.viewCount", "missing", "")
+}
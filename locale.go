@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const LocaleContextKey ctxKey = "locale"
+
+var (
+	hlPattern = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,4})?$`)
+	glPattern = regexp.MustCompile(`^[a-zA-Z]{2}$`)
+)
+
+// Locale is the language and region YouTube is asked for, empty fields keep
+// what YouTube guessed for the visitor
+type Locale struct {
+	// Hl is the interface language, e.g. en or pt-BR, which the view counts,
+	// durations and publish times are formatted in
+	Hl string `yaml:"hl"`
+	// Gl is the region searched, e.g. US or DE
+	Gl string `yaml:"gl"`
+}
+
+func (locale Locale) validate() error {
+	if locale.Hl != "" && !hlPattern.MatchString(locale.Hl) {
+		return fmt.Errorf("invalid hl %q", locale.Hl)
+	}
+	if locale.Gl != "" && !glPattern.MatchString(locale.Gl) {
+		return fmt.Errorf("invalid gl %q", locale.Gl)
+	}
+	return nil
+}
+
+func LocaleFromContext(ctx context.Context) *Locale {
+	locale, _ := ctx.Value(LocaleContextKey).(*Locale)
+	return locale
+}
+
+// Locales attaches the hl and gl parameters of a request to its context
+func (srv *Server) Locales(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		locale := Locale{
+			Hl: strings.TrimSpace(req.URL.Query().Get("hl")),
+			Gl: strings.ToUpper(strings.TrimSpace(req.URL.Query().Get("gl"))),
+		}
+		if locale == (Locale{}) {
+			next.ServeHTTP(writer, req)
+			return
+		}
+		if locale.Hl != "" && !hlPattern.MatchString(locale.Hl) {
+			writeValidationError(writer, &ValidationError{
+				Code:    "invalid_hl",
+				Param:   "hl",
+				Message: "hl must be a language code like en or pt-BR",
+			})
+			return
+		}
+		if locale.Gl != "" && !glPattern.MatchString(locale.Gl) {
+			writeValidationError(writer, &ValidationError{
+				Code:    "invalid_gl",
+				Param:   "gl",
+				Message: "gl must be a two letter region code like US",
+			})
+			return
+		}
+		next.ServeHTTP(writer, req.WithContext(context.WithValue(req.Context(), LocaleContextKey, &locale)))
+	})
+}
+
+// innertubeLocale is the locale of a request: the configured one, whose region
+// the route profile and then the tenant override, and the request's own hl and
+// gl over all of them
+func (srv *Server) innertubeLocale(ctx context.Context) Locale {
+	locale := srv.Cfg.Locale
+	if profile := RouteProfileFromContext(ctx); profile != nil && profile.Region != "" {
+		locale.Gl = profile.Region
+	}
+	if tenant := TenantFromContext(ctx); tenant != nil && tenant.Region != "" {
+		locale.Gl = tenant.Region
+	}
+	if requested := LocaleFromContext(ctx); requested != nil {
+		if requested.Hl != "" {
+			locale.Hl = requested.Hl
+		}
+		if requested.Gl != "" {
+			locale.Gl = requested.Gl
+		}
+	}
+	return locale
+}
+
+// localizedInnertubeContext sets the locale in a copy of an innertube context,
+// the visitor contexts are shared between requests
+func localizedInnertubeContext(innertubeContext map[string]any, locale Locale) map[string]any {
+	if locale == (Locale{}) {
+		return innertubeContext
+	}
+	client, ok := innertubeContext["client"].(map[string]any)
+	if !ok {
+		return innertubeContext
+	}
+	copied := maps.Clone(innertubeContext)
+	copiedClient := maps.Clone(client)
+	if locale.Hl != "" {
+		copiedClient["hl"] = locale.Hl
+	}
+	if locale.Gl != "" {
+		copiedClient["gl"] = strings.ToUpper(locale.Gl)
+	}
+	copied["client"] = copiedClient
+	return copied
+}
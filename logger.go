@@ -1,11 +1,27 @@
 package main
 
 import (
+	"context"
 	"github.com/topi314/tint"
 	"log/slog"
 	"os"
 )
 
+const LoggerContextKey ctxKey = "logger"
+
+// LoggerFromContext returns the request scoped logger carrying the request id,
+// route, source and tenant, or the default logger outside of a request
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(LoggerContextKey).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+func withLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, LoggerContextKey, logger)
+}
+
 func reddactSensitiveInfo(groups []string, a slog.Attr) slog.Attr {
 	if a.Key == "dsn" || a.Key == "access_token" || a.Key == "password" {
 		a.Value = slog.StringValue("[REDACTED]")
@@ -28,13 +44,17 @@ const (
 	ansiMagenta = "\033[35m"
 )
 
+// logLevel can be changed at runtime by a config reload
+var logLevel = new(slog.LevelVar)
+
 func SetupLogger(cfg LogConfig) {
+	logLevel.Set(cfg.Level)
 	var handler slog.Handler
 	switch cfg.Format {
 	case "json":
 		handler = slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
 			AddSource:   cfg.AddSource,
-			Level:       cfg.Level,
+			Level:       logLevel,
 			ReplaceAttr: reddactSensitiveInfo,
 		})
 	case "text":
@@ -42,7 +62,7 @@ func SetupLogger(cfg LogConfig) {
 			ReplaceAttr: reddactSensitiveInfo,
 			AddSource:   cfg.AddSource,
 			NoColor:     cfg.NoColor,
-			Level:       cfg.Level,
+			Level:       logLevel,
 			LevelColors: map[slog.Level]string{
 				slog.LevelDebug: ansiMagenta,
 				slog.LevelInfo:  ansiGreen,
@@ -68,5 +88,5 @@ func SetupLogger(cfg LogConfig) {
 		slog.Error("Unsupported log format", "format", cfg.Format)
 		os.Exit(-1)
 	}
-	slog.SetDefault(slog.New(handler))
+	slog.SetDefault(slog.New(&recentErrorsHandler{Handler: handler}))
 }
@@ -13,6 +13,30 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		if err := RunBench(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, "bench:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "parse" {
+		if err := RunParseFixtures(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, "parse:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "openapi" {
+		if err := RunOpenAPI(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, "openapi:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	ctx := context.Background()
 
 	shutdownCtx, shutdownCancel := signal.NotifyContext(
@@ -25,6 +49,7 @@ func main() {
 	defer shutdownCancel()
 
 	configPath := flag.String("config", "config.yaml", "Path to configuration file")
+	mock := flag.Bool("mock", false, "Serve canned innertube responses instead of contacting YouTube")
 	flag.Parse()
 
 	if configPath == nil || *configPath == "" {
@@ -39,13 +64,67 @@ func main() {
 	slog.Info("Configuration loaded", "config", cfg.String())
 
 	SetupLogger(cfg.Logging)
+	artifacts = NewDebugArtifacts(cfg.Debug)
+	tenantLabels.Configure(cfg.Metrics)
+
+	server := &Server{
+		Cfg:           cfg,
+		configPath:    *configPath,
+		playlistSlots: make(chan struct{}, cfg.Playlist.MaxConcurrentLoads),
+		jobSlots:      make(chan struct{}, cfg.Jobs.MaxRunning),
+		external:      NewExternalHttpClient(cfg.RequestTimeout),
+		callbacks:     NewCallbackHttpClient(cfg.RequestTimeout),
+	}
+	server.accessLog, err = NewAccessLogger(cfg.Logging)
+	if err != nil {
+		panic(err)
+	}
+	server.client = NewHttpClient(cfg.RequestTimeout, cfg.Ipv6Subnet, cfg.MaxUpstreamConcurrency)
+	server.client.StaticHeaders = cfg.UpstreamHeaders
+	if *mock {
+		slog.Warn("Mock mode enabled, upstream requests are answered with canned responses")
+		server.client.Transport = MockTransport{}
+	} else if cfg.Fixtures.Mode != "" {
+		slog.Info("Upstream fixtures enabled", "mode", cfg.Fixtures.Mode, "dir", cfg.Fixtures.Dir)
+		server.client.Transport = NewFixtureTransport(cfg.Fixtures, server.client.Transport)
+	}
 
-	server := &Server{Cfg: cfg}
-	server.client = NewHttpClient(cfg.RequestTimeout, cfg.Ipv6Subnet)
+	if cfg.MusicBrainz.Enabled {
+		server.musicbrainz = NewMusicBrainzClient(cfg.MusicBrainz, cfg.RequestTimeout)
+	}
 
-	server.Start(shutdownCtx)
-	slog.Info("Server started", "address", cfg.ServerAddr)
+	if cfg.Redis.Addr != "" {
+		server.redis = NewRedisClient(cfg.Redis)
+	}
+	if cfg.VisitorPool.Backend == VisitorPoolRedis {
+		server.sharedVisitors = NewRedisVisitorPool(server.redis, cfg.VisitorPool)
+	}
+
+	if cfg.RetryBudget.Enabled {
+		server.retryBudget = NewRetryBudget(cfg.RetryBudget)
+	}
+
+	server.trustedProxies, _ = parseTrustedProxies(cfg.TrustedProxies)
+	if cfg.AnonymousRateLimit.Enabled {
+		server.anonymousLimiter = newKeyedRateLimiter(
+			cfg.AnonymousRateLimit.RequestsPerMinute,
+			cfg.AnonymousRateLimit.Burst,
+			cfg.AnonymousRateLimit.MaxTrackedClients,
+		)
+	}
 
+	if cfg.Auth.Enabled {
+		tenants, err := NewTenantStore(cfg.Auth)
+		if err != nil {
+			panic(fmt.Errorf("failed to load api keys: %w", err))
+		}
+		server.tenants = tenants
+		server.usage = NewUsageTracker()
+		go tenants.WatchKeysFile(shutdownCtx, time.Duration(cfg.Auth.ReloadInterval)*time.Second)
+	}
+
+	// the database and the leader elector are in place before anything runs
+	// that reads them, requests and maintenance loops alike
 	if cfg.Caching.Enabled {
 		if err := server.ConnectDb(shutdownCtx); err != nil {
 			slog.Error("Failed to connect to database", "error", err)
@@ -53,10 +132,30 @@ func main() {
 		}
 	}
 
+	if cfg.LeaderElection.Enabled {
+		leader, err := NewLeaderElector(cfg.LeaderElection, server.redis, server.db)
+		if err != nil {
+			panic(fmt.Errorf("failed to set up leader election: %w", err))
+		}
+		server.leader = leader
+		go leader.Run(shutdownCtx)
+	}
+
+	server.Start(shutdownCtx)
+	server.StartMaintenance(shutdownCtx)
+	slog.Info("Server started", "address", cfg.ServerAddr, "admin_address", cfg.Admin.Addr)
+
 	server.visitors = make([]*YouTubeVisitorData, 0)
 	server.ticker = time.NewTicker(30 * time.Minute)
 
-	for i := 0; i < cfg.MaxVisitorCount; i++ {
+	if server.sharedVisitors != nil {
+		if err := server.syncSharedVisitors(shutdownCtx); err != nil {
+			slog.Error("Failed to load shared visitors", "error", err)
+		}
+		go server.SyncSharedVisitors(shutdownCtx)
+	}
+
+	for i := 0; server.sharedVisitors == nil && i < cfg.MaxVisitorCount; i++ {
 		isYoutube := false
 		if i%2 != 0 {
 			isYoutube = true
@@ -71,13 +170,19 @@ func main() {
 	}
 
 	go server.RotateVisitors(shutdownCtx)
+	if cfg.Metrics.Push.Mode != "" {
+		go PushMetrics(shutdownCtx, cfg.Metrics.Push)
+	}
+	if cfg.Alerts.Enabled {
+		go server.RunAlerts(shutdownCtx)
+	}
 
 	slog.Info("Press Ctrl+C to shut down the server")
 
 	<-shutdownCtx.Done()
 
-	if server.db != nil {
-		if err := server.db.Close(); err != nil {
+	for _, db := range server.cacheShards {
+		if err := db.Close(); err != nil {
 			slog.Error("Error closing database", "error", err)
 		}
 	}
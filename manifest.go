@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type mpdManifest struct {
+	XMLName                   xml.Name `xml:"MPD"`
+	Xmlns                     string   `xml:"xmlns,attr"`
+	Profiles                  string   `xml:"profiles,attr"`
+	Type                      string   `xml:"type,attr"`
+	MediaPresentationDuration string   `xml:"mediaPresentationDuration,attr"`
+	MinBufferTime             string   `xml:"minBufferTime,attr"`
+	Period                    mpdPeriod
+}
+
+type mpdPeriod struct {
+	XMLName        xml.Name           `xml:"Period"`
+	AdaptationSets []mpdAdaptationSet `xml:"AdaptationSet"`
+}
+
+type mpdAdaptationSet struct {
+	Id                  int                 `xml:"id,attr"`
+	MimeType            string              `xml:"mimeType,attr"`
+	SubsegmentAlignment bool                `xml:"subsegmentAlignment,attr"`
+	Representations     []mpdRepresentation `xml:"Representation"`
+}
+
+type mpdRepresentation struct {
+	Id                string                  `xml:"id,attr"`
+	Codecs            string                  `xml:"codecs,attr"`
+	Bandwidth         int                     `xml:"bandwidth,attr"`
+	Width             int                     `xml:"width,attr,omitempty"`
+	Height            int                     `xml:"height,attr,omitempty"`
+	FrameRate         int                     `xml:"frameRate,attr,omitempty"`
+	AudioSamplingRate int                     `xml:"audioSamplingRate,attr,omitempty"`
+	AudioChannels     *mpdAudioChannelsConfig `xml:"AudioChannelConfiguration,omitempty"`
+	BaseURL           string                  `xml:"BaseURL"`
+	SegmentBase       mpdSegmentBase          `xml:"SegmentBase"`
+}
+
+type mpdAudioChannelsConfig struct {
+	SchemeIdUri string `xml:"schemeIdUri,attr"`
+	Value       int    `xml:"value,attr"`
+}
+
+type mpdSegmentBase struct {
+	IndexRange     string `xml:"indexRange,attr"`
+	Initialization struct {
+		Range string `xml:"range,attr"`
+	} `xml:"Initialization"`
+}
+
+// buildDashManifest lays out the adaptive formats as a static on-demand MPD,
+// one adaptation set per container. Formats without a url or the init and
+// index ranges a player needs to find the segments are left out.
+func buildDashManifest(formats *StreamFormats) ([]byte, error) {
+	sets := make(map[string]*mpdAdaptationSet)
+	var durationMs int64
+	for _, format := range formats.Formats {
+		if !format.Adaptive || format.Url == "" || format.InitRange == "" || format.IndexRange == "" {
+			continue
+		}
+		set, ok := sets[format.MimeType]
+		if !ok {
+			set = &mpdAdaptationSet{MimeType: format.MimeType, SubsegmentAlignment: true}
+			sets[format.MimeType] = set
+		}
+		representation := mpdRepresentation{
+			Id:                strconv.Itoa(format.Itag),
+			Codecs:            format.Codecs,
+			Bandwidth:         format.Bitrate,
+			Width:             format.Width,
+			Height:            format.Height,
+			FrameRate:         format.Fps,
+			AudioSamplingRate: format.AudioSampleRate,
+			BaseURL:           format.Url,
+		}
+		if format.AudioChannels > 0 {
+			representation.AudioChannels = &mpdAudioChannelsConfig{
+				SchemeIdUri: "urn:mpeg:dash:23003:3:audio_channel_configuration:2011",
+				Value:       format.AudioChannels,
+			}
+		}
+		representation.SegmentBase.IndexRange = format.IndexRange
+		representation.SegmentBase.Initialization.Range = format.InitRange
+		set.Representations = append(set.Representations, representation)
+		durationMs = max(durationMs, format.DurationMs)
+	}
+	if len(sets) == 0 {
+		return nil, fmt.Errorf("video %s has no adaptive formats to build a manifest from", formats.VideoId)
+	}
+
+	manifest := mpdManifest{
+		Xmlns:                     "urn:mpeg:dash:schema:mpd:2011",
+		Profiles:                  "urn:mpeg:dash:profile:isoff-on-demand:2011",
+		Type:                      "static",
+		MediaPresentationDuration: fmt.Sprintf("PT%d.%03dS", durationMs/1000, durationMs%1000),
+		MinBufferTime:             "PT1.500S",
+	}
+	mimeTypes := make([]string, 0, len(sets))
+	for mimeType := range sets {
+		mimeTypes = append(mimeTypes, mimeType)
+	}
+	sort.Strings(mimeTypes)
+	for i, mimeType := range mimeTypes {
+		set := sets[mimeType]
+		set.Id = i
+		sort.Slice(set.Representations, func(a, b int) bool {
+			return set.Representations[a].Bandwidth > set.Representations[b].Bandwidth
+		})
+		manifest.Period.AdaptationSets = append(manifest.Period.AdaptationSets, *set)
+	}
+
+	body, err := xml.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+func (srv *Server) MakeManifestHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		file := req.PathValue("file")
+		videoId, isDash := strings.CutSuffix(file, ".mpd")
+		isHls := false
+		if !isDash {
+			videoId, isHls = strings.CutSuffix(file, ".m3u8")
+		}
+		if !isDash && !isHls {
+			writeRequestError(writer, http.StatusNotFound, &ValidationError{
+				Code:    "unsupported_manifest",
+				Message: "manifests are served as <videoId>.mpd or <videoId>.m3u8",
+			})
+			return
+		}
+		if !DirectVideoIDPattern.MatchString(videoId) {
+			writeValidationError(writer, &ValidationError{
+				Code:    "invalid_video_id",
+				Param:   "videoId",
+				Message: "a valid video id is required",
+			})
+			return
+		}
+
+		// the manifest embeds stream urls that expire within hours, so it is never cached
+		formats, err := srv.LoadStreamFormats(req.Context(), videoId, true)
+		if err != nil {
+			writeError(writer, http.StatusInternalServerError, fmt.Sprintf("Error loading formats: %v", err))
+			return
+		}
+
+		if isHls {
+			// youtube only has hls playlists for live streams, its own one is served as is
+			if formats.HlsManifestUrl == "" {
+				writeRequestError(writer, http.StatusNotFound, &ValidationError{
+					Code:    "hls_unavailable",
+					Message: fmt.Sprintf("video %s has no hls manifest, use %s.mpd", videoId, videoId),
+				})
+				return
+			}
+			http.Redirect(writer, req, formats.HlsManifestUrl, http.StatusFound)
+			return
+		}
+
+		manifest, err := buildDashManifest(formats)
+		if err != nil {
+			writeRequestError(writer, http.StatusNotFound, &ValidationError{
+				Code:    "dash_unavailable",
+				Message: err.Error(),
+			})
+			return
+		}
+		writer.Header().Set("Content-Type", "application/dash+xml")
+		writer.Header().Set("Cache-Control", "no-store")
+		_, _ = writer.Write(manifest)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var bracketedPattern = regexp.MustCompile(`[\(\[][^\)\]]*[\)\]]`)
+
+// MatchReference is the known metadata a search result is compared against
+type MatchReference struct {
+	Title    string
+	Artist   string
+	LengthMs int
+}
+
+func normalizeMatchText(text string) string {
+	text = strings.ToLower(bracketedPattern.ReplaceAllString(text, " "))
+	text = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			return r
+		}
+		return ' '
+	}, text)
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// textSimilarity is the dice coefficient of the normalized word sets, in [0, 1]
+func textSimilarity(a string, b string) float64 {
+	tokensA := strings.Fields(normalizeMatchText(a))
+	tokensB := strings.Fields(normalizeMatchText(b))
+	if len(tokensA) == 0 || len(tokensB) == 0 {
+		return 0
+	}
+
+	setB := make(map[string]int, len(tokensB))
+	for _, token := range tokensB {
+		setB[token]++
+	}
+	common := 0
+	for _, token := range tokensA {
+		if setB[token] > 0 {
+			setB[token]--
+			common++
+		}
+	}
+	return 2 * float64(common) / float64(len(tokensA)+len(tokensB))
+}
+
+// containsSimilarity also accepts titles that embed the reference, e.g.
+// "Artist - Title (Official Video)"
+func containsSimilarity(candidate string, reference string) float64 {
+	normCandidate := normalizeMatchText(candidate)
+	normReference := normalizeMatchText(reference)
+	if normReference != "" && strings.Contains(normCandidate, normReference) {
+		return 1
+	}
+	return textSimilarity(candidate, reference)
+}
+
+// durationCloseness is 1 for identical lengths and falls to 0 at toleranceMs
+func durationCloseness(lengthMs int, referenceMs int, toleranceMs int) float64 {
+	diff := lengthMs - referenceMs
+	if diff < 0 {
+		diff = -diff
+	}
+	if diff >= toleranceMs {
+		return 0
+	}
+	return 1 - float64(diff)/float64(toleranceMs)
+}
+
+// scoreTrack rates how well a track matches the reference, in [0, 1]
+func scoreTrack(track YouTubeTrack, ref MatchReference) float64 {
+	score, weights := 0.0, 0.0
+	if ref.Title != "" {
+		score += 0.5 * containsSimilarity(track.Title, ref.Title)
+		weights += 0.5
+	}
+	if ref.Artist != "" {
+		score += 0.3 * max(
+			containsSimilarity(track.Author, ref.Artist),
+			containsSimilarity(track.Title, ref.Artist),
+		)
+		weights += 0.3
+	}
+	if ref.LengthMs > 0 {
+		score += 0.2 * durationCloseness(track.Length, ref.LengthMs, 15000)
+		weights += 0.2
+	}
+	if weights == 0 {
+		return 0
+	}
+	return score / weights
+}
+
+// parseScoreReference reads the optional scoring parameters of a search, the
+// title defaults to the query and nil means the caller asked for no scores
+func parseScoreReference(req *http.Request, query string) (*MatchReference, error) {
+	ref := &MatchReference{
+		Title:  req.FormValue("title"),
+		Artist: req.FormValue("artist"),
+	}
+	if target := req.FormValue("target_duration_ms"); target != "" {
+		lengthMs, err := strconv.Atoi(target)
+		if err != nil || lengthMs <= 0 {
+			return nil, fmt.Errorf("target_duration_ms must be a positive integer")
+		}
+		ref.LengthMs = lengthMs
+	}
+	if req.FormValue("score") != "true" && ref.Title == "" && ref.Artist == "" && ref.LengthMs == 0 {
+		return nil, nil
+	}
+	if ref.Title == "" {
+		ref.Title = query
+	}
+	return ref, nil
+}
+
+// withScores returns copies of the tracks carrying their score against ref
+func withScores(tracks []YouTubeTrack, ref *MatchReference) []YouTubeTrack {
+	if ref == nil {
+		return tracks
+	}
+	scored := slices.Clone(tracks)
+	for i := range scored {
+		score := math.Round(scoreTrack(scored[i], *ref)*1000) / 1000
+		scored[i].Score = &score
+	}
+	return scored
+}
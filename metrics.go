@@ -0,0 +1,338 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// a tiny prometheus compatible registry, enough for counters, gauges and histograms
+// without pulling in the whole client library
+
+var metrics = NewMetricsRegistry()
+
+type metricFamily interface {
+	write(w io.Writer)
+	samples() []metricSample
+}
+
+// metricSample is one value of a family, used by the push exporters
+type metricSample struct {
+	Name       string
+	Kind       string
+	LabelNames []string
+	Labels     []string
+	Value      float64
+}
+
+type MetricsRegistry struct {
+	mu       sync.Mutex
+	families map[string]metricFamily
+	names    []string
+	// collectors refresh gauges derived from live state right before a scrape
+	collectors []func()
+}
+
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{families: make(map[string]metricFamily)}
+}
+
+func (registry *MetricsRegistry) register(name string, family metricFamily) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if _, ok := registry.families[name]; ok {
+		panic(fmt.Sprintf("metric %s registered twice", name))
+	}
+	registry.families[name] = family
+	registry.names = append(registry.names, name)
+	slices.Sort(registry.names)
+}
+
+func (registry *MetricsRegistry) OnCollect(collector func()) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.collectors = append(registry.collectors, collector)
+}
+
+// collect runs the collectors and returns the families sorted by name
+func (registry *MetricsRegistry) collect() []metricFamily {
+	registry.mu.Lock()
+	collectors := slices.Clone(registry.collectors)
+	registry.mu.Unlock()
+	for _, collect := range collectors {
+		collect()
+	}
+
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	families := make([]metricFamily, 0, len(registry.names))
+	for _, name := range registry.names {
+		families = append(families, registry.families[name])
+	}
+	return families
+}
+
+func (registry *MetricsRegistry) Write(w io.Writer) {
+	for _, family := range registry.collect() {
+		family.write(w)
+	}
+}
+
+// Samples returns every current value of the registry for the push exporters
+func (registry *MetricsRegistry) Samples() []metricSample {
+	var samples []metricSample
+	for _, family := range registry.collect() {
+		samples = append(samples, family.samples()...)
+	}
+	return samples
+}
+
+func (registry *MetricsRegistry) Handler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		registry.Write(writer)
+	}
+}
+
+type labeledValues struct {
+	name       string
+	help       string
+	kind       string
+	labelNames []string
+	mu         sync.Mutex
+	values     map[string]float64
+	labels     map[string][]string
+}
+
+func newLabeledValues(name, help, kind string, labelNames []string) *labeledValues {
+	return &labeledValues{
+		name:       name,
+		help:       help,
+		kind:       kind,
+		labelNames: labelNames,
+		values:     make(map[string]float64),
+		labels:     make(map[string][]string),
+	}
+}
+
+func (lv *labeledValues) key(labelValues []string) string {
+	if len(labelValues) != len(lv.labelNames) {
+		panic(fmt.Sprintf("metric %s expects %d labels, got %d", lv.name, len(lv.labelNames), len(labelValues)))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+func (lv *labeledValues) add(delta float64, labelValues []string) {
+	key := lv.key(labelValues)
+	lv.mu.Lock()
+	if _, ok := lv.labels[key]; !ok {
+		lv.labels[key] = slices.Clone(labelValues)
+	}
+	lv.values[key] += delta
+	lv.mu.Unlock()
+}
+
+func (lv *labeledValues) set(value float64, labelValues []string) {
+	key := lv.key(labelValues)
+	lv.mu.Lock()
+	if _, ok := lv.labels[key]; !ok {
+		lv.labels[key] = slices.Clone(labelValues)
+	}
+	lv.values[key] = value
+	lv.mu.Unlock()
+}
+
+func (lv *labeledValues) get(labelValues []string) float64 {
+	key := lv.key(labelValues)
+	lv.mu.Lock()
+	defer lv.mu.Unlock()
+	return lv.values[key]
+}
+
+func (lv *labeledValues) write(w io.Writer) {
+	lv.mu.Lock()
+	defer lv.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", lv.name, lv.help, lv.name, lv.kind)
+	keys := make([]string, 0, len(lv.values))
+	for key := range lv.values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s%s %s\n", lv.name, formatLabels(lv.labelNames, lv.labels[key], "", ""), formatValue(lv.values[key]))
+	}
+}
+
+func (lv *labeledValues) samples() []metricSample {
+	lv.mu.Lock()
+	defer lv.mu.Unlock()
+	samples := make([]metricSample, 0, len(lv.values))
+	for key, value := range lv.values {
+		samples = append(samples, metricSample{
+			Name:       lv.name,
+			Kind:       lv.kind,
+			LabelNames: lv.labelNames,
+			Labels:     lv.labels[key],
+			Value:      value,
+		})
+	}
+	return samples
+}
+
+type CounterVec struct {
+	*labeledValues
+}
+
+func (registry *MetricsRegistry) Counter(name, help string, labelNames ...string) *CounterVec {
+	counter := &CounterVec{newLabeledValues(name, help, "counter", labelNames)}
+	registry.register(name, counter)
+	return counter
+}
+
+func (counter *CounterVec) Inc(labelValues ...string) {
+	counter.add(1, labelValues)
+}
+
+func (counter *CounterVec) Add(delta float64, labelValues ...string) {
+	counter.add(delta, labelValues)
+}
+
+func (counter *CounterVec) Value(labelValues ...string) float64 {
+	return counter.get(labelValues)
+}
+
+type GaugeVec struct {
+	*labeledValues
+}
+
+func (registry *MetricsRegistry) Gauge(name, help string, labelNames ...string) *GaugeVec {
+	gauge := &GaugeVec{newLabeledValues(name, help, "gauge", labelNames)}
+	registry.register(name, gauge)
+	return gauge
+}
+
+func (gauge *GaugeVec) Set(value float64, labelValues ...string) {
+	gauge.set(value, labelValues)
+}
+
+func (gauge *GaugeVec) Add(delta float64, labelValues ...string) {
+	gauge.add(delta, labelValues)
+}
+
+func (gauge *GaugeVec) Value(labelValues ...string) float64 {
+	return gauge.get(labelValues)
+}
+
+type histogramValue struct {
+	labels  []string
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+type HistogramVec struct {
+	name       string
+	help       string
+	labelNames []string
+	bounds     []float64
+	mu         sync.Mutex
+	values     map[string]*histogramValue
+}
+
+var DefaultLatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+func (registry *MetricsRegistry) Histogram(name, help string, bounds []float64, labelNames ...string) *HistogramVec {
+	histogram := &HistogramVec{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		bounds:     bounds,
+		values:     make(map[string]*histogramValue),
+	}
+	registry.register(name, histogram)
+	return histogram
+}
+
+func (histogram *HistogramVec) Observe(value float64, labelValues ...string) {
+	if len(labelValues) != len(histogram.labelNames) {
+		panic(fmt.Sprintf("metric %s expects %d labels, got %d", histogram.name, len(histogram.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	histogram.mu.Lock()
+	defer histogram.mu.Unlock()
+	hv, ok := histogram.values[key]
+	if !ok {
+		hv = &histogramValue{labels: slices.Clone(labelValues), buckets: make([]uint64, len(histogram.bounds))}
+		histogram.values[key] = hv
+	}
+	for i, bound := range histogram.bounds {
+		if value <= bound {
+			hv.buckets[i]++
+		}
+	}
+	hv.count++
+	hv.sum += value
+}
+
+func (histogram *HistogramVec) write(w io.Writer) {
+	histogram.mu.Lock()
+	defer histogram.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", histogram.name, histogram.help, histogram.name)
+	keys := make([]string, 0, len(histogram.values))
+	for key := range histogram.values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		hv := histogram.values[key]
+		for i, bound := range histogram.bounds {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", histogram.name,
+				formatLabels(histogram.labelNames, hv.labels, "le", formatValue(bound)), hv.buckets[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", histogram.name, formatLabels(histogram.labelNames, hv.labels, "le", "+Inf"), hv.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", histogram.name, formatLabels(histogram.labelNames, hv.labels, "", ""), formatValue(hv.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", histogram.name, formatLabels(histogram.labelNames, hv.labels, "", ""), hv.count)
+	}
+}
+
+// samples reports histograms as their count and sum counters, push targets
+// without bucket support can still derive rates and averages from them
+func (histogram *HistogramVec) samples() []metricSample {
+	histogram.mu.Lock()
+	defer histogram.mu.Unlock()
+	samples := make([]metricSample, 0, 2*len(histogram.values))
+	for _, hv := range histogram.values {
+		samples = append(samples,
+			metricSample{Name: histogram.name + "_count", Kind: "counter", LabelNames: histogram.labelNames, Labels: hv.labels, Value: float64(hv.count)},
+			metricSample{Name: histogram.name + "_sum", Kind: "counter", LabelNames: histogram.labelNames, Labels: hv.labels, Value: hv.sum},
+		)
+	}
+	return samples
+}
+
+func formatLabels(names []string, values []string, extraName string, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+	pairs := make([]string, 0, len(names)+1)
+	for i, name := range names {
+		pairs = append(pairs, name+"="+strconv.Quote(values[i]))
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+"="+strconv.Quote(extraValue))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	PushModeStatsd      = "statsd"
+	PushModeDogStatsd   = "dogstatsd"
+	PushModePushGateway = "pushgateway"
+)
+
+// statsd packets are kept below the common 1500 byte mtu
+const maxStatsdPacket = 1400
+
+type MetricsPushConfig struct {
+	Mode string `yaml:"mode"`
+	// Address is host:port of the statsd agent or the push gateway url
+	Address  string `yaml:"address"`
+	Interval int    `yaml:"interval"`
+	// Prefix is prepended to statsd metric names
+	Prefix string `yaml:"prefix"`
+	// Job and Instance group the metrics on the push gateway, the instance
+	// defaults to the hostname
+	Job      string `yaml:"job"`
+	Instance string `yaml:"instance"`
+}
+
+type metricsPusher struct {
+	cfg    MetricsPushConfig
+	client *http.Client
+	// last sent counter values, statsd counters are deltas
+	sent map[string]float64
+}
+
+func statsdName(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-', r == '.':
+			return r
+		}
+		return '_'
+	}, value)
+}
+
+// statsdLine formats a sample, dogstatsd gets its labels as tags while plain
+// statsd has them appended to the name
+func (pusher *metricsPusher) statsdLine(sample metricSample, value float64) string {
+	name := pusher.cfg.Prefix + sample.Name
+	kind := "g"
+	if sample.Kind == "counter" {
+		kind = "c"
+	}
+	var tags []string
+	for i, label := range sample.Labels {
+		if label == "" {
+			continue
+		}
+		if pusher.cfg.Mode == PushModeDogStatsd {
+			tags = append(tags, sample.LabelNames[i]+":"+statsdName(label))
+		} else {
+			name += "." + statsdName(label)
+		}
+	}
+	line := name + ":" + strconv.FormatFloat(value, 'f', -1, 64) + "|" + kind
+	if len(tags) > 0 {
+		line += "|#" + strings.Join(tags, ",")
+	}
+	return line
+}
+
+func (pusher *metricsPusher) pushStatsd() error {
+	conn, err := net.Dial("udp", pusher.cfg.Address)
+	if err != nil {
+		return fmt.Errorf("failed to connect to statsd: %w", err)
+	}
+	defer conn.Close()
+
+	var packet bytes.Buffer
+	flush := func() error {
+		if packet.Len() == 0 {
+			return nil
+		}
+		_, err := conn.Write(packet.Bytes())
+		packet.Reset()
+		return err
+	}
+	for _, sample := range metrics.Samples() {
+		value := sample.Value
+		if sample.Kind == "counter" {
+			key := sample.Name + "\xff" + strings.Join(sample.Labels, "\xff")
+			value -= pusher.sent[key]
+			pusher.sent[key] = sample.Value
+			if value == 0 {
+				continue
+			}
+		}
+		line := pusher.statsdLine(sample, value)
+		if packet.Len() > 0 && packet.Len()+1+len(line) > maxStatsdPacket {
+			if err := flush(); err != nil {
+				return fmt.Errorf("failed to send statsd packet: %w", err)
+			}
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	if err := flush(); err != nil {
+		return fmt.Errorf("failed to send statsd packet: %w", err)
+	}
+	return nil
+}
+
+func (pusher *metricsPusher) pushGateway(ctx context.Context) error {
+	var body bytes.Buffer
+	metrics.Write(&body)
+
+	target := strings.TrimRight(pusher.cfg.Address, "/") + "/metrics/job/" + url.PathEscape(pusher.cfg.Job) +
+		"/instance/" + url.PathEscape(pusher.cfg.Instance)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, target, &body)
+	if err != nil {
+		return fmt.Errorf("failed to create push gateway request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	resp, err := pusher.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to push metrics: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("push gateway answered with status: %s", resp.Status)
+	}
+	return nil
+}
+
+// PushMetrics sends the registry to the configured statsd agent or push
+// gateway every interval, for setups without a prometheus scraper
+func PushMetrics(ctx context.Context, cfg MetricsPushConfig) {
+	if cfg.Instance == "" {
+		cfg.Instance, _ = os.Hostname()
+	}
+	pusher := &metricsPusher{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+		sent:   make(map[string]float64),
+	}
+	ticker := time.NewTicker(time.Duration(cfg.Interval) * time.Second)
+	defer ticker.Stop()
+
+	slog.Info("Pushing metrics", "mode", cfg.Mode, "address", cfg.Address, "interval", cfg.Interval)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		var err error
+		if cfg.Mode == PushModePushGateway {
+			err = pusher.pushGateway(ctx)
+		} else {
+			err = pusher.pushStatsd()
+		}
+		if err != nil {
+			slog.Error("Failed to push metrics", "mode", cfg.Mode, "error", err)
+		}
+	}
+}
+
+func validatePushConfig(cfg MetricsPushConfig) error {
+	switch cfg.Mode {
+	case "":
+		return nil
+	case PushModeStatsd, PushModeDogStatsd:
+		if _, _, err := net.SplitHostPort(cfg.Address); err != nil {
+			return fmt.Errorf("metrics.push.address must be host:port for %s: %w", cfg.Mode, err)
+		}
+	case PushModePushGateway:
+		parsed, err := url.Parse(cfg.Address)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return fmt.Errorf("metrics.push.address must be an http(s) url for the push gateway")
+		}
+	default:
+		return fmt.Errorf("unsupported metrics push mode: %s", cfg.Mode)
+	}
+	return nil
+}
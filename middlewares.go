@@ -1,45 +1,230 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"log/slog"
 	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 )
 
-func RequestLogger(next http.Handler) http.Handler {
+// statusRecorder remembers the status code and body size a handler wrote
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Write(data []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(data)
+	rec.bytes += n
+	return n, err
+}
+
+func (rec *statusRecorder) Status() int {
+	if rec.status == 0 {
+		return http.StatusOK
+	}
+	return rec.status
+}
+
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+const RequestInfoContextKey ctxKey = "requestInfo"
+
+// RequestInfo describes a request for logs and metrics, the tenant is filled
+// in once the api key has been resolved further down the chain
+type RequestInfo struct {
+	Id     string
+	Route  string
+	Source string
+	Tenant string
+
+	mu        sync.Mutex
+	startedAt time.Time
+	upstream  []UpstreamTiming
+	// retries counts the fallback calls per endpoint against the retry budget
+	retries map[string]int
+	// cache and parsers are only reported in the output of ?debug=true requests
+	cache   []CacheDecision
+	parsers []ParseTrace
+}
+
+// UpstreamTiming is one upstream call made while serving a request
+type UpstreamTiming struct {
+	Host       string  `json:"host"`
+	Endpoint   string  `json:"endpoint"`
+	Status     string  `json:"status"`
+	DurationMs float64 `json:"duration_ms"`
+	Retry      int     `json:"retry"`
+	Visitor    string  `json:"visitor,omitempty"`
+	Client     string  `json:"client,omitempty"`
+	// SourcePrefix is the /64 of the rotated ipv6 address the call was made from
+	SourcePrefix string `json:"source_prefix,omitempty"`
+}
+
+// addUpstream records an upstream call, a call following failed calls to the
+// same endpoint counts as their retry
+func (info *RequestInfo) addUpstream(timing UpstreamTiming) {
+	info.mu.Lock()
+	defer info.mu.Unlock()
+	for _, previous := range info.upstream {
+		if previous.Host == timing.Host && previous.Endpoint == timing.Endpoint && !strings.HasPrefix(previous.Status, "2") {
+			timing.Retry++
+		}
+	}
+	info.upstream = append(info.upstream, timing)
+}
+
+func (info *RequestInfo) Upstream() []UpstreamTiming {
+	info.mu.Lock()
+	defer info.mu.Unlock()
+	return slices.Clone(info.upstream)
+}
+
+func RequestInfoFromContext(ctx context.Context) *RequestInfo {
+	info, _ := ctx.Value(RequestInfoContextKey).(*RequestInfo)
+	if info == nil {
+		return &RequestInfo{}
+	}
+	return info
+}
+
+// requestIdPattern limits the request ids taken from clients to ones safe to
+// log and send on upstream
+var requestIdPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// requestId is the id a client sent in X-Request-ID, or a new one
+func requestId(header string) string {
+	if requestIdPattern.MatchString(header) {
+		return header
+	}
+	return randomHex(8)
+}
+
+// RequestContext gives every request an id and a logger carrying it together
+// with the matched route and the client address. The id is taken from the
+// X-Request-ID of the client if it sent one, and answered in X-Request-ID so a
+// failing request can be found in the logs.
+func (srv *Server) RequestContext(mux *http.ServeMux, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		startedAt := time.Now()
-		slog.Info(
-			"Incoming request",
-			"method",
-			r.Method,
-			"url",
-			r.URL.String(),
-			"remote_addr",
-			r.RemoteAddr,
+		_, route := mux.Handler(r)
+		info := &RequestInfo{
+			Id:        requestId(r.Header.Get("X-Request-ID")),
+			Route:     route,
+			Source:    clientAddr(r, srv.trustedProxies),
+			startedAt: time.Now(),
+		}
+		logger := slog.Default().With(
+			"request_id", info.Id,
+			"route", info.Route,
+			"source", info.Source,
 		)
-		next.ServeHTTP(w, r)
+		ctx := context.WithValue(withLogger(r.Context(), logger), RequestInfoContextKey, info)
+		w.Header().Set("X-Request-ID", info.Id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequestLogger logs every request, as a pair of log records by default or as
+// a single access log line in the configured format
+func (srv *Server) RequestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		startedAt := time.Now()
+		logger := LoggerFromContext(r.Context())
+		accessLog := srv.accessLog != nil
+		if !accessLog {
+			logger.Info(
+				"Incoming request",
+				"method",
+				r.Method,
+				"url",
+				loggedUrl(r),
+				"remote_addr",
+				r.RemoteAddr,
+			)
+		}
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
 		duration := time.Since(startedAt)
-		slog.Info(
+		srv.logSlowRequest(r, recorder.Status(), duration)
+		if accessLog {
+			srv.accessLog.Write(r, recorder, startedAt, duration)
+			return
+		}
+		logger.Info(
 			"Completed request",
 			"method",
 			r.Method,
 			"url",
-			r.URL.String(),
+			loggedUrl(r),
 			"remote_addr",
 			r.RemoteAddr,
+			"status",
+			recorder.Status(),
+			"bytes",
+			recorder.bytes,
+			"cache",
+			recorder.Header().Get("X-Cache"),
 			"duration_ms",
 			duration.Milliseconds(),
 		)
 	})
 }
 
+// logSlowRequest warns about requests slower than logging.slow_request_ms with
+// everything needed to tell why, the query is hashed to keep it out of the logs
+func (srv *Server) logSlowRequest(req *http.Request, status int, duration time.Duration) {
+	threshold := time.Duration(srv.Cfg.Logging.SlowRequestMs) * time.Millisecond
+	if threshold <= 0 || duration < threshold {
+		return
+	}
+	info := RequestInfoFromContext(req.Context())
+	upstream := info.Upstream()
+	retries := 0
+	var upstreamMs float64
+	for _, timing := range upstream {
+		retries += min(timing.Retry, 1)
+		upstreamMs += timing.DurationMs
+	}
+	sum := sha256.Sum256([]byte(req.URL.RawQuery))
+	LoggerFromContext(req.Context()).Warn(
+		"Slow request",
+		"method", req.Method,
+		"query_hash", hex.EncodeToString(sum[:8]),
+		"status", status,
+		"duration_ms", duration.Milliseconds(),
+		"threshold_ms", threshold.Milliseconds(),
+		"upstream_calls", len(upstream),
+		"upstream_ms", upstreamMs,
+		"retries", retries,
+		"upstream", upstream,
+	)
+}
+
 func PanicRecovery(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
-			if r := recover(); r != nil {
-				slog.Error("Recovered from panic in HTTP handler", "error", r)
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			if rec := recover(); rec != nil {
+				LoggerFromContext(r.Context()).Error("Recovered from panic in HTTP handler", "error", rec)
+				writeError(w, http.StatusInternalServerError, "Internal Server Error")
 			}
 		}()
 		next.ServeHTTP(w, r)
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+const INNERTUBE_NEXT_API_URL = YT_BASE_URL + "/youtubei/v1/next?prettyPrint=false"
+
+// a mix page holds ~25 items, stop expanding when the pages no longer add anything
+const maxMixPages = 20
+
+func parsePlaylistPanelVideo(item gjson.Result) (YouTubeTrack, error) {
+	itemRenderer := item.Get("playlistPanelVideoRenderer")
+	if !itemRenderer.Exists() {
+		return YouTubeTrack{}, newParseError(rendererName(item), ParseReasonUnsupportedRenderer, "")
+	}
+
+	videoId := itemRenderer.Get("videoId").String()
+	lengthText, length := parseLengthText(itemRenderer.Get("lengthText"))
+	if length == 0 {
+		return YouTubeTrack{}, newParseError("playlistPanelVideoRenderer.lengthText", "invalid_duration", lengthText)
+	}
+
+	return YouTubeTrack{
+		Title:      itemRenderer.Get("title.simpleText").String(),
+		Author:     itemRenderer.Get("shortBylineText.runs.0.text").String(),
+		Identifier: videoId,
+		Images:     parseThumbnails(itemRenderer.Get("thumbnail.thumbnails")),
+		Length:     length,
+		LengthText: lengthText,
+		Uri:        YT_BASE_URL + "/watch?v=" + videoId,
+		Type:       "video",
+		ChannelId: itemRenderer.Get("shortBylineText.runs.0.navigationEndpoint.browseEndpoint.browseId").
+			String(),
+	}, nil
+}
+
+func parseMixPage(data []byte) (string, []YouTubeTrack, error) {
+	panel := gjson.GetBytes(data, "contents.twoColumnWatchNextResults.playlist.playlist")
+	if !panel.Get("contents").IsArray() {
+		err := newParseError("twoColumnWatchNextResults.playlist.playlist.contents", "missing", "")
+		recordParseFailure("mix", err, data)
+		return "", nil, err
+	}
+
+	tracks := make([]YouTubeTrack, 0)
+	for _, item := range panel.Get("contents").Array() {
+		track, err := parsePlaylistPanelVideo(item)
+		if err != nil {
+			recordParseFailure("mix", err, data)
+			continue
+		}
+		tracks = append(tracks, track)
+	}
+	return panel.Get("title").String(), tracks, nil
+}
+
+var mixIdPattern = regexp.MustCompile(`^RD[a-zA-Z0-9_-]{2,64}$`)
+
+// mixSeedVideo is the video a mix id like RD<videoId> or RDAMVM<videoId> was
+// generated from, empty for mixes that aren't seeded by a video
+func mixSeedVideo(mixId string) string {
+	seed := strings.TrimPrefix(strings.TrimPrefix(mixId, "RDAMVM"), "RD")
+	if DirectVideoIDPattern.MatchString(seed) {
+		return seed
+	}
+	return ""
+}
+
+// LoadMix seeds a radio from the video, or opens the mix when only its id is
+// known, and keeps following the watch-next queue from its last track until
+// enough tracks not in exclude are collected
+func (srv *Server) LoadMix(
+	ctx context.Context,
+	mixId string,
+	videoId string,
+	count int,
+	exclude map[string]struct{},
+) (*YouTubePlaylist, error) {
+	visitor, err := srv.pickVisitor(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if mixId == "" {
+		mixId = "RD" + videoId
+	}
+	if videoId == "" {
+		videoId = mixSeedVideo(mixId)
+	}
+	mix := &YouTubePlaylist{
+		Identifier: mixId,
+		Uri:        YT_BASE_URL + "/watch?v=" + videoId + "&list=" + mixId,
+		Tracks:     make([]YouTubeTrack, 0, count),
+	}
+	if videoId == "" {
+		mix.Uri = YT_BASE_URL + "/playlist?list=" + mixId
+	}
+	seen := make(map[string]struct{}, len(exclude))
+	for id := range exclude {
+		seen[id] = struct{}{}
+	}
+
+	current := videoId
+	for page := 0; page < maxMixPages && len(mix.Tracks) < count; page++ {
+		payload := map[string]any{"playlistId": mixId}
+		// without a seed video the first page starts wherever the mix starts
+		if current != "" {
+			payload["videoId"] = current
+		}
+		respBody, err := srv.innertubeRequest(ctx, "mix", INNERTUBE_NEXT_API_URL, visitor, payload)
+		if err != nil {
+			if page > 0 {
+				LoggerFromContext(ctx).Warn("Stopped expanding mix early", "mix", mixId, "error", err)
+				break
+			}
+			return nil, err
+		}
+
+		title, tracks, err := parseMixPage(respBody)
+		recordParse(ctx, "mix", len(tracks), err)
+		if err != nil {
+			if page > 0 {
+				break
+			}
+			return nil, err
+		}
+		if mix.Title == "" {
+			mix.Title = title
+		}
+
+		added := 0
+		for _, track := range tracks {
+			if _, ok := seen[track.Identifier]; ok {
+				continue
+			}
+			seen[track.Identifier] = struct{}{}
+			added++
+			if len(mix.Tracks) < count {
+				mix.Tracks = append(mix.Tracks, track)
+			}
+		}
+		if added == 0 || len(tracks) == 0 {
+			break
+		}
+		current = tracks[len(tracks)-1].Identifier
+	}
+
+	mix.TotalCount = len(mix.Tracks)
+	LoggerFromContext(ctx).Info("Loaded mix", "mix", mixId, "tracks", len(mix.Tracks), "requested", count)
+	return mix, nil
+}
+
+func (srv *Server) MakeMixHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		videoId := strings.TrimSpace(req.FormValue("videoId"))
+		mixId := strings.TrimSpace(req.FormValue("list"))
+		if mixId != "" && !mixIdPattern.MatchString(mixId) {
+			writeError(writer, http.StatusBadRequest, "list must be a RD... mix id")
+			return
+		}
+		if (mixId == "" || videoId != "") && !DirectVideoIDPattern.MatchString(videoId) {
+			writeError(writer, http.StatusBadRequest, "a valid videoId or list parameter is required")
+			return
+		}
+
+		count := srv.Cfg.Mix.DefaultTracks
+		if limit := req.FormValue("limit"); limit != "" {
+			parsed, err := strconv.Atoi(limit)
+			if err != nil || parsed <= 0 {
+				writeError(writer, http.StatusBadRequest, "limit must be a positive integer")
+				return
+			}
+			count = min(parsed, srv.Cfg.Mix.MaxTracks)
+		}
+
+		exclude := make(map[string]struct{})
+		for _, id := range strings.Split(req.FormValue("exclude"), ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				exclude[id] = struct{}{}
+			}
+		}
+
+		mix, err := srv.LoadMix(req.Context(), mixId, videoId, count, exclude)
+		if err != nil {
+			writeError(
+				writer,
+				http.StatusInternalServerError,
+				fmt.Sprintf("Error loading mix: %v", err),
+			)
+			return
+		}
+
+		srv.writeJSON(writer, req, mix, CacheStatus{})
+	}
+}
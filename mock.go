@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+//go:embed mockdata
+var mockData embed.FS
+
+// MockTransport answers innertube requests with canned responses so the whole
+// HTTP surface can be exercised without contacting YouTube.
+type MockTransport struct{}
+
+func mockResponse(req *http.Request, status int, contentType string, body []byte) *http.Response {
+	return (&Fixture{
+		Method:      req.Method,
+		Url:         req.URL.String(),
+		Status:      status,
+		ContentType: contentType,
+		Body:        string(body),
+	}).Response(req)
+}
+
+// mockExactSearch reports whether search params switch spelling correction off
+func mockExactSearch(params string) bool {
+	unescaped, _ := url.QueryUnescape(params)
+	raw, _ := base64.StdEncoding.DecodeString(unescaped)
+	return bytes.Contains(raw, noSpellingCorrection)
+}
+
+func (transport MockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+	}
+
+	isMusic := strings.Contains(req.URL.Host, "music.youtube.com")
+	endpoint := strings.Trim(strings.TrimPrefix(req.URL.Path, "/youtubei/v1/"), "/")
+	clientName := gjson.GetBytes(body, "context.client.clientName").String()
+
+	var name, contentType string
+	switch {
+	case req.Method == http.MethodGet && endpoint == "":
+		name, contentType = "home_youtube.html", "text/html; charset=utf-8"
+		if isMusic {
+			name = "home_music.html"
+		}
+	case req.Method == http.MethodGet && endpoint == "oembed":
+		name, contentType = "oembed.json", "application/json"
+	case endpoint == "search":
+		name, contentType = "search_youtube.json", "application/json"
+		if clientName == "WEB_REMIX" {
+			name = "search_music.json"
+			// the filters of the categories share their first bytes up to the category
+			for category, filter := range musicCategoryParams {
+				if category != MusicCategorySongs && strings.HasPrefix(gjson.GetBytes(body, "params").String(), filter[:8]) {
+					name = "search_music_" + category + ".json"
+				}
+			}
+		}
+		if gjson.GetBytes(body, "continuation").Exists() {
+			name = "search_continuation.json"
+			if clientName == "WEB_REMIX" {
+				name = "search_music_continuation.json"
+			}
+		}
+		// "astly" is corrected to "astley" unless the params ask for the query as typed
+		if strings.Contains(gjson.GetBytes(body, "query").String(), "astly") &&
+			!mockExactSearch(gjson.GetBytes(body, "params").String()) {
+			name = "search_corrected.json"
+		}
+	case endpoint == "player":
+		name, contentType = "player.json", "application/json"
+		// video ids starting with "age" are age gated for every client but the embedded one
+		if strings.HasPrefix(gjson.GetBytes(body, "videoId").String(), "age") &&
+			clientName != "TVHTML5_SIMPLY_EMBEDDED_PLAYER" {
+			name = "player_age_restricted.json"
+		}
+		// video ids starting with "live" are streams that are live right now, "prem" upcoming premieres
+		if strings.HasPrefix(gjson.GetBytes(body, "videoId").String(), "live") {
+			name = "player_live.json"
+		}
+		if strings.HasPrefix(gjson.GetBytes(body, "videoId").String(), "prem") {
+			name = "player_upcoming.json"
+		}
+	case endpoint == "next":
+		name, contentType = "next.json", "application/json"
+		if clientName == "WEB_REMIX" {
+			name = "next_music.json"
+		} else if strings.HasPrefix(gjson.GetBytes(body, "videoId").String(), "live") &&
+			!gjson.GetBytes(body, "playlistId").Exists() {
+			name = "next_live.json"
+		}
+	case req.Method == http.MethodGet && endpoint == "iframe_api":
+		name, contentType = "iframe_api.js", "text/javascript"
+	case req.Method == http.MethodGet && strings.HasPrefix(endpoint, "s/player/"):
+		name, contentType = "base.js", "text/javascript"
+	case req.Method == http.MethodGet && endpoint == "api/timedtext":
+		name, contentType = "timedtext.json", "application/json"
+	case endpoint == "navigation/resolve_url":
+		name, contentType = "resolve_url.json", "application/json"
+	case endpoint == "browse" && gjson.GetBytes(body, "continuation").Exists():
+		name, contentType = "playlist_continuation.json", "application/json"
+	case endpoint == "browse" && gjson.GetBytes(body, "browseId").String() == exploreBrowseId:
+		name, contentType = "explore.json", "application/json"
+	case endpoint == "browse" && gjson.GetBytes(body, "browseId").String() == exploreCategoryBrowseId:
+		name, contentType = "explore_category.json", "application/json"
+	case endpoint == "browse" && strings.HasPrefix(gjson.GetBytes(body, "browseId").String(), "UC"):
+		name, contentType = "artist.json", "application/json"
+	case endpoint == "browse" && strings.HasPrefix(gjson.GetBytes(body, "browseId").String(), "MPREb"):
+		name, contentType = "album.json", "application/json"
+	case endpoint == "browse" && strings.HasPrefix(gjson.GetBytes(body, "browseId").String(), "VL"):
+		name, contentType = "playlist.json", "application/json"
+	default:
+		slog.Warn("No mock response available", "method", req.Method, "url", req.URL.String())
+		return mockResponse(req, http.StatusNotFound, "text/plain", []byte("no mock response")), nil
+	}
+
+	data, err := mockData.ReadFile("mockdata/" + name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mock response %s: %w", name, err)
+	}
+
+	if videoId := gjson.GetBytes(body, "videoId").String(); videoId != "" {
+		escaped, _ := json.Marshal(videoId)
+		data = bytes.ReplaceAll(data, []byte("{{videoId}}"), escaped[1:len(escaped)-1])
+	}
+
+	slog.Debug("Serving mock response", "endpoint", endpoint, "file", name)
+	return mockResponse(req, http.StatusOK, contentType, data), nil
+}
@@ -0,0 +1,7 @@
+var _yt_player={};(function(g){var window=this;
+var Zx={Qe:function(a){a.reverse()},
+fP:function(a,b){a.splice(0,b)},
+Jz:function(a,b){var c=a[0];a[0]=a[b%a.length];a[b%a.length]=c}};
+Wqa=function(a){a=a.split("");Zx.Jz(a,3);Zx.Qe(a,12);Zx.fP(a,2);Zx["Jz"](a,41);return a.join("")};
+g.CG=function(){return{signatureTimestamp:20371,clientName:"WEB"}};
+})(_yt_player);
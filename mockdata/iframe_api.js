@@ -0,0 +1 @@
+var scriptUrl = 'https:\/\/www.youtube.com\/s\/player\/1a2b3c4d\/www-widgetapi.vflset\/www-widgetapi.js';try{var ttPolicy=window.trustedTypes.createPolicy("youtube-widget-api",{createScriptURL:function(x){return x}});scriptUrl=ttPolicy.createScriptURL(scriptUrl)}catch(e){}
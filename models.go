@@ -2,23 +2,26 @@ package main
 
 import (
 	"fmt"
-	"log/slog"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/tidwall/gjson"
-	"github.com/topi314/tint"
 )
 
 type YouTubeVisitorData struct {
 	Context   map[string]any `json:"context"`
 	CreatedAt time.Time      `json:"createdAt"`
 	IsYouTube bool           `json:"isYouTube"`
+	// Cookies are set when the visitor went through a consent page
+	Cookies string `json:"cookies,omitempty"`
 }
 
+const visitorLifetime = 30 * time.Minute
+
 func (v *YouTubeVisitorData) IsExpired() bool {
-	return time.Since(v.CreatedAt) > 30*time.Minute
+	return time.Since(v.CreatedAt) > visitorLifetime
 }
 
 func (v *YouTubeVisitorData) VisitorID() string {
@@ -80,22 +83,70 @@ type PlaybilityStatus struct {
 	PlayableInEmbed bool   `json:"playableInEmbed"`
 }
 
+// IsAgeGated reports whether the player refused a video until the viewer confirms their age
+func (status PlaybilityStatus) IsAgeGated() bool {
+	if strings.HasPrefix(status.Status, "AGE_") {
+		return true
+	}
+	reason := strings.ToLower(status.Reason)
+	return status.Status == "LOGIN_REQUIRED" &&
+		(strings.Contains(reason, "age") || strings.Contains(reason, "inappropriate"))
+}
+
 type YouTubePlayerResponse struct {
 	PlaybilityStatus PlaybilityStatus `json:"playabilityStatus"`
 	VideoDetails     VideoDetails     `json:"videoDetails"`
 }
 
 type YouTubeTrack struct {
-	Title      string      `json:"title"`
-	Author     string      `json:"author"`
-	Identifier string      `json:"identifier"`
-	Images     []Thumbnail `json:"images"`
-	Length     int         `json:"length"`
-	Uri        string      `json:"uri"`
-	Type       string      `json:"type"`
-	Views      string      `json:"views"`
-	ChannelId  string      `json:"channel_id"`
-	IsLive     bool        `json:"is_live"`
+	Title         string      `json:"title"`
+	Author        string      `json:"author"`
+	Identifier    string      `json:"identifier"`
+	Images        []Thumbnail `json:"images"`
+	Length        int         `json:"length"`
+	LengthText    string      `json:"length_text,omitempty"`
+	Uri           string      `json:"uri"`
+	Type          string      `json:"type"`
+	Views         string      `json:"views"`
+	ChannelId     string      `json:"channel_id"`
+	IsLive        bool        `json:"is_live"`
+	MusicBrainzId string      `json:"musicbrainz_id,omitempty"`
+	Partial       bool        `json:"partial,omitempty"`
+	AgeRestricted bool        `json:"age_restricted,omitempty"`
+	// Badges are labels shown next to the result, like "Free with ads" or a
+	// rating, for videos "4K", "CC" or the badge of a verified channel
+	Badges []string `json:"badges,omitempty"`
+	// PublishedTime and DescriptionSnippet are only in extended search results,
+	// the publish time as YouTube words it, like "3 years ago"
+	PublishedTime      string `json:"published_time,omitempty"`
+	DescriptionSnippet string `json:"description_snippet,omitempty"`
+	// Artists and Album are set on YouTube Music results, Author joins the
+	// names of the artists
+	Artists []MusicTrackArtist `json:"artists,omitempty"`
+	Album   *MusicTrackAlbum   `json:"album,omitempty"`
+	// Encoded is the track as Lavaplayer encodes it, which Lavalink nodes play
+	// without loading the track again. It is set when the response is written.
+	Encoded string `json:"encoded,omitempty"`
+	// Live is set for streams that are live right now
+	Live *LiveDetails `json:"live,omitempty"`
+	// IsUpcoming marks premieres and streams that can't be watched before ScheduledStartTime
+	IsUpcoming         bool       `json:"is_upcoming,omitempty"`
+	ScheduledStartTime *time.Time `json:"scheduled_start_time,omitempty"`
+	// Score is set when the caller asked for match scores
+	Score *float64 `json:"score,omitempty"`
+	// MatchConfidence is how likely a result of an ISRC search is the
+	// recording behind the ISRC, unset when nothing could verify it
+	MatchConfidence *float64 `json:"match_confidence,omitempty"`
+}
+
+type MusicTrackArtist struct {
+	Name      string `json:"name"`
+	ChannelId string `json:"channel_id,omitempty"`
+}
+
+type MusicTrackAlbum struct {
+	Name     string `json:"name"`
+	BrowseId string `json:"browse_id"`
 }
 
 func parseDurationText(durationStr string) int {
@@ -116,11 +167,50 @@ func parseDurationText(durationStr string) int {
 	return totalSeconds * 1000
 }
 
+var (
+	durationTextPattern       = regexp.MustCompile(`^\d+(:\d{2}){1,2}$`)
+	accessibleDurationPattern = regexp.MustCompile(`(\d+)\s*(hour|minute|second)s?`)
+)
+
+// parseAccessibleDuration reads accessibility labels like "1 hour, 11 minutes, 3 seconds"
+func parseAccessibleDuration(label string) int {
+	seconds := 0
+	for _, match := range accessibleDurationPattern.FindAllStringSubmatch(strings.ToLower(label), -1) {
+		value, _ := strconv.Atoi(match[1])
+		switch match[2] {
+		case "hour":
+			seconds += value * 3600
+		case "minute":
+			seconds += value * 60
+		case "second":
+			seconds += value
+		}
+	}
+	return seconds * 1000
+}
+
+// parseLengthText returns the raw length text of a renderer and its duration,
+// falling back to the accessibility label when there is no usable simpleText
+func parseLengthText(lengthText gjson.Result) (string, int) {
+	text := lengthText.Get("simpleText").String()
+	if text == "" {
+		text = lengthText.Get("runs.0.text").String()
+	}
+	if length := parseDurationText(text); length > 0 {
+		return text, length
+	}
+	label := lengthText.Get("accessibility.accessibilityData.label").String()
+	if length := parseAccessibleDuration(label); length > 0 {
+		return label, length
+	}
+	return text, 0
+}
+
 func parseYouTubeMusicTrack(item gjson.Result) (YouTubeTrack, error) {
 
 	itemRenderer := item.Get("musicResponsiveListItemRenderer")
 	if !itemRenderer.Exists() {
-		return YouTubeTrack{}, fmt.Errorf("musicResponsiveListItemRenderer not found")
+		return YouTubeTrack{}, newParseError(rendererName(item), ParseReasonUnsupportedRenderer, "")
 	}
 	thumbnails := []Thumbnail{}
 	thumbnailArray := itemRenderer.Get("thumbnail.musicThumbnailRenderer.thumbnail.thumbnails")
@@ -143,12 +233,23 @@ func parseYouTubeMusicTrack(item gjson.Result) (YouTubeTrack, error) {
 	views := ""
 	author := ""
 
-	if len(flexColumns) < 3 {
-		return YouTubeTrack{}, fmt.Errorf("expected 3 flex columns, got %d", len(flexColumns))
+	if len(flexColumns) < 2 {
+		return YouTubeTrack{}, newParseError(
+			"musicResponsiveListItemRenderer.flexColumns",
+			"missing_columns",
+			fmt.Sprintf("expected at least 2 flex columns, got %d", len(flexColumns)),
+		)
 	}
 
 	authorAndLengthRuns := flexColumns[1].Get("musicResponsiveListItemFlexColumnRenderer.text.runs").
 		Array()
+	if len(authorAndLengthRuns) == 0 {
+		return YouTubeTrack{}, newParseError(
+			"musicResponsiveListItemRenderer.flexColumns.1",
+			"missing_runs",
+			"",
+		)
+	}
 	for _, run := range authorAndLengthRuns {
 		text := run.Get("text").String()
 
@@ -158,9 +259,26 @@ func parseYouTubeMusicTrack(item gjson.Result) (YouTubeTrack, error) {
 			author += text
 		}
 	}
-	length = authorAndLengthRuns[len(authorAndLengthRuns)-1].Get("text").String()
-	views = flexColumns[2].Get("musicResponsiveListItemFlexColumnRenderer.text.runs.0.text").
-		String()
+	artists, album := parseMusicTrackByline(authorAndLengthRuns)
+	// the length is usually the last run, but albums and uploads sometimes trail it
+	for i := len(authorAndLengthRuns) - 1; i >= 0; i-- {
+		if text := strings.TrimSpace(authorAndLengthRuns[i].Get("text").String()); durationTextPattern.MatchString(text) {
+			length = text
+			break
+		}
+	}
+	if len(flexColumns) > 2 {
+		views = flexColumns[2].Get("musicResponsiveListItemFlexColumnRenderer.text.runs.0.text").
+			String()
+	} else {
+		// results of the videos category have no third column, their views are
+		// part of the second one: "Rick Astley • 1.6B views • 3:33"
+		for _, run := range authorAndLengthRuns {
+			if text := strings.TrimSpace(run.Get("text").String()); strings.HasSuffix(text, " views") {
+				views = text
+			}
+		}
+	}
 
 	videoId := itemRenderer.Get("playlistItemData.videoId").String()
 	uri := fmt.Sprintf("https://music.youtube.com/watch?v=%s", videoId)
@@ -187,7 +305,18 @@ outer:
 
 	lengthInt := parseDurationText(length)
 	if lengthInt == 0 {
-		return YouTubeTrack{}, fmt.Errorf("failed to parse duration: %v", length)
+		label := flexColumns[1].Get("musicResponsiveListItemFlexColumnRenderer.text.accessibility.accessibilityData.label").
+			String()
+		if lengthInt = parseAccessibleDuration(label); lengthInt > 0 {
+			length = label
+		}
+	}
+	if lengthInt == 0 {
+		return YouTubeTrack{}, newParseError(
+			"musicResponsiveListItemRenderer.flexColumns.1",
+			"invalid_duration",
+			length,
+		)
 	}
 
 	itemType := "song"
@@ -203,38 +332,66 @@ outer:
 		Identifier: videoId,
 		Images:     thumbnails,
 		Length:     lengthInt,
+		LengthText: length,
 		Uri:        uri,
 		Type:       itemType,
 		Views:      views,
 		ChannelId:  channelId,
+		Artists:    artists,
+		Album:      album,
 	}
 
 	return track, nil
 
 }
 
+// parseMusicTrackByline reads the artists and album from the second flex
+// column of a music result, "Artist & Artist • Album • 3:34". Artists are the
+// runs before the first separator, linked to their channel unless they have
+// none, the album is the run linking to an MPRE browse id.
+func parseMusicTrackByline(runs []gjson.Result) ([]MusicTrackArtist, *MusicTrackAlbum) {
+	var artists []MusicTrackArtist
+	var album *MusicTrackAlbum
+	segment := 0
+	for _, run := range runs {
+		text := strings.TrimSpace(run.Get("text").String())
+		switch text {
+		case "•":
+			segment++
+			continue
+		case "&", ",", "":
+			continue
+		}
+
+		browseId := run.Get("navigationEndpoint.browseEndpoint.browseId").String()
+		switch {
+		case strings.HasPrefix(browseId, "MPRE"):
+			album = &MusicTrackAlbum{Name: text, BrowseId: browseId}
+		case segment == 0:
+			artists = append(artists, MusicTrackArtist{Name: text, ChannelId: browseId})
+		}
+	}
+	return artists, album
+}
+
 func parseYouTubeMusicSearchResults(data []byte) ([]YouTubeTrack, error) {
-	result := gjson.GetBytes(
-		data,
-		"contents.tabbedSearchResultsRenderer.tabs.0.tabRenderer.content.sectionListRenderer.contents.0.musicShelfRenderer.contents",
-	)
+	result := musicSearchShelf(data).Get("contents")
 	if !result.Exists() {
-		return nil, fmt.Errorf(
-			"array of musicResponsiveListItemRenderer doesn't found in the data",
-		)
+		err := newParseError("musicShelfRenderer.contents", "missing", "")
+		recordParseFailure("youtubemusic_search", err, data)
+		return nil, err
 	}
 
 	if !result.IsArray() {
-		return nil, fmt.Errorf(
-			"expected musicShelfRenderer.contents to be an array but got : %v",
-			result.Type.String(),
-		)
+		err := newParseError("musicShelfRenderer.contents", "not_array", result.Type.String())
+		recordParseFailure("youtubemusic_search", err, data)
+		return nil, err
 	}
 	tracks := make([]YouTubeTrack, 0)
 	for _, item := range result.Array() {
 		track, err := parseYouTubeMusicTrack(item)
 		if err != nil {
-			slog.Debug("Skipping item due to error", tint.Err(err))
+			recordParseFailure("youtubemusic_search", err, data)
 			continue
 		}
 		tracks = append(tracks, track)
@@ -242,11 +399,52 @@ func parseYouTubeMusicSearchResults(data []byte) ([]YouTubeTrack, error) {
 	return tracks, nil
 }
 
+// parseMovieTrack reads a movieRenderer, YouTube Movies titles that are free
+// with ads or for rent and purchase, which the badges and offer tell apart
+func parseMovieTrack(itemRenderer gjson.Result) (YouTubeTrack, error) {
+	videoId := itemRenderer.Get("videoId").String()
+	if videoId == "" {
+		return YouTubeTrack{}, newParseError("movieRenderer.videoId", "missing", "")
+	}
+	length, lengthInt := parseLengthText(itemRenderer.Get("lengthText"))
+	if lengthInt == 0 {
+		return YouTubeTrack{}, newParseError("movieRenderer.lengthText", "invalid_duration", length)
+	}
+
+	var badges []string
+	for _, badge := range itemRenderer.Get("badges").Array() {
+		if label := badge.Get("metadataBadgeRenderer.label").String(); label != "" {
+			badges = append(badges, label)
+		}
+	}
+	for _, offer := range itemRenderer.Get("offerButtons").Array() {
+		if text := offer.Get("buttonRenderer.text.simpleText").String(); text != "" {
+			badges = append(badges, text)
+		}
+	}
+
+	return YouTubeTrack{
+		Title:      itemRenderer.Get("title.runs.0.text").String(),
+		Author:     itemRenderer.Get("longBylineText.runs.0.text").String(),
+		Identifier: videoId,
+		Images:     parseThumbnails(itemRenderer.Get("thumbnail.thumbnails")),
+		Length:     lengthInt,
+		LengthText: length,
+		Uri:        YT_BASE_URL + "/watch?v=" + videoId,
+		Type:       "movie",
+		ChannelId:  itemRenderer.Get("longBylineText.runs.0.navigationEndpoint.browseEndpoint.browseId").String(),
+		Badges:     badges,
+	}, nil
+}
+
 func parseYouTubeTrack(item gjson.Result) (YouTubeTrack, error) {
+	if movie := item.Get("movieRenderer"); movie.Exists() {
+		return parseMovieTrack(movie)
+	}
 
 	itemRenderer := item.Get("videoRenderer")
 	if !itemRenderer.Exists() {
-		return YouTubeTrack{}, fmt.Errorf("videoRenderer not found")
+		return YouTubeTrack{}, newParseError(rendererName(item), ParseReasonUnsupportedRenderer, "")
 	}
 	thumbnails := []Thumbnail{}
 	thumbnailArray := itemRenderer.Get("thumbnail.thumbnails")
@@ -262,16 +460,17 @@ func parseYouTubeTrack(item gjson.Result) (YouTubeTrack, error) {
 
 	title := itemRenderer.Get("title.runs.0.text").String()
 	author := itemRenderer.Get("ownerText.runs.0.text").String()
-	length := itemRenderer.Get("lengthText.simpleText").String()
+	length, lengthInt := parseLengthText(itemRenderer.Get("lengthText"))
 	videoId := itemRenderer.Get("videoId").String()
 	uri := fmt.Sprintf("https://www.youtube.com/watch?v=%s", videoId)
 	views := itemRenderer.Get("viewCountText.simpleText").String()
 	channelId := itemRenderer.Get("ownerText.runs.0.navigationEndpoint.browseEndpoint.browseId").
 		String()
 
-	lengthInt := parseDurationText(length)
-	if lengthInt == 0 {
-		return YouTubeTrack{}, fmt.Errorf("failed to parse duration: %v", length)
+	live := isLiveRenderer(itemRenderer)
+	scheduled, upcoming := parseUpcomingEvent(itemRenderer)
+	if lengthInt == 0 && !live && !upcoming {
+		return YouTubeTrack{}, newParseError("videoRenderer.lengthText", "invalid_duration", length)
 	}
 
 	track := YouTubeTrack{
@@ -280,39 +479,132 @@ func parseYouTubeTrack(item gjson.Result) (YouTubeTrack, error) {
 		Identifier: videoId,
 		Images:     thumbnails,
 		Length:     lengthInt,
+		LengthText: length,
 		Uri:        uri,
 		Type:       "video",
 		Views:      views,
 		ChannelId:  channelId,
 	}
+	parseExtendedMetadata(&track, itemRenderer)
+	if live {
+		markLive(&track, itemRenderer)
+	}
+	if upcoming {
+		markUpcoming(&track, scheduled)
+	}
 
 	return track, nil
 }
 
+// parseExtendedMetadata reads what extended search results add to a
+// videoRenderer: the publish time, the description snippet and the badges of
+// the video and its channel
+func parseExtendedMetadata(track *YouTubeTrack, itemRenderer gjson.Result) {
+	track.PublishedTime = itemRenderer.Get("publishedTimeText.simpleText").String()
+
+	snippetRuns := itemRenderer.Get("detailedMetadataSnippets.0.snippetText.runs")
+	if !snippetRuns.Exists() {
+		snippetRuns = itemRenderer.Get("descriptionSnippet.runs")
+	}
+	var snippet strings.Builder
+	for _, run := range snippetRuns.Array() {
+		snippet.WriteString(run.Get("text").String())
+	}
+	track.DescriptionSnippet = snippet.String()
+
+	for _, badge := range itemRenderer.Get("badges").Array() {
+		if label := badge.Get("metadataBadgeRenderer.label").String(); label != "" {
+			track.Badges = append(track.Badges, label)
+		}
+	}
+	// channel badges only have a tooltip, like "Verified"
+	for _, badge := range itemRenderer.Get("ownerBadges").Array() {
+		if tooltip := badge.Get("metadataBadgeRenderer.tooltip").String(); tooltip != "" {
+			track.Badges = append(track.Badges, tooltip)
+		}
+	}
+}
+
+// trimExtendedMetadata leaves out what only extended search results carry, the
+// badges of movies are part of every result
+func trimExtendedMetadata(track *YouTubeTrack) {
+	track.PublishedTime = ""
+	track.DescriptionSnippet = ""
+	if track.Type != "movie" {
+		track.Badges = nil
+	}
+}
+
+// markLive turns a parsed result into a live stream, streams have no length
+// and their view count text is the current audience instead
+func markLive(track *YouTubeTrack, itemRenderer gjson.Result) {
+	viewers := itemRenderer.Get("viewCountText.simpleText").String()
+	if runs := itemRenderer.Get("viewCountText.runs").Array(); len(runs) > 0 {
+		var text strings.Builder
+		for _, run := range runs {
+			text.WriteString(run.Get("text").String())
+		}
+		viewers = text.String()
+	}
+	track.IsLive = true
+	track.Length = 0
+	track.LengthText = ""
+	track.Views = viewers
+	track.Live = &LiveDetails{ConcurrentViewers: parseConcurrentViewers(viewers)}
+}
+
+// isLiveRenderer reports whether a videoRenderer is a stream that is live
+// right now, marked by a LIVE badge or thumbnail overlay
+func isLiveRenderer(itemRenderer gjson.Result) bool {
+	for _, badge := range itemRenderer.Get("badges").Array() {
+		if badge.Get("metadataBadgeRenderer.style").String() == "BADGE_STYLE_TYPE_LIVE_NOW" {
+			return true
+		}
+	}
+	for _, overlay := range itemRenderer.Get("thumbnailOverlays").Array() {
+		if overlay.Get("thumbnailOverlayTimeStatusRenderer.style").String() == "LIVE" {
+			return true
+		}
+	}
+	return false
+}
+
 func parseYouTubeSearchResults(data []byte) ([]YouTubeTrack, error) {
-	result := gjson.GetBytes(
-		data,
-		"contents.twoColumnSearchResultsRenderer.primaryContents.sectionListRenderer.contents.0.itemSectionRenderer.contents",
-	)
+	result := youtubeSearchSections(data).Get("0.itemSectionRenderer.contents")
 	if !result.Exists() {
-		return nil, fmt.Errorf(
-			"array of videoRenderer doesn't found in the data",
-		)
+		err := newParseError("itemSectionRenderer.contents", "missing", "")
+		recordParseFailure("youtube_search", err, data)
+		return nil, err
 	}
 	if !result.IsArray() {
-		return nil, fmt.Errorf(
-			"expected itemSectionRenderer.contents to be an array but got : %v",
-			result.Type.String(),
-		)
+		err := newParseError("itemSectionRenderer.contents", "not_array", result.Type.String())
+		recordParseFailure("youtube_search", err, data)
+		return nil, err
 	}
 	tracks := make([]YouTubeTrack, 0)
 	for _, item := range result.Array() {
 		track, err := parseYouTubeTrack(item)
 		if err != nil {
-			slog.Debug("Skipping item due to error", tint.Err(err))
+			recordParseFailure("youtube_search", err, data)
 			continue
 		}
 		tracks = append(tracks, track)
 	}
 	return tracks, nil
 }
+
+func parseThumbnails(thumbnailArray gjson.Result) []Thumbnail {
+	thumbnails := []Thumbnail{}
+	for _, thumb := range thumbnailArray.Array() {
+		thumbUrl := thumb.Get("url").String()
+		if strings.HasPrefix(thumbUrl, "//") {
+			thumbUrl = "https:" + thumbUrl
+		}
+		thumbnails = append(thumbnails, Thumbnail{
+			Url:    thumbUrl,
+			Width:  int(thumb.Get("width").Int()),
+			Height: int(thumb.Get("height").Int()),
+		})
+	}
+	return thumbnails
+}
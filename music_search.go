@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+const (
+	MusicCategorySongs     = "songs"
+	MusicCategoryVideos    = "videos"
+	MusicCategoryAlbums    = "albums"
+	MusicCategoryArtists   = "artists"
+	MusicCategoryPlaylists = "playlists"
+)
+
+const (
+	ResultKindAlbum  = "album"
+	ResultKindArtist = "artist"
+)
+
+// the music search filters only differ in field 17 of the filters, which
+// picks the category
+var musicCategoryParams = map[string]string{
+	MusicCategorySongs:     YT_SONG_FILTER_PARAM,
+	MusicCategoryVideos:    YT_VIDEO_FILTER_PARAM,
+	MusicCategoryAlbums:    "EgWKAQIYAWoQEAMQBRAEEAkQChAVEBAQEQ%3D%3D",
+	MusicCategoryArtists:   "EgWKAQIgAWoQEAMQBRAEEAkQChAVEBAQEQ%3D%3D",
+	MusicCategoryPlaylists: "EgWKAQIoAWoQEAMQBRAEEAkQChAVEBAQEQ%3D%3D",
+}
+
+// MusicAlbumResult is an album search result, its identifier is the MPREb
+// browse id the album loader accepts
+type MusicAlbumResult struct {
+	Kind       string `json:"kind"`
+	Identifier string `json:"identifier"`
+	Title      string `json:"title"`
+	// AlbumType is Album, Single or EP
+	AlbumType string      `json:"album_type"`
+	Artists   []MusicRef  `json:"artists"`
+	Year      string      `json:"year,omitempty"`
+	Images    []Thumbnail `json:"images"`
+	Uri       string      `json:"uri"`
+}
+
+type MusicArtistResult struct {
+	Kind        string      `json:"kind"`
+	Identifier  string      `json:"identifier"`
+	Name        string      `json:"name"`
+	Subscribers string      `json:"subscribers,omitempty"`
+	Images      []Thumbnail `json:"images"`
+	Uri         string      `json:"uri"`
+}
+
+// isMusicCollectionCategory tells the categories whose results are no tracks
+func isMusicCollectionCategory(category string) bool {
+	return category == MusicCategoryAlbums || category == MusicCategoryArtists || category == MusicCategoryPlaylists
+}
+
+// musicSubtitleRuns are the runs of the second flex column of a result, like
+// "Album • Rick Astley • 1987", without the separators
+func musicSubtitleRuns(itemRenderer gjson.Result) []gjson.Result {
+	var runs []gjson.Result
+	for _, run := range itemRenderer.Get("flexColumns.1.musicResponsiveListItemFlexColumnRenderer.text.runs").Array() {
+		if strings.TrimSpace(run.Get("text").String()) != "•" {
+			runs = append(runs, run)
+		}
+	}
+	return runs
+}
+
+func parseMusicAlbumResult(itemRenderer gjson.Result) (MusicAlbumResult, error) {
+	browseId := itemRenderer.Get("navigationEndpoint.browseEndpoint.browseId").String()
+	if !strings.HasPrefix(browseId, "MPRE") {
+		return MusicAlbumResult{}, newParseError("musicResponsiveListItemRenderer.navigationEndpoint", "not_album", browseId)
+	}
+	album := MusicAlbumResult{
+		Kind:       ResultKindAlbum,
+		Identifier: browseId,
+		Title:      itemRenderer.Get("flexColumns.0.musicResponsiveListItemFlexColumnRenderer.text.runs.0.text").String(),
+		Artists:    make([]MusicRef, 0),
+		Images:     parseThumbnails(itemRenderer.Get("thumbnail.musicThumbnailRenderer.thumbnail.thumbnails")),
+		Uri:        YT_MUSIC_BASE_URL + "/browse/" + browseId,
+	}
+	for i, run := range musicSubtitleRuns(itemRenderer) {
+		text := strings.TrimSpace(run.Get("text").String())
+		switch artistId := run.Get("navigationEndpoint.browseEndpoint.browseId").String(); {
+		case i == 0:
+			album.AlbumType = text
+		case strings.HasPrefix(artistId, "UC"):
+			album.Artists = append(album.Artists, MusicRef{Id: artistId, Name: text})
+		case yearPattern.MatchString(text):
+			album.Year = text
+		}
+	}
+	return album, nil
+}
+
+func parseMusicArtistResult(itemRenderer gjson.Result) (MusicArtistResult, error) {
+	browseId := itemRenderer.Get("navigationEndpoint.browseEndpoint.browseId").String()
+	if !strings.HasPrefix(browseId, "UC") {
+		return MusicArtistResult{}, newParseError("musicResponsiveListItemRenderer.navigationEndpoint", "not_artist", browseId)
+	}
+	artist := MusicArtistResult{
+		Kind:       ResultKindArtist,
+		Identifier: browseId,
+		Name:       itemRenderer.Get("flexColumns.0.musicResponsiveListItemFlexColumnRenderer.text.runs.0.text").String(),
+		Images:     parseThumbnails(itemRenderer.Get("thumbnail.musicThumbnailRenderer.thumbnail.thumbnails")),
+		Uri:        YT_MUSIC_BASE_URL + "/channel/" + browseId,
+	}
+	// the first run is the "Artist" label
+	if runs := musicSubtitleRuns(itemRenderer); len(runs) > 1 {
+		artist.Subscribers = strings.TrimSpace(runs[len(runs)-1].Get("text").String())
+	}
+	return artist, nil
+}
+
+func parseMusicPlaylistResult(itemRenderer gjson.Result) (YouTubePlaylistResult, error) {
+	browseId := itemRenderer.Get("navigationEndpoint.browseEndpoint.browseId").String()
+	playlistId, ok := strings.CutPrefix(browseId, "VL")
+	if !ok {
+		return YouTubePlaylistResult{}, newParseError("musicResponsiveListItemRenderer.navigationEndpoint", "not_playlist", browseId)
+	}
+	playlist := YouTubePlaylistResult{
+		Kind:       ResultKindPlaylist,
+		Identifier: playlistId,
+		Title:      itemRenderer.Get("flexColumns.0.musicResponsiveListItemFlexColumnRenderer.text.runs.0.text").String(),
+		Images:     parseThumbnails(itemRenderer.Get("thumbnail.musicThumbnailRenderer.thumbnail.thumbnails")),
+		Uri:        YT_MUSIC_BASE_URL + "/playlist?list=" + playlistId,
+	}
+	// "Playlist • <author> • <views or track count>", the label only shows up
+	// when the results mix categories
+	runs := musicSubtitleRuns(itemRenderer)
+	if len(runs) > 0 && strings.TrimSpace(runs[0].Get("text").String()) == "Playlist" {
+		runs = runs[1:]
+	}
+	if len(runs) > 0 {
+		playlist.Author = strings.TrimSpace(runs[0].Get("text").String())
+		playlist.ChannelId = runs[0].Get("navigationEndpoint.browseEndpoint.browseId").String()
+	}
+	for _, run := range runs {
+		if text := run.Get("text").String(); strings.HasSuffix(text, " songs") || strings.HasSuffix(text, " tracks") {
+			playlist.TrackCount = parseCount(text)
+		}
+	}
+	return playlist, nil
+}
+
+func parseMusicCollectionResult(item gjson.Result, category string) (any, error) {
+	itemRenderer := item.Get("musicResponsiveListItemRenderer")
+	if !itemRenderer.Exists() {
+		return nil, newParseError(rendererName(item), ParseReasonUnsupportedRenderer, "")
+	}
+	switch category {
+	case MusicCategoryAlbums:
+		return parseMusicAlbumResult(itemRenderer)
+	case MusicCategoryArtists:
+		return parseMusicArtistResult(itemRenderer)
+	default:
+		return parseMusicPlaylistResult(itemRenderer)
+	}
+}
+
+func parseMusicCollectionResults(data []byte, category string) ([]any, error) {
+	result := musicSearchShelf(data).Get("contents")
+	if !result.IsArray() {
+		err := newParseError("musicShelfRenderer.contents", "missing", "")
+		recordParseFailure("youtubemusic_search", err, data)
+		return nil, err
+	}
+	items := make([]any, 0)
+	for _, item := range result.Array() {
+		parsed, err := parseMusicCollectionResult(item, category)
+		if err != nil {
+			recordParseFailure("youtubemusic_search", err, data)
+			continue
+		}
+		items = append(items, parsed)
+	}
+	return items, nil
+}
+
+// searchMusicCollections searches YouTube Music for albums, artists or
+// playlists, every item carrying a kind discriminator like the results of
+// searchYouTubeKinds
+func (srv *Server) searchMusicCollections(
+	ctx context.Context,
+	query string,
+	opts SearchOptions,
+) ([]json.RawMessage, *SpellingCorrection, CacheStatus, error) {
+	cacheKey := srv.createCacheKey(SearchTypeYouTubeMusic, query, opts.cacheOptions())
+	if srv.db != nil {
+		entry, err := srv.LookupCache(ctx, cacheKey)
+		if err != nil {
+			LoggerFromContext(ctx).Error("Failed to lookup cache", "error", err)
+		} else if entry != nil {
+			var result []json.RawMessage
+			if err := json.Unmarshal(entry.Value, &result); err != nil {
+				LoggerFromContext(ctx).Error("Failed to unmarshal cached search results", "error", err)
+			} else {
+				return result, srv.cachedCorrection(ctx, cacheKey), CacheStatus{Hit: true, StoredAt: entry.StoredAt}, nil
+			}
+		}
+	}
+
+	visitor, err := srv.pickVisitor(ctx, false)
+	if err != nil {
+		return nil, nil, CacheStatus{}, err
+	}
+
+	payload := map[string]any{
+		"context": opts.innertubeContext(visitor.Context),
+		"query":   query,
+		"params":  opts.params(musicCategoryParams[opts.Category]),
+	}
+	var items []any
+	respBody, err := srv.searchPages(ctx, SearchTypeYouTubeMusic, visitor, payload, opts.Limit, func(page []byte) (int, error) {
+		pageItems, err := parseMusicCollectionResults(page, opts.Category)
+		items = append(items, pageItems...)
+		return len(pageItems), err
+	})
+	if respBody == nil {
+		return nil, nil, CacheStatus{}, err
+	}
+	recordParse(ctx, "youtubemusic_search_"+opts.Category, len(items), err)
+	if err != nil {
+		return nil, nil, CacheStatus{}, err
+	}
+	correction := parseSpellingCorrection(respBody)
+
+	encoded := make([]json.RawMessage, 0, len(items))
+	for _, item := range items {
+		raw, err := json.Marshal(item)
+		if err != nil {
+			return nil, nil, CacheStatus{}, fmt.Errorf("failed to marshal search item: %w", err)
+		}
+		encoded = append(encoded, raw)
+	}
+
+	if len(encoded) > 0 && srv.db != nil {
+		if err := srv.StoreCache(ctx, cacheKey, encoded); err != nil {
+			LoggerFromContext(ctx).Error("Failed to store search results in cache", "error", err)
+		}
+		if correction != nil {
+			if err := srv.StoreCache(ctx, "correction:"+cacheKey, correction); err != nil {
+				LoggerFromContext(ctx).Error("Failed to store spelling correction in cache", "error", err)
+			}
+		}
+	}
+	return encoded, correction, CacheStatus{}, nil
+}
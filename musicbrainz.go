@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const MUSICBRAINZ_API_URL = "https://musicbrainz.org/ws/2"
+
+// musicBrainzMaxWait bounds the wait for a turn of callers without a deadline
+const musicBrainzMaxWait = 5 * time.Second
+
+// errMusicBrainzBusy is returned instead of queueing for a turn that would
+// come too late, bulk isrc requests then rank the rest of their items by
+// consensus instead of waiting a second per item
+var errMusicBrainzBusy = errors.New("musicbrainz throttle queue is longer than the request deadline")
+
+type MusicBrainzRecording struct {
+	Id           string `json:"id"`
+	Title        string `json:"title"`
+	Length       int    `json:"length"`
+	ArtistCredit []struct {
+		Name       string `json:"name"`
+		JoinPhrase string `json:"joinphrase"`
+	} `json:"artist-credit"`
+}
+
+func (recording *MusicBrainzRecording) Artist() string {
+	var artist strings.Builder
+	for _, credit := range recording.ArtistCredit {
+		artist.WriteString(credit.Name)
+		artist.WriteString(credit.JoinPhrase)
+	}
+	return artist.String()
+}
+
+func (recording *MusicBrainzRecording) MatchReference() MatchReference {
+	return MatchReference{
+		Title:    recording.Title,
+		Artist:   recording.Artist(),
+		LengthMs: recording.Length,
+	}
+}
+
+// MusicBrainzClient talks to the public MusicBrainz API, which asks clients
+// to identify themselves and stay below one request per second
+type MusicBrainzClient struct {
+	client      *http.Client
+	userAgent   string
+	mu          sync.Mutex
+	lastRequest time.Time
+}
+
+func NewMusicBrainzClient(cfg MusicBrainzConfig, timeoutSeconds int) *MusicBrainzClient {
+	return &MusicBrainzClient{
+		client:    &http.Client{Timeout: time.Duration(timeoutSeconds) * time.Second},
+		userAgent: cfg.UserAgent,
+	}
+}
+
+// wait takes the next free turn, one per second, or errMusicBrainzBusy when
+// that turn is past the deadline of ctx
+func (mb *MusicBrainzClient) wait(ctx context.Context) error {
+	mb.mu.Lock()
+	delay := time.Until(mb.lastRequest.Add(time.Second))
+	if delay < 0 {
+		delay = 0
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(musicBrainzMaxWait)
+	}
+	if time.Now().Add(delay).After(deadline) {
+		mb.mu.Unlock()
+		return errMusicBrainzBusy
+	}
+	mb.lastRequest = time.Now().Add(delay)
+	mb.mu.Unlock()
+
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (mb *MusicBrainzClient) LookupISRC(ctx context.Context, isrc string) ([]MusicBrainzRecording, error) {
+	if err := mb.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	reqUrl := MUSICBRAINZ_API_URL + "/isrc/" + url.PathEscape(isrc) + "?inc=artist-credits&fmt=json"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqUrl, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create musicbrainz request: %w", err)
+	}
+	req.Header.Set("User-Agent", mb.userAgent)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := mb.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to perform musicbrainz request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("musicbrainz request failed with status: %s", resp.Status)
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read musicbrainz response body: %w", err)
+	}
+
+	var respdata struct {
+		Recordings []MusicBrainzRecording `json:"recordings"`
+	}
+	if err := json.Unmarshal(respBody, &respdata); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal musicbrainz response: %w", err)
+	}
+	return respdata.Recordings, nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+const YT_OEMBED_URL = YT_BASE_URL + "/oembed"
+
+type YouTubeOEmbed struct {
+	Title           string `json:"title"`
+	AuthorName      string `json:"author_name"`
+	AuthorUrl       string `json:"author_url"`
+	ThumbnailUrl    string `json:"thumbnail_url"`
+	ThumbnailWidth  int    `json:"thumbnail_width"`
+	ThumbnailHeight int    `json:"thumbnail_height"`
+}
+
+// fetchOEmbed returns the oembed data of a video together with the status
+// youtube answered with: 401 means embedding is disabled, 400/404 that the
+// video doesn't exist or is private
+func (srv *Server) fetchOEmbed(ctx context.Context, videoId string) (*YouTubeOEmbed, int, error) {
+	query := url.Values{}
+	query.Set("url", YT_BASE_URL+"/watch?v="+videoId)
+	query.Set("format", "json")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, YT_OEMBED_URL+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create oembed request: %w", err)
+	}
+
+	resp, err := srv.client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to perform oembed request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.StatusCode, nil
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp.StatusCode, fmt.Errorf("failed to read oembed response body: %w", err)
+	}
+	var oembed YouTubeOEmbed
+	if err := json.Unmarshal(respBody, &oembed); err != nil {
+		return nil, resp.StatusCode, fmt.Errorf("failed to unmarshal oembed response: %w", err)
+	}
+	return &oembed, resp.StatusCode, nil
+}
+
+// loadOEmbedTrack builds a partial track from oembed when the player request
+// failed with cause, returning cause if oembed has nothing either
+func (srv *Server) loadOEmbedTrack(ctx context.Context, videoId string, cause error) (YouTubeTrack, error) {
+	if !srv.spendRetry(ctx, RetryOEmbed) {
+		return YouTubeTrack{}, cause
+	}
+	oembed, status, err := srv.fetchOEmbed(ctx, videoId)
+	if err != nil || oembed == nil {
+		LoggerFromContext(ctx).Debug("oEmbed fallback failed", "videoId", videoId, "status", status, "error", err)
+		recordParse(ctx, "oembed", 0, err)
+		return YouTubeTrack{}, cause
+	}
+	recordParse(ctx, "oembed", 1, nil)
+	LoggerFromContext(ctx).Warn("Player request failed, serving partial oEmbed metadata", "videoId", videoId, "error", cause)
+
+	var images []Thumbnail
+	if oembed.ThumbnailUrl != "" {
+		images = append(images, Thumbnail{
+			Url:    oembed.ThumbnailUrl,
+			Width:  oembed.ThumbnailWidth,
+			Height: oembed.ThumbnailHeight,
+		})
+	}
+	return YouTubeTrack{
+		Title:      oembed.Title,
+		Author:     oembed.AuthorName,
+		Identifier: videoId,
+		Images:     images,
+		Uri:        YT_BASE_URL + "/watch?v=" + videoId,
+		Type:       "video",
+		Partial:    true,
+	}, nil
+}
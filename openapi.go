@@ -0,0 +1,623 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/swaggest/swgui/v5emb"
+)
+
+const openAPIVersion = "3.0.3"
+
+type OpenAPIConfig struct {
+	// Docs serves Swagger UI for the document at /docs
+	Docs bool `yaml:"docs"`
+}
+
+// apiParam is a query or path parameter of a documented route
+type apiParam struct {
+	Name        string
+	In          string
+	Type        string
+	Description string
+	Required    bool
+	Enum        []string
+}
+
+func queryParam(name string, paramType string, description string) apiParam {
+	return apiParam{Name: name, In: "query", Type: paramType, Description: description}
+}
+
+func requiredParam(param apiParam) apiParam {
+	param.Required = true
+	return param
+}
+
+func enumParam(param apiParam, values ...string) apiParam {
+	param.Enum = values
+	return param
+}
+
+// apiRoute documents a route of the public api. Body and Response are values
+// of the request and response types, their schemas are read off the types.
+type apiRoute struct {
+	Method      string
+	Path        string
+	Summary     string
+	Tag         string
+	Params      []apiParam
+	Body        any
+	Response    any
+	Status      int
+	ContentType string
+	// Formats are the other content types the route answers with by its format parameter
+	Formats []string
+	// Tracks marks responses holding tracks, which the fields parameter applies to
+	Tracks bool
+}
+
+var searchParams = []apiParam{
+	requiredParam(queryParam("query", "string", "text to search, a video id or url, or an ISRC")),
+	queryParam("limit", "integer", "results to return, continuation pages are loaded until it is met"),
+	queryParam("exact", "boolean", "search the query as typed instead of YouTube's spelling correction"),
+	queryParam("safeSearch", "boolean", "search in restricted mode, overriding search.safe_search"),
+	queryParam("score", "boolean", "add a match score against the query to every result"),
+	queryParam("title", "string", "title to score the results against instead of the query"),
+	queryParam("artist", "string", "artist to score the results against"),
+	queryParam("target_duration_ms", "integer", "length to score the results against"),
+}
+
+// apiRoutes are the routes the OpenAPI document describes
+var apiRoutes = []apiRoute{
+	{
+		Method:  http.MethodGet,
+		Path:    "/api/youtube/search",
+		Summary: "Search YouTube videos",
+		Tag:     "youtube",
+		Params: append(slices.Clone(searchParams),
+			queryParam("extended", "boolean", "add the publish time, description snippet and badges"),
+			enumParam(queryParam("duration", "string", "only find videos of this length"), "short", "medium", "long"),
+			enumParam(queryParam("uploadDate", "string", "only find videos uploaded within"), "hour", "today", "week", "month", "year"),
+			enumParam(queryParam("sort", "string", "order of the results"), "relevance", "date", "views", "rating"),
+			queryParam("features", "string", "comma separated features the videos must have: hd, cc, 4k, live"),
+			queryParam("types", "string", "comma separated result kinds, videos are returned as tracks when unset"),
+			queryParam("duration_ms", "integer", "expected length of the recording of an ISRC query"),
+		),
+		Response: []YouTubeTrack{},
+		Tracks:   true,
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/api/youtubemusic/search",
+		Summary: "Search YouTube Music",
+		Tag:     "music",
+		Params: append(slices.Clone(searchParams),
+			enumParam(queryParam("category", "string", "what to find, songs when unset"), "songs", "videos", "albums", "artists", "playlists"),
+		),
+		Response: []YouTubeTrack{},
+		Tracks:   true,
+	},
+	{
+		Method:   http.MethodGet,
+		Path:     "/api/youtubemusic/song/{id}",
+		Summary:  "YouTube Music song details",
+		Tag:      "music",
+		Params:   []apiParam{{Name: "id", In: "path", Type: "string", Description: "video id of the song", Required: true}},
+		Response: &YouTubeMusicSong{},
+	},
+	{
+		Method:   http.MethodGet,
+		Path:     "/api/youtubemusic/explore",
+		Summary:  "YouTube Music moods & genres",
+		Tag:      "music",
+		Params:   []apiParam{queryParam("category", "string", "params of a category, the overview when unset")},
+		Response: &YouTubeMusicExplore{},
+	},
+	{
+		Method:   http.MethodGet,
+		Path:     "/api/youtubemusic/artist",
+		Summary:  "YouTube Music artist",
+		Tag:      "music",
+		Params:   []apiParam{requiredParam(queryParam("id", "string", "channel id of the artist"))},
+		Response: &YouTubeMusicArtist{},
+	},
+	{
+		Method:   http.MethodPost,
+		Path:     "/api/youtubemusic/isrc",
+		Summary:  "Look up ISRCs in bulk",
+		Tag:      "music",
+		Body:     BulkISRCRequest{},
+		Response: BatchResponse{},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/api/youtube/formats",
+		Summary: "Stream formats of a video",
+		Tag:     "youtube",
+		Params: []apiParam{
+			requiredParam(queryParam("videoId", "string", "")),
+			queryParam("playable", "boolean", "only formats with a playable url"),
+		},
+		Response: &StreamFormats{},
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/api/youtube/manifest/{file}",
+		Summary:     "DASH or HLS manifest of a video",
+		Tag:         "youtube",
+		Params:      []apiParam{{Name: "file", In: "path", Type: "string", Description: "<videoId>.mpd, or <videoId>.m3u8 redirecting to the HLS playlist of a live stream", Required: true}},
+		ContentType: "application/dash+xml",
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/api/youtube/available",
+		Summary: "Availability of a video",
+		Tag:     "youtube",
+		Params: []apiParam{
+			requiredParam(queryParam("videoId", "string", "")),
+			queryParam("oembed", "boolean", "ask the oEmbed endpoint first, settling missing and private videos cheaply"),
+		},
+		Response: &VideoAvailability{},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/api/youtube/playlist",
+		Summary: "Load a playlist",
+		Tag:     "youtube",
+		Params: []apiParam{
+			requiredParam(queryParam("id", "string", "playlist id, its browse id, a url carrying it or a channel id")),
+			queryParam("limit", "integer", "tracks to load, at most playlist.max_tracks"),
+			enumParam(queryParam("format", "string", ""), "json", "rss", "atom"),
+		},
+		Response: &YouTubePlaylist{},
+		Formats:  []string{"application/rss+xml", "application/atom+xml"},
+		Tracks:   true,
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/api/youtube/playlist/stream",
+		Summary: "Stream the tracks of a playlist as its pages load",
+		Tag:     "youtube",
+		Params: []apiParam{
+			requiredParam(queryParam("id", "string", "playlist id, its browse id, a url carrying it or a channel id")),
+			queryParam("limit", "integer", "tracks to load, at most playlist.max_tracks"),
+			enumParam(queryParam("format", "string", ""), "ndjson", "json", "sse"),
+		},
+		ContentType: "application/x-ndjson",
+		Formats:     []string{"application/json", "text/event-stream"},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/api/youtube/channel",
+		Summary: "Uploads of a channel",
+		Tag:     "youtube",
+		Params: []apiParam{
+			requiredParam(queryParam("id", "string", "channel id, @handle or channel url")),
+			enumParam(queryParam("format", "string", ""), "json", "rss", "atom"),
+		},
+		Response: &YouTubePlaylist{},
+		Formats:  []string{"application/rss+xml", "application/atom+xml"},
+		Tracks:   true,
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/api/youtube/mix",
+		Summary: "Load a YouTube Mix",
+		Tag:     "youtube",
+		Params: []apiParam{
+			queryParam("videoId", "string", "video the mix starts from"),
+			queryParam("list", "string", "RD... id of the mix"),
+			queryParam("limit", "integer", "tracks to load"),
+			queryParam("exclude", "string", "comma separated video ids to leave out"),
+		},
+		Response: &YouTubePlaylist{},
+		Tracks:   true,
+	},
+	{
+		Method:   http.MethodGet,
+		Path:     "/api/youtube/related",
+		Summary:  "Related videos",
+		Tag:      "youtube",
+		Params:   []apiParam{requiredParam(queryParam("videoId", "string", ""))},
+		Response: []YouTubeTrack{},
+		Tracks:   true,
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/api/youtube/captions",
+		Summary: "Caption tracks of a video, or the captions of one language",
+		Tag:     "youtube",
+		Params: []apiParam{
+			requiredParam(queryParam("videoId", "string", "")),
+			queryParam("lang", "string", "language of the captions, the list of tracks when unset"),
+			enumParam(queryParam("format", "string", ""), "json", "srt", "vtt"),
+		},
+		Response: &Captions{},
+		Formats:  []string{"application/x-subrip", "text/vtt"},
+	},
+	{
+		Method:   http.MethodGet,
+		Path:     "/api/youtube/storyboards",
+		Summary:  "Storyboards of a video",
+		Tag:      "youtube",
+		Params:   []apiParam{requiredParam(queryParam("videoId", "string", ""))},
+		Response: &Storyboards{},
+	},
+	{
+		Method:   http.MethodGet,
+		Path:     "/api/resolve",
+		Summary:  "Resolve a YouTube, Spotify, Apple Music or Deezer url",
+		Tag:      "resolve",
+		Params:   []apiParam{requiredParam(queryParam("url", "string", ""))},
+		Response: &ResolveResult{},
+	},
+	{
+		Method:   http.MethodGet,
+		Path:     "/api/loadtracks",
+		Summary:  "Load tracks like a Lavalink v4 node",
+		Tag:      "resolve",
+		Params:   []apiParam{requiredParam(queryParam("identifier", "string", "ytsearch:, ytmsearch: or a link"))},
+		Response: LavalinkLoadResult{},
+	},
+	{
+		Method:   http.MethodPost,
+		Path:     "/api/equivalent",
+		Summary:  "Find the YouTube Music equivalent of a track",
+		Tag:      "resolve",
+		Body:     EquivalentRequest{},
+		Response: &EquivalentResponse{},
+	},
+	{
+		Method:   http.MethodPost,
+		Path:     "/api/batch",
+		Summary:  "Run a batch of lookups",
+		Tag:      "batch",
+		Body:     BatchRequest{},
+		Response: BatchResponse{},
+	},
+	{
+		Method:   http.MethodPost,
+		Path:     "/api/jobs",
+		Summary:  "Create an async job",
+		Tag:      "batch",
+		Body:     JobRequest{},
+		Response: &Job{},
+		Status:   http.StatusAccepted,
+	},
+	{
+		Method:   http.MethodGet,
+		Path:     "/api/jobs/{id}",
+		Summary:  "Status and result of a job",
+		Tag:      "batch",
+		Params:   []apiParam{{Name: "id", In: "path", Type: "string", Required: true}},
+		Response: &Job{},
+	},
+	{
+		Method:   http.MethodPost,
+		Path:     rpcPath,
+		Summary:  "JSON-RPC 2.0 call or batch of calls",
+		Tag:      "rpc",
+		Body:     RPCRequest{},
+		Response: RPCResponse{},
+	},
+	{
+		Method:   http.MethodGet,
+		Path:     "/healthz/deep",
+		Summary:  "Deep health check",
+		Tag:      "health",
+		Response: &DeepHealth{},
+	},
+}
+
+// openAPISchemas builds the schemas of Go types, named structs become
+// components referenced by name
+type openAPISchemas struct {
+	components map[string]any
+}
+
+func (schemas *openAPISchemas) schemaOf(typ reflect.Type) map[string]any {
+	switch typ {
+	case reflect.TypeFor[time.Time]():
+		return map[string]any{"type": "string", "format": "date-time"}
+	case reflect.TypeFor[json.RawMessage]():
+		return map[string]any{}
+	}
+	switch typ.Kind() {
+	case reflect.Pointer:
+		return schemas.schemaOf(typ.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]any{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": schemas.schemaOf(typ.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemas.schemaOf(typ.Elem())}
+	case reflect.Struct:
+		if typ.Name() == "" {
+			return schemas.objectOf(typ)
+		}
+		if _, ok := schemas.components[typ.Name()]; !ok {
+			// set before the fields are walked, so types referring to
+			// themselves end
+			schemas.components[typ.Name()] = map[string]any{}
+			schemas.components[typ.Name()] = schemas.objectOf(typ)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + typ.Name()}
+	}
+	// interfaces hold any value
+	return map[string]any{}
+}
+
+func (schemas *openAPISchemas) objectOf(typ reflect.Type) map[string]any {
+	properties := map[string]any{}
+	var required []string
+	schemas.addFields(typ, properties, &required)
+	object := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		object["required"] = required
+	}
+	return object
+}
+
+// addFields adds the fields of a struct the way encoding/json encodes them,
+// the fields of embedded structs as fields of their own
+func (schemas *openAPISchemas) addFields(typ reflect.Type, properties map[string]any, required *[]string) {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				schemas.addFields(embedded, properties, required)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = schemas.schemaOf(field.Type)
+		if !strings.Contains(options, "omitempty") && field.Type.Kind() != reflect.Pointer {
+			*required = append(*required, name)
+		}
+	}
+}
+
+func (schemas *openAPISchemas) parameterOf(param apiParam) map[string]any {
+	schema := map[string]any{"type": param.Type}
+	if len(param.Enum) > 0 {
+		schema["enum"] = param.Enum
+	}
+	parameter := map[string]any{"name": param.Name, "in": param.In, "schema": schema}
+	if param.Description != "" {
+		parameter["description"] = param.Description
+	}
+	if param.Required {
+		parameter["required"] = true
+	}
+	return parameter
+}
+
+func (schemas *openAPISchemas) operationOf(route apiRoute) map[string]any {
+	var parameters []any
+	for _, param := range route.Params {
+		parameters = append(parameters, schemas.parameterOf(param))
+	}
+	if strings.HasPrefix(route.Path, "/api/") {
+		parameters = append(parameters,
+			map[string]any{"$ref": "#/components/parameters/hl"},
+			map[string]any{"$ref": "#/components/parameters/gl"},
+		)
+	}
+	if route.Tracks {
+		parameters = append(parameters, map[string]any{"$ref": "#/components/parameters/fields"})
+	}
+
+	content := map[string]any{}
+	contentType := route.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	if route.Response != nil {
+		content[contentType] = map[string]any{"schema": schemas.schemaOf(reflect.TypeOf(route.Response))}
+	} else {
+		content[contentType] = map[string]any{"schema": map[string]any{"type": "string"}}
+	}
+	for _, format := range route.Formats {
+		content[format] = map[string]any{"schema": map[string]any{"type": "string"}}
+	}
+	status := route.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := map[string]any{"description": http.StatusText(status), "content": content}
+	if strings.HasPrefix(route.Path, "/api/") {
+		success["headers"] = map[string]any{"X-API-Version": map[string]any{"$ref": "#/components/headers/X-API-Version"}}
+	}
+	responses := map[string]any{fmt.Sprint(status): success}
+	if len(route.Params) > 0 || route.Body != nil {
+		responses["400"] = map[string]any{"$ref": "#/components/responses/ValidationError"}
+	}
+
+	operation := map[string]any{
+		"summary":     route.Summary,
+		"operationId": operationId(route),
+		"tags":        []string{route.Tag},
+		"responses":   responses,
+	}
+	if len(parameters) > 0 {
+		operation["parameters"] = parameters
+	}
+	if route.Body != nil {
+		operation["requestBody"] = map[string]any{
+			"required": true,
+			"content": map[string]any{
+				"application/json": map[string]any{"schema": schemas.schemaOf(reflect.TypeOf(route.Body))},
+			},
+		}
+	}
+	return operation
+}
+
+// operationId names an operation after its method and path, GET
+// /api/youtube/playlist/stream is getYoutubePlaylistStream
+func operationId(route apiRoute) string {
+	var name strings.Builder
+	name.WriteString(strings.ToLower(route.Method))
+	for _, part := range strings.FieldsFunc(strings.TrimPrefix(route.Path, "/api"), func(r rune) bool {
+		return r == '/' || r == '{' || r == '}'
+	}) {
+		name.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return name.String()
+}
+
+// buildOpenAPI describes apiRoutes as an OpenAPI 3 document, the api routes
+// under the prefix of the current schema version
+func buildOpenAPI() map[string]any {
+	schemas := &openAPISchemas{components: map[string]any{}}
+	paths := map[string]any{}
+	prefix := fmt.Sprintf("/v%d/", CurrentAPIVersion)
+	for _, route := range apiRoutes {
+		path := route.Path
+		if rest, ok := strings.CutPrefix(path, "/api/"); ok {
+			path = prefix + rest
+		}
+		item, _ := paths[path].(map[string]any)
+		if item == nil {
+			item = map[string]any{}
+			paths[path] = item
+		}
+		item[strings.ToLower(route.Method)] = schemas.operationOf(route)
+	}
+
+	errorSchema := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"error":      schemas.schemaOf(reflect.TypeFor[ValidationError]()),
+			"request_id": map[string]any{"type": "string"},
+		},
+		"required": []string{"error"},
+	}
+	localeParam := func(name string, description string) map[string]any {
+		return map[string]any{"name": name, "in": "query", "description": description, "schema": map[string]any{"type": "string"}}
+	}
+	return map[string]any{
+		"openapi": openAPIVersion,
+		"info": map[string]any{
+			"title": "YouTube Search API",
+			"description": "Search videos and songs on YouTube and YouTube Music, load playlists and resolve links. " +
+				"The routes are also served under /api/, answering with schema version 1.",
+			"version": fmt.Sprint(CurrentAPIVersion),
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": schemas.components,
+			"parameters": map[string]any{
+				"hl": localeParam("hl", "language of the upstream requests, e.g. de or pt-BR"),
+				"gl": localeParam("gl", "region of the upstream requests, e.g. DE"),
+				"fields": map[string]any{
+					"name":        "fields",
+					"in":          "query",
+					"description": "comma separated track fields to return: " + strings.Join(trackFields, ", "),
+					"schema":      map[string]any{"type": "string"},
+				},
+			},
+			"headers": map[string]any{
+				"X-API-Version": map[string]any{
+					"description": "schema version of the response",
+					"schema":      map[string]any{"type": "integer"},
+				},
+			},
+			"responses": map[string]any{
+				"ValidationError": map[string]any{
+					"description": "Invalid parameters",
+					"content":     map[string]any{"application/json": map[string]any{"schema": errorSchema}},
+				},
+			},
+			"securitySchemes": map[string]any{
+				"apiKeyHeader": map[string]any{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+				"bearer":       map[string]any{"type": "http", "scheme": "bearer"},
+				"apiKeyQuery":  map[string]any{"type": "apiKey", "in": "query", "name": "api_key"},
+			},
+		},
+		// keys are only required with auth.enabled
+		"security": []any{
+			map[string]any{},
+			map[string]any{"apiKeyHeader": []string{}},
+			map[string]any{"bearer": []string{}},
+			map[string]any{"apiKeyQuery": []string{}},
+		},
+	}
+}
+
+// openAPIDocument is the encoded document, built once from the routes and
+// types compiled in
+var openAPIDocument = sync.OnceValues(func() ([]byte, error) {
+	return json.MarshalIndent(buildOpenAPI(), "", "  ")
+})
+
+func (srv *Server) MakeOpenAPIHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		document, err := openAPIDocument()
+		if err != nil {
+			writeError(writer, http.StatusInternalServerError, fmt.Sprintf("Error encoding OpenAPI document: %v", err))
+			return
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		_, _ = writer.Write(document)
+	}
+}
+
+// MakeDocsHandler serves Swagger UI for /openapi.json, its assets are
+// compiled in so the page works without reaching a CDN
+func (srv *Server) MakeDocsHandler() http.Handler {
+	return v5emb.New("YouTube Search API", "/openapi.json", "/docs/")
+}
+
+// RunOpenAPI writes the OpenAPI document, for client generators to use without
+// a running server
+func RunOpenAPI(args []string) error {
+	var out io.Writer = os.Stdout
+	if len(args) > 0 && args[0] != "-" {
+		file, err := os.Create(args[0])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	document, err := openAPIDocument()
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(append(document, '\n'))
+	return err
+}
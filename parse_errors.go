@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/tidwall/gjson"
+	"github.com/topi314/tint"
+)
+
+const (
+	ParseReasonUnsupportedRenderer = "unsupported_renderer"
+	ParseReasonUnplayable          = "unplayable"
+)
+
+var (
+	parseFailuresTotal = metrics.Counter(
+		"ytsearch_parse_failures_total",
+		"Upstream items or responses that could not be parsed",
+		"endpoint", "path", "reason",
+	)
+	parseSkippedTotal = metrics.Counter(
+		"ytsearch_parse_skipped_items_total",
+		"Upstream items skipped because they are not supported or not playable",
+		"endpoint", "renderer",
+	)
+)
+
+// skippedRenderers are the renderer label values of parseSkippedTotal. The
+// names come from upstream JSON, so any other renderer is counted as "other"
+// to keep the number of series bounded.
+var skippedRenderers = map[string]bool{
+	"unknown":                                          true,
+	"videoRenderer":                                    true,
+	"compactVideoRenderer":                             true,
+	"playlistVideoRenderer":                            true,
+	"playlistPanelVideoRenderer":                       true,
+	"musicResponsiveListItemRenderer":                  true,
+	"musicResponsiveListItemRenderer.playlistItemData": true,
+	"musicTwoRowItemRenderer":                          true,
+	"musicNavigationButtonRenderer":                    true,
+	"channelRenderer":                                  true,
+	"playlistRenderer":                                 true,
+	"movieRenderer":                                    true,
+	"radioRenderer":                                    true,
+	"compactRadioRenderer":                             true,
+	"compactPlaylistRenderer":                          true,
+	"shelfRenderer":                                    true,
+	"reelShelfRenderer":                                true,
+	"reelItemRenderer":                                 true,
+	"horizontalCardListRenderer":                       true,
+	"continuationItemRenderer":                         true,
+	"adSlotRenderer":                                   true,
+	"promotedSparklesWebRenderer":                      true,
+	"searchPyvRenderer":                                true,
+	"messageRenderer":                                  true,
+	"backgroundPromoRenderer":                          true,
+	"lockupViewModel":                                  true,
+	"shortsLockupViewModel":                            true,
+	"gridShelfViewModel":                               true,
+}
+
+func skippedRendererLabel(renderer string) string {
+	if skippedRenderers[renderer] {
+		return renderer
+	}
+	return "other"
+}
+
+type ParseError struct {
+	Path   string
+	Reason string
+	Detail string
+}
+
+func (e *ParseError) Error() string {
+	if e.Detail == "" {
+		return fmt.Sprintf("%s: %s", e.Path, e.Reason)
+	}
+	return fmt.Sprintf("%s: %s (%s)", e.Path, e.Reason, e.Detail)
+}
+
+func newParseError(path string, reason string, detail string) *ParseError {
+	return &ParseError{Path: path, Reason: reason, Detail: detail}
+}
+
+// rendererName returns the renderer key of an item like {"videoRenderer": {...}}
+func rendererName(item gjson.Result) string {
+	name := "unknown"
+	item.ForEach(func(key, _ gjson.Result) bool {
+		name = key.String()
+		return false
+	})
+	return name
+}
+
+// recordParseFailure counts the failure and keeps a sample of the payload the
+// first time a failure signature shows up
+func recordParseFailure(endpoint string, err error, payload []byte) {
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		parseErr = newParseError("response", "invalid", err.Error())
+	}
+
+	if parseErr.Reason == ParseReasonUnsupportedRenderer || parseErr.Reason == ParseReasonUnplayable {
+		parseSkippedTotal.Inc(endpoint, skippedRendererLabel(parseErr.Path))
+		slog.Debug("Skipping item", "endpoint", endpoint, "renderer", parseErr.Path, "reason", parseErr.Reason)
+		return
+	}
+
+	parseFailuresTotal.Inc(endpoint, parseErr.Path, parseErr.Reason)
+	alertTotals.parseFailures.Add(1)
+	slog.Warn("Failed to parse upstream item", "endpoint", endpoint, tint.Err(err))
+
+	signature := endpoint + "|" + parseErr.Path + "|" + parseErr.Reason
+	artifacts.SaveOnce(signature, "parse_"+endpoint+"_"+parseErr.Reason, payload)
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const YT_IFRAME_API_URL = YT_BASE_URL + "/iframe_api"
+
+// youtube ships a new player every few days, older ones keep working for a while
+const playerScriptTTL = 6 * time.Hour
+
+var (
+	playerIdPattern           = regexp.MustCompile(`player\\?/([0-9a-fA-F]{8})\\?/`)
+	signatureTimestampPattern = regexp.MustCompile(`(?:signatureTimestamp|sts)\s*:\s*(\d{5})`)
+	decipherFunctionPattern   = regexp.MustCompile(
+		`(?s)=function\(([a-zA-Z0-9_$]+)\)\{\s*[a-zA-Z0-9_$]+=[a-zA-Z0-9_$]+\.split\(""\);(.+?)return [a-zA-Z0-9_$]+\.join\(""\)\}`,
+	)
+	decipherCallPattern = regexp.MustCompile(
+		`([a-zA-Z0-9_$]+)(?:\.|\[")([a-zA-Z0-9_$]+)(?:"\])?\([a-zA-Z0-9_$]+,(\d+)\)`,
+	)
+	decipherMethodPattern = regexp.MustCompile(`(?s)([a-zA-Z0-9_$]+):function\([^)]*\)\{(.*?)\}`)
+
+	// helper bodies of the known transforms, anything else is a parse error
+	// rather than a guess that yields signatures youtube refuses
+	cipherReversePattern = regexp.MustCompile(`^\s*[a-zA-Z0-9_$]+\.reverse\(\);?\s*$`)
+	cipherSplicePattern  = regexp.MustCompile(`^\s*[a-zA-Z0-9_$]+\.splice\(0,[a-zA-Z0-9_$]+\);?\s*$`)
+	cipherSwapPattern    = regexp.MustCompile(
+		`^\s*var [a-zA-Z0-9_$]+=[a-zA-Z0-9_$]+\[0\];[a-zA-Z0-9_$]+\[0\]=[a-zA-Z0-9_$]+\[[a-zA-Z0-9_$]+%[a-zA-Z0-9_$]+\.length\];` +
+			`[a-zA-Z0-9_$]+\[[a-zA-Z0-9_$]+%[a-zA-Z0-9_$]+\.length\]=[a-zA-Z0-9_$]+;?\s*$`,
+	)
+)
+
+type cipherOpKind int
+
+const (
+	cipherReverse cipherOpKind = iota
+	cipherSplice
+	cipherSwap
+)
+
+type cipherOp struct {
+	kind cipherOpKind
+	arg  int
+}
+
+// PlayerScript is what the stream urls need from youtube's player script: the
+// signature timestamp to ask the player api with and the signature cipher
+type PlayerScript struct {
+	Id                 string
+	SignatureTimestamp int
+	ops                []cipherOp
+	fetchedAt          time.Time
+}
+
+func (script *PlayerScript) Decipher(signature string) string {
+	sig := []byte(signature)
+	for _, op := range script.ops {
+		switch op.kind {
+		case cipherReverse:
+			for i, j := 0, len(sig)-1; i < j; i, j = i+1, j-1 {
+				sig[i], sig[j] = sig[j], sig[i]
+			}
+		case cipherSplice:
+			sig = sig[min(op.arg, len(sig)):]
+		case cipherSwap:
+			if len(sig) > 0 {
+				pos := op.arg % len(sig)
+				sig[0], sig[pos] = sig[pos], sig[0]
+			}
+		}
+	}
+	return string(sig)
+}
+
+// parsePlayerScript extracts the cipher, a function splitting the signature
+// into characters and running it through reverse, splice and swap helpers of
+// one object before joining it again
+func parsePlayerScript(id string, script []byte) (*PlayerScript, error) {
+	player := &PlayerScript{Id: id, fetchedAt: time.Now()}
+
+	match := signatureTimestampPattern.FindSubmatch(script)
+	if match == nil {
+		return nil, newParseError("signatureTimestamp", "missing", id)
+	}
+	player.SignatureTimestamp, _ = strconv.Atoi(string(match[1]))
+
+	function := decipherFunctionPattern.FindSubmatch(script)
+	if function == nil {
+		return nil, newParseError("decipher function", "missing", id)
+	}
+	calls := decipherCallPattern.FindAllSubmatch(function[2], -1)
+	if len(calls) == 0 {
+		return nil, newParseError("decipher function", "no transforms", id)
+	}
+
+	helperName := string(calls[0][1])
+	helper := regexp.MustCompile(`(?s)var ` + regexp.QuoteMeta(helperName) + `=\{(.*?)\};`).FindSubmatch(script)
+	if helper == nil {
+		return nil, newParseError("decipher helper", "missing", id+" "+helperName)
+	}
+	methods := make(map[string]cipherOpKind)
+	for _, method := range decipherMethodPattern.FindAllSubmatch(helper[1], -1) {
+		switch body := method[2]; {
+		case cipherReversePattern.Match(body):
+			methods[string(method[1])] = cipherReverse
+		case cipherSplicePattern.Match(body):
+			methods[string(method[1])] = cipherSplice
+		case cipherSwapPattern.Match(body):
+			methods[string(method[1])] = cipherSwap
+		}
+	}
+
+	// a call of a helper left out of methods fails the parse
+	for _, call := range calls {
+		kind, ok := methods[string(call[2])]
+		if !ok || string(call[1]) != helperName {
+			// the names come from the script, they go in the detail so the
+			// failure metric's labels stay fixed
+			return nil, newParseError("decipher helper", "unknown transform", id+" "+helperName+"."+string(call[2]))
+		}
+		arg, _ := strconv.Atoi(string(call[3]))
+		player.ops = append(player.ops, cipherOp{kind: kind, arg: arg})
+	}
+	return player, nil
+}
+
+func (srv *Server) fetchText(ctx context.Context, name string, targetUrl string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, targetUrl, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s request: %w", name, err)
+	}
+	resp, err := srv.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to perform %s request: %w", name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s request failed with status %d", name, resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s response: %w", name, err)
+	}
+	return body, nil
+}
+
+// LoadPlayerScript returns the current player script, looked up through the
+// iframe api and kept for playerScriptTTL
+func (srv *Server) LoadPlayerScript(ctx context.Context) (*PlayerScript, error) {
+	if script := srv.playerScript.Load(); script != nil && time.Since(script.fetchedAt) < playerScriptTTL {
+		return script, nil
+	}
+	srv.playerScriptMu.Lock()
+	defer srv.playerScriptMu.Unlock()
+	if script := srv.playerScript.Load(); script != nil && time.Since(script.fetchedAt) < playerScriptTTL {
+		return script, nil
+	}
+
+	iframeApi, err := srv.fetchText(ctx, "iframe api", YT_IFRAME_API_URL)
+	if err != nil {
+		return nil, err
+	}
+	match := playerIdPattern.FindSubmatch(iframeApi)
+	if match == nil {
+		err := newParseError("player id", "missing", "")
+		recordParseFailure("iframe api", err, iframeApi)
+		return nil, err
+	}
+	id := string(match[1])
+
+	body, err := srv.fetchText(ctx, "player script", YT_BASE_URL+"/s/player/"+id+"/player_ias.vflset/en_US/base.js")
+	if err != nil {
+		return nil, err
+	}
+	script, err := parsePlayerScript(id, body)
+	if err != nil {
+		recordParse(ctx, "player script", 0, err)
+		recordParseFailure("player script", err, body)
+		return nil, err
+	}
+	recordParse(ctx, "player script", len(script.ops), nil)
+	LoggerFromContext(ctx).Info(
+		"Loaded player script",
+		"player_id", id,
+		"signature_timestamp", script.SignatureTimestamp,
+		"cipher_ops", len(script.ops),
+	)
+	srv.playerScript.Store(script)
+	return script, nil
+}
+
+// streamUrl is the playable url of a format, deciphering the signature of
+// formats that only carry a signatureCipher
+func (script *PlayerScript) streamUrl(plain string, signatureCipher string) (string, error) {
+	if plain != "" {
+		return plain, nil
+	}
+	cipher, err := url.ParseQuery(signatureCipher)
+	if err != nil {
+		return "", fmt.Errorf("invalid signature cipher: %w", err)
+	}
+	streamUrl, err := url.Parse(cipher.Get("url"))
+	if err != nil || cipher.Get("s") == "" {
+		return "", fmt.Errorf("invalid signature cipher: %q", signatureCipher)
+	}
+	param := cipher.Get("sp")
+	if param == "" {
+		param = "signature"
+	}
+	query := streamUrl.Query()
+	query.Set(param, script.Decipher(cipher.Get("s")))
+	streamUrl.RawQuery = query.Encode()
+	return streamUrl.String(), nil
+}
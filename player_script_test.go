@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func loadTestPlayerScript(t *testing.T) []byte {
+	t.Helper()
+	script, err := os.ReadFile("mockdata/base.js")
+	if err != nil {
+		t.Fatalf("failed to read player script: %v", err)
+	}
+	return script
+}
+
+func TestParsePlayerScript(t *testing.T) {
+	player, err := parsePlayerScript("mock", loadTestPlayerScript(t))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if player.SignatureTimestamp != 20371 {
+		t.Errorf("signature timestamp = %d, want 20371", player.SignatureTimestamp)
+	}
+	want := []cipherOp{{cipherSwap, 3}, {cipherReverse, 12}, {cipherSplice, 2}, {cipherSwap, 41}}
+	if len(player.ops) != len(want) {
+		t.Fatalf("got %d cipher ops, want %d", len(player.ops), len(want))
+	}
+	for i, op := range player.ops {
+		if op != want[i] {
+			t.Errorf("op %d = %+v, want %+v", i, op, want[i])
+		}
+	}
+
+	// swap 3, reverse, drop 2, swap 41 % 18 = 5
+	if got := player.Decipher("ABCDEFGHIJKLMNOPQRST"); got != "MQPONRLKJIHGFEACBD" {
+		t.Errorf("Decipher = %q, want %q", got, "MQPONRLKJIHGFEACBD")
+	}
+}
+
+func TestParsePlayerScriptUnknownTransform(t *testing.T) {
+	script := strings.Replace(
+		string(loadTestPlayerScript(t)),
+		"Qe:function(a){a.reverse()}",
+		"Qe:function(a){a.sort()}",
+		1,
+	)
+	_, err := parsePlayerScript("mock", []byte(script))
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("got %v, want a parse error", err)
+	}
+	if parseErr.Path != "decipher helper" || parseErr.Reason != "unknown transform" {
+		t.Errorf("error = %q %q, want fixed labels", parseErr.Path, parseErr.Reason)
+	}
+	if parseErr.Detail != "mock Zx.Qe" {
+		t.Errorf("detail = %q, want %q", parseErr.Detail, "mock Zx.Qe")
+	}
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+var digitsPattern = regexp.MustCompile(`[0-9][0-9,.\s]*`)
+
+type YouTubePlaylist struct {
+	Identifier string         `json:"identifier"`
+	Title      string         `json:"title"`
+	Author     string         `json:"author"`
+	Uri        string         `json:"uri"`
+	TotalCount int            `json:"total_count"`
+	Truncated  bool           `json:"truncated"`
+	Tracks     []YouTubeTrack `json:"tracks"`
+}
+
+// parsePlaylistId accepts a playlist id, its browse id or a url carrying it in
+// the list parameter. A channel id stands for the playlist of its uploads.
+func parsePlaylistId(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if strings.Contains(value, "list=") {
+		if parsed, err := url.Parse(value); err == nil {
+			value = parsed.Query().Get("list")
+		}
+	}
+	value = strings.TrimPrefix(value, "VL")
+	if strings.HasPrefix(value, "UC") && len(value) == 24 {
+		value = "UU" + value[2:]
+	}
+	if !DirectPlaylistIDPattern.MatchString(value) {
+		return "", fmt.Errorf("unsupported playlist id: %q", value)
+	}
+	return value, nil
+}
+
+func parseCount(text string) int {
+	match := digitsPattern.FindString(text)
+	count, _ := strconv.Atoi(strings.NewReplacer(",", "", ".", "", " ", "").Replace(match))
+	return count
+}
+
+func parsePlaylistVideo(item gjson.Result) (YouTubeTrack, error) {
+	itemRenderer := item.Get("playlistVideoRenderer")
+	if !itemRenderer.Exists() {
+		return YouTubeTrack{}, newParseError(rendererName(item), ParseReasonUnsupportedRenderer, "")
+	}
+
+	videoId := itemRenderer.Get("videoId").String()
+	if itemRenderer.Get("isPlayable").Exists() && !itemRenderer.Get("isPlayable").Bool() {
+		return YouTubeTrack{}, newParseError("playlistVideoRenderer", ParseReasonUnplayable, videoId)
+	}
+
+	lengthText, length := parseLengthText(itemRenderer.Get("lengthText"))
+	if seconds := itemRenderer.Get("lengthSeconds").Int(); seconds > 0 {
+		length = int(seconds) * 1000
+	}
+	if length == 0 {
+		return YouTubeTrack{}, newParseError(
+			"playlistVideoRenderer.lengthSeconds",
+			"invalid_duration",
+			itemRenderer.Get("lengthSeconds").String(),
+		)
+	}
+
+	return YouTubeTrack{
+		Title:      itemRenderer.Get("title.runs.0.text").String(),
+		Author:     itemRenderer.Get("shortBylineText.runs.0.text").String(),
+		Identifier: videoId,
+		Images:     parseThumbnails(itemRenderer.Get("thumbnail.thumbnails")),
+		Length:     length,
+		LengthText: lengthText,
+		Uri:        YT_BASE_URL + "/watch?v=" + videoId,
+		Type:       "video",
+		ChannelId: itemRenderer.Get("shortBylineText.runs.0.navigationEndpoint.browseEndpoint.browseId").
+			String(),
+	}, nil
+}
+
+// parsePlaylistItems returns the tracks of a page of playlist items and the
+// continuation token of the next page, if any
+func parsePlaylistItems(items gjson.Result, data []byte) ([]YouTubeTrack, string) {
+	tracks := make([]YouTubeTrack, 0)
+	continuation := ""
+	for _, item := range items.Array() {
+		if token := item.Get("continuationItemRenderer.continuationEndpoint.continuationCommand.token"); token.Exists() {
+			continuation = token.String()
+			continue
+		}
+		track, err := parsePlaylistVideo(item)
+		if err != nil {
+			recordParseFailure("playlist", err, data)
+			continue
+		}
+		tracks = append(tracks, track)
+	}
+	return tracks, continuation
+}
+
+func parsePlaylistPage(data []byte) (*YouTubePlaylist, string, error) {
+	items := gjson.GetBytes(
+		data,
+		"contents.twoColumnBrowseResultsRenderer.tabs.0.tabRenderer.content.sectionListRenderer.contents.0.itemSectionRenderer.contents.0.playlistVideoListRenderer.contents",
+	)
+	if !items.IsArray() {
+		if alert := gjson.GetBytes(data, "alerts.0.alertRenderer.text.runs.0.text"); alert.Exists() {
+			return nil, "", fmt.Errorf("playlist unavailable: %s", alert.String())
+		}
+		err := newParseError("playlistVideoListRenderer.contents", "missing", "")
+		recordParseFailure("playlist", err, data)
+		return nil, "", err
+	}
+
+	playlist := &YouTubePlaylist{
+		Title: gjson.GetBytes(data, "metadata.playlistMetadataRenderer.title").String(),
+	}
+
+	header := gjson.GetBytes(data, "header.playlistHeaderRenderer")
+	if header.Exists() {
+		playlist.Author = header.Get("ownerText.runs.0.text").String()
+		playlist.TotalCount = parseCount(header.Get("numVideosText.runs.0.text").String())
+	}
+	sidebar := gjson.GetBytes(data, "sidebar.playlistSidebarRenderer.items")
+	for _, item := range sidebar.Array() {
+		if primary := item.Get("playlistSidebarPrimaryInfoRenderer"); primary.Exists() && playlist.TotalCount == 0 {
+			stats := primary.Get("stats.0")
+			if text := stats.Get("runs.0.text"); text.Exists() {
+				playlist.TotalCount = parseCount(text.String())
+			} else {
+				playlist.TotalCount = parseCount(stats.Get("simpleText").String())
+			}
+		}
+		if secondary := item.Get("playlistSidebarSecondaryInfoRenderer"); secondary.Exists() && playlist.Author == "" {
+			playlist.Author = secondary.Get("videoOwner.videoOwnerRenderer.title.runs.0.text").String()
+		}
+	}
+
+	tracks, continuation := parsePlaylistItems(items, data)
+	playlist.Tracks = tracks
+	return playlist, continuation, nil
+}
+
+func parsePlaylistContinuation(data []byte) ([]YouTubeTrack, string, error) {
+	items := gjson.GetBytes(data, "onResponseReceivedActions.0.appendContinuationItemsAction.continuationItems")
+	if !items.IsArray() {
+		err := newParseError("appendContinuationItemsAction.continuationItems", "missing", "")
+		recordParseFailure("playlist", err, data)
+		return nil, "", err
+	}
+	tracks, continuation := parsePlaylistItems(items, data)
+	return tracks, continuation, nil
+}
+
+func (srv *Server) LoadPlaylist(ctx context.Context, playlistId string, maxTracks int) (*YouTubePlaylist, error) {
+	return srv.loadPlaylistPages(ctx, playlistId, maxTracks, nil)
+}
+
+// loadPlaylistPages loads a playlist page by page, handing the tracks of every
+// page to onPage as soon as its continuation resolves
+func (srv *Server) loadPlaylistPages(
+	ctx context.Context,
+	playlistId string,
+	maxTracks int,
+	onPage func(playlist *YouTubePlaylist, tracks []YouTubeTrack) error,
+) (*YouTubePlaylist, error) {
+	select {
+	case srv.playlistSlots <- struct{}{}:
+		defer func() { <-srv.playlistSlots }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	visitor, err := srv.pickVisitor(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := srv.innertubeRequest(ctx, "playlist", INNERTUBE_BROWSE_API_URL, visitor, map[string]any{
+		"browseId": "VL" + playlistId,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	playlist, continuation, err := parsePlaylistPage(respBody)
+	if err != nil {
+		recordParse(ctx, "playlist", 0, err)
+		return nil, err
+	}
+	recordParse(ctx, "playlist", len(playlist.Tracks), nil)
+	playlist.Identifier = playlistId
+	playlist.Uri = YT_BASE_URL + "/playlist?list=" + playlistId
+
+	emitted := 0
+	emit := func(tracks []YouTubeTrack) error {
+		if onPage == nil || emitted >= maxTracks {
+			return nil
+		}
+		tracks = tracks[:min(len(tracks), maxTracks-emitted)]
+		emitted += len(tracks)
+		return onPage(playlist, tracks)
+	}
+	if err := emit(playlist.Tracks); err != nil {
+		return nil, err
+	}
+
+	pages := 1
+	for continuation != "" && len(playlist.Tracks) < maxTracks {
+		respBody, err := srv.innertubeRequest(ctx, "playlist continuation", INNERTUBE_BROWSE_API_URL, visitor, map[string]any{
+			"continuation": continuation,
+		})
+		if err != nil {
+			return nil, err
+		}
+		var tracks []YouTubeTrack
+		tracks, continuation, err = parsePlaylistContinuation(respBody)
+		recordParse(ctx, "playlist_continuation", len(tracks), err)
+		if err != nil {
+			return nil, err
+		}
+		playlist.Tracks = append(playlist.Tracks, tracks...)
+		pages++
+		if err := emit(tracks); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(playlist.Tracks) > maxTracks {
+		playlist.Tracks = playlist.Tracks[:maxTracks]
+		playlist.Truncated = true
+	}
+	if continuation != "" {
+		playlist.Truncated = true
+	}
+	if playlist.TotalCount == 0 && !playlist.Truncated {
+		playlist.TotalCount = len(playlist.Tracks)
+	}
+
+	LoggerFromContext(ctx).Info(
+		"Loaded playlist",
+		"playlist", playlistId,
+		"tracks", len(playlist.Tracks),
+		"total", playlist.TotalCount,
+		"pages", pages,
+		"truncated", playlist.Truncated,
+	)
+	return playlist, nil
+}
+
+func (srv *Server) MakePlaylistHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		if strings.TrimSpace(req.FormValue("id")) == "" {
+			writeError(writer, http.StatusBadRequest, "id parameter is required")
+			return
+		}
+		playlistId, err := parsePlaylistId(req.FormValue("id"))
+		if err != nil {
+			writeValidationError(writer, &ValidationError{Code: "invalid_playlist_id", Param: "id", Message: err.Error()})
+			return
+		}
+		format, validationErr := parseFeedFormat(req)
+		if validationErr != nil {
+			writeValidationError(writer, validationErr)
+			return
+		}
+
+		maxTracks := srv.Cfg.Playlist.MaxTracks
+		if limit := req.FormValue("limit"); limit != "" {
+			parsed, err := strconv.Atoi(limit)
+			if err != nil || parsed <= 0 {
+				writeError(writer, http.StatusBadRequest, "limit must be a positive integer")
+				return
+			}
+			maxTracks = min(parsed, maxTracks)
+		}
+
+		playlist, cacheStatus, err := srv.loadPlaylistCached(req.Context(), playlistId, maxTracks)
+		if err != nil {
+			writeError(
+				writer,
+				http.StatusInternalServerError,
+				fmt.Sprintf("Error loading playlist: %v", err),
+			)
+			return
+		}
+		srv.writePlaylist(writer, req, format, playlist, cacheStatus)
+	}
+}
+
+// loadPlaylistCached loads a playlist through the cache, whose entries are
+// kept apart by the track limit
+func (srv *Server) loadPlaylistCached(
+	ctx context.Context,
+	playlistId string,
+	maxTracks int,
+) (*YouTubePlaylist, CacheStatus, error) {
+	cacheKey := fmt.Sprintf("playlist:%s:%d", playlistId, maxTracks)
+	if srv.db != nil {
+		entry, err := srv.LookupCache(ctx, cacheKey)
+		if err != nil {
+			LoggerFromContext(ctx).Error("Failed to lookup cache for playlist", "error", err)
+		} else if entry != nil {
+			var playlist YouTubePlaylist
+			if err := json.Unmarshal(entry.Value, &playlist); err != nil {
+				LoggerFromContext(ctx).Error("Failed to unmarshal cached playlist", "error", err)
+			} else {
+				return &playlist, CacheStatus{Hit: true, StoredAt: entry.StoredAt}, nil
+			}
+		}
+	}
+
+	playlist, err := srv.LoadPlaylist(ctx, playlistId, maxTracks)
+	if err != nil {
+		return nil, CacheStatus{}, err
+	}
+
+	if srv.db != nil && len(playlist.Tracks) > 0 {
+		if err := srv.StoreCache(ctx, cacheKey, playlist); err != nil {
+			LoggerFromContext(ctx).Error("Failed to store playlist in cache", "error", err)
+		}
+	}
+	return playlist, CacheStatus{}, nil
+}
+
+// writePlaylist answers with a playlist as JSON or in a feed format
+func (srv *Server) writePlaylist(
+	writer http.ResponseWriter,
+	req *http.Request,
+	format string,
+	playlist *YouTubePlaylist,
+	status CacheStatus,
+) {
+	if format != "" {
+		srv.writeFeed(writer, req, format, playlist, playlist.Uri, status)
+		return
+	}
+	srv.writeJSON(writer, req, playlist, status)
+}
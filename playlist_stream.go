@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	streamFormatNDJSON = "ndjson"
+	streamFormatJSON   = "json"
+	streamFormatSSE    = "sse"
+)
+
+// proxies close connections idle for about a minute, SSE streams send a
+// comment this often while a page loads
+const sseKeepAliveInterval = 15 * time.Second
+
+// PlaylistStreamSummary is the final done event of an SSE playlist stream
+type PlaylistStreamSummary struct {
+	Tracks         int     `json:"tracks"`
+	TotalEstimated int     `json:"total_estimated"`
+	Cache          string  `json:"cache"`
+	ElapsedMs      float64 `json:"elapsed_ms"`
+	Error          string  `json:"error,omitempty"`
+}
+
+// playlistStream writes tracks as they resolve, as NDJSON lines, as the
+// elements of a chunked JSON array or as server-sent events
+type playlistStream struct {
+	ctx    context.Context
+	writer http.ResponseWriter
+	// controller flushes through the status recording wrappers of the middlewares
+	controller *http.ResponseController
+	format     string
+	started    bool
+	written    int
+
+	// what the summary of SSE streams reports
+	startedAt      time.Time
+	totalEstimated int
+	cacheStatus    string
+	// mu keeps the keep-alive comments of SSE streams out of the events
+	mu            sync.Mutex
+	stopKeepAlive chan struct{}
+	keepAlives    sync.WaitGroup
+}
+
+func (stream *playlistStream) start(totalEstimated int, cacheStatus string) {
+	header := stream.writer.Header()
+	switch stream.format {
+	case streamFormatNDJSON:
+		header.Set("Content-Type", "application/x-ndjson")
+	case streamFormatJSON:
+		header.Set("Content-Type", "application/json")
+	case streamFormatSSE:
+		header.Set("Content-Type", "text/event-stream")
+		header.Set("Cache-Control", "no-cache")
+		// nginx buffers responses unless told not to
+		header.Set("X-Accel-Buffering", "no")
+	}
+	header.Set("X-Total-Estimated", strconv.Itoa(totalEstimated))
+	header.Set("X-Cache", cacheStatus)
+	if stream.format != streamFormatSSE {
+		header.Set("Trailer", "X-Stream-Error")
+	}
+	stream.writer.WriteHeader(http.StatusOK)
+	if stream.format == streamFormatJSON {
+		_, _ = stream.writer.Write([]byte("["))
+	}
+	stream.started = true
+	stream.totalEstimated = totalEstimated
+	stream.cacheStatus = cacheStatus
+	if stream.format == streamFormatSSE {
+		stream.stopKeepAlive = make(chan struct{})
+		stream.keepAlives.Add(1)
+		go stream.keepAlive()
+	}
+}
+
+func (stream *playlistStream) keepAlive() {
+	defer stream.keepAlives.Done()
+	ticker := time.NewTicker(sseKeepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stream.stopKeepAlive:
+			return
+		case <-ticker.C:
+			stream.mu.Lock()
+			_, _ = stream.writer.Write([]byte(": keep-alive\n\n"))
+			_ = stream.controller.Flush()
+			stream.mu.Unlock()
+		}
+	}
+}
+
+// writeEvent writes a server-sent event with a JSON payload
+func (stream *playlistStream) writeEvent(event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(stream.writer, "event: %s\ndata: %s\n\n", event, payload)
+	return err
+}
+
+func (stream *playlistStream) write(tracks []YouTubeTrack) error {
+	tracks = applyTenantFilters(stream.ctx, tracks).([]YouTubeTrack)
+	if stream.format == streamFormatSSE {
+		// a tracks event per page, then the progress so far
+		stream.mu.Lock()
+		defer stream.mu.Unlock()
+		if len(tracks) > 0 {
+			if err := stream.writeEvent("tracks", tracks); err != nil {
+				return err
+			}
+			stream.written += len(tracks)
+		}
+		err := stream.writeEvent("progress", map[string]int{
+			"loaded":          stream.written,
+			"total_estimated": stream.totalEstimated,
+		})
+		_ = stream.controller.Flush()
+		return err
+	}
+
+	for _, track := range tracks {
+		data, err := json.Marshal(track)
+		if err != nil {
+			return err
+		}
+		if stream.format == streamFormatNDJSON {
+			data = append(data, '\n')
+		} else if stream.written > 0 {
+			data = append([]byte(","), data...)
+		}
+		if _, err := stream.writer.Write(data); err != nil {
+			return err
+		}
+		stream.written++
+	}
+	_ = stream.controller.Flush()
+	return nil
+}
+
+// finish closes the stream, a failure after the first chunk can only be
+// reported in the X-Stream-Error trailer and, for NDJSON, an error line. SSE
+// streams report it in an error event and always end with a done event
+// summing the stream up.
+func (stream *playlistStream) finish(err error) {
+	if stream.format == streamFormatSSE {
+		// nothing may be written once the handler returns
+		close(stream.stopKeepAlive)
+		stream.keepAlives.Wait()
+		stream.mu.Lock()
+		defer stream.mu.Unlock()
+		summary := PlaylistStreamSummary{
+			Tracks:         stream.written,
+			TotalEstimated: stream.totalEstimated,
+			Cache:          stream.cacheStatus,
+			ElapsedMs:      float64(time.Since(stream.startedAt).Microseconds()) / 1000,
+		}
+		if err != nil {
+			summary.Error = err.Error()
+			_ = stream.writeEvent("error", map[string]string{"error": err.Error()})
+		}
+		_ = stream.writeEvent("done", summary)
+		_ = stream.controller.Flush()
+		return
+	}
+
+	if err != nil {
+		stream.writer.Header().Set("X-Stream-Error", err.Error())
+		if stream.format == streamFormatNDJSON {
+			line, _ := json.Marshal(map[string]string{"error": err.Error()})
+			_, _ = stream.writer.Write(append(line, '\n'))
+		}
+	}
+	if stream.format == streamFormatJSON {
+		_, _ = stream.writer.Write([]byte("]"))
+	}
+}
+
+func (srv *Server) MakePlaylistStreamHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		if strings.TrimSpace(req.FormValue("id")) == "" {
+			writeError(writer, http.StatusBadRequest, "id parameter is required")
+			return
+		}
+		playlistId, err := parsePlaylistId(req.FormValue("id"))
+		if err != nil {
+			writeValidationError(writer, &ValidationError{Code: "invalid_playlist_id", Param: "id", Message: err.Error()})
+			return
+		}
+
+		maxTracks := srv.Cfg.Playlist.MaxTracks
+		if limit := req.FormValue("limit"); limit != "" {
+			parsed, err := strconv.Atoi(limit)
+			if err != nil || parsed <= 0 {
+				writeError(writer, http.StatusBadRequest, "limit must be a positive integer")
+				return
+			}
+			maxTracks = min(parsed, maxTracks)
+		}
+
+		stream := &playlistStream{
+			ctx:        req.Context(),
+			writer:     writer,
+			controller: http.NewResponseController(writer),
+			format:     streamFormatNDJSON,
+			startedAt:  time.Now(),
+		}
+		switch format := req.FormValue("format"); format {
+		case "":
+		case streamFormatNDJSON, streamFormatJSON, streamFormatSSE:
+			stream.format = format
+		default:
+			writeError(writer, http.StatusBadRequest, "format must be ndjson, json or sse")
+			return
+		}
+
+		// shares its cache entries with the buffered playlist endpoint
+		cacheKey := fmt.Sprintf("playlist:%s:%d", playlistId, maxTracks)
+		if srv.db != nil {
+			entry, err := srv.LookupCache(req.Context(), cacheKey)
+			if err != nil {
+				LoggerFromContext(req.Context()).Error("Failed to lookup cache for playlist", "error", err)
+			} else if entry != nil {
+				var playlist YouTubePlaylist
+				if err := json.Unmarshal(entry.Value, &playlist); err != nil {
+					LoggerFromContext(req.Context()).Error("Failed to unmarshal cached playlist", "error", err)
+				} else {
+					stream.start(max(playlist.TotalCount, len(playlist.Tracks)), "HIT")
+					stream.finish(stream.write(playlist.Tracks))
+					return
+				}
+			}
+		}
+
+		playlist, err := srv.loadPlaylistPages(
+			req.Context(),
+			playlistId,
+			maxTracks,
+			func(playlist *YouTubePlaylist, tracks []YouTubeTrack) error {
+				if !stream.started {
+					stream.start(min(max(playlist.TotalCount, len(playlist.Tracks)), maxTracks), "MISS")
+				}
+				return stream.write(tracks)
+			},
+		)
+		if err != nil && !stream.started {
+			writeError(
+				writer,
+				http.StatusInternalServerError,
+				fmt.Sprintf("Error loading playlist: %v", err),
+			)
+			return
+		}
+		stream.finish(err)
+
+		if err == nil && srv.db != nil && len(playlist.Tracks) > 0 {
+			if err := srv.StoreCache(req.Context(), cacheKey, playlist); err != nil {
+				LoggerFromContext(req.Context()).Error("Failed to store playlist in cache", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const RouteProfileContextKey ctxKey = "routeProfile"
+
+// RouteProfile customizes the searches of the routes bound to it, and can
+// mount an extra search route of its own
+type RouteProfile struct {
+	Name string `yaml:"name"`
+	// Path mounts an extra search route bound to the profile, e.g. /api/karaoke/search
+	Path string `yaml:"path"`
+	// SearchType is youtube or youtubemusic, the search behind Path
+	SearchType string `yaml:"search_type"`
+	// Routes binds existing routes to the profile
+	Routes      []string      `yaml:"routes"`
+	QueryPrefix string        `yaml:"query_prefix"`
+	QuerySuffix string        `yaml:"query_suffix"`
+	Region      string        `yaml:"region"`
+	CacheTTL    int           `yaml:"cache_ttl"`
+	Rerank      bool          `yaml:"rerank"`
+	Filters     TenantFilters `yaml:"filters"`
+}
+
+func (profile *RouteProfile) searchType() SearchType {
+	if profile.SearchType == "youtubemusic" {
+		return SearchTypeYouTubeMusic
+	}
+	return SearchTypeYouTube
+}
+
+// Query adds the configured prefix and suffix to a search query
+func (profile *RouteProfile) Query(query string) string {
+	return strings.TrimSpace(profile.QueryPrefix + " " + query + " " + profile.QuerySuffix)
+}
+
+func validateRouteProfiles(profiles []RouteProfile) error {
+	names := make(map[string]bool, len(profiles))
+	paths := make(map[string]string, len(profiles))
+	for _, profile := range profiles {
+		if profile.Name == "" {
+			return fmt.Errorf("route profile without a name")
+		}
+		if names[profile.Name] {
+			return fmt.Errorf("duplicate route profile %s", profile.Name)
+		}
+		names[profile.Name] = true
+		if profile.Path != "" && !strings.HasPrefix(profile.Path, "/api/") {
+			return fmt.Errorf("route profile %s: path must start with /api/", profile.Name)
+		}
+		if profile.Path != "" {
+			// the mux refuses to mount a path twice, so the server wouldn't start
+			if other, ok := paths[profile.Path]; ok {
+				return fmt.Errorf("route profile %s: path %s is already mounted by route profile %s", profile.Name, profile.Path, other)
+			}
+			paths[profile.Path] = profile.Name
+			for _, route := range apiRoutes {
+				if routeMatches(route.Path, profile.Path) {
+					return fmt.Errorf("route profile %s: path %s collides with the route %s", profile.Name, profile.Path, route.Path)
+				}
+			}
+		}
+		switch profile.SearchType {
+		case "", "youtube", "youtubemusic":
+		default:
+			return fmt.Errorf("route profile %s: unsupported search type %s", profile.Name, profile.SearchType)
+		}
+	}
+	return nil
+}
+
+func RouteProfileFromContext(ctx context.Context) *RouteProfile {
+	profile, _ := ctx.Value(RouteProfileContextKey).(*RouteProfile)
+	return profile
+}
+
+// mountRouteProfiles registers the search routes of the profiles with a path
+// routeMatches tells whether path is served by the route pattern, whose
+// {wildcard} segments match any segment
+func routeMatches(pattern string, path string) bool {
+	patternSegments := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(patternSegments) != len(pathSegments) {
+		return false
+	}
+	for i, segment := range patternSegments {
+		if !strings.HasPrefix(segment, "{") && segment != pathSegments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (srv *Server) mountRouteProfiles(mux *http.ServeMux) {
+	for _, profile := range srv.Cfg.RouteProfiles {
+		if profile.Path != "" {
+			mux.HandleFunc(profile.Path, srv.MakeSearchHandler(profile.searchType()))
+		}
+	}
+}
+
+// RouteProfiles attaches the profile bound to the requested route to its context
+func (srv *Server) RouteProfiles(next http.Handler) http.Handler {
+	byPath := make(map[string]*RouteProfile)
+	for i := range srv.Cfg.RouteProfiles {
+		profile := &srv.Cfg.RouteProfiles[i]
+		for _, path := range profile.Routes {
+			byPath[path] = profile
+		}
+		if profile.Path != "" {
+			byPath[profile.Path] = profile
+		}
+	}
+	if len(byPath) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		if profile, ok := byPath[req.URL.Path]; ok {
+			req = req.WithContext(context.WithValue(req.Context(), RouteProfileContextKey, profile))
+		}
+		next.ServeHTTP(writer, req)
+	})
+}
+
+// cacheTTL is the cache_ttl of the route profile, if it sets one
+func (srv *Server) cacheTTL(ctx context.Context) int {
+	if profile := RouteProfileFromContext(ctx); profile != nil && profile.CacheTTL > 0 {
+		return profile.CacheTTL
+	}
+	return srv.Cfg.Caching.CacheTTL
+}
+
+// rerankTracks orders tracks by their match score against the original query
+// when the route profile asks for it
+func rerankTracks(ctx context.Context, tracks []YouTubeTrack, query string) []YouTubeTrack {
+	profile := RouteProfileFromContext(ctx)
+	if profile == nil || !profile.Rerank {
+		return tracks
+	}
+	ref := MatchReference{Title: query}
+	reranked := slices.Clone(tracks)
+	slices.SortStableFunc(reranked, func(a, b YouTubeTrack) int {
+		return cmp.Compare(scoreTrack(b, ref), scoreTrack(a, ref))
+	})
+	return reranked
+}
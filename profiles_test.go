@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateRouteProfilesRejectsTakenPaths(t *testing.T) {
+	for name, test := range map[string]struct {
+		profiles []RouteProfile
+		err      string
+	}{
+		"existing route": {
+			profiles: []RouteProfile{{Name: "karaoke", Path: "/api/youtube/search"}},
+			err:      "collides with the route /api/youtube/search",
+		},
+		"wildcard route": {
+			profiles: []RouteProfile{{Name: "karaoke", Path: "/api/jobs/karaoke"}},
+			err:      "collides with the route /api/jobs/{id}",
+		},
+		"other profile": {
+			profiles: []RouteProfile{
+				{Name: "karaoke", Path: "/api/karaoke/search"},
+				{Name: "lyrics", Path: "/api/karaoke/search"},
+			},
+			err: "already mounted by route profile karaoke",
+		},
+		"free path": {
+			profiles: []RouteProfile{{Name: "karaoke", Path: "/api/karaoke/search"}},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := validateRouteProfiles(test.profiles)
+			if test.err == "" && err != nil {
+				t.Errorf("got %v, want no error", err)
+			}
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Errorf("got %v, want an error containing %q", err, test.err)
+			}
+		})
+	}
+}
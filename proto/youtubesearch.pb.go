@@ -0,0 +1,881 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: youtubesearch.proto
+
+package youtubesearchpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type SearchSource int32
+
+const (
+	SearchSource_SEARCH_SOURCE_YOUTUBE       SearchSource = 0
+	SearchSource_SEARCH_SOURCE_YOUTUBE_MUSIC SearchSource = 1
+)
+
+// Enum value maps for SearchSource.
+var (
+	SearchSource_name = map[int32]string{
+		0: "SEARCH_SOURCE_YOUTUBE",
+		1: "SEARCH_SOURCE_YOUTUBE_MUSIC",
+	}
+	SearchSource_value = map[string]int32{
+		"SEARCH_SOURCE_YOUTUBE":       0,
+		"SEARCH_SOURCE_YOUTUBE_MUSIC": 1,
+	}
+)
+
+func (x SearchSource) Enum() *SearchSource {
+	p := new(SearchSource)
+	*p = x
+	return p
+}
+
+func (x SearchSource) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (SearchSource) Descriptor() protoreflect.EnumDescriptor {
+	return file_youtubesearch_proto_enumTypes[0].Descriptor()
+}
+
+func (SearchSource) Type() protoreflect.EnumType {
+	return &file_youtubesearch_proto_enumTypes[0]
+}
+
+func (x SearchSource) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use SearchSource.Descriptor instead.
+func (SearchSource) EnumDescriptor() ([]byte, []int) {
+	return file_youtubesearch_proto_rawDescGZIP(), []int{0}
+}
+
+type SearchRequest struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Query  string                 `protobuf:"bytes,1,opt,name=query,proto3" json:"query,omitempty"`
+	Source SearchSource           `protobuf:"varint,2,opt,name=source,proto3,enum=youtubesearch.v1.SearchSource" json:"source,omitempty"`
+	// limit caps the results, continuation pages are loaded until it is met
+	Limit int32 `protobuf:"varint,3,opt,name=limit,proto3" json:"limit,omitempty"`
+	// exact searches the query as typed instead of YouTube's spelling correction
+	Exact bool `protobuf:"varint,4,opt,name=exact,proto3" json:"exact,omitempty"`
+	// safe_search overrides the server's search.safe_search default
+	SafeSearch    *bool `protobuf:"varint,5,opt,name=safe_search,json=safeSearch,proto3,oneof" json:"safe_search,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SearchRequest) Reset() {
+	*x = SearchRequest{}
+	mi := &file_youtubesearch_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchRequest) ProtoMessage() {}
+
+func (x *SearchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_youtubesearch_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchRequest.ProtoReflect.Descriptor instead.
+func (*SearchRequest) Descriptor() ([]byte, []int) {
+	return file_youtubesearch_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *SearchRequest) GetQuery() string {
+	if x != nil {
+		return x.Query
+	}
+	return ""
+}
+
+func (x *SearchRequest) GetSource() SearchSource {
+	if x != nil {
+		return x.Source
+	}
+	return SearchSource_SEARCH_SOURCE_YOUTUBE
+}
+
+func (x *SearchRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *SearchRequest) GetExact() bool {
+	if x != nil {
+		return x.Exact
+	}
+	return false
+}
+
+func (x *SearchRequest) GetSafeSearch() bool {
+	if x != nil && x.SafeSearch != nil {
+		return *x.SafeSearch
+	}
+	return false
+}
+
+type SearchResponse struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Tracks []*Track               `protobuf:"bytes,1,rep,name=tracks,proto3" json:"tracks,omitempty"`
+	// corrected_query is the query YouTube corrected or suggested, applied when
+	// the results are for it
+	CorrectedQuery    string `protobuf:"bytes,2,opt,name=corrected_query,json=correctedQuery,proto3" json:"corrected_query,omitempty"`
+	CorrectionApplied bool   `protobuf:"varint,3,opt,name=correction_applied,json=correctionApplied,proto3" json:"correction_applied,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *SearchResponse) Reset() {
+	*x = SearchResponse{}
+	mi := &file_youtubesearch_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchResponse) ProtoMessage() {}
+
+func (x *SearchResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_youtubesearch_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchResponse.ProtoReflect.Descriptor instead.
+func (*SearchResponse) Descriptor() ([]byte, []int) {
+	return file_youtubesearch_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *SearchResponse) GetTracks() []*Track {
+	if x != nil {
+		return x.Tracks
+	}
+	return nil
+}
+
+func (x *SearchResponse) GetCorrectedQuery() string {
+	if x != nil {
+		return x.CorrectedQuery
+	}
+	return ""
+}
+
+func (x *SearchResponse) GetCorrectionApplied() bool {
+	if x != nil {
+		return x.CorrectionApplied
+	}
+	return false
+}
+
+type GetVideoRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	VideoId       string                 `protobuf:"bytes,1,opt,name=video_id,json=videoId,proto3" json:"video_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetVideoRequest) Reset() {
+	*x = GetVideoRequest{}
+	mi := &file_youtubesearch_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetVideoRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetVideoRequest) ProtoMessage() {}
+
+func (x *GetVideoRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_youtubesearch_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetVideoRequest.ProtoReflect.Descriptor instead.
+func (*GetVideoRequest) Descriptor() ([]byte, []int) {
+	return file_youtubesearch_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *GetVideoRequest) GetVideoId() string {
+	if x != nil {
+		return x.VideoId
+	}
+	return ""
+}
+
+type GetPlaylistRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// id is a playlist id, its browse id, a url carrying it or a channel id
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// limit caps the tracks below the server's playlist.max_tracks
+	Limit         int32 `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetPlaylistRequest) Reset() {
+	*x = GetPlaylistRequest{}
+	mi := &file_youtubesearch_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetPlaylistRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetPlaylistRequest) ProtoMessage() {}
+
+func (x *GetPlaylistRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_youtubesearch_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetPlaylistRequest.ProtoReflect.Descriptor instead.
+func (*GetPlaylistRequest) Descriptor() ([]byte, []int) {
+	return file_youtubesearch_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *GetPlaylistRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *GetPlaylistRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type Thumbnail struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Url           string                 `protobuf:"bytes,1,opt,name=url,proto3" json:"url,omitempty"`
+	Width         int32                  `protobuf:"varint,2,opt,name=width,proto3" json:"width,omitempty"`
+	Height        int32                  `protobuf:"varint,3,opt,name=height,proto3" json:"height,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Thumbnail) Reset() {
+	*x = Thumbnail{}
+	mi := &file_youtubesearch_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Thumbnail) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Thumbnail) ProtoMessage() {}
+
+func (x *Thumbnail) ProtoReflect() protoreflect.Message {
+	mi := &file_youtubesearch_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Thumbnail.ProtoReflect.Descriptor instead.
+func (*Thumbnail) Descriptor() ([]byte, []int) {
+	return file_youtubesearch_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Thumbnail) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *Thumbnail) GetWidth() int32 {
+	if x != nil {
+		return x.Width
+	}
+	return 0
+}
+
+func (x *Thumbnail) GetHeight() int32 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+type Artist struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	ChannelId     string                 `protobuf:"bytes,2,opt,name=channel_id,json=channelId,proto3" json:"channel_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Artist) Reset() {
+	*x = Artist{}
+	mi := &file_youtubesearch_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Artist) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Artist) ProtoMessage() {}
+
+func (x *Artist) ProtoReflect() protoreflect.Message {
+	mi := &file_youtubesearch_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Artist.ProtoReflect.Descriptor instead.
+func (*Artist) Descriptor() ([]byte, []int) {
+	return file_youtubesearch_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Artist) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Artist) GetChannelId() string {
+	if x != nil {
+		return x.ChannelId
+	}
+	return ""
+}
+
+type Album struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	BrowseId      string                 `protobuf:"bytes,2,opt,name=browse_id,json=browseId,proto3" json:"browse_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Album) Reset() {
+	*x = Album{}
+	mi := &file_youtubesearch_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Album) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Album) ProtoMessage() {}
+
+func (x *Album) ProtoReflect() protoreflect.Message {
+	mi := &file_youtubesearch_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Album.ProtoReflect.Descriptor instead.
+func (*Album) Descriptor() ([]byte, []int) {
+	return file_youtubesearch_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Album) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Album) GetBrowseId() string {
+	if x != nil {
+		return x.BrowseId
+	}
+	return ""
+}
+
+type Track struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	Identifier string                 `protobuf:"bytes,1,opt,name=identifier,proto3" json:"identifier,omitempty"`
+	Title      string                 `protobuf:"bytes,2,opt,name=title,proto3" json:"title,omitempty"`
+	Author     string                 `protobuf:"bytes,3,opt,name=author,proto3" json:"author,omitempty"`
+	Images     []*Thumbnail           `protobuf:"bytes,4,rep,name=images,proto3" json:"images,omitempty"`
+	// length_ms is 0 for live streams and premieres
+	LengthMs   int64  `protobuf:"varint,5,opt,name=length_ms,json=lengthMs,proto3" json:"length_ms,omitempty"`
+	LengthText string `protobuf:"bytes,6,opt,name=length_text,json=lengthText,proto3" json:"length_text,omitempty"`
+	Uri        string `protobuf:"bytes,7,opt,name=uri,proto3" json:"uri,omitempty"`
+	// type is video, song or movie
+	Type       string `protobuf:"bytes,8,opt,name=type,proto3" json:"type,omitempty"`
+	Views      string `protobuf:"bytes,9,opt,name=views,proto3" json:"views,omitempty"`
+	ChannelId  string `protobuf:"bytes,10,opt,name=channel_id,json=channelId,proto3" json:"channel_id,omitempty"`
+	IsLive     bool   `protobuf:"varint,11,opt,name=is_live,json=isLive,proto3" json:"is_live,omitempty"`
+	IsUpcoming bool   `protobuf:"varint,12,opt,name=is_upcoming,json=isUpcoming,proto3" json:"is_upcoming,omitempty"`
+	// artists and album are set on YouTube Music results
+	Artists       []*Artist `protobuf:"bytes,13,rep,name=artists,proto3" json:"artists,omitempty"`
+	Album         *Album    `protobuf:"bytes,14,opt,name=album,proto3" json:"album,omitempty"`
+	MusicbrainzId string    `protobuf:"bytes,15,opt,name=musicbrainz_id,json=musicbrainzId,proto3" json:"musicbrainz_id,omitempty"`
+	// encoded is the track as Lavaplayer encodes it
+	Encoded       string `protobuf:"bytes,16,opt,name=encoded,proto3" json:"encoded,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Track) Reset() {
+	*x = Track{}
+	mi := &file_youtubesearch_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Track) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Track) ProtoMessage() {}
+
+func (x *Track) ProtoReflect() protoreflect.Message {
+	mi := &file_youtubesearch_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Track.ProtoReflect.Descriptor instead.
+func (*Track) Descriptor() ([]byte, []int) {
+	return file_youtubesearch_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Track) GetIdentifier() string {
+	if x != nil {
+		return x.Identifier
+	}
+	return ""
+}
+
+func (x *Track) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *Track) GetAuthor() string {
+	if x != nil {
+		return x.Author
+	}
+	return ""
+}
+
+func (x *Track) GetImages() []*Thumbnail {
+	if x != nil {
+		return x.Images
+	}
+	return nil
+}
+
+func (x *Track) GetLengthMs() int64 {
+	if x != nil {
+		return x.LengthMs
+	}
+	return 0
+}
+
+func (x *Track) GetLengthText() string {
+	if x != nil {
+		return x.LengthText
+	}
+	return ""
+}
+
+func (x *Track) GetUri() string {
+	if x != nil {
+		return x.Uri
+	}
+	return ""
+}
+
+func (x *Track) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Track) GetViews() string {
+	if x != nil {
+		return x.Views
+	}
+	return ""
+}
+
+func (x *Track) GetChannelId() string {
+	if x != nil {
+		return x.ChannelId
+	}
+	return ""
+}
+
+func (x *Track) GetIsLive() bool {
+	if x != nil {
+		return x.IsLive
+	}
+	return false
+}
+
+func (x *Track) GetIsUpcoming() bool {
+	if x != nil {
+		return x.IsUpcoming
+	}
+	return false
+}
+
+func (x *Track) GetArtists() []*Artist {
+	if x != nil {
+		return x.Artists
+	}
+	return nil
+}
+
+func (x *Track) GetAlbum() *Album {
+	if x != nil {
+		return x.Album
+	}
+	return nil
+}
+
+func (x *Track) GetMusicbrainzId() string {
+	if x != nil {
+		return x.MusicbrainzId
+	}
+	return ""
+}
+
+func (x *Track) GetEncoded() string {
+	if x != nil {
+		return x.Encoded
+	}
+	return ""
+}
+
+type Playlist struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Identifier    string                 `protobuf:"bytes,1,opt,name=identifier,proto3" json:"identifier,omitempty"`
+	Title         string                 `protobuf:"bytes,2,opt,name=title,proto3" json:"title,omitempty"`
+	Author        string                 `protobuf:"bytes,3,opt,name=author,proto3" json:"author,omitempty"`
+	Uri           string                 `protobuf:"bytes,4,opt,name=uri,proto3" json:"uri,omitempty"`
+	TotalCount    int32                  `protobuf:"varint,5,opt,name=total_count,json=totalCount,proto3" json:"total_count,omitempty"`
+	Truncated     bool                   `protobuf:"varint,6,opt,name=truncated,proto3" json:"truncated,omitempty"`
+	Tracks        []*Track               `protobuf:"bytes,7,rep,name=tracks,proto3" json:"tracks,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Playlist) Reset() {
+	*x = Playlist{}
+	mi := &file_youtubesearch_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Playlist) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Playlist) ProtoMessage() {}
+
+func (x *Playlist) ProtoReflect() protoreflect.Message {
+	mi := &file_youtubesearch_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Playlist.ProtoReflect.Descriptor instead.
+func (*Playlist) Descriptor() ([]byte, []int) {
+	return file_youtubesearch_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *Playlist) GetIdentifier() string {
+	if x != nil {
+		return x.Identifier
+	}
+	return ""
+}
+
+func (x *Playlist) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *Playlist) GetAuthor() string {
+	if x != nil {
+		return x.Author
+	}
+	return ""
+}
+
+func (x *Playlist) GetUri() string {
+	if x != nil {
+		return x.Uri
+	}
+	return ""
+}
+
+func (x *Playlist) GetTotalCount() int32 {
+	if x != nil {
+		return x.TotalCount
+	}
+	return 0
+}
+
+func (x *Playlist) GetTruncated() bool {
+	if x != nil {
+		return x.Truncated
+	}
+	return false
+}
+
+func (x *Playlist) GetTracks() []*Track {
+	if x != nil {
+		return x.Tracks
+	}
+	return nil
+}
+
+var File_youtubesearch_proto protoreflect.FileDescriptor
+
+const file_youtubesearch_proto_rawDesc = "" +
+	"\n" +
+	"\x13youtubesearch.proto\x12\x10youtubesearch.v1\"\xbf\x01\n" +
+	"\rSearchRequest\x12\x14\n" +
+	"\x05query\x18\x01 \x01(\tR\x05query\x126\n" +
+	"\x06source\x18\x02 \x01(\x0e2\x1e.youtubesearch.v1.SearchSourceR\x06source\x12\x14\n" +
+	"\x05limit\x18\x03 \x01(\x05R\x05limit\x12\x14\n" +
+	"\x05exact\x18\x04 \x01(\bR\x05exact\x12$\n" +
+	"\vsafe_search\x18\x05 \x01(\bH\x00R\n" +
+	"safeSearch\x88\x01\x01B\x0e\n" +
+	"\f_safe_search\"\x99\x01\n" +
+	"\x0eSearchResponse\x12/\n" +
+	"\x06tracks\x18\x01 \x03(\v2\x17.youtubesearch.v1.TrackR\x06tracks\x12'\n" +
+	"\x0fcorrected_query\x18\x02 \x01(\tR\x0ecorrectedQuery\x12-\n" +
+	"\x12correction_applied\x18\x03 \x01(\bR\x11correctionApplied\",\n" +
+	"\x0fGetVideoRequest\x12\x19\n" +
+	"\bvideo_id\x18\x01 \x01(\tR\avideoId\":\n" +
+	"\x12GetPlaylistRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x14\n" +
+	"\x05limit\x18\x02 \x01(\x05R\x05limit\"K\n" +
+	"\tThumbnail\x12\x10\n" +
+	"\x03url\x18\x01 \x01(\tR\x03url\x12\x14\n" +
+	"\x05width\x18\x02 \x01(\x05R\x05width\x12\x16\n" +
+	"\x06height\x18\x03 \x01(\x05R\x06height\";\n" +
+	"\x06Artist\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x1d\n" +
+	"\n" +
+	"channel_id\x18\x02 \x01(\tR\tchannelId\"8\n" +
+	"\x05Album\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x1b\n" +
+	"\tbrowse_id\x18\x02 \x01(\tR\bbrowseId\"\x81\x04\n" +
+	"\x05Track\x12\x1e\n" +
+	"\n" +
+	"identifier\x18\x01 \x01(\tR\n" +
+	"identifier\x12\x14\n" +
+	"\x05title\x18\x02 \x01(\tR\x05title\x12\x16\n" +
+	"\x06author\x18\x03 \x01(\tR\x06author\x123\n" +
+	"\x06images\x18\x04 \x03(\v2\x1b.youtubesearch.v1.ThumbnailR\x06images\x12\x1b\n" +
+	"\tlength_ms\x18\x05 \x01(\x03R\blengthMs\x12\x1f\n" +
+	"\vlength_text\x18\x06 \x01(\tR\n" +
+	"lengthText\x12\x10\n" +
+	"\x03uri\x18\a \x01(\tR\x03uri\x12\x12\n" +
+	"\x04type\x18\b \x01(\tR\x04type\x12\x14\n" +
+	"\x05views\x18\t \x01(\tR\x05views\x12\x1d\n" +
+	"\n" +
+	"channel_id\x18\n" +
+	" \x01(\tR\tchannelId\x12\x17\n" +
+	"\ais_live\x18\v \x01(\bR\x06isLive\x12\x1f\n" +
+	"\vis_upcoming\x18\f \x01(\bR\n" +
+	"isUpcoming\x122\n" +
+	"\aartists\x18\r \x03(\v2\x18.youtubesearch.v1.ArtistR\aartists\x12-\n" +
+	"\x05album\x18\x0e \x01(\v2\x17.youtubesearch.v1.AlbumR\x05album\x12%\n" +
+	"\x0emusicbrainz_id\x18\x0f \x01(\tR\rmusicbrainzId\x12\x18\n" +
+	"\aencoded\x18\x10 \x01(\tR\aencoded\"\xda\x01\n" +
+	"\bPlaylist\x12\x1e\n" +
+	"\n" +
+	"identifier\x18\x01 \x01(\tR\n" +
+	"identifier\x12\x14\n" +
+	"\x05title\x18\x02 \x01(\tR\x05title\x12\x16\n" +
+	"\x06author\x18\x03 \x01(\tR\x06author\x12\x10\n" +
+	"\x03uri\x18\x04 \x01(\tR\x03uri\x12\x1f\n" +
+	"\vtotal_count\x18\x05 \x01(\x05R\n" +
+	"totalCount\x12\x1c\n" +
+	"\ttruncated\x18\x06 \x01(\bR\ttruncated\x12/\n" +
+	"\x06tracks\x18\a \x03(\v2\x17.youtubesearch.v1.TrackR\x06tracks*J\n" +
+	"\fSearchSource\x12\x19\n" +
+	"\x15SEARCH_SOURCE_YOUTUBE\x10\x00\x12\x1f\n" +
+	"\x1bSEARCH_SOURCE_YOUTUBE_MUSIC\x10\x012\xc8\x02\n" +
+	"\rYouTubeSearch\x12K\n" +
+	"\x06Search\x12\x1f.youtubesearch.v1.SearchRequest\x1a .youtubesearch.v1.SearchResponse\x12F\n" +
+	"\bGetVideo\x12!.youtubesearch.v1.GetVideoRequest\x1a\x17.youtubesearch.v1.Track\x12O\n" +
+	"\vGetPlaylist\x12$.youtubesearch.v1.GetPlaylistRequest\x1a\x1a.youtubesearch.v1.Playlist\x12Q\n" +
+	"\x0eStreamPlaylist\x12$.youtubesearch.v1.GetPlaylistRequest\x1a\x17.youtubesearch.v1.Track0\x01B(Z&youtubesearchapi/proto;youtubesearchpbb\x06proto3"
+
+var (
+	file_youtubesearch_proto_rawDescOnce sync.Once
+	file_youtubesearch_proto_rawDescData []byte
+)
+
+func file_youtubesearch_proto_rawDescGZIP() []byte {
+	file_youtubesearch_proto_rawDescOnce.Do(func() {
+		file_youtubesearch_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_youtubesearch_proto_rawDesc), len(file_youtubesearch_proto_rawDesc)))
+	})
+	return file_youtubesearch_proto_rawDescData
+}
+
+var file_youtubesearch_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_youtubesearch_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
+var file_youtubesearch_proto_goTypes = []any{
+	(SearchSource)(0),          // 0: youtubesearch.v1.SearchSource
+	(*SearchRequest)(nil),      // 1: youtubesearch.v1.SearchRequest
+	(*SearchResponse)(nil),     // 2: youtubesearch.v1.SearchResponse
+	(*GetVideoRequest)(nil),    // 3: youtubesearch.v1.GetVideoRequest
+	(*GetPlaylistRequest)(nil), // 4: youtubesearch.v1.GetPlaylistRequest
+	(*Thumbnail)(nil),          // 5: youtubesearch.v1.Thumbnail
+	(*Artist)(nil),             // 6: youtubesearch.v1.Artist
+	(*Album)(nil),              // 7: youtubesearch.v1.Album
+	(*Track)(nil),              // 8: youtubesearch.v1.Track
+	(*Playlist)(nil),           // 9: youtubesearch.v1.Playlist
+}
+var file_youtubesearch_proto_depIdxs = []int32{
+	0,  // 0: youtubesearch.v1.SearchRequest.source:type_name -> youtubesearch.v1.SearchSource
+	8,  // 1: youtubesearch.v1.SearchResponse.tracks:type_name -> youtubesearch.v1.Track
+	5,  // 2: youtubesearch.v1.Track.images:type_name -> youtubesearch.v1.Thumbnail
+	6,  // 3: youtubesearch.v1.Track.artists:type_name -> youtubesearch.v1.Artist
+	7,  // 4: youtubesearch.v1.Track.album:type_name -> youtubesearch.v1.Album
+	8,  // 5: youtubesearch.v1.Playlist.tracks:type_name -> youtubesearch.v1.Track
+	1,  // 6: youtubesearch.v1.YouTubeSearch.Search:input_type -> youtubesearch.v1.SearchRequest
+	3,  // 7: youtubesearch.v1.YouTubeSearch.GetVideo:input_type -> youtubesearch.v1.GetVideoRequest
+	4,  // 8: youtubesearch.v1.YouTubeSearch.GetPlaylist:input_type -> youtubesearch.v1.GetPlaylistRequest
+	4,  // 9: youtubesearch.v1.YouTubeSearch.StreamPlaylist:input_type -> youtubesearch.v1.GetPlaylistRequest
+	2,  // 10: youtubesearch.v1.YouTubeSearch.Search:output_type -> youtubesearch.v1.SearchResponse
+	8,  // 11: youtubesearch.v1.YouTubeSearch.GetVideo:output_type -> youtubesearch.v1.Track
+	9,  // 12: youtubesearch.v1.YouTubeSearch.GetPlaylist:output_type -> youtubesearch.v1.Playlist
+	8,  // 13: youtubesearch.v1.YouTubeSearch.StreamPlaylist:output_type -> youtubesearch.v1.Track
+	10, // [10:14] is the sub-list for method output_type
+	6,  // [6:10] is the sub-list for method input_type
+	6,  // [6:6] is the sub-list for extension type_name
+	6,  // [6:6] is the sub-list for extension extendee
+	0,  // [0:6] is the sub-list for field type_name
+}
+
+func init() { file_youtubesearch_proto_init() }
+func file_youtubesearch_proto_init() {
+	if File_youtubesearch_proto != nil {
+		return
+	}
+	file_youtubesearch_proto_msgTypes[0].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_youtubesearch_proto_rawDesc), len(file_youtubesearch_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   9,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_youtubesearch_proto_goTypes,
+		DependencyIndexes: file_youtubesearch_proto_depIdxs,
+		EnumInfos:         file_youtubesearch_proto_enumTypes,
+		MessageInfos:      file_youtubesearch_proto_msgTypes,
+	}.Build()
+	File_youtubesearch_proto = out.File
+	file_youtubesearch_proto_goTypes = nil
+	file_youtubesearch_proto_depIdxs = nil
+}
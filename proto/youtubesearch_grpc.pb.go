@@ -0,0 +1,255 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: youtubesearch.proto
+
+package youtubesearchpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	YouTubeSearch_Search_FullMethodName         = "/youtubesearch.v1.YouTubeSearch/Search"
+	YouTubeSearch_GetVideo_FullMethodName       = "/youtubesearch.v1.YouTubeSearch/GetVideo"
+	YouTubeSearch_GetPlaylist_FullMethodName    = "/youtubesearch.v1.YouTubeSearch/GetPlaylist"
+	YouTubeSearch_StreamPlaylist_FullMethodName = "/youtubesearch.v1.YouTubeSearch/StreamPlaylist"
+)
+
+// YouTubeSearchClient is the client API for YouTubeSearch service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// YouTubeSearch serves the searches, video metadata and playlists of the HTTP
+// API to internal services. Requests carry the api key in the x-api-key
+// metadata when api keys are enabled.
+type YouTubeSearchClient interface {
+	// Search runs a text search on YouTube or YouTube Music
+	Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResponse, error)
+	// GetVideo loads the metadata of a video
+	GetVideo(ctx context.Context, in *GetVideoRequest, opts ...grpc.CallOption) (*Track, error)
+	// GetPlaylist loads a playlist, an album or the uploads of a channel
+	GetPlaylist(ctx context.Context, in *GetPlaylistRequest, opts ...grpc.CallOption) (*Playlist, error)
+	// StreamPlaylist sends the tracks of a playlist as its pages load
+	StreamPlaylist(ctx context.Context, in *GetPlaylistRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Track], error)
+}
+
+type youTubeSearchClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewYouTubeSearchClient(cc grpc.ClientConnInterface) YouTubeSearchClient {
+	return &youTubeSearchClient{cc}
+}
+
+func (c *youTubeSearchClient) Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SearchResponse)
+	err := c.cc.Invoke(ctx, YouTubeSearch_Search_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *youTubeSearchClient) GetVideo(ctx context.Context, in *GetVideoRequest, opts ...grpc.CallOption) (*Track, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Track)
+	err := c.cc.Invoke(ctx, YouTubeSearch_GetVideo_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *youTubeSearchClient) GetPlaylist(ctx context.Context, in *GetPlaylistRequest, opts ...grpc.CallOption) (*Playlist, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Playlist)
+	err := c.cc.Invoke(ctx, YouTubeSearch_GetPlaylist_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *youTubeSearchClient) StreamPlaylist(ctx context.Context, in *GetPlaylistRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Track], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &YouTubeSearch_ServiceDesc.Streams[0], YouTubeSearch_StreamPlaylist_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[GetPlaylistRequest, Track]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type YouTubeSearch_StreamPlaylistClient = grpc.ServerStreamingClient[Track]
+
+// YouTubeSearchServer is the server API for YouTubeSearch service.
+// All implementations must embed UnimplementedYouTubeSearchServer
+// for forward compatibility.
+//
+// YouTubeSearch serves the searches, video metadata and playlists of the HTTP
+// API to internal services. Requests carry the api key in the x-api-key
+// metadata when api keys are enabled.
+type YouTubeSearchServer interface {
+	// Search runs a text search on YouTube or YouTube Music
+	Search(context.Context, *SearchRequest) (*SearchResponse, error)
+	// GetVideo loads the metadata of a video
+	GetVideo(context.Context, *GetVideoRequest) (*Track, error)
+	// GetPlaylist loads a playlist, an album or the uploads of a channel
+	GetPlaylist(context.Context, *GetPlaylistRequest) (*Playlist, error)
+	// StreamPlaylist sends the tracks of a playlist as its pages load
+	StreamPlaylist(*GetPlaylistRequest, grpc.ServerStreamingServer[Track]) error
+	mustEmbedUnimplementedYouTubeSearchServer()
+}
+
+// UnimplementedYouTubeSearchServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedYouTubeSearchServer struct{}
+
+func (UnimplementedYouTubeSearchServer) Search(context.Context, *SearchRequest) (*SearchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Search not implemented")
+}
+func (UnimplementedYouTubeSearchServer) GetVideo(context.Context, *GetVideoRequest) (*Track, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetVideo not implemented")
+}
+func (UnimplementedYouTubeSearchServer) GetPlaylist(context.Context, *GetPlaylistRequest) (*Playlist, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPlaylist not implemented")
+}
+func (UnimplementedYouTubeSearchServer) StreamPlaylist(*GetPlaylistRequest, grpc.ServerStreamingServer[Track]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamPlaylist not implemented")
+}
+func (UnimplementedYouTubeSearchServer) mustEmbedUnimplementedYouTubeSearchServer() {}
+func (UnimplementedYouTubeSearchServer) testEmbeddedByValue()                       {}
+
+// UnsafeYouTubeSearchServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to YouTubeSearchServer will
+// result in compilation errors.
+type UnsafeYouTubeSearchServer interface {
+	mustEmbedUnimplementedYouTubeSearchServer()
+}
+
+func RegisterYouTubeSearchServer(s grpc.ServiceRegistrar, srv YouTubeSearchServer) {
+	// If the following call pancis, it indicates UnimplementedYouTubeSearchServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&YouTubeSearch_ServiceDesc, srv)
+}
+
+func _YouTubeSearch_Search_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(YouTubeSearchServer).Search(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: YouTubeSearch_Search_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(YouTubeSearchServer).Search(ctx, req.(*SearchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _YouTubeSearch_GetVideo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetVideoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(YouTubeSearchServer).GetVideo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: YouTubeSearch_GetVideo_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(YouTubeSearchServer).GetVideo(ctx, req.(*GetVideoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _YouTubeSearch_GetPlaylist_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetPlaylistRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(YouTubeSearchServer).GetPlaylist(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: YouTubeSearch_GetPlaylist_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(YouTubeSearchServer).GetPlaylist(ctx, req.(*GetPlaylistRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _YouTubeSearch_StreamPlaylist_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetPlaylistRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(YouTubeSearchServer).StreamPlaylist(m, &grpc.GenericServerStream[GetPlaylistRequest, Track]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type YouTubeSearch_StreamPlaylistServer = grpc.ServerStreamingServer[Track]
+
+// YouTubeSearch_ServiceDesc is the grpc.ServiceDesc for YouTubeSearch service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var YouTubeSearch_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "youtubesearch.v1.YouTubeSearch",
+	HandlerType: (*YouTubeSearchServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Search",
+			Handler:    _YouTubeSearch_Search_Handler,
+		},
+		{
+			MethodName: "GetVideo",
+			Handler:    _YouTubeSearch_GetVideo_Handler,
+		},
+		{
+			MethodName: "GetPlaylist",
+			Handler:    _YouTubeSearch_GetPlaylist_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamPlaylist",
+			Handler:       _YouTubeSearch_StreamPlaylist_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "youtubesearch.proto",
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// tokenBucket refills rate tokens per second up to burst
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(perMinute int, burst int) *tokenBucket {
+	if burst <= 0 {
+		burst = max(1, perMinute/6)
+	}
+	return &tokenBucket{
+		rate:   float64(perMinute) / 60,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+type rateLimitStatus struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Take takes a token if one is available and reports the bucket state
+// afterwards, including how long until the next token when none was left
+func (bucket *tokenBucket) Take() rateLimitStatus {
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+
+	now := time.Now()
+	bucket.tokens = min(bucket.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*bucket.rate)
+	bucket.last = now
+
+	status := rateLimitStatus{Limit: int(bucket.burst)}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		status.Allowed = true
+	} else {
+		status.RetryAfter = time.Duration((1 - bucket.tokens) / bucket.rate * float64(time.Second))
+	}
+	status.Remaining = int(bucket.tokens)
+	status.Reset = time.Duration((bucket.burst - bucket.tokens) / bucket.rate * float64(time.Second))
+	return status
+}
+
+func ceilSeconds(duration time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(duration.Seconds())))
+}
+
+// WriteHeaders sets the X-RateLimit headers, plus Retry-After when the request was refused
+func (status rateLimitStatus) WriteHeaders(header http.Header) {
+	header.Set("X-RateLimit-Limit", strconv.Itoa(status.Limit))
+	header.Set("X-RateLimit-Remaining", strconv.Itoa(status.Remaining))
+	header.Set("X-RateLimit-Reset", ceilSeconds(status.Reset))
+	if !status.Allowed {
+		header.Set("Retry-After", ceilSeconds(status.RetryAfter))
+	}
+}
+
+// concurrencyLimiter bounds in-flight requests, letting a few more wait for
+// a free slot instead of failing right away
+type concurrencyLimiter struct {
+	slots     chan struct{}
+	queued    atomic.Int32
+	maxQueued int32
+	timeout   time.Duration
+}
+
+func newConcurrencyLimiter(maxInFlight int, maxQueued int, timeout time.Duration) *concurrencyLimiter {
+	return &concurrencyLimiter{
+		slots:     make(chan struct{}, maxInFlight),
+		maxQueued: int32(maxQueued),
+		timeout:   timeout,
+	}
+}
+
+func (limiter *concurrencyLimiter) Acquire(ctx context.Context) bool {
+	select {
+	case limiter.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	if limiter.queued.Add(1) > limiter.maxQueued {
+		limiter.queued.Add(-1)
+		return false
+	}
+	defer limiter.queued.Add(-1)
+
+	timer := time.NewTimer(limiter.timeout)
+	defer timer.Stop()
+	select {
+	case limiter.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (limiter *concurrencyLimiter) Release() {
+	<-limiter.slots
+}
+
+// keyedRateLimiter keeps a token bucket per client, evicting the least
+// recently seen clients once maxEntries is reached
+type keyedRateLimiter struct {
+	mu         sync.Mutex
+	perMinute  int
+	burst      int
+	maxEntries int
+	order      *list.List
+	entries    map[string]*list.Element
+}
+
+type keyedBucket struct {
+	key    string
+	bucket *tokenBucket
+}
+
+func newKeyedRateLimiter(perMinute int, burst int, maxEntries int) *keyedRateLimiter {
+	return &keyedRateLimiter{
+		perMinute:  perMinute,
+		burst:      burst,
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+func (limiter *keyedRateLimiter) Take(key string) rateLimitStatus {
+	limiter.mu.Lock()
+	var bucket *tokenBucket
+	if element, ok := limiter.entries[key]; ok {
+		limiter.order.MoveToFront(element)
+		bucket = element.Value.(*keyedBucket).bucket
+	} else {
+		bucket = newTokenBucket(limiter.perMinute, limiter.burst)
+		limiter.entries[key] = limiter.order.PushFront(&keyedBucket{key: key, bucket: bucket})
+		for limiter.order.Len() > limiter.maxEntries {
+			oldest := limiter.order.Back()
+			limiter.order.Remove(oldest)
+			delete(limiter.entries, oldest.Value.(*keyedBucket).key)
+		}
+	}
+	limiter.mu.Unlock()
+	return bucket.Take()
+}
+
+// clientBucketKey is the bucket of a client address, ipv6 clients share one
+// per prefix so a client can't dodge its limit by changing addresses
+func clientBucketKey(client string, ipv6Prefix int) string {
+	addr, err := netip.ParseAddr(client)
+	if err != nil || !addr.Unmap().Is6() {
+		return client
+	}
+	prefix, err := addr.WithZone("").Prefix(ipv6Prefix)
+	if err != nil {
+		return client
+	}
+	return prefix.String()
+}
+
+func parseTrustedProxies(cidrs []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			addr, err := netip.ParseAddr(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", cidr, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", cidr, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func isTrustedProxy(addr netip.Addr, trusted []netip.Prefix) bool {
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientAddr returns the address of the client, following X-Forwarded-For
+// only through hops that are trusted proxies
+func clientAddr(req *http.Request, trusted []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	addr = addr.Unmap()
+	if !isTrustedProxy(addr, trusted) {
+		return addr.String()
+	}
+
+	hops := strings.Split(strings.Join(req.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		addr = hop.Unmap()
+		if !isTrustedProxy(addr, trusted) {
+			break
+		}
+	}
+	return addr.String()
+}
@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestClientBucketKey(t *testing.T) {
+	for _, tc := range []struct {
+		client string
+		prefix int
+		want   string
+	}{
+		{"203.0.113.7", 64, "203.0.113.7"},
+		{"::ffff:203.0.113.7", 64, "::ffff:203.0.113.7"},
+		{"2001:db8:1:2:aaaa::1", 64, "2001:db8:1:2::/64"},
+		{"2001:db8:1:2:bbbb::2", 64, "2001:db8:1:2::/64"},
+		{"2001:db8:1:2:aaaa::1", 56, "2001:db8:1::/56"},
+		{"fe80::1%eth0", 64, "fe80::/64"},
+		{"not an address", 64, "not an address"},
+	} {
+		if got := clientBucketKey(tc.client, tc.prefix); got != tc.want {
+			t.Errorf("clientBucketKey(%q, %d) = %q, want %q", tc.client, tc.prefix, got, tc.want)
+		}
+	}
+}
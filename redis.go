@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// a minimal RESP2 client covering the few commands the shared visitor pool
+// and leader election need, instead of pulling in a full redis library
+
+type RedisConfig struct {
+	Addr     string `yaml:"addr"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	DB       int    `yaml:"db"`
+	TLS      bool   `yaml:"tls"`
+}
+
+type RedisError string
+
+func (err RedisError) Error() string {
+	return "redis: " + string(err)
+}
+
+type RedisClient struct {
+	cfg    RedisConfig
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func NewRedisClient(cfg RedisConfig) *RedisClient {
+	return &RedisClient{cfg: cfg}
+}
+
+func (client *RedisClient) connect(ctx context.Context) error {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	var conn net.Conn
+	var err error
+	if client.cfg.TLS {
+		host, _, _ := net.SplitHostPort(client.cfg.Addr)
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: host}}).DialContext(ctx, "tcp", client.cfg.Addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", client.cfg.Addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to redis: %w", err)
+	}
+	client.conn = conn
+	client.reader = bufio.NewReader(conn)
+
+	if client.cfg.Password != "" {
+		args := []string{"AUTH", client.cfg.Password}
+		if client.cfg.Username != "" {
+			args = []string{"AUTH", client.cfg.Username, client.cfg.Password}
+		}
+		if _, err := client.roundTrip(ctx, args); err != nil {
+			client.close()
+			return fmt.Errorf("failed to authenticate to redis: %w", err)
+		}
+	}
+	if client.cfg.DB != 0 {
+		if _, err := client.roundTrip(ctx, []string{"SELECT", strconv.Itoa(client.cfg.DB)}); err != nil {
+			client.close()
+			return fmt.Errorf("failed to select redis db: %w", err)
+		}
+	}
+	return nil
+}
+
+func (client *RedisClient) close() {
+	if client.conn != nil {
+		client.conn.Close()
+		client.conn = nil
+	}
+}
+
+func (client *RedisClient) roundTrip(ctx context.Context, args []string) (any, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(5 * time.Second)
+	}
+	_ = client.conn.SetDeadline(deadline)
+
+	buf := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		buf = append(buf, "$"+strconv.Itoa(len(arg))+"\r\n"...)
+		buf = append(buf, arg...)
+		buf = append(buf, "\r\n"...)
+	}
+	if _, err := client.conn.Write(buf); err != nil {
+		return nil, err
+	}
+	return readRedisReply(client.reader)
+}
+
+// Do runs a command, replies are strings, int64s, []any or nil; a broken
+// connection is dropped and dialed again on the next command
+func (client *RedisClient) Do(ctx context.Context, args ...string) (any, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if client.conn == nil {
+		if err := client.connect(ctx); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := client.roundTrip(ctx, args)
+	var redisErr RedisError
+	if err != nil && !errors.As(err, &redisErr) {
+		client.close()
+	}
+	return reply, err
+}
+
+func (client *RedisClient) Close() {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.close()
+}
+
+func readRedisLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("redis: malformed reply line %q", line)
+	}
+	return line[:len(line)-2], nil
+}
+
+func readRedisReply(reader *bufio.Reader) (any, error) {
+	line, err := readRedisLine(reader)
+	if err != nil {
+		return nil, err
+	}
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, RedisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid bulk length: %w", err)
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		return string(data[:size]), nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid array length: %w", err)
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		items := make([]any, count)
+		for i := range items {
+			if items[i], err = readRedisReply(reader); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unknown reply type %q", line[0])
+}
+
+// SetNX sets key only when it doesn't exist yet, reporting whether it did
+func (client *RedisClient) SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	reply, err := client.Do(ctx, "SET", key, value, "PX", strconv.FormatInt(ttl.Milliseconds(), 10), "NX")
+	if err != nil {
+		return false, err
+	}
+	return reply != nil, nil
+}
+
+func (client *RedisClient) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	_, err := client.Do(ctx, "SET", key, value, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	return err
+}
+
+func (client *RedisClient) Del(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	_, err := client.Do(ctx, append([]string{"DEL"}, keys...)...)
+	return err
+}
+
+// Keys lists the keys matching pattern with SCAN, never blocking redis like KEYS
+func (client *RedisClient) Keys(ctx context.Context, pattern string) ([]string, error) {
+	var keys []string
+	cursor := "0"
+	for {
+		reply, err := client.Do(ctx, "SCAN", cursor, "MATCH", pattern, "COUNT", "100")
+		if err != nil {
+			return nil, err
+		}
+		parts, ok := reply.([]any)
+		if !ok || len(parts) != 2 {
+			return nil, fmt.Errorf("redis: unexpected SCAN reply %v", reply)
+		}
+		cursor, _ = parts[0].(string)
+		batch, _ := parts[1].([]any)
+		for _, key := range batch {
+			if name, ok := key.(string); ok {
+				keys = append(keys, name)
+			}
+		}
+		if cursor == "0" || cursor == "" {
+			return keys, nil
+		}
+	}
+}
+
+// MGet returns the values of keys, missing keys are left out
+func (client *RedisClient) MGet(ctx context.Context, keys ...string) ([]string, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	reply, err := client.Do(ctx, append([]string{"MGET"}, keys...)...)
+	if err != nil {
+		return nil, err
+	}
+	items, _ := reply.([]any)
+	values := make([]string, 0, len(items))
+	for _, item := range items {
+		if value, ok := item.(string); ok {
+			values = append(values, value)
+		}
+	}
+	return values, nil
+}
+
+const (
+	redisReleaseScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) else return 0 end`
+	redisRenewScript   = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("PEXPIRE", KEYS[1], ARGV[2]) else return 0 end`
+)
+
+// Release deletes a lease key, but only while token still owns it
+func (client *RedisClient) Release(ctx context.Context, key, token string) error {
+	_, err := client.Do(ctx, "EVAL", redisReleaseScript, "1", key, token)
+	return err
+}
+
+// Renew extends a lease key owned by token, reporting whether it still was
+func (client *RedisClient) Renew(ctx context.Context, key, token string, ttl time.Duration) (bool, error) {
+	reply, err := client.Do(ctx, "EVAL", redisRenewScript, "1", key, token, strconv.FormatInt(ttl.Milliseconds(), 10))
+	if err != nil {
+		return false, err
+	}
+	renewed, _ := reply.(int64)
+	return renewed == 1, nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+func parseCompactVideo(item gjson.Result) (YouTubeTrack, error) {
+	itemRenderer := item.Get("compactVideoRenderer")
+	if !itemRenderer.Exists() {
+		return YouTubeTrack{}, newParseError(rendererName(item), ParseReasonUnsupportedRenderer, "")
+	}
+
+	videoId := itemRenderer.Get("videoId").String()
+	lengthText, length := parseLengthText(itemRenderer.Get("lengthText"))
+	live := isLiveRenderer(itemRenderer)
+	scheduled, upcoming := parseUpcomingEvent(itemRenderer)
+	if length == 0 && !live && !upcoming {
+		return YouTubeTrack{}, newParseError("compactVideoRenderer.lengthText", "invalid_duration", lengthText)
+	}
+
+	track := YouTubeTrack{
+		Title:      itemRenderer.Get("title.simpleText").String(),
+		Author:     itemRenderer.Get("shortBylineText.runs.0.text").String(),
+		Identifier: videoId,
+		Images:     parseThumbnails(itemRenderer.Get("thumbnail.thumbnails")),
+		Length:     length,
+		LengthText: lengthText,
+		Uri:        YT_BASE_URL + "/watch?v=" + videoId,
+		Type:       "video",
+		Views:      itemRenderer.Get("viewCountText.simpleText").String(),
+		ChannelId: itemRenderer.Get("shortBylineText.runs.0.navigationEndpoint.browseEndpoint.browseId").
+			String(),
+	}
+	if live {
+		markLive(&track, itemRenderer)
+	}
+	if upcoming {
+		markUpcoming(&track, scheduled)
+	}
+	return track, nil
+}
+
+func parseRelatedVideos(data []byte) ([]YouTubeTrack, error) {
+	results := gjson.GetBytes(data, "contents.twoColumnWatchNextResults.secondaryResults.secondaryResults.results")
+	if !results.IsArray() {
+		err := newParseError("secondaryResults.results", "missing", "")
+		recordParseFailure("related", err, data)
+		return nil, err
+	}
+
+	tracks := make([]YouTubeTrack, 0)
+	for _, item := range results.Array() {
+		// the related list is sometimes nested in a section with filter chips
+		if section := item.Get("itemSectionRenderer.contents"); section.IsArray() {
+			for _, nested := range section.Array() {
+				if track, err := parseCompactVideo(nested); err == nil {
+					tracks = append(tracks, track)
+				} else {
+					recordParseFailure("related", err, data)
+				}
+			}
+			continue
+		}
+		track, err := parseCompactVideo(item)
+		if err != nil {
+			recordParseFailure("related", err, data)
+			continue
+		}
+		tracks = append(tracks, track)
+	}
+	return tracks, nil
+}
+
+// LoadRelated returns the watch-next recommendations of a video, the tracks
+// autoplay would pick from
+func (srv *Server) LoadRelated(ctx context.Context, videoId string) ([]YouTubeTrack, error) {
+	visitor, err := srv.pickVisitor(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := srv.innertubeRequest(ctx, "related", INNERTUBE_NEXT_API_URL, visitor, map[string]any{
+		"videoId": videoId,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tracks, err := parseRelatedVideos(respBody)
+	recordParse(ctx, "related", len(tracks), err)
+	if err != nil {
+		return nil, err
+	}
+	LoggerFromContext(ctx).Info("Loaded related videos", "videoId", videoId, "tracks", len(tracks))
+	return tracks, nil
+}
+
+func (srv *Server) MakeRelatedHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		videoId := strings.TrimSpace(req.FormValue("videoId"))
+		if !DirectVideoIDPattern.MatchString(videoId) {
+			writeError(writer, http.StatusBadRequest, "a valid videoId parameter is required")
+			return
+		}
+
+		cacheKey := "related:" + videoId
+		if srv.db != nil {
+			entry, err := srv.LookupCache(req.Context(), cacheKey)
+			if err != nil {
+				LoggerFromContext(req.Context()).Error("Failed to lookup cache for related videos", "error", err)
+			} else if entry != nil {
+				var tracks []YouTubeTrack
+				if err := json.Unmarshal(entry.Value, &tracks); err != nil {
+					LoggerFromContext(req.Context()).Error("Failed to unmarshal cached related videos", "error", err)
+				} else {
+					srv.writeJSON(writer, req, tracks, CacheStatus{Hit: true, StoredAt: entry.StoredAt})
+					return
+				}
+			}
+		}
+
+		tracks, err := srv.LoadRelated(req.Context(), videoId)
+		if err != nil {
+			writeError(
+				writer,
+				http.StatusInternalServerError,
+				fmt.Sprintf("Error loading related videos: %v", err),
+			)
+			return
+		}
+
+		if srv.db != nil && len(tracks) > 0 {
+			if err := srv.StoreCache(req.Context(), cacheKey, tracks); err != nil {
+				LoggerFromContext(req.Context()).Error("Failed to store related videos in cache", "error", err)
+			}
+		}
+		srv.writeJSON(writer, req, tracks, CacheStatus{})
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"sync"
+)
+
+type MetricsConfig struct {
+	// TenantLabels adds the tenant as a label to the request, upstream and cache metrics
+	TenantLabels bool `yaml:"tenant_labels"`
+	// MaxTenantLabels bounds the cardinality, tenants seen after the first
+	// MaxTenantLabels share the "other" label
+	MaxTenantLabels int               `yaml:"max_tenant_labels"`
+	Push            MetricsPushConfig `yaml:"push"`
+}
+
+var (
+	httpRequestsTotal = metrics.Counter(
+		"ytsearch_http_requests_total",
+		"Served requests by route, status code and tenant",
+		"route", "status", "tenant",
+	)
+	httpRequestDuration = metrics.Histogram(
+		"ytsearch_http_request_duration_seconds",
+		"Time spent serving requests by route and tenant",
+		DefaultLatencyBuckets,
+		"route", "tenant",
+	)
+	tenantUpstreamRequestsTotal = metrics.Counter(
+		"ytsearch_tenant_upstream_requests_total",
+		"Upstream requests made on behalf of a tenant",
+		"tenant",
+	)
+	cacheLookupsTotal = metrics.Counter(
+		"ytsearch_cache_lookups_total",
+		"Cache lookups by tenant and result",
+		"tenant", "result",
+	)
+)
+
+var tenantLabels = &tenantLabeler{}
+
+// tenantLabeler maps tenants to metric label values, handing out at most
+// max distinct ones
+type tenantLabeler struct {
+	mu      sync.Mutex
+	enabled bool
+	max     int
+	seen    map[string]struct{}
+}
+
+func (labeler *tenantLabeler) Configure(cfg MetricsConfig) {
+	labeler.mu.Lock()
+	defer labeler.mu.Unlock()
+	labeler.enabled = cfg.TenantLabels
+	labeler.max = cfg.MaxTenantLabels
+	labeler.seen = make(map[string]struct{})
+}
+
+func (labeler *tenantLabeler) Label(tenant string) string {
+	labeler.mu.Lock()
+	defer labeler.mu.Unlock()
+	if !labeler.enabled {
+		return ""
+	}
+	if tenant == "" {
+		return "anonymous"
+	}
+	if _, ok := labeler.seen[tenant]; ok {
+		return tenant
+	}
+	if len(labeler.seen) >= labeler.max {
+		return "other"
+	}
+	labeler.seen[tenant] = struct{}{}
+	return tenant
+}
+
+func tenantLabel(ctx context.Context) string {
+	return tenantLabels.Label(RequestInfoFromContext(ctx).Tenant)
+}
+
+func recordRequest(info *RequestInfo, status int, seconds float64) {
+	tenant := tenantLabels.Label(info.Tenant)
+	httpRequestsTotal.Inc(info.Route, strconv.Itoa(status), tenant)
+	httpRequestDuration.Observe(seconds, info.Route, tenant)
+}
+
+func recordCacheLookup(ctx context.Context, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	cacheLookupsTotal.Inc(tenantLabel(ctx), result)
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+const (
+	ResolveTypeTrack    = "track"
+	ResolveTypePlaylist = "playlist"
+	ResolveTypeAlbum    = "album"
+	ResolveTypeChannel  = "channel"
+)
+
+const INNERTUBE_RESOLVE_URL_API_URL = YT_BASE_URL + "/youtubei/v1/navigation/resolve_url?prettyPrint=false"
+
+// minimum score a youtube music result needs to count as the same track
+const externalMatchThreshold = 0.45
+
+var ErrUnsupportedUrl = errors.New("unsupported url")
+
+type ResolveResult struct {
+	Type     string                `json:"type"`
+	Track    *YouTubeTrack         `json:"track,omitempty"`
+	Playlist *YouTubePlaylist      `json:"playlist,omitempty"`
+	Channel  *YouTubeChannelResult `json:"channel,omitempty"`
+	Source   *ExternalTrack        `json:"source,omitempty"`
+}
+
+// matchExternalTrack finds the youtube music equivalent of a track from
+// another service, preferring an ISRC lookup when the ISRC is known
+func (srv *Server) matchExternalTrack(ctx context.Context, ext *ExternalTrack) (*YouTubeTrack, error) {
+	ref := ext.MatchReference()
+
+	var candidates []YouTubeTrack
+	if ext.ISRC != "" {
+		tracks, _, _, err := srv.searchISRC(ctx, ext.ISRC, ext.LengthMs)
+		if err != nil {
+			LoggerFromContext(ctx).Warn("ISRC search failed, falling back to text search", "isrc", ext.ISRC, "error", err)
+		}
+		candidates = tracks
+	}
+
+	best, bestScore := -1, 0.0
+	pick := func() {
+		for i := range candidates {
+			if score := scoreTrack(candidates[i], ref); score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+	}
+	pick()
+
+	if bestScore < externalMatchThreshold {
+		query := strings.TrimSpace(ext.Artist + " " + ext.Title)
+		tracks, _, _, err := srv.searchFromYouTube(ctx, SearchTypeYouTubeMusic, query, srv.defaultSearchOptions())
+		if err != nil {
+			return nil, err
+		}
+		candidates, best, bestScore = tracks, -1, 0
+		pick()
+	}
+
+	if best < 0 || bestScore < externalMatchThreshold {
+		return nil, fmt.Errorf("no matching track found for %s - %s", ext.Artist, ext.Title)
+	}
+	LoggerFromContext(ctx).Info(
+		"Matched external track",
+		"service", ext.Service,
+		"title", ext.Title,
+		"match", candidates[best].Identifier,
+		"score", bestScore,
+	)
+	track := candidates[best]
+	return &track, nil
+}
+
+func (srv *Server) resolveExternalTrack(ctx context.Context, ext *ExternalTrack) (*ResolveResult, error) {
+	track, err := srv.matchExternalTrack(ctx, ext)
+	if err != nil {
+		return nil, err
+	}
+	return &ResolveResult{Type: ResolveTypeTrack, Track: track, Source: ext}, nil
+}
+
+// resolveMusicUrl handles music.youtube.com watch, playlist and browse links
+func (srv *Server) resolveMusicUrl(ctx context.Context, parsed *url.URL) (*ResolveResult, error) {
+	maxTracks := srv.Cfg.Playlist.MaxTracks
+	query := parsed.Query()
+
+	var browseId string
+	switch path := strings.Trim(parsed.Path, "/"); {
+	case path == "watch" && DirectVideoIDPattern.MatchString(query.Get("v")):
+		track, err := srv.LoadVideoMetadata(ctx, query.Get("v"))
+		if err != nil {
+			return nil, err
+		}
+		track.Uri = YT_MUSIC_BASE_URL + "/watch?v=" + track.Identifier
+		return &ResolveResult{Type: ResolveTypeTrack, Track: &track}, nil
+	case path == "playlist" && query.Get("list") != "":
+		browseId = query.Get("list")
+	case strings.HasPrefix(path, "browse/"):
+		browseId = strings.TrimPrefix(path, "browse/")
+	}
+
+	switch {
+	case strings.HasPrefix(browseId, "MPREb"):
+		album, err := srv.LoadAlbum(ctx, browseId, maxTracks)
+		if err != nil {
+			return nil, err
+		}
+		return &ResolveResult{Type: ResolveTypeAlbum, Playlist: album}, nil
+	case browseId != "":
+		playlistId := strings.TrimPrefix(browseId, "VL")
+		playlist, err := srv.LoadPlaylist(ctx, playlistId, maxTracks)
+		if err != nil {
+			return nil, err
+		}
+		playlist.Uri = YT_MUSIC_BASE_URL + "/playlist?list=" + playlistId
+		resultType := ResolveTypePlaylist
+		if strings.HasPrefix(playlistId, "OLAK5uy") {
+			resultType = ResolveTypeAlbum
+		}
+		return &ResolveResult{Type: resultType, Playlist: playlist}, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedUrl, parsed.String())
+}
+
+// youtubeHosts are the hosts serving youtube video, playlist and channel pages
+var youtubeHosts = map[string]bool{
+	"youtube.com":          true,
+	"m.youtube.com":        true,
+	"youtu.be":             true,
+	"youtube-nocookie.com": true,
+}
+
+// resolveYouTubeUrl handles watch, youtu.be, shorts, live and embed links as
+// tracks, playlist and mix links as playlists and channel pages as channels
+func (srv *Server) resolveYouTubeUrl(ctx context.Context, host string, parsed *url.URL) (*ResolveResult, error) {
+	query := parsed.Query()
+	segments := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+
+	var videoId string
+	switch {
+	case host == "youtu.be":
+		videoId = segments[0]
+	case segments[0] == "watch":
+		videoId = query.Get("v")
+	case len(segments) > 1 && (segments[0] == "shorts" || segments[0] == "live" || segments[0] == "embed" ||
+		segments[0] == "v"):
+		videoId = segments[1]
+	}
+	if !DirectVideoIDPattern.MatchString(videoId) {
+		videoId = ""
+	}
+
+	// a list next to a video means the video was opened from that playlist,
+	// the playlist is what the link shares
+	if list := query.Get("list"); list != "" {
+		if mixIdPattern.MatchString(list) {
+			mix, err := srv.LoadMix(ctx, list, videoId, srv.Cfg.Mix.DefaultTracks, nil)
+			if err != nil {
+				return nil, err
+			}
+			return &ResolveResult{Type: ResolveTypePlaylist, Playlist: mix}, nil
+		}
+		if playlistId, err := parsePlaylistId(list); err == nil {
+			playlist, err := srv.LoadPlaylist(ctx, playlistId, srv.Cfg.Playlist.MaxTracks)
+			if err != nil {
+				return nil, err
+			}
+			return &ResolveResult{Type: ResolveTypePlaylist, Playlist: playlist}, nil
+		}
+		if videoId == "" {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedUrl, parsed.String())
+		}
+	}
+
+	if videoId != "" {
+		track, err := srv.LoadVideoMetadata(ctx, videoId)
+		if err != nil {
+			return nil, err
+		}
+		return &ResolveResult{Type: ResolveTypeTrack, Track: &track}, nil
+	}
+
+	var channelId, handle string
+	switch {
+	case segments[0] == "channel" && len(segments) > 1 && channelIdPattern.MatchString(segments[1]):
+		channelId = segments[1]
+	case strings.HasPrefix(segments[0], "@") && len(segments[0]) > 1,
+		(segments[0] == "c" || segments[0] == "user") && len(segments) > 1:
+		var err error
+		channelId, handle, err = srv.resolveChannelUrl(ctx, parsed)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedUrl, parsed.String())
+	}
+	return srv.resolveChannel(ctx, channelId, handle)
+}
+
+// resolveChannelUrl looks up the channel id behind a handle, custom or legacy
+// user url, which only youtube itself can map
+func (srv *Server) resolveChannelUrl(ctx context.Context, parsed *url.URL) (string, string, error) {
+	visitor, err := srv.pickVisitor(ctx, true)
+	if err != nil {
+		return "", "", err
+	}
+	respBody, err := srv.innertubeRequest(ctx, "resolve url", INNERTUBE_RESOLVE_URL_API_URL, visitor, map[string]any{
+		"url": YT_BASE_URL + parsed.EscapedPath(),
+	})
+	if err != nil {
+		return "", "", err
+	}
+	endpoint := gjson.GetBytes(respBody, "endpoint.browseEndpoint")
+	channelId := endpoint.Get("browseId").String()
+	if !channelIdPattern.MatchString(channelId) {
+		err := newParseError("endpoint.browseEndpoint.browseId", "missing", "")
+		recordParse(ctx, "resolve url", 0, err)
+		recordParseFailure("resolve url", err, respBody)
+		return "", "", fmt.Errorf("%w: %s", ErrUnsupportedUrl, parsed.String())
+	}
+	recordParse(ctx, "resolve url", 1, nil)
+	return channelId, strings.TrimPrefix(endpoint.Get("canonicalBaseUrl").String(), "/"), nil
+}
+
+// resolveChannel returns the channel with its uploads, the uploads playlist
+// also carries the channel name
+func (srv *Server) resolveChannel(ctx context.Context, channelId string, handle string) (*ResolveResult, error) {
+	uploads, err := srv.LoadPlaylist(ctx, "UU"+channelId[2:], srv.Cfg.Playlist.MaxTracks)
+	if err != nil {
+		return nil, err
+	}
+	channel := &YouTubeChannelResult{
+		Kind:       "channel",
+		Identifier: channelId,
+		Title:      uploads.Author,
+		Handle:     handle,
+		Images:     []Thumbnail{},
+		Uri:        YT_BASE_URL + "/channel/" + channelId,
+	}
+	if handle != "" {
+		channel.Uri = YT_BASE_URL + "/" + handle
+	}
+	return &ResolveResult{Type: ResolveTypeChannel, Channel: channel, Playlist: uploads}, nil
+}
+
+func (srv *Server) Resolve(ctx context.Context, rawUrl string) (*ResolveResult, error) {
+	rawUrl = strings.TrimSpace(rawUrl)
+	// bare ids are taken as the youtube page they name, links without a scheme as https
+	switch {
+	case DirectVideoIDPattern.MatchString(rawUrl):
+		rawUrl = YT_BASE_URL + "/watch?v=" + rawUrl
+	case DirectPlaylistIDPattern.MatchString(rawUrl) || mixIdPattern.MatchString(rawUrl):
+		rawUrl = YT_BASE_URL + "/playlist?list=" + rawUrl
+	case !strings.Contains(rawUrl, "://"):
+		rawUrl = "https://" + rawUrl
+	}
+	parsed, err := url.Parse(rawUrl)
+	if err != nil || parsed.Host == "" {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedUrl, rawUrl)
+	}
+	host := strings.TrimPrefix(strings.ToLower(parsed.Host), "www.")
+
+	switch {
+	case host == "music.youtube.com":
+		return srv.resolveMusicUrl(ctx, parsed)
+	case youtubeHosts[host]:
+		return srv.resolveYouTubeUrl(ctx, host, parsed)
+	case host == "open.spotify.com":
+		if match := spotifyTrackPattern.FindStringSubmatch(parsed.Path); match != nil {
+			ext, err := fetchSpotifyTrack(ctx, srv.external, match[1])
+			if err != nil {
+				return nil, err
+			}
+			return srv.resolveExternalTrack(ctx, ext)
+		}
+	case host == "deezer.com":
+		if match := deezerTrackPattern.FindStringSubmatch(parsed.Path); match != nil {
+			ext, err := fetchDeezerTrack(ctx, srv.external, match[1])
+			if err != nil {
+				return nil, err
+			}
+			return srv.resolveExternalTrack(ctx, ext)
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedUrl, rawUrl)
+}
+
+// resolveCached resolves a url through the cache, results with partial
+// metadata are not stored
+func (srv *Server) resolveCached(ctx context.Context, rawUrl string) (*ResolveResult, CacheStatus, error) {
+	cacheKey := "resolve:" + rawUrl
+	if srv.db != nil {
+		entry, err := srv.LookupCache(ctx, cacheKey)
+		if err != nil {
+			LoggerFromContext(ctx).Error("Failed to lookup cache for resolve", "error", err)
+		} else if entry != nil {
+			var result ResolveResult
+			if err := json.Unmarshal(entry.Value, &result); err != nil {
+				LoggerFromContext(ctx).Error("Failed to unmarshal cached resolve result", "error", err)
+			} else {
+				return &result, CacheStatus{Hit: true, StoredAt: entry.StoredAt}, nil
+			}
+		}
+	}
+
+	result, err := srv.Resolve(ctx, rawUrl)
+	if err != nil {
+		return nil, CacheStatus{}, err
+	}
+
+	if srv.db != nil && (result.Track == nil || !result.Track.Partial) {
+		if err := srv.StoreCache(ctx, cacheKey, result); err != nil {
+			LoggerFromContext(ctx).Error("Failed to store resolve result in cache", "error", err)
+		}
+	}
+	return result, CacheStatus{}, nil
+}
+
+func (srv *Server) MakeResolveHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		rawUrl := strings.TrimSpace(req.FormValue("url"))
+		if rawUrl == "" {
+			writeError(writer, http.StatusBadRequest, "url parameter is required")
+			return
+		}
+
+		result, cacheStatus, err := srv.resolveCached(req.Context(), rawUrl)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, ErrUnsupportedUrl) {
+				status = http.StatusBadRequest
+			}
+			writeError(writer, status, fmt.Sprintf("Error resolving url: %v", err))
+			return
+		}
+		srv.writeJSON(writer, req, result, cacheStatus)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CacheStatus describes where a response came from, used for the X-Cache,
+// ETag, Cache-Control and Age headers
+type CacheStatus struct {
+	Hit      bool
+	StoredAt time.Time
+	// Video marks lookups of a single video's metadata
+	Video bool
+	// Live marks responses holding a live or upcoming stream
+	Live bool
+	// NoStore marks responses no cache may keep, like expiring stream urls
+	NoStore bool
+}
+
+// routeMaxAge is the max-age configured for path, by the longest route
+// covering it
+func (cfg CacheControlConfig) routeMaxAge(path string) (int, bool) {
+	if maxAge, ok := cfg.Routes[path]; ok {
+		return maxAge, true
+	}
+	maxAge, matched := 0, ""
+	for route, routeMaxAge := range cfg.Routes {
+		if strings.HasSuffix(route, "/") && strings.HasPrefix(path, route) && len(route) > len(matched) {
+			maxAge, matched = routeMaxAge, route
+		}
+	}
+	return maxAge, matched != ""
+}
+
+// cacheControl is the Cache-Control header of a response to path. The max-age
+// is its lifetime counted from when it was stored, the Age header sent along
+// tells caches how much of it is gone.
+func (srv *Server) cacheControl(ctx context.Context, path string, status CacheStatus) string {
+	if debugEnabled(ctx) || status.NoStore {
+		return "no-store"
+	}
+	cfg := srv.Cfg.Caching.CacheControl
+	maxAge, ok := cfg.routeMaxAge(path)
+	switch {
+	case status.Live:
+		if cfg.LiveMaxAge <= 0 {
+			return "no-store"
+		}
+		maxAge = cfg.LiveMaxAge
+	case status.Video && cfg.VideoMaxAge > 0:
+		maxAge = cfg.VideoMaxAge
+	case ok:
+	case srv.db == nil:
+		return "no-cache"
+	default:
+		if maxAge = srv.cacheTTL(ctx); maxAge <= 0 {
+			maxAge = srv.Cfg.Caching.ClientMaxAge
+		}
+	}
+	if maxAge <= 0 {
+		return "no-cache"
+	}
+	scope := "public"
+	if TenantFromContext(ctx) != nil {
+		scope = "private"
+	}
+	return scope + ", max-age=" + strconv.Itoa(maxAge)
+}
+
+// liveContent reports whether a response value is a single live or upcoming
+// stream, whose viewer counts and availability change from minute to minute
+func liveContent(value any) bool {
+	live := func(track *YouTubeTrack) bool {
+		return track != nil && (track.Live != nil || track.IsUpcoming)
+	}
+	switch value := value.(type) {
+	case YouTubeTrack:
+		return live(&value)
+	case *YouTubeTrack:
+		return live(value)
+	case []YouTubeTrack:
+		return len(value) == 1 && live(&value[0])
+	case *ResolveResult:
+		return value != nil && live(value.Track)
+	}
+	return false
+}
+
+func etagMatches(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// prepareResponse filters, encodes and cuts down the tracks of a response
+// value the way the request asked for
+func prepareResponse(ctx context.Context, value any) (any, error) {
+	filtered := applyTenantFilters(ctx, value)
+	if filtered == nil && value != nil {
+		return nil, errFilteredOut
+	}
+	value = encodeTracks(filtered)
+	return applyFields(ctx, value)
+}
+
+func (srv *Server) writeJSON(
+	writer http.ResponseWriter,
+	req *http.Request,
+	value any,
+	status CacheStatus,
+) {
+	status.Live = status.Live || liveContent(value)
+	value, err := prepareResponse(req.Context(), value)
+	if errors.Is(err, errFilteredOut) {
+		writeError(writer, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(
+			writer,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Error encoding response: %v", err),
+		)
+		return
+	}
+	if debugEnabled(req.Context()) {
+		value = DebugResponse{Data: value, Debug: RequestInfoFromContext(req.Context()).Diagnostics()}
+	}
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(value); err != nil {
+		writeError(
+			writer,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Error encoding response: %v", err),
+		)
+		return
+	}
+	srv.writeBody(writer, req, body.Bytes(), "application/json", status)
+}
+
+// writeBody writes an encoded response with the ETag, X-Cache, Cache-Control
+// and Age headers, answering a matching If-None-Match with a 304
+func (srv *Server) writeBody(
+	writer http.ResponseWriter,
+	req *http.Request,
+	body []byte,
+	contentType string,
+	status CacheStatus,
+) {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	header := writer.Header()
+	header.Set("ETag", etag)
+	if status.Hit {
+		header.Set("X-Cache", "HIT")
+	} else {
+		header.Set("X-Cache", "MISS")
+	}
+	header.Set("Cache-Control", srv.cacheControl(req.Context(), req.URL.Path, status))
+	if status.Hit && !status.StoredAt.IsZero() {
+		header.Set("Age", strconv.Itoa(max(0, int(time.Since(status.StoredAt).Seconds()))))
+	}
+
+	if inm := req.Header.Get("If-None-Match"); inm != "" && etagMatches(inm, etag) {
+		writer.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	header.Set("Content-Type", contentType)
+	_, _ = writer.Write(body)
+}
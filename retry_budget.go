@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// fallback calls that spend the retry budget
+const (
+	RetryOEmbed         = "oembed"
+	RetryEmbeddedPlayer = "embedded_player"
+)
+
+var (
+	retryBudgetSpentTotal = metrics.Counter(
+		"ytsearch_retry_budget_spent_total",
+		"Fallback upstream calls allowed by the retry budget",
+		"endpoint",
+	)
+	retryBudgetExhaustedTotal = metrics.Counter(
+		"ytsearch_retry_budget_exhausted_total",
+		"Fallback upstream calls skipped because a retry budget was used up",
+		"endpoint", "scope",
+	)
+)
+
+type RetryBudgetLimits struct {
+	// PerRequest is how many fallback calls a single client request may make
+	PerRequest int `yaml:"per_request"`
+	// PerMinute caps the fallback calls of all requests together
+	PerMinute int `yaml:"per_minute"`
+}
+
+type RetryBudgetConfig struct {
+	Enabled           bool `yaml:"enabled"`
+	RetryBudgetLimits `yaml:",inline"`
+	// Endpoints overrides the limits per fallback, oembed or embedded_player
+	Endpoints map[string]RetryBudgetLimits `yaml:"endpoints"`
+}
+
+func (cfg RetryBudgetConfig) limits(endpoint string) RetryBudgetLimits {
+	limits := cfg.RetryBudgetLimits
+	if override, ok := cfg.Endpoints[endpoint]; ok {
+		if override.PerRequest > 0 {
+			limits.PerRequest = override.PerRequest
+		}
+		if override.PerMinute > 0 {
+			limits.PerMinute = override.PerMinute
+		}
+	}
+	return limits
+}
+
+// RetryBudget keeps the retry and fallback features from amplifying an
+// upstream outage into a request storm
+type RetryBudget struct {
+	cfg     RetryBudgetConfig
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+func NewRetryBudget(cfg RetryBudgetConfig) *RetryBudget {
+	return &RetryBudget{cfg: cfg, buckets: make(map[string]*tokenBucket)}
+}
+
+// spendRetry reports whether a fallback call to endpoint is still within the
+// budget of the request and the global one, and spends it if so
+func (srv *Server) spendRetry(ctx context.Context, endpoint string) bool {
+	budget := srv.retryBudget
+	if budget == nil {
+		return true
+	}
+	limits := budget.cfg.limits(endpoint)
+
+	info := RequestInfoFromContext(ctx)
+	info.mu.Lock()
+	if info.retries == nil {
+		info.retries = make(map[string]int)
+	}
+	if info.retries[endpoint] >= limits.PerRequest {
+		info.mu.Unlock()
+		retryBudgetExhaustedTotal.Inc(endpoint, "request")
+		LoggerFromContext(ctx).Debug("Request retry budget used up", "endpoint", endpoint)
+		return false
+	}
+	info.retries[endpoint]++
+	info.mu.Unlock()
+
+	budget.mu.Lock()
+	bucket, ok := budget.buckets[endpoint]
+	if !ok {
+		// a full minute worth of retries may be spent at once
+		bucket = newTokenBucket(limits.PerMinute, limits.PerMinute)
+		budget.buckets[endpoint] = bucket
+	}
+	budget.mu.Unlock()
+	if !bucket.Take().Allowed {
+		retryBudgetExhaustedTotal.Inc(endpoint, "global")
+		LoggerFromContext(ctx).Warn("Global retry budget used up", "endpoint", endpoint)
+		return false
+	}
+	retryBudgetSpentTotal.Inc(endpoint)
+	return true
+}
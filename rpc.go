@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const rpcPath = "/rpc"
+
+// the error codes of JSON-RPC 2.0, -32000 to -32099 are left to servers
+const (
+	RPCParseError     = -32700
+	RPCInvalidRequest = -32600
+	RPCMethodNotFound = -32601
+	RPCInvalidParams  = -32602
+	RPCInternalError  = -32603
+	// RPCForbidden is the error of methods the api key isn't allowed to call
+	RPCForbidden = -32001
+	// RPCFilteredOut is the error of a single track the api key filters out
+	RPCFilteredOut = -32002
+	// RPCLimited is the error of calls over the rate limit, concurrency cap or
+	// quota of the api key
+	RPCLimited = -32003
+)
+
+type RPCRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	// Id is left unset for notifications, which get no response
+	Id json.RawMessage `json:"id,omitempty"`
+}
+
+type RPCResponse struct {
+	JSONRPC string    `json:"jsonrpc"`
+	Result  any       `json:"result,omitempty"`
+	Error   *RPCError `json:"error,omitempty"`
+	Id      any       `json:"id"`
+}
+
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	// Data is the validation error of invalid params
+	Data any `json:"data,omitempty"`
+}
+
+func (err *RPCError) Error() string {
+	return err.Message
+}
+
+func rpcInvalidParams(err *ValidationError) *RPCError {
+	return &RPCError{Code: RPCInvalidParams, Message: err.Message, Data: err}
+}
+
+type rpcSearchParams struct {
+	Query      string `json:"query"`
+	Limit      int    `json:"limit"`
+	Exact      bool   `json:"exact"`
+	SafeSearch *bool  `json:"safe_search"`
+}
+
+type rpcIdParams struct {
+	Id    string `json:"id"`
+	Limit int    `json:"limit"`
+}
+
+type rpcResolveParams struct {
+	Url string `json:"url"`
+}
+
+type rpcMethod struct {
+	// endpoint is the HTTP endpoint the method stands for, the allowed
+	// endpoints of a tenant are matched against it
+	endpoint string
+	call     func(srv *Server, ctx context.Context, params json.RawMessage) (any, error)
+}
+
+var rpcMethods = map[string]rpcMethod{
+	"youtube.search": {
+		endpoint: "/api/youtube/search",
+		call: func(srv *Server, ctx context.Context, params json.RawMessage) (any, error) {
+			return srv.rpcSearch(ctx, SearchTypeYouTube, params)
+		},
+	},
+	"music.search": {
+		endpoint: "/api/youtubemusic/search",
+		call: func(srv *Server, ctx context.Context, params json.RawMessage) (any, error) {
+			return srv.rpcSearch(ctx, SearchTypeYouTubeMusic, params)
+		},
+	},
+	"youtube.video":    {endpoint: "/api/youtube/search", call: (*Server).rpcVideo},
+	"youtube.playlist": {endpoint: "/api/youtube/playlist", call: (*Server).rpcPlaylist},
+	"resolve":          {endpoint: "/api/resolve", call: (*Server).rpcResolve},
+}
+
+// decodeRPCParams decodes the params of a call, which are passed by name
+func decodeRPCParams(params json.RawMessage, target any) error {
+	params = bytes.TrimSpace(params)
+	if len(params) == 0 || bytes.Equal(params, []byte("null")) {
+		params = []byte("{}")
+	}
+	if params[0] != '{' {
+		return &RPCError{Code: RPCInvalidParams, Message: "params must be an object"}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(params))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(target); err != nil {
+		return &RPCError{Code: RPCInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+func validateRPCLimit(limit int) error {
+	if limit < 0 {
+		return rpcInvalidParams(&ValidationError{
+			Code:    "invalid_limit",
+			Param:   "limit",
+			Message: "limit must be a positive integer",
+		})
+	}
+	return nil
+}
+
+func (srv *Server) rpcSearch(ctx context.Context, searchType SearchType, params json.RawMessage) (any, error) {
+	var search rpcSearchParams
+	if err := decodeRPCParams(params, &search); err != nil {
+		return nil, err
+	}
+	query := strings.TrimSpace(search.Query)
+	if query == "" {
+		return nil, rpcInvalidParams(&ValidationError{
+			Code:    "missing_query",
+			Param:   "query",
+			Message: "query is required",
+		})
+	}
+	if err := validateText("query", query, srv.Cfg.Validation.MaxQueryLength); err != nil {
+		return nil, rpcInvalidParams(err)
+	}
+	if err := validateRPCLimit(search.Limit); err != nil {
+		return nil, err
+	}
+
+	opts := srv.defaultSearchOptions()
+	opts.Exact = search.Exact
+	if search.SafeSearch != nil {
+		opts.SafeSearch = *search.SafeSearch
+	}
+	if search.Limit > 0 {
+		opts.Limit = min(search.Limit, srv.Cfg.Search.MaxResults)
+	}
+	tracks, _, _, err := srv.searchFromYouTube(ctx, searchType, query, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error searching YouTube: %w", err)
+	}
+	return limitResults(rerankTracks(ctx, tracks, query), opts.Limit), nil
+}
+
+func (srv *Server) rpcVideo(ctx context.Context, params json.RawMessage) (any, error) {
+	var video rpcIdParams
+	if err := decodeRPCParams(params, &video); err != nil {
+		return nil, err
+	}
+	match := DirectVideoIDPattern.FindStringSubmatch(strings.TrimSpace(video.Id))
+	if match == nil {
+		return nil, rpcInvalidParams(&ValidationError{
+			Code:    "invalid_video_id",
+			Param:   "id",
+			Message: "id must be a YouTube video id",
+		})
+	}
+	track, _, err := srv.loadVideoCached(ctx, match[1][:min(len(match[1]), 11)])
+	if err != nil {
+		return nil, fmt.Errorf("error loading video metadata: %w", err)
+	}
+	return track, nil
+}
+
+func (srv *Server) rpcPlaylist(ctx context.Context, params json.RawMessage) (any, error) {
+	var playlist rpcIdParams
+	if err := decodeRPCParams(params, &playlist); err != nil {
+		return nil, err
+	}
+	playlistId, err := parsePlaylistId(playlist.Id)
+	if err != nil {
+		return nil, rpcInvalidParams(&ValidationError{
+			Code:    "invalid_playlist_id",
+			Param:   "id",
+			Message: err.Error(),
+		})
+	}
+	if err := validateRPCLimit(playlist.Limit); err != nil {
+		return nil, err
+	}
+	maxTracks := srv.Cfg.Playlist.MaxTracks
+	if playlist.Limit > 0 {
+		maxTracks = min(playlist.Limit, maxTracks)
+	}
+	loaded, _, err := srv.loadPlaylistCached(ctx, playlistId, maxTracks)
+	if err != nil {
+		return nil, fmt.Errorf("error loading playlist: %w", err)
+	}
+	return loaded, nil
+}
+
+func (srv *Server) rpcResolve(ctx context.Context, params json.RawMessage) (any, error) {
+	var resolve rpcResolveParams
+	if err := decodeRPCParams(params, &resolve); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(resolve.Url) == "" {
+		return nil, rpcInvalidParams(&ValidationError{
+			Code:    "missing_url",
+			Param:   "url",
+			Message: "url is required",
+		})
+	}
+	result, _, err := srv.resolveCached(ctx, strings.TrimSpace(resolve.Url))
+	if errors.Is(err, ErrUnsupportedUrl) {
+		return nil, rpcInvalidParams(&ValidationError{
+			Code:    "unsupported_url",
+			Param:   "url",
+			Message: err.Error(),
+		})
+	}
+	return result, err
+}
+
+// runRPC runs a single call, nil for notifications
+func (srv *Server) runRPC(ctx context.Context, raw json.RawMessage) *RPCResponse {
+	var req RPCRequest
+	if err := json.Unmarshal(raw, &req); err != nil || req.JSONRPC != "2.0" || req.Method == "" {
+		// the id of a malformed request can't be trusted, it is answered with null
+		return &RPCResponse{
+			JSONRPC: "2.0",
+			Error:   &RPCError{Code: RPCInvalidRequest, Message: "invalid request"},
+		}
+	}
+	var id any
+	if req.Id != nil {
+		id = req.Id
+	}
+	respond := func(result any, err error) *RPCResponse {
+		if req.Id == nil {
+			return nil
+		}
+		resp := &RPCResponse{JSONRPC: "2.0", Result: result, Id: id}
+		if err != nil {
+			var rpcErr *RPCError
+			if !errors.As(err, &rpcErr) {
+				LoggerFromContext(ctx).Error("JSON-RPC call failed", "method", req.Method, "error", err)
+				rpcErr = &RPCError{Code: RPCInternalError, Message: err.Error()}
+			}
+			resp.Result = nil
+			resp.Error = rpcErr
+		}
+		return resp
+	}
+
+	method, ok := rpcMethods[req.Method]
+	if !ok {
+		return respond(nil, &RPCError{Code: RPCMethodNotFound, Message: fmt.Sprintf("method %q not found", req.Method)})
+	}
+	if tenant := TenantFromContext(ctx); tenant != nil && !tenant.Allows(method.endpoint) {
+		return respond(nil, &RPCError{Code: RPCForbidden, Message: "method not allowed for this api key"})
+	}
+	release, err := srv.chargeCall(ctx)
+	if err != nil {
+		return respond(nil, &RPCError{Code: RPCLimited, Message: err.Error()})
+	}
+	defer release()
+	result, err := method.call(srv, ctx, req.Params)
+	if err != nil {
+		return respond(nil, err)
+	}
+	result, err = prepareResponse(ctx, result)
+	if errors.Is(err, errFilteredOut) {
+		err = &RPCError{Code: RPCFilteredOut, Message: err.Error()}
+	}
+	return respond(result, err)
+}
+
+// MakeRPCHandler answers JSON-RPC 2.0 requests and batches of them. The calls
+// of a batch run concurrently like the items of /api/batch, each under the
+// batch item timeout. Errors are reported in the responses with status 200.
+func (srv *Server) MakeRPCHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		write := func(value any) {
+			writer.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(writer).Encode(value)
+		}
+
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			write(RPCResponse{JSONRPC: "2.0", Error: &RPCError{Code: RPCParseError, Message: err.Error()}})
+			return
+		}
+		body = bytes.TrimSpace(body)
+		if !json.Valid(body) {
+			write(RPCResponse{JSONRPC: "2.0", Error: &RPCError{Code: RPCParseError, Message: "parse error"}})
+			return
+		}
+
+		if len(body) == 0 || body[0] != '[' {
+			if resp := srv.runRPC(req.Context(), body); resp != nil {
+				write(resp)
+				return
+			}
+			writer.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		var calls []json.RawMessage
+		if err := json.Unmarshal(body, &calls); err != nil || len(calls) == 0 {
+			write(RPCResponse{JSONRPC: "2.0", Error: &RPCError{Code: RPCInvalidRequest, Message: "invalid request"}})
+			return
+		}
+		if len(calls) > srv.Cfg.Batch.MaxItems {
+			write(RPCResponse{JSONRPC: "2.0", Error: &RPCError{
+				Code:    RPCInvalidRequest,
+				Message: fmt.Sprintf("a batch holds at most %d calls", srv.Cfg.Batch.MaxItems),
+			}})
+			return
+		}
+
+		responses := make([]*RPCResponse, len(calls))
+		timeout := time.Duration(srv.Cfg.Batch.ItemTimeout) * time.Second
+		slots := make(chan struct{}, srv.Cfg.Batch.MaxConcurrency)
+		var wg sync.WaitGroup
+		for i, call := range calls {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				slots <- struct{}{}
+				defer func() { <-slots }()
+				ctx, cancel := context.WithTimeout(req.Context(), timeout)
+				defer cancel()
+				responses[i] = srv.runRPC(ctx, call)
+			}()
+		}
+		wg.Wait()
+
+		answered := make([]*RPCResponse, 0, len(responses))
+		for _, resp := range responses {
+			if resp != nil {
+				answered = append(answered, resp)
+			}
+		}
+		// a batch of notifications is answered with nothing at all
+		if len(answered) == 0 {
+			writer.WriteHeader(http.StatusNoContent)
+			return
+		}
+		write(answered)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"expvar"
+	"runtime"
+)
+
+var (
+	goGoroutines = metrics.Gauge("go_goroutines", "Number of goroutines that currently exist")
+	goHeapBytes  = metrics.Gauge(
+		"go_memstats_heap_bytes",
+		"Heap memory by state, alloc is live objects and sys is obtained from the OS",
+		"state",
+	)
+	goGcCycles      = metrics.Gauge("go_gc_cycles", "Completed GC cycles")
+	goGcPauseTotal  = metrics.Gauge("go_gc_pause_seconds", "Cumulative stop-the-world GC pause time")
+	goGcLastPause   = metrics.Gauge("go_gc_last_pause_seconds", "Duration of the most recent GC pause")
+	goHeapObjects   = metrics.Gauge("go_memstats_heap_objects", "Number of allocated heap objects")
+	goNextGcTrigger = metrics.Gauge("go_memstats_next_gc_bytes", "Heap size at which the next GC cycle starts")
+)
+
+func collectRuntimeMetrics() {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	goGoroutines.Set(float64(runtime.NumGoroutine()))
+	goHeapBytes.Set(float64(stats.HeapAlloc), "alloc")
+	goHeapBytes.Set(float64(stats.HeapInuse), "inuse")
+	goHeapBytes.Set(float64(stats.HeapIdle), "idle")
+	goHeapBytes.Set(float64(stats.HeapSys), "sys")
+	goHeapObjects.Set(float64(stats.HeapObjects))
+	goNextGcTrigger.Set(float64(stats.NextGC))
+	goGcCycles.Set(float64(stats.NumGC))
+	goGcPauseTotal.Set(float64(stats.PauseTotalNs) / 1e9)
+	if stats.NumGC > 0 {
+		goGcLastPause.Set(float64(stats.PauseNs[(stats.NumGC+255)%256]) / 1e9)
+	}
+}
+
+func init() {
+	metrics.OnCollect(collectRuntimeMetrics)
+	expvar.Publish("goroutines", expvar.Func(func() any {
+		return runtime.NumGoroutine()
+	}))
+}
+
+// publishServerVars exposes the visitor pool and cache state on /debug/vars
+// next to the memstats expvar already publishes
+func (srv *Server) publishServerVars() {
+	expvar.Publish("visitors", expvar.Func(func() any {
+		srv.mu.RLock()
+		defer srv.mu.RUnlock()
+		pool := map[string]any{"fault_count": srv.faultCount}
+		for _, visitor := range srv.visitors {
+			kind := visitorType(visitor.IsYouTube)
+			count, _ := pool[kind].(int)
+			pool[kind] = count + 1
+		}
+		return pool
+	}))
+	expvar.Publish("cache", expvar.Func(func() any {
+		return map[string]float64{
+			"entries": cacheEntries.Value(),
+			"bytes":   cacheBytes.Value(),
+		}
+	}))
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// SearchOptions are the per request settings of a text search, the zero value
+// searches the way the server always has
+type SearchOptions struct {
+	// Exact searches the query as typed instead of YouTube's spelling correction
+	Exact bool
+	// Limit caps the results, continuation pages are loaded until it is met.
+	// 0 returns the first page.
+	Limit int
+	// Duration, UploadDate and Sort narrow down and order YouTube searches,
+	// empty ones leave YouTube's defaults
+	Duration   string
+	UploadDate string
+	Sort       string
+	// Features only finds videos with all of them, sorted by name
+	Features []string
+	// SafeSearch searches in restricted mode, which leaves out mature results
+	SafeSearch bool
+	// Category is what YouTube Music searches find, empty for songs
+	Category string
+	// Extended adds the publish time, description snippet and badges to the
+	// video results
+	Extended bool
+}
+
+// the values of the search filters, as YouTube numbers them in the params
+var (
+	searchDurations   = map[string]uint64{"short": 1, "long": 2, "medium": 3}
+	searchUploadDates = map[string]uint64{"hour": 1, "today": 2, "week": 3, "month": 4, "year": 5}
+	searchSorts       = map[string]uint64{"relevance": 0, "rating": 1, "date": 2, "views": 3}
+	// the field of each feature in the filters, set to true
+	searchFeatures = map[string]int{"hd": 4, "cc": 5, "live": 8, "4k": 14}
+)
+
+// a results page holds about this many results
+const searchPageSize = 20
+
+// defaultSearchOptions are the options of searches not made for a request
+func (srv *Server) defaultSearchOptions() SearchOptions {
+	return SearchOptions{SafeSearch: srv.Cfg.Search.SafeSearch}
+}
+
+func parseSearchOptions(req *http.Request, cfg SearchConfig) (SearchOptions, *ValidationError) {
+	opts := SearchOptions{
+		Exact:      req.FormValue("exact") == "true",
+		SafeSearch: cfg.SafeSearch,
+		Extended:   req.FormValue("extended") == "true",
+	}
+	if safeSearch := req.FormValue("safeSearch"); safeSearch != "" {
+		opts.SafeSearch = safeSearch == "true"
+	}
+	if limit := req.FormValue("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed <= 0 {
+			return opts, &ValidationError{
+				Code:    "invalid_limit",
+				Param:   "limit",
+				Message: "limit must be a positive integer",
+			}
+		}
+		opts.Limit = min(parsed, cfg.MaxResults)
+	}
+
+	filters := []struct {
+		param   string
+		target  *string
+		values  map[string]uint64
+		message string
+	}{
+		{"duration", &opts.Duration, searchDurations, "duration must be one of short, medium or long"},
+		{"uploadDate", &opts.UploadDate, searchUploadDates, "uploadDate must be one of hour, today, week, month or year"},
+		{"sort", &opts.Sort, searchSorts, "sort must be one of relevance, date, views or rating"},
+	}
+	for _, filter := range filters {
+		value := strings.ToLower(strings.TrimSpace(req.FormValue(filter.param)))
+		if value == "" {
+			continue
+		}
+		if _, ok := filter.values[value]; !ok {
+			return opts, &ValidationError{Code: "invalid_" + filter.param, Param: filter.param, Message: filter.message}
+		}
+		*filter.target = value
+	}
+	if opts.Sort == "relevance" {
+		// the default order, searched and cached like no sort at all
+		opts.Sort = ""
+	}
+
+	for _, feature := range strings.Split(req.FormValue("features"), ",") {
+		feature = strings.ToLower(strings.TrimSpace(feature))
+		if feature == "" || slices.Contains(opts.Features, feature) {
+			continue
+		}
+		if _, ok := searchFeatures[feature]; !ok {
+			return opts, &ValidationError{
+				Code:    "invalid_features",
+				Param:   "features",
+				Message: fmt.Sprintf("unknown feature %q, features are hd, cc, 4k and live", feature),
+			}
+		}
+		opts.Features = append(opts.Features, feature)
+	}
+	slices.Sort(opts.Features)
+
+	if category := strings.ToLower(strings.TrimSpace(req.FormValue("category"))); category != "" {
+		if _, ok := musicCategoryParams[category]; !ok {
+			return opts, &ValidationError{
+				Code:    "invalid_category",
+				Param:   "category",
+				Message: "category must be one of songs, videos, albums, artists or playlists",
+			}
+		}
+		if category != MusicCategorySongs {
+			// songs are searched and cached like no category at all
+			opts.Category = category
+		}
+	}
+	return opts, nil
+}
+
+// youtubeOnlyParam names the first option set that only YouTube searches
+// support, if any
+func (opts SearchOptions) youtubeOnlyParam() string {
+	switch {
+	case opts.Duration != "":
+		return "duration"
+	case opts.UploadDate != "":
+		return "uploadDate"
+	case opts.Sort != "":
+		return "sort"
+	case len(opts.Features) > 0:
+		return "features"
+	case opts.Extended:
+		return "extended"
+	}
+	return ""
+}
+
+// musicOnlyParam names the option that only YouTube Music searches support, if set
+func (opts SearchOptions) musicOnlyParam() string {
+	if opts.Category != "" {
+		return "category"
+	}
+	return ""
+}
+
+// cacheOptions keeps results of searches with other options apart in the
+// cache. Limits within the first page share its entry and are cut from it.
+func (opts SearchOptions) cacheOptions() map[string]string {
+	options := map[string]string{}
+	if opts.Exact {
+		options["exact"] = "true"
+	}
+	if opts.Limit > searchPageSize {
+		options["limit"] = strconv.Itoa(opts.Limit)
+	}
+	options["duration"] = opts.Duration
+	options["upload_date"] = opts.UploadDate
+	options["sort"] = opts.Sort
+	options["features"] = strings.Join(opts.Features, ",")
+	if opts.SafeSearch {
+		options["safe_search"] = "true"
+	}
+	options["category"] = opts.Category
+	if opts.Extended {
+		options["extended"] = "true"
+	}
+	return options
+}
+
+// innertubeContext is the visitor context to search with, restricted mode is a
+// setting of the user in it
+func (opts SearchOptions) innertubeContext(visitorContext map[string]any) map[string]any {
+	if !opts.SafeSearch {
+		return visitorContext
+	}
+	user := map[string]any{}
+	if visitorUser, ok := visitorContext["user"].(map[string]any); ok {
+		user = maps.Clone(visitorUser)
+	}
+	user["enableSafetyMode"] = true
+	copied := maps.Clone(visitorContext)
+	copied["user"] = user
+	return copied
+}
+
+// limitResults cuts results down to the limit, if any
+func limitResults[T any](results []T, limit int) []T {
+	if limit > 0 && len(results) > limit {
+		return results[:limit]
+	}
+	return results
+}
+
+// spelling correction is switched off by field 8 {1: 1} of the search params,
+// protobuf merges the field into whatever filter the params already carry
+var noSpellingCorrection = []byte{0x42, 0x02, 0x08, 0x01}
+
+func appendProtoVarint(buf []byte, field int, value uint64) []byte {
+	buf = binary.AppendUvarint(buf, uint64(field<<3))
+	return binary.AppendUvarint(buf, value)
+}
+
+func appendProtoMessage(buf []byte, field int, message []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(field<<3|2))
+	buf = binary.AppendUvarint(buf, uint64(len(message)))
+	return append(buf, message...)
+}
+
+// params returns the search params for a filter with the options applied. The
+// sort order is field 1 of the params, the filters are fields of the message
+// in field 2: 1 the upload date, 3 the duration and the searchFeatures.
+func (opts SearchOptions) params(filter string) string {
+	var extra []byte
+	if sort := searchSorts[opts.Sort]; sort != 0 {
+		extra = appendProtoVarint(extra, 1, sort)
+	}
+	var filters []byte
+	if opts.UploadDate != "" {
+		filters = appendProtoVarint(filters, 1, searchUploadDates[opts.UploadDate])
+	}
+	if opts.Duration != "" {
+		filters = appendProtoVarint(filters, 3, searchDurations[opts.Duration])
+	}
+	for _, feature := range opts.Features {
+		filters = appendProtoVarint(filters, searchFeatures[feature], 1)
+	}
+	if len(filters) > 0 {
+		extra = appendProtoMessage(extra, 2, filters)
+	}
+	if opts.Exact {
+		extra = append(extra, noSpellingCorrection...)
+	}
+	if len(extra) == 0 {
+		return filter
+	}
+
+	unescaped, err := url.QueryUnescape(filter)
+	if err != nil {
+		return filter
+	}
+	raw, err := base64.StdEncoding.DecodeString(unescaped)
+	if err != nil {
+		return filter
+	}
+	return url.QueryEscape(base64.StdEncoding.EncodeToString(append(raw, extra...)))
+}
+
+// SpellingCorrection is the query YouTube corrected a search to
+type SpellingCorrection struct {
+	Query string `json:"query"`
+	// Applied is set when the results are for Query instead of the searched
+	// query, otherwise Query is only suggested
+	Applied bool `json:"applied"`
+}
+
+// Header sets X-Corrected-Query or X-Suggested-Query, escaped as the query can
+// hold characters headers can't
+func (correction *SpellingCorrection) Header(header http.Header) {
+	if correction == nil {
+		return
+	}
+	if correction.Applied {
+		header.Set("X-Corrected-Query", url.QueryEscape(correction.Query))
+	} else {
+		header.Set("X-Suggested-Query", url.QueryEscape(correction.Query))
+	}
+}
+
+// parseSpellingCorrection finds the showingResultsForRenderer or
+// didYouMeanRenderer YouTube puts above the results of a misspelled query
+func parseSpellingCorrection(data []byte) *SpellingCorrection {
+	sections := gjson.GetBytes(
+		data,
+		"contents.twoColumnSearchResultsRenderer.primaryContents.sectionListRenderer.contents",
+	)
+	if !sections.Exists() {
+		sections = gjson.GetBytes(
+			data,
+			"contents.tabbedSearchResultsRenderer.tabs.0.tabRenderer.content.sectionListRenderer.contents",
+		)
+	}
+	for _, section := range sections.Array() {
+		for _, item := range section.Get("itemSectionRenderer.contents").Array() {
+			renderer, applied := item.Get("showingResultsForRenderer"), true
+			if !renderer.Exists() {
+				renderer, applied = item.Get("didYouMeanRenderer"), false
+			}
+			if !renderer.Exists() {
+				continue
+			}
+			var query strings.Builder
+			for _, run := range renderer.Get("correctedQuery.runs").Array() {
+				query.WriteString(run.Get("text").String())
+			}
+			if query.Len() > 0 {
+				return &SpellingCorrection{Query: query.String(), Applied: applied}
+			}
+		}
+	}
+	return nil
+}
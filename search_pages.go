@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+
+	"github.com/tidwall/gjson"
+)
+
+// youtubeSearchSections are the sections of a YouTube results page, the first
+// page lists them in the section list and continuation pages append them
+func youtubeSearchSections(data []byte) gjson.Result {
+	sections := gjson.GetBytes(data, "contents.twoColumnSearchResultsRenderer.primaryContents.sectionListRenderer.contents")
+	if !sections.Exists() {
+		sections = gjson.GetBytes(data, "onResponseReceivedCommands.0.appendContinuationItemsAction.continuationItems")
+	}
+	return sections
+}
+
+// musicSearchShelf is the shelf of a YouTube Music results page, continuation
+// pages carry the next part of it as a musicShelfContinuation. Corrected
+// queries put an item section with the correction above the shelf.
+func musicSearchShelf(data []byte) gjson.Result {
+	sections := gjson.GetBytes(data, "contents.tabbedSearchResultsRenderer.tabs.0.tabRenderer.content.sectionListRenderer.contents")
+	for _, section := range sections.Array() {
+		if shelf := section.Get("musicShelfRenderer"); shelf.Exists() {
+			return shelf
+		}
+	}
+	return gjson.GetBytes(data, "continuationContents.musicShelfContinuation")
+}
+
+// searchContinuation is the token of the page after a results page, empty
+// when it was the last one
+func searchContinuation(searchType SearchType, data []byte) string {
+	if searchType == SearchTypeYouTubeMusic {
+		return musicSearchShelf(data).Get("continuations.0.nextContinuationData.continuation").String()
+	}
+	for _, section := range youtubeSearchSections(data).Array() {
+		if token := section.Get("continuationItemRenderer.continuationEndpoint.continuationCommand.token"); token.Exists() {
+			return token.String()
+		}
+	}
+	return ""
+}
+
+// searchPages runs a search and hands its first page to parse, continuation
+// pages follow until parse has counted limit results or the results run out.
+// The first page is returned for what only it carries, like the spelling
+// correction, along with the error parse had with it. No page comes back when
+// the search request failed. A continuation that fails ends the search with
+// the results so far, the callers record the parse of all pages at once.
+func (srv *Server) searchPages(
+	ctx context.Context,
+	searchType SearchType,
+	visitor *YouTubeVisitorData,
+	payload map[string]any,
+	limit int,
+	parse func(page []byte) (int, error),
+) ([]byte, error) {
+	respBody, err := srv.innertubeRequest(ctx, "search", INNERTUBE_SEARCH_API_URL, visitor, payload)
+	if err != nil {
+		return nil, err
+	}
+	total, err := parse(respBody)
+	if err != nil {
+		return respBody, err
+	}
+
+	page := respBody
+	for total < limit {
+		continuation := searchContinuation(searchType, page)
+		if continuation == "" {
+			break
+		}
+		page, err = srv.innertubeRequest(ctx, "search continuation", INNERTUBE_SEARCH_API_URL, visitor, map[string]any{
+			"context":      payload["context"],
+			"continuation": continuation,
+		})
+		if err != nil {
+			LoggerFromContext(ctx).Warn("Failed to load search continuation", "error", err)
+			break
+		}
+		count, err := parse(page)
+		if err != nil || count == 0 {
+			break
+		}
+		total += count
+	}
+	return respBody, nil
+}
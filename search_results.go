@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+const (
+	ResultKindVideo    = "video"
+	ResultKindPlaylist = "playlist"
+	ResultKindChannel  = "channel"
+	ResultKindShorts   = "shorts"
+	// ResultKindAll expands to every kind
+	ResultKindAll = "all"
+)
+
+const YT_CHANNEL_FILTER_PARAM = "EgIQAg%3D%3D"
+const YT_PLAYLIST_FILTER_PARAM = "EgIQAw%3D%3D"
+
+var searchResultKinds = []string{ResultKindVideo, ResultKindPlaylist, ResultKindChannel, ResultKindShorts}
+
+type YouTubeVideoResult struct {
+	Kind string `json:"kind"`
+	YouTubeTrack
+}
+
+type YouTubePlaylistResult struct {
+	Kind       string      `json:"kind"`
+	Identifier string      `json:"identifier"`
+	Title      string      `json:"title"`
+	Author     string      `json:"author"`
+	ChannelId  string      `json:"channel_id"`
+	TrackCount int         `json:"track_count"`
+	Images     []Thumbnail `json:"images"`
+	Uri        string      `json:"uri"`
+}
+
+// YouTubeShortsShelf is a shelf of shorts between the other results
+type YouTubeShortsShelf struct {
+	Kind   string         `json:"kind"`
+	Title  string         `json:"title"`
+	Shorts []YouTubeShort `json:"shorts"`
+}
+
+type YouTubeShort struct {
+	Identifier string      `json:"identifier"`
+	Title      string      `json:"title"`
+	Views      string      `json:"views"`
+	Images     []Thumbnail `json:"images"`
+	Uri        string      `json:"uri"`
+}
+
+type YouTubeChannelResult struct {
+	Kind        string      `json:"kind"`
+	Identifier  string      `json:"identifier"`
+	Title       string      `json:"title"`
+	Handle      string      `json:"handle"`
+	Subscribers string      `json:"subscribers"`
+	Images      []Thumbnail `json:"images"`
+	Uri         string      `json:"uri"`
+}
+
+// parseSearchKinds validates a comma separated list like "video,playlist"
+func parseSearchKinds(value string) ([]string, error) {
+	var kinds []string
+	for _, kind := range strings.Split(value, ",") {
+		kind = strings.ToLower(strings.TrimSpace(kind))
+		if kind == "" {
+			continue
+		}
+		if kind == ResultKindAll {
+			return slices.Sorted(slices.Values(searchResultKinds)), nil
+		}
+		if !slices.Contains(searchResultKinds, kind) {
+			return nil, fmt.Errorf("unsupported result type: %s", kind)
+		}
+		if !slices.Contains(kinds, kind) {
+			kinds = append(kinds, kind)
+		}
+	}
+	slices.Sort(kinds)
+	return kinds, nil
+}
+
+func parsePlaylistResult(itemRenderer gjson.Result) (YouTubePlaylistResult, error) {
+	playlistId := itemRenderer.Get("playlistId").String()
+	if playlistId == "" {
+		return YouTubePlaylistResult{}, newParseError("playlistRenderer.playlistId", "missing", "")
+	}
+	return YouTubePlaylistResult{
+		Kind:       ResultKindPlaylist,
+		Identifier: playlistId,
+		Title:      itemRenderer.Get("title.simpleText").String(),
+		Author:     itemRenderer.Get("shortBylineText.runs.0.text").String(),
+		ChannelId: itemRenderer.Get("shortBylineText.runs.0.navigationEndpoint.browseEndpoint.browseId").
+			String(),
+		TrackCount: parseCount(itemRenderer.Get("videoCount").String()),
+		Images:     parseThumbnails(itemRenderer.Get("thumbnails.0.thumbnails")),
+		Uri:        YT_BASE_URL + "/playlist?list=" + playlistId,
+	}, nil
+}
+
+// parsePlaylistLockup reads a playlist from the lockupViewModel that replaced
+// playlistRenderer, the track count is the badge on its thumbnail
+func parsePlaylistLockup(lockup gjson.Result) (YouTubePlaylistResult, error) {
+	playlistId := lockup.Get("contentId").String()
+	if playlistId == "" {
+		return YouTubePlaylistResult{}, newParseError("lockupViewModel.contentId", "missing", "")
+	}
+	thumbnail := lockup.Get("contentImage.collectionThumbnailViewModel.primaryThumbnail.thumbnailViewModel")
+	trackCount := 0
+	for _, overlay := range thumbnail.Get("overlays").Array() {
+		badges := overlay.Get("thumbnailOverlayBadgeViewModel.thumbnailBadges")
+		if !badges.Exists() {
+			badges = overlay.Get("thumbnailBottomOverlayViewModel.badges")
+		}
+		for _, badge := range badges.Array() {
+			if count := parseCount(badge.Get("thumbnailBadgeViewModel.text").String()); count > 0 {
+				trackCount = count
+			}
+		}
+	}
+
+	metadata := lockup.Get("metadata.lockupMetadataViewModel")
+	owner := metadata.Get("metadata.contentMetadataViewModel.metadataRows.0.metadataParts.0.text")
+	return YouTubePlaylistResult{
+		Kind:       ResultKindPlaylist,
+		Identifier: playlistId,
+		Title:      metadata.Get("title.content").String(),
+		Author:     owner.Get("content").String(),
+		ChannelId:  owner.Get("commandRuns.0.onTap.innertubeCommand.browseEndpoint.browseId").String(),
+		TrackCount: trackCount,
+		Images:     parseThumbnails(thumbnail.Get("image.sources")),
+		Uri:        YT_BASE_URL + "/playlist?list=" + playlistId,
+	}, nil
+}
+
+// parseShortsShelf reads a reelShelfRenderer, whose shorts are either
+// reelItemRenderers or the newer shortsLockupViewModels
+func parseShortsShelf(shelf gjson.Result) (YouTubeShortsShelf, error) {
+	result := YouTubeShortsShelf{
+		Kind:   ResultKindShorts,
+		Title:  shelf.Get("title.simpleText").String(),
+		Shorts: make([]YouTubeShort, 0),
+	}
+	if result.Title == "" {
+		result.Title = shelf.Get("title.runs.0.text").String()
+	}
+	for _, item := range shelf.Get("items").Array() {
+		var short YouTubeShort
+		if reel := item.Get("reelItemRenderer"); reel.Exists() {
+			short = YouTubeShort{
+				Identifier: reel.Get("videoId").String(),
+				Title:      reel.Get("headline.simpleText").String(),
+				Views:      reel.Get("viewCountText.simpleText").String(),
+				Images:     parseThumbnails(reel.Get("thumbnail.thumbnails")),
+			}
+		} else if lockup := item.Get("shortsLockupViewModel"); lockup.Exists() {
+			short = YouTubeShort{
+				Identifier: lockup.Get("onTap.innertubeCommand.reelWatchEndpoint.videoId").String(),
+				Title:      lockup.Get("overlayMetadata.primaryText.content").String(),
+				Views:      lockup.Get("overlayMetadata.secondaryText.content").String(),
+				Images:     parseThumbnails(lockup.Get("thumbnail.sources")),
+			}
+		}
+		if short.Identifier == "" {
+			continue
+		}
+		short.Uri = YT_BASE_URL + "/shorts/" + short.Identifier
+		result.Shorts = append(result.Shorts, short)
+	}
+	if len(result.Shorts) == 0 {
+		return YouTubeShortsShelf{}, newParseError("reelShelfRenderer.items", "empty", "")
+	}
+	return result, nil
+}
+
+func parseChannelResult(itemRenderer gjson.Result) (YouTubeChannelResult, error) {
+	channelId := itemRenderer.Get("channelId").String()
+	if channelId == "" {
+		return YouTubeChannelResult{}, newParseError("channelRenderer.channelId", "missing", "")
+	}
+	handle := strings.TrimPrefix(
+		itemRenderer.Get("navigationEndpoint.browseEndpoint.canonicalBaseUrl").String(),
+		"/",
+	)
+	// the subscriber count moved to videoCountText once handles replaced it
+	subscribers := itemRenderer.Get("subscriberCountText.simpleText").String()
+	if strings.HasPrefix(subscribers, "@") {
+		subscribers = itemRenderer.Get("videoCountText.simpleText").String()
+	}
+
+	uri := YT_BASE_URL + "/channel/" + channelId
+	if strings.HasPrefix(handle, "@") {
+		uri = YT_BASE_URL + "/" + handle
+	}
+	return YouTubeChannelResult{
+		Kind:        ResultKindChannel,
+		Identifier:  channelId,
+		Title:       itemRenderer.Get("title.simpleText").String(),
+		Handle:      handle,
+		Subscribers: subscribers,
+		Images:      parseThumbnails(itemRenderer.Get("thumbnail.thumbnails")),
+		Uri:         uri,
+	}, nil
+}
+
+// lockups also stand for videos and podcasts, albums are playlists as well
+func isPlaylistLockup(lockup gjson.Result) bool {
+	switch lockup.Get("contentType").String() {
+	case "LOCKUP_CONTENT_TYPE_PLAYLIST", "LOCKUP_CONTENT_TYPE_ALBUM":
+		return true
+	}
+	return false
+}
+
+func parseSearchResultItem(item gjson.Result, kinds []string, extended bool) (any, error) {
+	switch {
+	case (item.Get("videoRenderer").Exists() || item.Get("movieRenderer").Exists()) &&
+		slices.Contains(kinds, ResultKindVideo):
+		track, err := parseYouTubeTrack(item)
+		if err != nil {
+			return nil, err
+		}
+		if !extended {
+			trimExtendedMetadata(&track)
+		}
+		return YouTubeVideoResult{Kind: ResultKindVideo, YouTubeTrack: track}, nil
+	case item.Get("playlistRenderer").Exists() && slices.Contains(kinds, ResultKindPlaylist):
+		return parsePlaylistResult(item.Get("playlistRenderer"))
+	case isPlaylistLockup(item.Get("lockupViewModel")) && slices.Contains(kinds, ResultKindPlaylist):
+		return parsePlaylistLockup(item.Get("lockupViewModel"))
+	case item.Get("channelRenderer").Exists() && slices.Contains(kinds, ResultKindChannel):
+		return parseChannelResult(item.Get("channelRenderer"))
+	case item.Get("reelShelfRenderer").Exists() && slices.Contains(kinds, ResultKindShorts):
+		return parseShortsShelf(item.Get("reelShelfRenderer"))
+	}
+	return nil, newParseError(rendererName(item), ParseReasonUnsupportedRenderer, "")
+}
+
+func parseYouTubeSearchItems(data []byte, kinds []string, extended bool) ([]any, error) {
+	result := youtubeSearchSections(data).Get("0.itemSectionRenderer.contents")
+	if !result.IsArray() {
+		err := newParseError("itemSectionRenderer.contents", "missing", "")
+		recordParseFailure("youtube_search", err, data)
+		return nil, err
+	}
+
+	items := make([]any, 0)
+	for _, item := range result.Array() {
+		parsed, err := parseSearchResultItem(item, kinds, extended)
+		if err != nil {
+			recordParseFailure("youtube_search", err, data)
+			continue
+		}
+		items = append(items, parsed)
+	}
+	return items, nil
+}
+
+func searchParamsForKinds(kinds []string) string {
+	if len(kinds) != 1 {
+		// several kinds can't be combined in one filter, search unfiltered instead
+		return ""
+	}
+	switch kinds[0] {
+	case ResultKindPlaylist:
+		return YT_PLAYLIST_FILTER_PARAM
+	case ResultKindChannel:
+		return YT_CHANNEL_FILTER_PARAM
+	case ResultKindShorts:
+		// shorts shelves only show up in unfiltered searches
+		return ""
+	}
+	return YT_VIDEO_FILTER_PARAM
+}
+
+// searchYouTubeKinds searches YouTube for the requested result kinds and
+// returns a mixed list where every item carries a kind discriminator
+func (srv *Server) searchYouTubeKinds(
+	ctx context.Context,
+	query string,
+	kinds []string,
+	opts SearchOptions,
+) ([]json.RawMessage, *SpellingCorrection, CacheStatus, error) {
+	options := opts.cacheOptions()
+	options["types"] = strings.Join(kinds, ",")
+	cacheKey := srv.createCacheKey(SearchTypeYouTube, query, options)
+	if srv.db != nil {
+		entry, err := srv.LookupCache(ctx, cacheKey)
+		if err != nil {
+			LoggerFromContext(ctx).Error("Failed to lookup cache", "error", err)
+		} else if entry != nil {
+			var result []json.RawMessage
+			if err := json.Unmarshal(entry.Value, &result); err != nil {
+				LoggerFromContext(ctx).Error("Failed to unmarshal cached search results", "error", err)
+			} else {
+				return result, srv.cachedCorrection(ctx, cacheKey), CacheStatus{Hit: true, StoredAt: entry.StoredAt}, nil
+			}
+		}
+	}
+
+	visitor, err := srv.pickVisitor(ctx, true)
+	if err != nil {
+		return nil, nil, CacheStatus{}, err
+	}
+
+	payload := map[string]any{"context": opts.innertubeContext(visitor.Context), "query": query}
+	if params := opts.params(searchParamsForKinds(kinds)); params != "" {
+		payload["params"] = params
+	}
+
+	var items []any
+	respBody, err := srv.searchPages(ctx, SearchTypeYouTube, visitor, payload, opts.Limit, func(page []byte) (int, error) {
+		pageItems, err := parseYouTubeSearchItems(page, kinds, opts.Extended)
+		items = append(items, pageItems...)
+		return len(pageItems), err
+	})
+	if respBody == nil {
+		return nil, nil, CacheStatus{}, err
+	}
+	recordParse(ctx, "youtube_search_items", len(items), err)
+	if err != nil {
+		return nil, nil, CacheStatus{}, err
+	}
+	correction := parseSpellingCorrection(respBody)
+
+	encoded := make([]json.RawMessage, 0, len(items))
+	for _, item := range items {
+		raw, err := json.Marshal(item)
+		if err != nil {
+			return nil, nil, CacheStatus{}, fmt.Errorf("failed to marshal search item: %w", err)
+		}
+		encoded = append(encoded, raw)
+	}
+
+	if len(encoded) > 0 && srv.db != nil {
+		if err := srv.StoreCache(ctx, cacheKey, encoded); err != nil {
+			LoggerFromContext(ctx).Error("Failed to store search results in cache", "error", err)
+		}
+		if correction != nil {
+			if err := srv.StoreCache(ctx, "correction:"+cacheKey, correction); err != nil {
+				LoggerFromContext(ctx).Error("Failed to store spelling correction in cache", "error", err)
+			}
+		}
+	}
+	return encoded, correction, CacheStatus{}, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const secretFilePrefix = "file:"
+
+var envReferencePattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// resolveSecret expands ${ENV_VAR} references in a config value, or reads
+// the whole value from a file when it is written as file:/path/to/secret
+func resolveSecret(value string) (string, error) {
+	var missing []string
+	value = envReferencePattern.ReplaceAllStringFunc(value, func(reference string) string {
+		name := envReferencePattern.FindStringSubmatch(reference)[1]
+		resolved, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return resolved
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
+	}
+
+	if path, ok := strings.CutPrefix(value, secretFilePrefix); ok {
+		data, err := os.ReadFile(strings.TrimSpace(path))
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret file: %w", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	return value, nil
+}
+
+// resolveSecrets resolves the references of every scalar in a yaml document
+func resolveSecrets(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!str" {
+		resolved, err := resolveSecret(node.Value)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		node.Value = resolved
+		return nil
+	}
+	for _, child := range node.Content {
+		if err := resolveSecrets(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeYAMLWithSecrets decodes data into out after resolving secret references
+func decodeYAMLWithSecrets(data []byte, out any) error {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return err
+	}
+	if err := resolveSecrets(&document); err != nil {
+		return err
+	}
+	if document.Kind == 0 {
+		return nil
+	}
+	return document.Decode(out)
+}
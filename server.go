@@ -3,18 +3,27 @@ package main
 import (
 	"context"
 	"database/sql"
+	"expvar"
+	"fmt"
 	"log/slog"
 	"math/rand/v2"
 	"net"
 	"net/http"
+	"net/http/pprof"
+	"net/netip"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"google.golang.org/grpc"
 	_ "modernc.org/sqlite"
 )
 
 type Server struct {
 	srv        *http.Server
+	adminSrv   *http.Server
+	grpcSrv    *grpc.Server
 	client     *HttpClient
 	visitors   []*YouTubeVisitorData
 	ticker     *time.Ticker
@@ -22,9 +31,44 @@ type Server struct {
 	mu         sync.RWMutex
 	faultCount int
 	db         *sql.DB
+	// cacheShards hold the caches table, the first one is db
+	cacheShards []*sql.DB
+	cacheHits   cacheHitCounter
+	musicbrainz *MusicBrainzClient
+	redis       *RedisClient
+
+	sharedVisitors *RedisVisitorPool
+	leader         *LeaderElector
+	retryBudget    *RetryBudget
+
+	external    *http.Client
+	callbacks   *http.Client
+	tenants     *TenantStore
+	usage       *UsageTracker
+	maintenance atomic.Pointer[maintenanceState]
+
+	anonymousLimiter *keyedRateLimiter
+	trustedProxies   []netip.Prefix
+	configPath       string
+
+	accessLog  *AccessLogger
+	startedAt  time.Time
+	rates      requestRates
+	deepHealth deepHealthState
+
+	playerScript   atomic.Pointer[PlayerScript]
+	playerScriptMu sync.Mutex
+
+	playlistSlots chan struct{}
+	jobSlots      chan struct{}
+	baseCtx       context.Context
 }
 
 func (srv *Server) RandomVisitor(ctx context.Context, isYouTube bool) *YouTubeVisitorData {
+	if srv.sharedVisitors != nil {
+		return srv.randomSharedVisitor(ctx, isYouTube)
+	}
+
 	srv.mu.RLock()
 	needNew := len(srv.visitors) < srv.Cfg.MaxVisitorCount &&
 		srv.faultCount < srv.Cfg.MaxVisitorCount*4
@@ -80,6 +124,10 @@ func (srv *Server) RotateVisitors(ctx context.Context) {
 			slog.Info("Stopping visitor rotation")
 			return
 		case <-srv.ticker.C:
+			if srv.sharedVisitors != nil {
+				// expired shared visitors drop out of redis and are refilled by the sync
+				continue
+			}
 			// Collect expired visitors with read lock
 			srv.mu.RLock()
 			if len(srv.visitors) == 0 {
@@ -112,6 +160,7 @@ func (srv *Server) RotateVisitors(ctx context.Context) {
 			for _, expired := range expiredList {
 				slog.Info("Rotating expired visitor data", slog.Any("visitor", expired.idx))
 				newVisitor, err := srv.fetchInnertubeContext(ctx, expired.isYouTube)
+				recordVisitorRotation(expired.isYouTube, err)
 				if err != nil {
 					slog.Error("Failed to fetch new visitor data", "error", err)
 				} else {
@@ -127,15 +176,25 @@ func (srv *Server) RotateVisitors(ctx context.Context) {
 	}
 }
 
-func (srv *Server) ConnectDb(ctx context.Context) error {
-	slog.Info("Connecting to database", "path", srv.Cfg.Caching.CacheDir)
-	conn, err := sql.Open("sqlite", srv.Cfg.Caching.CacheDir)
+const cacheSchema = `
+	CREATE TABLE IF NOT EXISTS caches (
+		key TEXT PRIMARY KEY,
+		value BLOB,
+		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+		hits INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX IF NOT EXISTS idx_caches_key ON caches (key);`
+
+// openDb opens a sqlite database holding the caches table and the given schema
+func openDb(ctx context.Context, path string, schema string) (*sql.DB, error) {
+	slog.Info("Connecting to database", "path", path)
+	conn, err := sql.Open("sqlite", path)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if err := conn.PingContext(ctx); err != nil {
-		return err
+		return nil, err
 	}
 
 	slog.Info("Connected to database successfully")
@@ -144,44 +203,164 @@ func (srv *Server) ConnectDb(ctx context.Context) error {
 		`PRAGMA journal_mode = WAL; PRAGMA synchronous = NORMAL; PRAGMA busy_timeout = 5000;`,
 	)
 
-	schema := `
-	CREATE TABLE IF NOT EXISTS caches (
-		key TEXT PRIMARY KEY,
-		value BLOB,
-		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP
-	);
-	CREATE INDEX IF NOT EXISTS idx_caches_key ON caches (key);`
+	if _, err := conn.Exec(cacheSchema + schema); err != nil {
+		return nil, err
+	}
+	// databases created before hits were counted
+	if _, err := conn.Exec("ALTER TABLE caches ADD COLUMN hits INTEGER NOT NULL DEFAULT 0"); err != nil &&
+		!strings.Contains(err.Error(), "duplicate column") {
+		return nil, err
+	}
+	return conn, nil
+}
 
-	_, err = conn.Exec(schema)
+func (srv *Server) ConnectDb(ctx context.Context) error {
+	conn, err := openDb(ctx, srv.Cfg.Caching.CacheDir, jobsSchema+usageSchema+auditSchema+leasesSchema+idempotencySchema)
 	if err != nil {
 		return err
 	}
+	srv.cacheShards = []*sql.DB{conn}
+	for i := 1; i < srv.Cfg.Caching.Shards; i++ {
+		shard, err := openDb(ctx, cacheShardPath(srv.Cfg.Caching.CacheDir, i), "")
+		if err != nil {
+			return fmt.Errorf("failed to open cache shard %d: %w", i, err)
+		}
+		srv.cacheShards = append(srv.cacheShards, shard)
+	}
 
-	go srv.EnforceCacheLimit(ctx)
+	// databases created before jobs had an owner
+	if _, err := conn.Exec("ALTER TABLE jobs ADD COLUMN owner TEXT NOT NULL DEFAULT ''"); err != nil &&
+		!strings.Contains(err.Error(), "duplicate column") {
+		return err
+	}
 
 	srv.db = conn
+	if err := srv.recoverJobs(ctx); err != nil {
+		slog.Error("Failed to recover interrupted jobs", "error", err)
+	}
 	return nil
 }
 
+// StartMaintenance starts the cache cleanup, job expiry and cache refresh
+// loops. It runs once the database is connected and the leader elector is
+// set, which the loops ask whether to do their work.
+func (srv *Server) StartMaintenance(ctx context.Context) {
+	if srv.db == nil {
+		return
+	}
+	go srv.EnforceCacheLimit(ctx)
+	go srv.ExpireJobs(ctx)
+	if srv.Cfg.Caching.Refresh.Enabled {
+		go srv.RefreshHotEntries(ctx)
+	}
+}
+
 func (srv *Server) Start(ctx context.Context) {
+	srv.baseCtx = ctx
+	srv.startedAt = time.Now()
+	metrics.OnCollect(srv.collectVisitorMetrics)
+	srv.publishServerVars()
 	mux := http.NewServeMux()
 	mux.HandleFunc("/api/youtube/search", srv.MakeSearchHandler(SearchTypeYouTube))
 	mux.HandleFunc("/api/youtubemusic/search", srv.MakeSearchHandler(SearchTypeYouTubeMusic))
+	mux.HandleFunc("GET /api/youtubemusic/song/{id}", srv.MakeMusicSongHandler())
+	mux.HandleFunc("GET /api/youtubemusic/explore", srv.MakeExploreHandler())
+	mux.HandleFunc("GET /api/youtubemusic/artist", srv.MakeArtistHandler())
+	mux.HandleFunc("POST /api/youtubemusic/isrc", srv.MakeBulkISRCHandler())
+	mux.HandleFunc("/api/youtube/formats", srv.MakeFormatsHandler())
+	mux.HandleFunc("GET /api/youtube/manifest/{file}", srv.MakeManifestHandler())
+	mux.HandleFunc("/api/youtube/available", srv.MakeAvailabilityHandler())
+	mux.HandleFunc("/api/youtube/playlist", srv.MakePlaylistHandler())
+	mux.HandleFunc("GET /api/youtube/playlist/stream", srv.MakePlaylistStreamHandler())
+	mux.HandleFunc("GET /api/youtube/channel", srv.MakeChannelHandler())
+	mux.HandleFunc("/api/youtube/mix", srv.MakeMixHandler())
+	mux.HandleFunc("/api/youtube/related", srv.MakeRelatedHandler())
+	mux.HandleFunc("GET /api/youtube/captions", srv.MakeCaptionsHandler())
+	mux.HandleFunc("GET /api/youtube/storyboards", srv.MakeStoryboardsHandler())
+	mux.HandleFunc("/api/resolve", srv.MakeResolveHandler())
+	mux.HandleFunc("GET /api/loadtracks", srv.MakeLavalinkLoadTracksHandler())
+	mux.HandleFunc("POST /api/equivalent", srv.MakeEquivalentHandler())
+	mux.HandleFunc("/api/batch", srv.MakeBatchHandler())
+	mux.HandleFunc("POST /api/jobs", srv.MakeCreateJobHandler())
+	mux.HandleFunc("GET /api/jobs/{id}", srv.MakeJobStatusHandler())
+	mux.HandleFunc("POST "+rpcPath, srv.MakeRPCHandler())
+	mux.HandleFunc("GET /healthz/deep", srv.MakeDeepHealthHandler())
+	mux.HandleFunc("GET /openapi.json", srv.MakeOpenAPIHandler())
+	if srv.Cfg.OpenAPI.Docs {
+		mux.Handle("GET /docs/", srv.MakeDocsHandler())
+		mux.Handle("GET /docs", http.RedirectHandler("/docs/", http.StatusMovedPermanently))
+	}
+	srv.mountRouteProfiles(mux)
+	handler := PanicRecovery(srv.RequestLogger(srv.CountRequests(srv.Tracing(srv.Maintenance(srv.TenantAuth(srv.DebugIntrospection(srv.ValidateInput(srv.RouteProfiles(srv.Locales(srv.Fields(mux)))))))))))
 	srv.srv = &http.Server{
 		BaseContext: func(l net.Listener) context.Context {
 			return ctx
 		},
 		Addr:    srv.Cfg.ServerAddr,
-		Handler: PanicRecovery(RequestLogger(mux)),
+		Handler: srv.APIVersions(srv.CORS(srv.RequestContext(mux, handler))),
 	}
 	go func() {
 		if err := srv.srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			panic(err)
 		}
 	}()
+	srv.startAdmin(ctx)
+	if srv.Cfg.Grpc.Addr != "" {
+		srv.startGrpc()
+	}
+}
+
+// startAdmin serves the admin endpoints, metrics and pprof on their own
+// listener so they are never reachable through the public address
+func (srv *Server) startAdmin(ctx context.Context) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/usage", srv.AdminAuth(srv.MakeUsageHandler()))
+	mux.HandleFunc("GET /admin/audit", srv.AdminAuth(srv.MakeAuditLogHandler()))
+	mux.HandleFunc("POST /admin/cache/purge", srv.AdminAuth(srv.MakeCachePurgeHandler()))
+	mux.HandleFunc("POST /admin/visitors/rotate", srv.AdminAuth(srv.MakeVisitorRotateHandler()))
+	mux.HandleFunc("POST /admin/config/reload", srv.AdminAuth(srv.MakeConfigReloadHandler()))
+	mux.HandleFunc("POST /admin/maintenance", srv.AdminAuth(srv.MakeMaintenanceHandler()))
+	mux.HandleFunc("GET /debug/status", srv.AdminAuth(srv.MakeStatusPageHandler()))
+
+	guard := func(handler http.HandlerFunc) http.HandlerFunc {
+		if srv.Cfg.Admin.MetricsAuth {
+			return srv.AdminAuth(handler)
+		}
+		return handler
+	}
+	mux.HandleFunc("/metrics", guard(metrics.Handler()))
+	mux.HandleFunc("/debug/vars", guard(expvar.Handler().ServeHTTP))
+	if srv.Cfg.Admin.Pprof {
+		mux.HandleFunc("/debug/pprof/", guard(pprof.Index))
+		mux.HandleFunc("/debug/pprof/cmdline", guard(pprof.Cmdline))
+		mux.HandleFunc("/debug/pprof/profile", guard(pprof.Profile))
+		mux.HandleFunc("/debug/pprof/symbol", guard(pprof.Symbol))
+		mux.HandleFunc("/debug/pprof/trace", guard(pprof.Trace))
+	}
+
+	srv.adminSrv = &http.Server{
+		BaseContext: func(l net.Listener) context.Context {
+			return ctx
+		},
+		Addr:    srv.Cfg.Admin.Addr,
+		Handler: srv.RequestContext(mux, PanicRecovery(srv.RequestLogger(mux))),
+	}
+	go func() {
+		if err := srv.adminSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			panic(err)
+		}
+	}()
 }
 
 func (srv *Server) Stop(ctx context.Context) error {
+	if srv.grpcSrv != nil {
+		srv.stopGrpc(ctx)
+	}
+	if srv.adminSrv != nil {
+		if err := srv.adminSrv.Shutdown(ctx); err != nil {
+			slog.Error("Error shutting down admin server", "error", err)
+		}
+	}
 	if srv.srv == nil {
 		return nil
 	}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+const INNERTUBE_MUSIC_NEXT_API_URL = YT_MUSIC_BASE_URL + "/youtubei/v1/next?prettyPrint=false"
+
+var yearPattern = regexp.MustCompile(`^[0-9]{4}$`)
+
+type MusicRef struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type YouTubeMusicSong struct {
+	YouTubeTrack
+	Album             *MusicRef  `json:"album"`
+	Artists           []MusicRef `json:"artists"`
+	Year              string     `json:"year"`
+	LyricsBrowseId    string     `json:"lyrics_browse_id"`
+	RelatedBrowseId   string     `json:"related_browse_id"`
+	RelatedPlaylistId string     `json:"related_playlist_id"`
+}
+
+// parseSongByline splits the "Artist & Artist • Album • 2020" byline of a
+// watch-next panel item into artists, album and year
+func parseSongByline(runs []gjson.Result, song *YouTubeMusicSong) {
+	segment := 0
+	for _, run := range runs {
+		text := run.Get("text").String()
+		switch strings.TrimSpace(text) {
+		case "•":
+			segment++
+			continue
+		case "&", ",", "":
+			continue
+		}
+
+		browseId := run.Get("navigationEndpoint.browseEndpoint.browseId").String()
+		switch {
+		case strings.HasPrefix(browseId, "MPRE"):
+			song.Album = &MusicRef{Id: browseId, Name: text}
+		case segment == 0:
+			song.Artists = append(song.Artists, MusicRef{Id: browseId, Name: text})
+		case yearPattern.MatchString(text):
+			song.Year = text
+		}
+	}
+}
+
+func parseMusicWatchNext(data []byte, song *YouTubeMusicSong) error {
+	tabs := gjson.GetBytes(data, "contents.singleColumnMusicWatchNextResultsRenderer.tabbedRenderer.watchNextTabbedResultsRenderer.tabs")
+	if !tabs.IsArray() {
+		err := newParseError("watchNextTabbedResultsRenderer.tabs", "missing", "")
+		recordParseFailure("music_next", err, data)
+		return err
+	}
+
+	for _, tab := range tabs.Array() {
+		tabRenderer := tab.Get("tabRenderer")
+		browseId := tabRenderer.Get("endpoint.browseEndpoint.browseId").String()
+		switch {
+		case strings.HasPrefix(browseId, "MPLY") && !tabRenderer.Get("unselectable").Bool():
+			song.LyricsBrowseId = browseId
+		case strings.HasPrefix(browseId, "MPTR"):
+			song.RelatedBrowseId = browseId
+		}
+	}
+
+	items := tabs.Get("0.tabRenderer.content.musicQueueRenderer.content.playlistPanelRenderer.contents")
+	for _, item := range items.Array() {
+		if automix := item.Get("automixPreviewVideoRenderer.content.automixPlaylistVideoRenderer"); automix.Exists() {
+			song.RelatedPlaylistId = automix.Get("navigationEndpoint.watchPlaylistEndpoint.playlistId").String()
+			continue
+		}
+
+		itemRenderer := item.Get("playlistPanelVideoRenderer")
+		if itemRenderer.Get("videoId").String() != song.Identifier {
+			continue
+		}
+		parseSongByline(itemRenderer.Get("longBylineText.runs").Array(), song)
+		if thumbnails := parseThumbnails(itemRenderer.Get("thumbnail.thumbnails")); len(thumbnails) > 0 {
+			song.Images = thumbnails
+		}
+		musicVideoType := itemRenderer.Get(
+			"navigationEndpoint.watchEndpoint.watchEndpointMusicSupportedConfigs.watchEndpointMusicConfig.musicVideoType",
+		).String()
+		if musicVideoType == "MUSIC_VIDEO_TYPE_ATV" {
+			song.Type = "song"
+		}
+	}
+	return nil
+}
+
+// LoadMusicSong combines the player details of a video with the YouTube Music
+// watch-next data that carries its album, artists, lyrics and related content
+func (srv *Server) LoadMusicSong(ctx context.Context, videoId string) (*YouTubeMusicSong, error) {
+	track, err := srv.LoadVideoMetadata(ctx, videoId)
+	if err != nil {
+		return nil, err
+	}
+	if track.Identifier == "" {
+		return nil, fmt.Errorf("video %s not found", videoId)
+	}
+	track.Uri = YT_MUSIC_BASE_URL + "/watch?v=" + videoId
+
+	song := &YouTubeMusicSong{YouTubeTrack: track, Artists: make([]MusicRef, 0)}
+
+	visitor, err := srv.pickVisitor(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := srv.innertubeRequest(ctx, "music next", INNERTUBE_MUSIC_NEXT_API_URL, visitor, map[string]any{
+		"videoId":     videoId,
+		"isAudioOnly": true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := parseMusicWatchNext(respBody, song); err != nil {
+		recordParse(ctx, "music_next", 0, err)
+		return nil, err
+	}
+	recordParse(ctx, "music_next", 1, nil)
+	return song, nil
+}
+
+func (srv *Server) MakeMusicSongHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		videoId := req.PathValue("id")
+		if !DirectVideoIDPattern.MatchString(videoId) {
+			writeError(writer, http.StatusBadRequest, "invalid video id")
+			return
+		}
+
+		song, cacheStatus, err := srv.loadMusicSongCached(req.Context(), videoId)
+		if err != nil {
+			writeError(
+				writer,
+				http.StatusInternalServerError,
+				fmt.Sprintf("Error loading song: %v", err),
+			)
+			return
+		}
+		srv.writeJSON(writer, req, song, cacheStatus)
+	}
+}
+
+// loadMusicSongCached serves a song from the cache, loading and storing it on a miss
+func (srv *Server) loadMusicSongCached(ctx context.Context, videoId string) (*YouTubeMusicSong, CacheStatus, error) {
+	cacheKey := "song:" + videoId
+	if srv.db != nil {
+		entry, err := srv.LookupCache(ctx, cacheKey)
+		if err != nil {
+			LoggerFromContext(ctx).Error("Failed to lookup cache for song", "error", err)
+		} else if entry != nil {
+			var song YouTubeMusicSong
+			if err := json.Unmarshal(entry.Value, &song); err != nil {
+				LoggerFromContext(ctx).Error("Failed to unmarshal cached song", "error", err)
+			} else {
+				return &song, CacheStatus{Hit: true, StoredAt: entry.StoredAt}, nil
+			}
+		}
+	}
+
+	song, err := srv.LoadMusicSong(ctx, videoId)
+	if err != nil {
+		return nil, CacheStatus{}, err
+	}
+
+	if srv.db != nil && !song.Partial {
+		if err := srv.StoreCache(ctx, cacheKey, song); err != nil {
+			LoggerFromContext(ctx).Error("Failed to store song in cache", "error", err)
+		}
+	}
+	return song, CacheStatus{}, nil
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const maxRecentErrors = 50
+
+type recentError struct {
+	Time    time.Time
+	Message string
+	Attrs   string
+}
+
+// errorLog keeps the latest error records for the status page
+type errorLog struct {
+	mu      sync.Mutex
+	entries []recentError
+}
+
+var recentErrors = &errorLog{}
+
+func (log *errorLog) add(entry recentError) {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	log.entries = append(log.entries, entry)
+	if len(log.entries) > maxRecentErrors {
+		log.entries = log.entries[len(log.entries)-maxRecentErrors:]
+	}
+}
+
+// Latest returns the recorded errors, newest first
+func (log *errorLog) Latest() []recentError {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	entries := slices.Clone(log.entries)
+	slices.Reverse(entries)
+	return entries
+}
+
+// recentErrorsHandler records error level records before passing them on
+type recentErrorsHandler struct {
+	slog.Handler
+	attrs []slog.Attr
+}
+
+func (handler *recentErrorsHandler) Handle(ctx context.Context, record slog.Record) error {
+	if record.Level >= slog.LevelError {
+		var attrs []string
+		for _, attr := range handler.attrs {
+			attrs = append(attrs, attr.String())
+		}
+		record.Attrs(func(attr slog.Attr) bool {
+			attrs = append(attrs, attr.String())
+			return true
+		})
+		recentErrors.add(recentError{Time: record.Time, Message: record.Message, Attrs: strings.Join(attrs, " ")})
+	}
+	return handler.Handler.Handle(ctx, record)
+}
+
+func (handler *recentErrorsHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &recentErrorsHandler{
+		Handler: handler.Handler.WithAttrs(attrs),
+		attrs:   append(slices.Clip(handler.attrs), attrs...),
+	}
+}
+
+func (handler *recentErrorsHandler) WithGroup(name string) slog.Handler {
+	return &recentErrorsHandler{Handler: handler.Handler.WithGroup(name), attrs: handler.attrs}
+}
+
+const rateWindowSeconds = 300
+
+// requestRates counts requests and server errors per second over the last five minutes
+type requestRates struct {
+	mu      sync.Mutex
+	seconds [rateWindowSeconds]int64
+	total   [rateWindowSeconds]int
+	errors  [rateWindowSeconds]int
+}
+
+func (rates *requestRates) slot(now int64) int {
+	i := int(now % rateWindowSeconds)
+	if rates.seconds[i] != now {
+		rates.seconds[i] = now
+		rates.total[i] = 0
+		rates.errors[i] = 0
+	}
+	return i
+}
+
+func (rates *requestRates) Record(status int) {
+	rates.mu.Lock()
+	defer rates.mu.Unlock()
+	i := rates.slot(time.Now().Unix())
+	rates.total[i]++
+	if status >= 500 {
+		rates.errors[i]++
+	}
+}
+
+// Over returns the requests and server errors per second of the last window
+func (rates *requestRates) Over(window time.Duration) (float64, float64) {
+	rates.mu.Lock()
+	defer rates.mu.Unlock()
+	seconds := int64(window.Seconds())
+	now := time.Now().Unix()
+	var total, errors int
+	for i := range rates.seconds {
+		if now-rates.seconds[i] < seconds {
+			total += rates.total[i]
+			errors += rates.errors[i]
+		}
+	}
+	return float64(total) / float64(seconds), float64(errors) / float64(seconds)
+}
+
+// CountRequests feeds the request metrics and the rates shown on the status page
+func (srv *Server) CountRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		startedAt := time.Now()
+		recorder := &statusRecorder{ResponseWriter: writer}
+		next.ServeHTTP(recorder, req)
+		srv.rates.Record(recorder.Status())
+		recordRequest(RequestInfoFromContext(req.Context()), recorder.Status(), time.Since(startedAt).Seconds())
+	})
+}
+
+type visitorPoolStatus struct {
+	Type   string
+	Size   int
+	Oldest time.Duration
+}
+
+type statusPage struct {
+	Now         time.Time
+	Uptime      time.Duration
+	Maintenance *maintenanceState
+
+	Visitors    []visitorPoolStatus
+	FaultCount  int
+	FaultLimit  int
+	PoolHealthy bool
+
+	CacheEnabled bool
+	CacheEntries int64
+	CacheBytes   int64
+	CacheOldest  time.Duration
+
+	UpstreamInFlight int
+	UpstreamSlots    int
+	CacheOnly        bool
+
+	Rate1m, Errors1m float64
+	Rate5m, Errors5m float64
+
+	Errors []recentError
+}
+
+func (srv *Server) collectStatus() statusPage {
+	page := statusPage{
+		Now:              time.Now(),
+		Uptime:           time.Since(srv.startedAt).Round(time.Second),
+		Maintenance:      srv.maintenance.Load(),
+		FaultLimit:       srv.Cfg.MaxVisitorCount * 4,
+		CacheEnabled:     srv.db != nil,
+		CacheEntries:     int64(cacheEntries.Value()),
+		CacheBytes:       int64(cacheBytes.Value()),
+		CacheOldest:      time.Duration(cacheEntryAge.Value("oldest")) * time.Second,
+		UpstreamInFlight: len(srv.client.slots),
+		UpstreamSlots:    cap(srv.client.slots),
+		CacheOnly:        srv.client.CacheOnly.Load(),
+		Errors:           recentErrors.Latest(),
+	}
+	page.Rate1m, page.Errors1m = srv.rates.Over(time.Minute)
+	page.Rate5m, page.Errors5m = srv.rates.Over(5 * time.Minute)
+
+	pools := map[bool]*visitorPoolStatus{
+		true:  {Type: visitorType(true)},
+		false: {Type: visitorType(false)},
+	}
+	srv.mu.RLock()
+	for _, visitor := range srv.visitors {
+		pool := pools[visitor.IsYouTube]
+		pool.Size++
+		pool.Oldest = max(pool.Oldest, time.Since(visitor.CreatedAt).Round(time.Second))
+	}
+	page.FaultCount = srv.faultCount
+	srv.mu.RUnlock()
+
+	page.Visitors = []visitorPoolStatus{*pools[true], *pools[false]}
+	page.PoolHealthy = pools[true].Size > 0 && pools[false].Size > 0 && page.FaultCount < page.FaultLimit
+	return page
+}
+
+var statusTemplate = template.Must(template.New("status").Funcs(template.FuncMap{
+	"rate": func(value float64) string { return fmt.Sprintf("%.2f/s", value) },
+	"time": func(value time.Time) string { return value.UTC().Format(time.DateTime) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="10">
+<title>youtube-search status</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { text-align: left; padding: 4px 12px; border-bottom: 1px solid #ddd; }
+.ok { color: #2a7d2a; } .bad { color: #b52a2a; }
+code { font-size: 0.9em; }
+</style>
+</head>
+<body>
+<h1>youtube-search status</h1>
+<p>{{time .Now}} UTC, up {{.Uptime}}{{if and .Maintenance .Maintenance.Enabled}}, <b class="bad">maintenance: {{.Maintenance.Message}}</b>{{end}}</p>
+
+<h2>Visitor pool <span class="{{if .PoolHealthy}}ok">healthy{{else}}bad">degraded{{end}}</span></h2>
+<table>
+<tr><th>Type</th><th>Visitors</th><th>Oldest</th></tr>
+{{range .Visitors}}<tr><td>{{.Type}}</td><td>{{.Size}}</td><td>{{.Oldest}}</td></tr>
+{{end}}</table>
+<p>Fault count {{.FaultCount}} of {{.FaultLimit}}, new visitors are no longer fetched once the limit is reached.</p>
+
+<h2>Cache</h2>
+{{if .CacheEnabled}}<table>
+<tr><th>Entries</th><td>{{.CacheEntries}}</td></tr>
+<tr><th>Stored bytes</th><td>{{.CacheBytes}}</td></tr>
+<tr><th>Oldest entry</th><td>{{.CacheOldest}}</td></tr>
+</table>{{else}}<p>Caching is disabled.</p>{{end}}
+
+<h2>Requests</h2>
+<table>
+<tr><th></th><th>Requests</th><th>Server errors</th></tr>
+<tr><td>Last minute</td><td>{{rate .Rate1m}}</td><td>{{rate .Errors1m}}</td></tr>
+<tr><td>Last 5 minutes</td><td>{{rate .Rate5m}}</td><td>{{rate .Errors5m}}</td></tr>
+</table>
+<p>Upstream requests in flight: {{.UpstreamInFlight}} of {{.UpstreamSlots}}{{if .CacheOnly}}, <b class="bad">cache only mode, upstream requests are disabled by an alert</b>{{end}}</p>
+
+<h2>Recent errors</h2>
+{{if .Errors}}<table>
+<tr><th>Time</th><th>Message</th><th>Details</th></tr>
+{{range .Errors}}<tr><td>{{time .Time}}</td><td>{{.Message}}</td><td><code>{{.Attrs}}</code></td></tr>
+{{end}}</table>{{else}}<p>No errors logged since start.</p>{{end}}
+</body>
+</html>
+`))
+
+func (srv *Server) MakeStatusPageHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+		writer.Header().Set("Cache-Control", "no-store")
+		if err := statusTemplate.Execute(writer, srv.collectStatus()); err != nil {
+			LoggerFromContext(req.Context()).Error("Failed to render status page", "error", err)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+type StoryboardLevel struct {
+	Level int `json:"level"`
+	// Width and Height are the size of one thumbnail tile
+	Width      int `json:"width"`
+	Height     int `json:"height"`
+	Count      int `json:"count"`
+	Columns    int `json:"columns"`
+	Rows       int `json:"rows"`
+	IntervalMs int `json:"interval_ms"`
+	// Sheets hold Columns x Rows tiles each, the last one may be partly empty
+	Sheets []string `json:"sheets"`
+}
+
+type Storyboards struct {
+	VideoId string            `json:"video_id"`
+	Levels  []StoryboardLevel `json:"levels"`
+}
+
+// parseStoryboardSpec decodes a storyboard spec, a url template followed by
+// one width#height#count#columns#rows#interval#name#sigh part per level:
+//
+//	https://i.ytimg.com/sb/<id>/storyboard3_L$L/$N.jpg?sqp=...|48#27#100#10#10#0#default#rs$...|80#45#...#M$M#rs$...
+//
+// $L is the level, $N the name and $M in a name the sheet index. Levels that
+// leave the interval at 0 spread their thumbnails evenly over the video.
+func parseStoryboardSpec(spec string, durationMs int64) ([]StoryboardLevel, error) {
+	parts := strings.Split(spec, "|")
+	if len(parts) < 2 || !strings.HasPrefix(parts[0], "http") {
+		return nil, newParseError("playerStoryboardSpecRenderer.spec", "invalid", spec)
+	}
+	template := parts[0]
+
+	levels := make([]StoryboardLevel, 0, len(parts)-1)
+	for i, part := range parts[1:] {
+		fields := strings.Split(part, "#")
+		if len(fields) < 8 {
+			return nil, newParseError("playerStoryboardSpecRenderer.spec", "invalid level", part)
+		}
+		numbers := make([]int, 6)
+		for j := range numbers {
+			number, err := strconv.Atoi(fields[j])
+			if err != nil {
+				return nil, newParseError("playerStoryboardSpecRenderer.spec", "invalid level", part)
+			}
+			numbers[j] = number
+		}
+		level := StoryboardLevel{
+			Level:      i,
+			Width:      numbers[0],
+			Height:     numbers[1],
+			Count:      numbers[2],
+			Columns:    numbers[3],
+			Rows:       numbers[4],
+			IntervalMs: numbers[5],
+		}
+		if level.IntervalMs == 0 && level.Count > 0 {
+			level.IntervalMs = int(durationMs / int64(level.Count))
+		}
+
+		name, sigh := fields[6], fields[7]
+		base := strings.ReplaceAll(template, "$L", strconv.Itoa(i))
+		perSheet := level.Columns * level.Rows
+		sheets := 1
+		if perSheet > 0 && strings.Contains(name, "$M") {
+			sheets = (level.Count + perSheet - 1) / perSheet
+		}
+		level.Sheets = make([]string, 0, sheets)
+		for sheet := 0; sheet < sheets; sheet++ {
+			sheetUrl := strings.ReplaceAll(base, "$N", strings.ReplaceAll(name, "$M", strconv.Itoa(sheet)))
+			level.Sheets = append(level.Sheets, sheetUrl+"&sigh="+sigh)
+		}
+		levels = append(levels, level)
+	}
+	return levels, nil
+}
+
+func parseStoryboards(videoId string, data []byte) (*Storyboards, error) {
+	if status := gjson.GetBytes(data, "playabilityStatus.status").String(); status != "OK" {
+		return nil, fmt.Errorf(
+			"video is not playable: %s",
+			gjson.GetBytes(data, "playabilityStatus.reason").String(),
+		)
+	}
+
+	storyboards := &Storyboards{VideoId: videoId, Levels: make([]StoryboardLevel, 0)}
+	// live streams only have a spec for the current live frame, short or
+	// fresh uploads none at all
+	spec := gjson.GetBytes(data, "storyboards.playerStoryboardSpecRenderer.spec").String()
+	if spec == "" {
+		return storyboards, nil
+	}
+	durationMs := gjson.GetBytes(data, "videoDetails.lengthSeconds").Int() * 1000
+	levels, err := parseStoryboardSpec(spec, durationMs)
+	if err != nil {
+		recordParseFailure("player", err, data)
+		return nil, err
+	}
+	storyboards.Levels = levels
+	return storyboards, nil
+}
+
+func (srv *Server) LoadStoryboards(ctx context.Context, videoId string) (*Storyboards, error) {
+	respBody, err := srv.playerRequest(ctx, videoId)
+	if err != nil {
+		return nil, err
+	}
+	storyboards, err := parseStoryboards(videoId, respBody)
+	if err != nil {
+		recordParse(ctx, "storyboards", 0, err)
+		return nil, err
+	}
+	recordParse(ctx, "storyboards", len(storyboards.Levels), nil)
+	return storyboards, nil
+}
+
+func (srv *Server) MakeStoryboardsHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		videoId := strings.TrimSpace(req.FormValue("videoId"))
+		if !DirectVideoIDPattern.MatchString(videoId) {
+			writeValidationError(writer, &ValidationError{
+				Code:    "invalid_video_id",
+				Param:   "videoId",
+				Message: "a valid videoId parameter is required",
+			})
+			return
+		}
+
+		// the sheet urls are signed, so like stream formats they are never cached
+		storyboards, err := srv.LoadStoryboards(req.Context(), videoId)
+		if err != nil {
+			writeError(writer, http.StatusInternalServerError, fmt.Sprintf("Error loading storyboards: %v", err))
+			return
+		}
+		srv.writeJSON(writer, req, storyboards, CacheStatus{})
+	}
+}
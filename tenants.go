@@ -0,0 +1,517 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const TenantContextKey ctxKey = "tenant"
+
+type TenantRateLimit struct {
+	RequestsPerMinute int `yaml:"requests_per_minute"`
+	Burst             int `yaml:"burst"`
+}
+
+type TenantConcurrency struct {
+	MaxInFlight    int `yaml:"max_in_flight"`
+	MaxQueued      int `yaml:"max_queued"`
+	QueueTimeoutMs int `yaml:"queue_timeout_ms"`
+}
+
+type TenantFilters struct {
+	ExcludeLive     bool     `yaml:"exclude_live"`
+	MinLengthMs     int      `yaml:"min_length_ms"`
+	MaxLengthMs     int      `yaml:"max_length_ms"`
+	BlockedChannels []string `yaml:"blocked_channels"`
+}
+
+type TenantConfig struct {
+	Name             string            `yaml:"name"`
+	Key              string            `yaml:"key"`
+	Region           string            `yaml:"region"`
+	CacheNamespace   string            `yaml:"cache_namespace"`
+	AllowedEndpoints []string          `yaml:"allowed_endpoints"`
+	RateLimit        TenantRateLimit   `yaml:"rate_limit"`
+	Concurrency      TenantConcurrency `yaml:"concurrency"`
+	Quota            TenantQuota       `yaml:"quota"`
+	Filters          TenantFilters     `yaml:"filters"`
+}
+
+type AuthConfig struct {
+	Enabled        bool           `yaml:"enabled"`
+	AllowAnonymous bool           `yaml:"allow_anonymous"`
+	KeysFile       string         `yaml:"keys_file"`
+	ReloadInterval int            `yaml:"reload_interval"`
+	Tenants        []TenantConfig `yaml:"tenants"`
+	// Keys are plain api keys for setups that need no policy per key, each
+	// becomes a tenant with the defaults
+	Keys []string `yaml:"keys"`
+	// DefaultRateLimit applies to keys without a rate_limit of their own, a
+	// negative requests_per_minute on a key leaves it unlimited
+	DefaultRateLimit TenantRateLimit `yaml:"default_rate_limit"`
+}
+
+type Tenant struct {
+	TenantConfig
+	limiter  *tokenBucket
+	inFlight *concurrencyLimiter
+}
+
+func (tenant *Tenant) Allows(path string) bool {
+	if len(tenant.AllowedEndpoints) == 0 {
+		return true
+	}
+	for _, endpoint := range tenant.AllowedEndpoints {
+		if path == endpoint || strings.HasPrefix(path, strings.TrimSuffix(endpoint, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (tenant *Tenant) Keep(track YouTubeTrack) bool {
+	return tenant.Filters.Keep(track)
+}
+
+func (filters TenantFilters) Keep(track YouTubeTrack) bool {
+	switch {
+	case filters.ExcludeLive && track.IsLive:
+		return false
+	case filters.MinLengthMs > 0 && track.Length < filters.MinLengthMs:
+		return false
+	case filters.MaxLengthMs > 0 && track.Length > filters.MaxLengthMs:
+		return false
+	case slices.Contains(filters.BlockedChannels, track.ChannelId):
+		return false
+	}
+	return true
+}
+
+func TenantFromContext(ctx context.Context) *Tenant {
+	tenant, _ := ctx.Value(TenantContextKey).(*Tenant)
+	return tenant
+}
+
+// TenantStore holds the tenants of the config merged with the keys file,
+// which is reloaded whenever it changes on disk
+type TenantStore struct {
+	mu       sync.RWMutex
+	reloadMu sync.Mutex
+	tenants  map[string]*Tenant
+	static   []TenantConfig
+	keysFile string
+	modTime  time.Time
+	// defaultRateLimit is given to tenants without a rate limit
+	defaultRateLimit TenantRateLimit
+}
+
+func readKeysFile(path string) ([]TenantConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keys file: %w", err)
+	}
+	var keys struct {
+		Tenants []TenantConfig `yaml:"tenants"`
+	}
+	if err := decodeYAMLWithSecrets(data, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse keys file: %w", err)
+	}
+	return keys.Tenants, nil
+}
+
+// staticTenants are the tenants of the config, followed by the plain keys
+func staticTenants(cfg AuthConfig) []TenantConfig {
+	tenants := slices.Clone(cfg.Tenants)
+	for i, key := range cfg.Keys {
+		tenants = append(tenants, TenantConfig{Name: fmt.Sprintf("key-%d", i+1), Key: key})
+	}
+	return tenants
+}
+
+func NewTenantStore(cfg AuthConfig) (*TenantStore, error) {
+	store := &TenantStore{static: staticTenants(cfg), keysFile: cfg.KeysFile, defaultRateLimit: cfg.DefaultRateLimit}
+	if err := store.Reload(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+func (store *TenantStore) Reload() error {
+	store.reloadMu.Lock()
+	defer store.reloadMu.Unlock()
+
+	configs := slices.Clone(store.static)
+	if store.keysFile != "" {
+		info, err := os.Stat(store.keysFile)
+		if err != nil {
+			return fmt.Errorf("failed to stat keys file: %w", err)
+		}
+		fileTenants, err := readKeysFile(store.keysFile)
+		if err != nil {
+			return err
+		}
+		configs = append(configs, fileTenants...)
+		store.modTime = info.ModTime()
+	}
+
+	store.mu.RLock()
+	previous := store.tenants
+	store.mu.RUnlock()
+
+	tenants := make(map[string]*Tenant, len(configs))
+	// jobs, idempotency keys and usage belong to a tenant by name, two tenants
+	// sharing one would see each other's
+	names := make(map[string]bool, len(configs))
+	for i, cfg := range configs {
+		if cfg.Key == "" {
+			return fmt.Errorf("tenant %d (%s) has no key", i, cfg.Name)
+		}
+		if _, ok := tenants[cfg.Key]; ok {
+			return fmt.Errorf("duplicate api key for tenant %s", cfg.Name)
+		}
+		if cfg.Name == "" {
+			cfg.Name = fmt.Sprintf("tenant-%d", i)
+		}
+		if names[cfg.Name] {
+			return fmt.Errorf("duplicate tenant name %s, names must be unique", cfg.Name)
+		}
+		names[cfg.Name] = true
+		// fill in only what the tenant left unset, so a tenant setting just a
+		// burst keeps it
+		if cfg.RateLimit.RequestsPerMinute == 0 {
+			cfg.RateLimit.RequestsPerMinute = store.defaultRateLimit.RequestsPerMinute
+		}
+		if cfg.RateLimit.Burst == 0 {
+			cfg.RateLimit.Burst = store.defaultRateLimit.Burst
+		}
+		tenant := &Tenant{TenantConfig: cfg}
+		// keep the bucket across reloads so editing the file doesn't reset limits
+		if old, ok := previous[cfg.Key]; ok && old.RateLimit == cfg.RateLimit {
+			tenant.limiter = old.limiter
+		} else if cfg.RateLimit.RequestsPerMinute > 0 {
+			tenant.limiter = newTokenBucket(cfg.RateLimit.RequestsPerMinute, cfg.RateLimit.Burst)
+		}
+		if old, ok := previous[cfg.Key]; ok && old.Concurrency == cfg.Concurrency {
+			tenant.inFlight = old.inFlight
+		} else if cfg.Concurrency.MaxInFlight > 0 {
+			timeout := time.Duration(cfg.Concurrency.QueueTimeoutMs) * time.Millisecond
+			if timeout <= 0 {
+				timeout = 5 * time.Second
+			}
+			tenant.inFlight = newConcurrencyLimiter(cfg.Concurrency.MaxInFlight, cfg.Concurrency.MaxQueued, timeout)
+		}
+		tenants[cfg.Key] = tenant
+	}
+
+	store.mu.Lock()
+	store.tenants = tenants
+	store.mu.Unlock()
+	slog.Info("Loaded API keys", "tenants", len(tenants))
+	if len(tenants) == 0 {
+		slog.Warn("No API keys configured, every api request without a key is refused unless auth.allow_anonymous is set")
+	}
+	return nil
+}
+
+// SetStatic replaces the tenants and the default rate limit taken from the
+// config file
+func (store *TenantStore) SetStatic(cfg AuthConfig) error {
+	store.reloadMu.Lock()
+	store.static = staticTenants(cfg)
+	store.defaultRateLimit = cfg.DefaultRateLimit
+	store.reloadMu.Unlock()
+	return store.Reload()
+}
+
+func (store *TenantStore) keysFileChanged(modTime time.Time) bool {
+	store.reloadMu.Lock()
+	defer store.reloadMu.Unlock()
+	if modTime.Equal(store.modTime) {
+		return false
+	}
+	store.modTime = modTime
+	return true
+}
+
+func (store *TenantStore) Lookup(key string) *Tenant {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	return store.tenants[key]
+}
+
+func (store *TenantStore) WatchKeysFile(ctx context.Context, interval time.Duration) {
+	if store.keysFile == "" {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(store.keysFile)
+			if err != nil {
+				slog.Error("Failed to stat keys file", "path", store.keysFile, "error", err)
+				continue
+			}
+			if !store.keysFileChanged(info.ModTime()) {
+				continue
+			}
+			// a broken file keeps the previous keys active
+			if err := store.Reload(); err != nil {
+				slog.Error("Failed to reload keys file", "path", store.keysFile, "error", err)
+			}
+		}
+	}
+}
+
+var errMissingApiKey = errors.New("missing api key")
+
+// isApiPath tells the paths of the public api, the /api endpoints and the
+// JSON-RPC endpoint
+func isApiPath(path string) bool {
+	return strings.HasPrefix(path, "/api/") || path == rpcPath
+}
+
+func apiKeyFromRequest(req *http.Request) string {
+	if key := req.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if auth := req.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return req.URL.Query().Get("api_key")
+}
+
+// loggedUrl is the request uri as written to logs, with an api key passed in
+// the query string redacted
+func loggedUrl(req *http.Request) string {
+	query := req.URL.Query()
+	if !query.Has("api_key") {
+		return req.URL.RequestURI()
+	}
+	query.Set("api_key", "REDACTED")
+	redacted := *req.URL
+	redacted.RawQuery = query.Encode()
+	return redacted.RequestURI()
+}
+
+// ChargedCallsContextKey marks the requests whose calls are charged one by
+// one with chargeCall
+const ChargedCallsContextKey ctxKey = "chargedCalls"
+
+var (
+	errCallRateLimited = errors.New("rate limit exceeded")
+	errCallConcurrency = errors.New("too many concurrent requests for this api key")
+	errCallQuota       = errors.New("quota exceeded")
+)
+
+// isBatchPath tells the endpoints running several calls per request, which
+// are charged per call instead of per request
+func isBatchPath(path string) bool {
+	return path == "/api/batch" || path == "/api/youtubemusic/isrc" || path == rpcPath
+}
+
+// chargeCall charges one call of a batch request against the rate limit,
+// concurrency cap and quotas of its tenant, the way TenantAuth charges any
+// other request. release gives the concurrency slot back once the call is done.
+func (srv *Server) chargeCall(ctx context.Context) (release func(), err error) {
+	tenant := TenantFromContext(ctx)
+	if tenant == nil || ctx.Value(ChargedCallsContextKey) == nil {
+		return func() {}, nil
+	}
+	if tenant.limiter != nil && !tenant.limiter.Take().Allowed {
+		return nil, errCallRateLimited
+	}
+	release = func() {}
+	if tenant.inFlight != nil {
+		if !tenant.inFlight.Acquire(ctx) {
+			return nil, errCallConcurrency
+		}
+		release = tenant.inFlight.Release
+	}
+	if !srv.reserveRequest(ctx, http.Header{}, tenant) {
+		release()
+		return nil, errCallQuota
+	}
+	srv.addUsage(context.WithoutCancel(ctx), tenant, 1, 0)
+	return release, nil
+}
+
+// TenantAuth resolves the api key of api requests into a tenant, enforcing
+// its allowed endpoints, rate limit, concurrency cap and quotas before the
+// handler runs. Requests without a tenant are rate limited per client ip.
+// Batch requests are charged per call instead, see chargeCall.
+func (srv *Server) TenantAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		if !isApiPath(req.URL.Path) {
+			next.ServeHTTP(writer, req)
+			return
+		}
+
+		key := apiKeyFromRequest(req)
+		if srv.tenants == nil || (key == "" && srv.Cfg.Auth.AllowAnonymous) {
+			if srv.anonymousLimiter != nil {
+				client := clientAddr(req, srv.trustedProxies)
+				status := srv.anonymousLimiter.Take(clientBucketKey(client, srv.Cfg.AnonymousRateLimit.Ipv6Prefix))
+				status.WriteHeaders(writer.Header())
+				if !status.Allowed {
+					writeError(writer, http.StatusTooManyRequests, "rate limit exceeded")
+					return
+				}
+			}
+			next.ServeHTTP(writer, req)
+			return
+		}
+		if key == "" {
+			writeError(writer, http.StatusUnauthorized, errMissingApiKey.Error())
+			return
+		}
+		tenant := srv.tenants.Lookup(key)
+		if tenant == nil {
+			writeError(writer, http.StatusUnauthorized, "invalid api key")
+			return
+		}
+		// the calls of a JSON-RPC request are checked one by one
+		if req.URL.Path != rpcPath && !tenant.Allows(req.URL.Path) {
+			writeError(writer, http.StatusForbidden, "endpoint not allowed for this api key")
+			return
+		}
+		batch := isBatchPath(req.URL.Path)
+		if tenant.limiter != nil && !batch {
+			status := tenant.limiter.Take()
+			status.WriteHeaders(writer.Header())
+			if !status.Allowed {
+				writeError(writer, http.StatusTooManyRequests, "rate limit exceeded")
+				return
+			}
+		}
+
+		if tenant.inFlight != nil && !batch {
+			if !tenant.inFlight.Acquire(req.Context()) {
+				writer.Header().Set("Retry-After", "1")
+				writeError(writer, http.StatusTooManyRequests, "too many concurrent requests for this api key")
+				return
+			}
+			defer tenant.inFlight.Release()
+		}
+		if !batch && !srv.reserveRequest(req.Context(), writer.Header(), tenant) {
+			writeError(writer, http.StatusTooManyRequests, "quota exceeded")
+			return
+		}
+
+		SpanFromContext(req.Context()).SetAttr(slog.String("tenant", tenant.Name))
+		RequestInfoFromContext(req.Context()).Tenant = tenant.Name
+		var upstreamCalls atomic.Int64
+		ctx := withUpstreamCounter(context.WithValue(req.Context(), TenantContextKey, tenant), &upstreamCalls)
+		ctx = withLogger(ctx, LoggerFromContext(ctx).With("tenant", tenant.Name))
+		if batch {
+			ctx = context.WithValue(ctx, ChargedCallsContextKey, true)
+			next.ServeHTTP(writer, req.WithContext(ctx))
+			// the calls were counted as requests when they were charged
+			srv.addUsage(context.WithoutCancel(ctx), tenant, 0, upstreamCalls.Load())
+			return
+		}
+		next.ServeHTTP(writer, req.WithContext(ctx))
+		srv.recordUsage(context.WithoutCancel(ctx), tenant, upstreamCalls.Load())
+	})
+}
+
+// tenantCacheKey keeps cache entries of tenants with a namespace, of route
+// profiles and tenants searching another region and of requests asking for a
+// locale apart
+func tenantCacheKey(ctx context.Context, key string) string {
+	if locale := LocaleFromContext(ctx); locale != nil {
+		key = "locale:" + locale.Hl + ":" + locale.Gl + ":" + key
+	}
+	if profile := RouteProfileFromContext(ctx); profile != nil && profile.Region != "" {
+		key = "profile:" + profile.Name + ":" + key
+	}
+	tenant := TenantFromContext(ctx)
+	if tenant == nil {
+		return key
+	}
+	if tenant.Region != "" {
+		key = "region:" + strings.ToUpper(tenant.Region) + ":" + key
+	}
+	if tenant.CacheNamespace != "" {
+		return tenant.CacheNamespace + ":" + key
+	}
+	return key
+}
+
+// errFilteredOut answers a request for a single track the tenant or the route
+// profile filters out
+var errFilteredOut = errors.New("filtered out for this api key")
+
+// applyTenantFilters drops the tracks the tenant or the route profile filters
+// out of a response value. A value that is a single track, a resolved track
+// or an isrc match is returned as nil when its track is filtered out.
+func applyTenantFilters(ctx context.Context, value any) any {
+	tenant := TenantFromContext(ctx)
+	profile := RouteProfileFromContext(ctx)
+	if tenant == nil && profile == nil {
+		return value
+	}
+	keep := func(track YouTubeTrack) bool {
+		return (tenant == nil || tenant.Keep(track)) && (profile == nil || profile.Filters.Keep(track))
+	}
+	filter := func(tracks []YouTubeTrack) []YouTubeTrack {
+		return slices.DeleteFunc(slices.Clone(tracks), func(track YouTubeTrack) bool {
+			return !keep(track)
+		})
+	}
+	switch typed := value.(type) {
+	case []YouTubeTrack:
+		return filter(typed)
+	case YouTubeTrack:
+		if !keep(typed) {
+			return nil
+		}
+	case *YouTubePlaylist:
+		if typed == nil {
+			return value
+		}
+		filtered := *typed
+		filtered.Tracks = filter(typed.Tracks)
+		return &filtered
+	case *ISRCMatch:
+		if typed != nil && !keep(typed.Track) {
+			return nil
+		}
+	case *ResolveResult:
+		if typed == nil {
+			return value
+		}
+		if typed.Track != nil && !keep(*typed.Track) {
+			return nil
+		}
+		filtered := *typed
+		if typed.Playlist != nil {
+			filtered.Playlist = applyTenantFilters(ctx, typed.Playlist).(*YouTubePlaylist)
+		}
+		return &filtered
+	case []json.RawMessage:
+		// search results of several kinds, only videos are tracks
+		return slices.DeleteFunc(slices.Clone(typed), func(item json.RawMessage) bool {
+			var video YouTubeVideoResult
+			if err := json.Unmarshal(item, &video); err != nil || video.Kind != ResultKindVideo {
+				return false
+			}
+			return !keep(video.YouTubeTrack)
+		})
+	}
+	return value
+}
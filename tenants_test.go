@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rickAstley is the channel of the mock tracks the filter tests block
+const rickAstley = "UCuAXFkgsw1L7xaCfnd5JJOw"
+
+// newMockServer builds a server answering upstream requests from mockdata
+func newMockServer(t *testing.T, config string) *Server {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("max_visitor_count: 4\n"+config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := ReadConfig(path)
+	if err != nil {
+		t.Fatalf("failed to read config: %v", err)
+	}
+	srv := &Server{
+		Cfg:           cfg,
+		baseCtx:       t.Context(),
+		playlistSlots: make(chan struct{}, cfg.Playlist.MaxConcurrentLoads),
+		jobSlots:      make(chan struct{}, cfg.Jobs.MaxRunning),
+	}
+	srv.client = NewHttpClient(cfg.RequestTimeout, "", cfg.MaxUpstreamConcurrency)
+	srv.client.Transport = MockTransport{}
+	if cfg.Caching.Enabled {
+		if err := srv.ConnectDb(t.Context()); err != nil {
+			t.Fatalf("failed to connect database: %v", err)
+		}
+		t.Cleanup(func() { _ = srv.db.Close() })
+	}
+	return srv
+}
+
+// filteredRequest is a request of a tenant blocking rickAstley and live streams
+func filteredRequest(method string, target string, body string) *http.Request {
+	tenant := &Tenant{TenantConfig: TenantConfig{
+		Name:    "filtered",
+		Filters: TenantFilters{ExcludeLive: true, BlockedChannels: []string{rickAstley}},
+	}}
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	return req.WithContext(context.WithValue(req.Context(), TenantContextKey, tenant))
+}
+
+func serve(handler http.HandlerFunc, req *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	handler(recorder, req)
+	return recorder
+}
+
+func decodeBody[T any](t *testing.T, recorder *httptest.ResponseRecorder) T {
+	t.Helper()
+	var value T
+	if err := json.Unmarshal(recorder.Body.Bytes(), &value); err != nil {
+		t.Fatalf("invalid response %q: %v", recorder.Body.String(), err)
+	}
+	return value
+}
+
+// checkBatchResults expects a search item without blocked tracks followed by
+// items whose single track is filtered out
+func checkBatchResults(t *testing.T, response BatchResponse) {
+	t.Helper()
+	search, _ := json.Marshal(response.Results[0].Data)
+	var tracks []YouTubeTrack
+	if err := json.Unmarshal(search, &tracks); err != nil || len(tracks) == 0 {
+		t.Fatalf("search item = %s, want tracks", search)
+	}
+	for _, track := range tracks {
+		if track.ChannelId == rickAstley {
+			t.Errorf("search item kept blocked track %s", track.Identifier)
+		}
+	}
+	for _, result := range response.Results[1:] {
+		if result.Code != http.StatusNotFound || result.Error != errFilteredOut.Error() {
+			t.Errorf("item %d = %d %q, want it filtered out", result.Index, result.Code, result.Error)
+		}
+	}
+}
+
+const filteredBatch = `{"items": [
+	{"type": "youtubemusic", "query": "never gonna give you up"},
+	{"type": "resolve", "query": "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+	{"type": "isrc", "query": "GBARL8700001"}
+]}`
+
+func TestTenantFiltersBatch(t *testing.T) {
+	srv := newMockServer(t, "")
+	recorder := serve(srv.MakeBatchHandler(), filteredRequest(http.MethodPost, "/api/batch", filteredBatch))
+	checkBatchResults(t, decodeBody[BatchResponse](t, recorder))
+}
+
+func TestTenantFiltersJob(t *testing.T) {
+	srv := newMockServer(t, "caching:\n  enabled: true\n  cache_dir: "+filepath.Join(t.TempDir(), "cache.db")+"\n")
+	body := strings.Replace(filteredBatch, "{", `{"type": "batch",`, 1)
+	created := serve(srv.MakeCreateJobHandler(), filteredRequest(http.MethodPost, "/api/jobs", body))
+	if created.Code != http.StatusAccepted {
+		t.Fatalf("create job = %d %s", created.Code, created.Body)
+	}
+	job := decodeBody[Job](t, created)
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		req := filteredRequest(http.MethodGet, "/api/jobs/"+job.Id, "")
+		req.SetPathValue("id", job.Id)
+		status := decodeBody[Job](t, serve(srv.MakeJobStatusHandler(), req))
+		if status.Status == JobStatusDone {
+			var response BatchResponse
+			if err := json.Unmarshal(status.Result, &response); err != nil {
+				t.Fatalf("invalid job result: %v", err)
+			}
+			checkBatchResults(t, response)
+			return
+		}
+		if status.Status == JobStatusFailed || time.Now().After(deadline) {
+			t.Fatalf("job ended as %s: %s", status.Status, status.Error)
+		}
+	}
+}
+
+func TestTenantFiltersBulkISRC(t *testing.T) {
+	srv := newMockServer(t, "")
+	req := filteredRequest(http.MethodPost, "/api/youtubemusic/isrc", `{"items": [{"isrc": "GBARL8700001"}]}`)
+	response := decodeBody[BatchResponse](t, serve(srv.MakeBulkISRCHandler(), req))
+	if len(response.Results) != 1 || response.Results[0].Code != http.StatusNotFound {
+		t.Errorf("results = %+v, want the match filtered out", response.Results)
+	}
+}
+
+func TestTenantFiltersResolve(t *testing.T) {
+	srv := newMockServer(t, "")
+	req := filteredRequest(http.MethodGet, "/api/resolve?url=https://www.youtube.com/watch?v=dQw4w9WgXcQ", "")
+	if recorder := serve(srv.MakeResolveHandler(), req); recorder.Code != http.StatusNotFound {
+		t.Errorf("resolve = %d %s, want 404", recorder.Code, recorder.Body)
+	}
+
+	call := `{"jsonrpc": "2.0", "id": 1, "method": "resolve", "params": {"url": "https://youtu.be/dQw4w9WgXcQ"}}`
+	response := decodeBody[RPCResponse](t, serve(srv.MakeRPCHandler(), filteredRequest(http.MethodPost, rpcPath, call)))
+	if response.Error == nil || response.Error.Code != RPCFilteredOut {
+		t.Errorf("rpc resolve = %+v, want error %d", response, RPCFilteredOut)
+	}
+}
+
+func TestTenantFiltersSearchKinds(t *testing.T) {
+	srv := newMockServer(t, "")
+	req := filteredRequest(http.MethodGet, "/api/youtube/search?query=lofi&types=video,channel", "")
+	items := decodeBody[[]map[string]any](t, serve(srv.MakeSearchHandler(SearchTypeYouTube), req))
+
+	var videos, channels int
+	for _, item := range items {
+		switch item["kind"] {
+		case ResultKindVideo:
+			videos++
+			if item["channel_id"] == rickAstley || item["is_live"] == true {
+				t.Errorf("kept filtered video %v", item["identifier"])
+			}
+		case ResultKindChannel:
+			channels++
+		}
+	}
+	if videos == 0 || channels == 0 {
+		t.Errorf("got %d videos and %d channels, want both kept", videos, channels)
+	}
+}
+
+func TestTenantStoreRejectsDuplicateNames(t *testing.T) {
+	for name, cfg := range map[string]AuthConfig{
+		"explicit": {Tenants: []TenantConfig{{Name: "acme", Key: "a"}, {Name: "acme", Key: "b"}}},
+		"default":  {Tenants: []TenantConfig{{Key: "a"}, {Name: "tenant-0", Key: "b"}}},
+		"keys":     {Tenants: []TenantConfig{{Name: "key-1", Key: "a"}}, Keys: []string{"b"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewTenantStore(cfg); err == nil || !strings.Contains(err.Error(), "duplicate tenant name") {
+				t.Errorf("got %v, want a duplicate tenant name error", err)
+			}
+		})
+	}
+}
+
+func TestTenantChargesBatchCalls(t *testing.T) {
+	srv := newMockServer(t, "")
+	tenants, err := NewTenantStore(AuthConfig{Tenants: []TenantConfig{{
+		Name:      "limited",
+		Key:       "secret",
+		RateLimit: TenantRateLimit{RequestsPerMinute: 1, Burst: 4},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.tenants, srv.usage = tenants, NewUsageTracker()
+
+	// the batch takes three of the four tokens, leaving one of the rpc calls
+	req := httptest.NewRequest(http.MethodPost, "/api/batch", strings.NewReader(filteredBatch))
+	req.Header.Set("X-API-Key", "secret")
+	recorder := httptest.NewRecorder()
+	srv.TenantAuth(srv.MakeBatchHandler()).ServeHTTP(recorder, req)
+	for _, result := range decodeBody[BatchResponse](t, recorder).Results {
+		if result.Code == http.StatusTooManyRequests {
+			t.Errorf("item %d was rate limited within the burst", result.Index)
+		}
+	}
+
+	call := `{"jsonrpc": "2.0", "id": %d, "method": "resolve", "params": {"url": "https://youtu.be/dQw4w9WgXcQ"}}`
+	req = httptest.NewRequest(http.MethodPost, rpcPath, strings.NewReader("["+fmt.Sprintf(call, 1)+","+fmt.Sprintf(call, 2)+"]"))
+	req.Header.Set("X-API-Key", "secret")
+	recorder = httptest.NewRecorder()
+	srv.TenantAuth(srv.MakeRPCHandler()).ServeHTTP(recorder, req)
+	var limited int
+	for _, response := range decodeBody[[]RPCResponse](t, recorder) {
+		if response.Error != nil && response.Error.Code == RPCLimited {
+			limited++
+		}
+	}
+	if limited != 1 {
+		t.Errorf("%d rpc calls were rate limited, want 1", limited)
+	}
+}
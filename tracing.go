@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	mathrand "math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const SpanContextKey ctxKey = "span"
+
+type TracingConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// SampleRate is the share of requests traced, requests with a sampled
+	// traceparent header are always traced
+	SampleRate float64 `yaml:"sample_rate"`
+}
+
+// Span is a minimal trace span, finished spans are written to the log with
+// their trace and parent ids so a trace can be put back together from there
+type Span struct {
+	Name     string
+	TraceID  string
+	SpanID   string
+	ParentID string
+
+	root    *Span
+	started time.Time
+	mu      sync.Mutex
+	attrs   []slog.Attr
+	// upstream calls per endpoint made within the trace, kept on the root span
+	calls map[string]int
+}
+
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(SpanContextKey).(*Span)
+	return span
+}
+
+// startChildSpan starts a span below the one in ctx, untraced requests get a nil span
+func startChildSpan(ctx context.Context, name string) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	span := &Span{
+		Name:     name,
+		TraceID:  parent.TraceID,
+		SpanID:   randomHex(8),
+		ParentID: parent.SpanID,
+		root:     parent.root,
+		started:  time.Now(),
+	}
+	return context.WithValue(ctx, SpanContextKey, span), span
+}
+
+func (span *Span) SetAttr(attrs ...slog.Attr) {
+	if span == nil {
+		return
+	}
+	span.mu.Lock()
+	span.attrs = append(span.attrs, attrs...)
+	span.mu.Unlock()
+}
+
+// countCall returns how often endpoint was already called in this trace,
+// a repeated call to the same endpoint is a retry
+func (span *Span) countCall(endpoint string) int {
+	root := span.root
+	root.mu.Lock()
+	defer root.mu.Unlock()
+	previous := root.calls[endpoint]
+	root.calls[endpoint] = previous + 1
+	return previous
+}
+
+func (span *Span) End(err error) {
+	if span == nil {
+		return
+	}
+	span.mu.Lock()
+	attrs := []any{
+		slog.String("trace_id", span.TraceID),
+		slog.String("span_id", span.SpanID),
+		slog.String("name", span.Name),
+		slog.Float64("duration_ms", float64(time.Since(span.started).Microseconds())/1000),
+	}
+	if span.ParentID != "" {
+		attrs = append(attrs, slog.String("parent_id", span.ParentID))
+	}
+	for _, attr := range span.attrs {
+		attrs = append(attrs, attr)
+	}
+	span.mu.Unlock()
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	slog.Info("Span finished", slog.Group("span", attrs...))
+}
+
+// hashVisitorId keeps visitor ids out of traces while still telling them apart
+func hashVisitorId(visitorId string) string {
+	sum := sha256.Sum256([]byte(visitorId))
+	return hex.EncodeToString(sum[:8])
+}
+
+// parseTraceparent reads a w3c traceparent header, returning the trace id,
+// parent span id and whether the caller sampled it
+func parseTraceparent(header string) (string, string, bool, bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return "", "", false, false
+	}
+	if _, err := hex.DecodeString(parts[1] + parts[2] + parts[3]); err != nil {
+		return "", "", false, false
+	}
+	return parts[1], parts[2], parts[3][1]&1 == 1, true
+}
+
+// Tracing starts a root span for sampled requests, upstream calls made while
+// handling them become its children
+func (srv *Server) Tracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		if !srv.Cfg.Tracing.Enabled {
+			next.ServeHTTP(writer, req)
+			return
+		}
+		traceId, parentId, sampled, ok := parseTraceparent(req.Header.Get("traceparent"))
+		if !sampled && mathrand.Float64() >= srv.Cfg.Tracing.SampleRate {
+			next.ServeHTTP(writer, req)
+			return
+		}
+		if !ok {
+			traceId = randomHex(16)
+		}
+		span := &Span{
+			Name:     req.Method + " " + req.URL.Path,
+			TraceID:  traceId,
+			SpanID:   randomHex(8),
+			ParentID: parentId,
+			started:  time.Now(),
+			calls:    make(map[string]int),
+		}
+		span.root = span
+		writer.Header().Set("traceparent", "00-"+span.TraceID+"-"+span.SpanID+"-01")
+
+		recorder := &statusRecorder{ResponseWriter: writer}
+		next.ServeHTTP(recorder, req.WithContext(context.WithValue(req.Context(), SpanContextKey, span)))
+
+		span.SetAttr(
+			slog.String("http.method", req.Method),
+			slog.String("http.path", req.URL.Path),
+			slog.Int("http.status_code", recorder.Status()),
+			slog.Int("http.response_bytes", recorder.bytes),
+		)
+		span.End(nil)
+	})
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const upstreamLocalAddrContextKey ctxKey = "upstreamLocalAddr"
+
+var (
+	upstreamRequestsTotal = metrics.Counter(
+		"ytsearch_upstream_requests_total",
+		"Requests sent to upstream hosts by endpoint, response status and whether a rotated ipv6 address was used",
+		"host", "endpoint", "status", "ipv6",
+	)
+	upstreamRequestDuration = metrics.Histogram(
+		"ytsearch_upstream_request_duration_seconds",
+		"Time until the upstream response headers arrived",
+		DefaultLatencyBuckets,
+		"host", "endpoint",
+	)
+	dialFailuresTotal = metrics.Counter(
+		"ytsearch_upstream_dial_failures_total",
+		"Failed upstream connections by source subnet, default when no rotated address was used",
+		"subnet",
+	)
+	dialsWithoutRotationTotal = metrics.Counter(
+		"ytsearch_upstream_dials_without_rotation_total",
+		"Upstream connections made from the default address instead of a rotated ipv6 one",
+		"reason",
+	)
+	distinctSourceAddresses = metrics.Gauge(
+		"ytsearch_upstream_distinct_source_addresses",
+		"Distinct rotated ipv6 source addresses used during the current hour",
+	)
+	sourceAddresses = &sourceAddressTracker{seen: make(map[string]struct{})}
+)
+
+// sourceAddressTracker counts the distinct source addresses of an hourly
+// window, capped so a large subnet can't grow it without bound
+type sourceAddressTracker struct {
+	mu          sync.Mutex
+	windowStart time.Time
+	seen        map[string]struct{}
+}
+
+const maxTrackedSourceAddresses = 100000
+
+func (tracker *sourceAddressTracker) Add(addr string) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	if time.Since(tracker.windowStart) > time.Hour {
+		tracker.windowStart = time.Now()
+		clear(tracker.seen)
+	}
+	if len(tracker.seen) < maxTrackedSourceAddresses {
+		tracker.seen[addr] = struct{}{}
+	}
+	distinctSourceAddresses.Set(float64(len(tracker.seen)))
+}
+
+// upstreamEndpoint names the innertube endpoint of a request, e.g. search,
+// player or browse, everything else is a plain page load
+func upstreamEndpoint(req *http.Request) string {
+	if name, ok := strings.CutPrefix(req.URL.Path, "/youtubei/v1/"); ok && name != "" {
+		return strings.ReplaceAll(name, "/", "_")
+	}
+	if req.URL.Path == "/oembed" {
+		return "oembed"
+	}
+	if req.URL.Path == "/api/timedtext" {
+		return "timedtext"
+	}
+	return "page"
+}
+
+// withLocalAddrMarker lets the dialer report back the rotated ipv6 address it bound
+func withLocalAddrMarker(ctx context.Context) (context.Context, *atomic.Pointer[string]) {
+	addr := new(atomic.Pointer[string])
+	return context.WithValue(ctx, upstreamLocalAddrContextKey, addr), addr
+}
+
+func markLocalAddr(ctx context.Context, addr string) {
+	if marker, ok := ctx.Value(upstreamLocalAddrContextKey).(*atomic.Pointer[string]); ok {
+		marker.Store(&addr)
+	}
+}
+
+// localPrefix reduces a rotated source address to its /64 for traces
+func localPrefix(addr string) string {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return addr
+	}
+	prefix, err := ip.Prefix(64)
+	if err != nil {
+		return addr
+	}
+	return prefix.String()
+}
+
+// startUpstreamSpan opens the span of an upstream call when the request is
+// traced, describing the visitor, innertube client and retries
+func (client *HttpClient) startUpstreamSpan(req *http.Request) (context.Context, *Span) {
+	endpoint := upstreamEndpoint(req)
+	ctx, span := startChildSpan(req.Context(), "upstream "+endpoint)
+	if span == nil {
+		return ctx, nil
+	}
+	span.SetAttr(
+		slog.String("upstream.host", req.URL.Hostname()),
+		slog.String("upstream.endpoint", endpoint),
+		slog.Int("upstream.retry_count", span.countCall(req.URL.Hostname()+endpoint)),
+	)
+	if visitorId, ok := ctx.Value(VisitorDataContextKey).(string); ok && visitorId != "" {
+		span.SetAttr(slog.String("visitor.id_hash", hashVisitorId(visitorId)))
+	}
+	if clientName, ok := ctx.Value(InnertubeClientContextKey).(string); ok && clientName != "" {
+		span.SetAttr(slog.String("innertube.client", clientName))
+	}
+	return ctx, span
+}
+
+func recordUpstreamCall(req *http.Request, resp *http.Response, err error, ipv6Addr *string, started time.Time) {
+	ipv6 := ipv6Addr != nil
+	host := req.URL.Hostname()
+	endpoint := upstreamEndpoint(req)
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(resp.StatusCode)
+	}
+	upstreamRequestsTotal.Inc(host, endpoint, status, strconv.FormatBool(ipv6))
+	tenantUpstreamRequestsTotal.Inc(tenantLabel(req.Context()))
+	timing := UpstreamTiming{
+		Host:       host,
+		Endpoint:   endpoint,
+		Status:     status,
+		DurationMs: float64(time.Since(started).Microseconds()) / 1000,
+	}
+	if visitorId, ok := req.Context().Value(VisitorDataContextKey).(string); ok && visitorId != "" {
+		timing.Visitor = hashVisitorId(visitorId)
+	}
+	if clientName, ok := req.Context().Value(InnertubeClientContextKey).(string); ok {
+		timing.Client = clientName
+	}
+	if ipv6 {
+		timing.SourcePrefix = localPrefix(*ipv6Addr)
+	}
+	RequestInfoFromContext(req.Context()).addUpstream(timing)
+	alertTotals.upstreamCalls.Add(1)
+	if err != nil || resp.StatusCode >= 400 {
+		alertTotals.upstreamErrors.Add(1)
+	}
+	upstreamRequestDuration.Observe(time.Since(started).Seconds(), host, endpoint)
+}
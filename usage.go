@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const usageSchema = `
+	CREATE TABLE IF NOT EXISTS usage (
+		tenant TEXT NOT NULL,
+		day TEXT NOT NULL,
+		requests INTEGER DEFAULT 0,
+		upstream_calls INTEGER DEFAULT 0,
+		PRIMARY KEY (tenant, day)
+	);`
+
+type TenantQuota struct {
+	DailyRequests   int `yaml:"daily_requests"`
+	MonthlyRequests int `yaml:"monthly_requests"`
+}
+
+type usageCounter struct {
+	day     string
+	daily   int
+	monthly int
+}
+
+// UsageTracker counts requests per tenant for quota enforcement. Counters
+// are kept in memory and seeded from the usage table on the first request
+// of a day, so quotas survive restarts.
+type UsageTracker struct {
+	mu       sync.Mutex
+	counters map[string]*usageCounter
+}
+
+type UsageRow struct {
+	Tenant        string `json:"tenant"`
+	Day           string `json:"day"`
+	Requests      int64  `json:"requests"`
+	UpstreamCalls int64  `json:"upstream_calls"`
+}
+
+func NewUsageTracker() *UsageTracker {
+	return &UsageTracker{counters: make(map[string]*usageCounter)}
+}
+
+func (srv *Server) loadUsageCounter(ctx context.Context, tenant string, day string) *usageCounter {
+	counter := &usageCounter{day: day}
+	if srv.db == nil {
+		return counter
+	}
+	err := srv.db.QueryRowContext(ctx,
+		`SELECT
+			COALESCE(SUM(CASE WHEN day = ? THEN requests ELSE 0 END), 0),
+			COALESCE(SUM(requests), 0)
+		FROM usage WHERE tenant = ? AND day LIKE ?`,
+		day, tenant, day[:7]+"-%",
+	).Scan(&counter.daily, &counter.monthly)
+	if err != nil {
+		LoggerFromContext(ctx).Error("Failed to load usage", "tenant", tenant, "error", err)
+	}
+	return counter
+}
+
+// reserveRequest counts a request against the tenant's quotas, refusing it
+// when a quota is used up. The remaining quotas are set as response headers.
+func (srv *Server) reserveRequest(ctx context.Context, header http.Header, tenant *Tenant) bool {
+	day := time.Now().UTC().Format(time.DateOnly)
+
+	srv.usage.mu.Lock()
+	counter, ok := srv.usage.counters[tenant.Name]
+	if !ok || counter.day != day {
+		monthly := 0
+		if ok && counter.day[:7] == day[:7] {
+			monthly = counter.monthly
+		}
+		counter = srv.loadUsageCounter(ctx, tenant.Name, day)
+		counter.monthly = max(counter.monthly, monthly)
+		srv.usage.counters[tenant.Name] = counter
+	}
+
+	quota := tenant.Quota
+	allowed := (quota.DailyRequests <= 0 || counter.daily < quota.DailyRequests) &&
+		(quota.MonthlyRequests <= 0 || counter.monthly < quota.MonthlyRequests)
+	if allowed {
+		counter.daily++
+		counter.monthly++
+	}
+	daily, monthly := counter.daily, counter.monthly
+	srv.usage.mu.Unlock()
+
+	if quota.DailyRequests > 0 {
+		header.Set("X-Quota-Daily-Limit", strconv.Itoa(quota.DailyRequests))
+		header.Set("X-Quota-Daily-Remaining", strconv.Itoa(max(0, quota.DailyRequests-daily)))
+	}
+	if quota.MonthlyRequests > 0 {
+		header.Set("X-Quota-Monthly-Limit", strconv.Itoa(quota.MonthlyRequests))
+		header.Set("X-Quota-Monthly-Remaining", strconv.Itoa(max(0, quota.MonthlyRequests-monthly)))
+	}
+	return allowed
+}
+
+func (srv *Server) recordUsage(ctx context.Context, tenant *Tenant, upstreamCalls int64) {
+	srv.addUsage(ctx, tenant, 1, upstreamCalls)
+}
+
+// addUsage adds to the usage of the tenant today, jobs add their upstream
+// calls without counting as another request
+func (srv *Server) addUsage(ctx context.Context, tenant *Tenant, requests int, upstreamCalls int64) {
+	if srv.db == nil {
+		return
+	}
+	_, err := srv.db.ExecContext(ctx,
+		`INSERT INTO usage (tenant, day, requests, upstream_calls) VALUES (?, ?, ?, ?)
+		ON CONFLICT (tenant, day) DO UPDATE SET
+			requests = requests + excluded.requests,
+			upstream_calls = upstream_calls + excluded.upstream_calls`,
+		tenant.Name, time.Now().UTC().Format(time.DateOnly), requests, upstreamCalls,
+	)
+	if err != nil {
+		LoggerFromContext(ctx).Error("Failed to record usage", "tenant", tenant.Name, "error", err)
+	}
+}
+
+func (srv *Server) LoadUsage(ctx context.Context, tenant string, since string) ([]UsageRow, error) {
+	query := "SELECT tenant, day, requests, upstream_calls FROM usage WHERE day >= ?"
+	args := []any{since}
+	if tenant != "" {
+		query += " AND tenant = ?"
+		args = append(args, tenant)
+	}
+	rows, err := srv.db.QueryContext(ctx, query+" ORDER BY tenant, day", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query usage: %w", err)
+	}
+	defer rows.Close()
+
+	usage := make([]UsageRow, 0)
+	for rows.Next() {
+		var row UsageRow
+		if err := rows.Scan(&row.Tenant, &row.Day, &row.Requests, &row.UpstreamCalls); err != nil {
+			return nil, fmt.Errorf("failed to scan usage: %w", err)
+		}
+		usage = append(usage, row)
+	}
+	return usage, rows.Err()
+}
+
+func (srv *Server) MakeUsageHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		if srv.db == nil {
+			writeError(writer, http.StatusServiceUnavailable, "usage reporting requires caching to be enabled")
+			return
+		}
+
+		days := 31
+		if value := req.FormValue("days"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed <= 0 {
+				writeError(writer, http.StatusBadRequest, "days must be a positive integer")
+				return
+			}
+			days = parsed
+		}
+		since := time.Now().UTC().AddDate(0, 0, -(days - 1)).Format(time.DateOnly)
+
+		usage, err := srv.LoadUsage(req.Context(), req.FormValue("tenant"), since)
+		if err != nil {
+			writeError(writer, http.StatusInternalServerError, fmt.Sprintf("Error loading usage: %v", err))
+			return
+		}
+		writer.Header().Set("Cache-Control", "no-store")
+		srv.writeJSON(writer, req, usage, CacheStatus{})
+	}
+}
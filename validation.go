@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type EndpointLimits struct {
+	MaxQueryLength int   `yaml:"max_query_length"`
+	MaxBodyBytes   int64 `yaml:"max_body_bytes"`
+}
+
+type ValidationConfig struct {
+	MaxQueryLength int                       `yaml:"max_query_length"`
+	MaxParamLength int                       `yaml:"max_param_length"`
+	MaxBodyBytes   int64                     `yaml:"max_body_bytes"`
+	Endpoints      map[string]EndpointLimits `yaml:"endpoints"`
+}
+
+type ValidationError struct {
+	Code    string `json:"code"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+func (err *ValidationError) Error() string {
+	return err.Message
+}
+
+func writeValidationError(writer http.ResponseWriter, err *ValidationError) {
+	writeRequestError(writer, http.StatusBadRequest, err)
+}
+
+// writeRequestError answers with a ValidationError body and a status other than
+// 400, along with the id RequestContext gave the request
+func writeRequestError(writer http.ResponseWriter, status int, err *ValidationError) {
+	body := map[string]any{"error": err}
+	if id := writer.Header().Get("X-Request-ID"); id != "" {
+		body["request_id"] = id
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	if encodeErr := json.NewEncoder(writer).Encode(body); encodeErr != nil {
+		slog.Error("Failed to encode validation error", "error", encodeErr)
+	}
+}
+
+// writeError answers with a ValidationError coded after the status, for the
+// errors that have no code of their own
+func writeError(writer http.ResponseWriter, status int, message string) {
+	code := strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+	writeRequestError(writer, status, &ValidationError{Code: code, Message: message})
+}
+
+// validateText rejects values that are not valid UTF-8, contain control
+// characters or are longer than maxLength runes
+func validateText(param string, value string, maxLength int) *ValidationError {
+	if !utf8.ValidString(value) {
+		return &ValidationError{Code: "invalid_utf8", Param: param, Message: param + " is not valid UTF-8"}
+	}
+	for _, r := range value {
+		if unicode.IsControl(r) {
+			return &ValidationError{
+				Code:    "control_character",
+				Param:   param,
+				Message: param + " must not contain control characters",
+			}
+		}
+	}
+	if maxLength > 0 && utf8.RuneCountInString(value) > maxLength {
+		return &ValidationError{
+			Code:    "too_long",
+			Param:   param,
+			Message: fmt.Sprintf("%s must be at most %d characters", param, maxLength),
+		}
+	}
+	return nil
+}
+
+func (cfg ValidationConfig) limitsFor(path string) EndpointLimits {
+	limits := EndpointLimits{MaxQueryLength: cfg.MaxQueryLength, MaxBodyBytes: cfg.MaxBodyBytes}
+	if override, ok := cfg.Endpoints[path]; ok {
+		if override.MaxQueryLength > 0 {
+			limits.MaxQueryLength = override.MaxQueryLength
+		}
+		if override.MaxBodyBytes > 0 {
+			limits.MaxBodyBytes = override.MaxBodyBytes
+		}
+	}
+	return limits
+}
+
+// ValidateInput rejects malformed parameters before they reach a handler or
+// get forwarded to youtube, and caps the size of request bodies
+func (srv *Server) ValidateInput(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		cfg := srv.Cfg.Validation
+		limits := cfg.limitsFor(req.URL.Path)
+
+		if req.URL.RawQuery != "" {
+			params, err := url.ParseQuery(req.URL.RawQuery)
+			if err != nil {
+				writeValidationError(writer, &ValidationError{Code: "invalid_query_string", Message: err.Error()})
+				return
+			}
+			for name, values := range params {
+				maxLength := cfg.MaxParamLength
+				if name == "query" {
+					maxLength = limits.MaxQueryLength
+				}
+				for _, value := range values {
+					if err := validateText(name, value, maxLength); err != nil {
+						writeValidationError(writer, err)
+						return
+					}
+				}
+			}
+		}
+
+		if req.Body != nil && limits.MaxBodyBytes > 0 {
+			if req.ContentLength > limits.MaxBodyBytes {
+				writeValidationError(writer, &ValidationError{
+					Code:    "body_too_large",
+					Message: fmt.Sprintf("request body must be at most %d bytes", limits.MaxBodyBytes),
+				})
+				return
+			}
+			req.Body = http.MaxBytesReader(writer, req.Body, limits.MaxBodyBytes)
+		}
+		next.ServeHTTP(writer, req)
+	})
+}
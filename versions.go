@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const APIVersionContextKey ctxKey = "apiVersion"
+
+const (
+	// CurrentAPIVersion is the response schema version of the newest /v<n>
+	// routes
+	CurrentAPIVersion = 1
+	// legacyAPIVersion is the schema version the unversioned /api routes stay
+	// on, so bots written against them keep working as the schema moves on
+	legacyAPIVersion = 1
+)
+
+// apiVersionPrefixes are the versioned route prefixes, each serving the /api
+// routes with the responses of its schema version
+var apiVersionPrefixes = map[string]int{
+	"/v1/": 1,
+}
+
+// APIVersionFromContext returns the response schema version a request is
+// answered with. Handlers and the response pipeline check it before changing
+// the shape of a response, older versions keep the shape they had.
+func APIVersionFromContext(ctx context.Context) int {
+	if version, ok := ctx.Value(APIVersionContextKey).(int); ok {
+		return version
+	}
+	return legacyAPIVersion
+}
+
+// versionedPath returns the /api path a versioned path is served by, and the
+// schema version of its prefix
+func versionedPath(path string) (string, int, bool) {
+	for prefix, version := range apiVersionPrefixes {
+		if rest, ok := strings.CutPrefix(path, prefix); ok {
+			return "/api/" + rest, version, true
+		}
+	}
+	return path, 0, false
+}
+
+// APIVersions serves the /v<n> routes by the /api routes, which stay as
+// aliases answering with the legacy schema version. Every api response names
+// its schema version in X-API-Version. The rewrite happens before anything
+// else sees the request, so tenants' allowed endpoints, validation limits and
+// route profiles given for /api paths apply to both.
+func (srv *Server) APIVersions(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		path, version, ok := versionedPath(req.URL.Path)
+		if !ok {
+			if !strings.HasPrefix(req.URL.Path, "/api/") {
+				next.ServeHTTP(writer, req)
+				return
+			}
+			version = legacyAPIVersion
+		}
+
+		writer.Header().Set("X-API-Version", strconv.Itoa(version))
+		req = req.WithContext(context.WithValue(req.Context(), APIVersionContextKey, version))
+		if ok {
+			rewritten := *req.URL
+			rewritten.Path = path
+			if rewritten.RawPath != "" {
+				rawPath, _, _ := versionedPath(rewritten.RawPath)
+				rewritten.RawPath = rawPath
+			}
+			req.URL = &rewritten
+		}
+		next.ServeHTTP(writer, req)
+	})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"slices"
+	"time"
+)
+
+var (
+	visitorPoolSize = metrics.Gauge(
+		"ytsearch_visitor_pool_size",
+		"Visitors in the pool by client type",
+		"type",
+	)
+	visitorAge = metrics.Gauge(
+		"ytsearch_visitor_age_seconds",
+		"Youngest, median and oldest visitor age by client type",
+		"type", "quantile",
+	)
+	visitorRotationsTotal = metrics.Counter(
+		"ytsearch_visitor_rotations_total",
+		"Visitor rotations by client type and result",
+		"type", "result",
+	)
+	visitorFaultCount = metrics.Gauge(
+		"ytsearch_visitor_fault_count",
+		"Failed visitor fetches, the pool stops refilling once it reaches ytsearch_visitor_fault_limit",
+	)
+	visitorFaultLimit = metrics.Gauge(
+		"ytsearch_visitor_fault_limit",
+		"Fault count at which the visitor pool stops fetching new visitors",
+	)
+)
+
+func visitorType(isYouTube bool) string {
+	if isYouTube {
+		return "youtube"
+	}
+	return "youtubemusic"
+}
+
+func recordVisitorRotation(isYouTube bool, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	visitorRotationsTotal.Inc(visitorType(isYouTube), result)
+}
+
+// collectVisitorMetrics snapshots the pool, registered as a scrape collector
+// so ages are current instead of as old as the last rotation
+func (srv *Server) collectVisitorMetrics() {
+	srv.mu.RLock()
+	ages := map[string][]float64{"youtube": nil, "youtubemusic": nil}
+	for _, visitor := range srv.visitors {
+		kind := visitorType(visitor.IsYouTube)
+		ages[kind] = append(ages[kind], time.Since(visitor.CreatedAt).Seconds())
+	}
+	faults := srv.faultCount
+	srv.mu.RUnlock()
+
+	for kind, values := range ages {
+		visitorPoolSize.Set(float64(len(values)), kind)
+		slices.Sort(values)
+		var youngest, median, oldest float64
+		if len(values) > 0 {
+			youngest, median, oldest = values[0], values[len(values)/2], values[len(values)-1]
+		}
+		visitorAge.Set(youngest, kind, "0")
+		visitorAge.Set(median, kind, "0.5")
+		visitorAge.Set(oldest, kind, "1")
+	}
+	visitorFaultCount.Set(float64(faults))
+	visitorFaultLimit.Set(float64(srv.Cfg.MaxVisitorCount * 4))
+}
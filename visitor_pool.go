@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	VisitorPoolMemory = "memory"
+	VisitorPoolRedis  = "redis"
+)
+
+type VisitorPoolConfig struct {
+	// Backend is memory for a pool per replica or redis to share one pool
+	// between all replicas
+	Backend   string `yaml:"backend"`
+	KeyPrefix string `yaml:"key_prefix"`
+	// SyncInterval is how many seconds a replica keeps its copy of the shared pool
+	SyncInterval int `yaml:"sync_interval"`
+	// FetchLease is how many seconds a replica holds the right to fetch new
+	// visitors of a type, so replicas don't fetch the same gap at once
+	FetchLease int `yaml:"fetch_lease"`
+}
+
+// RedisVisitorPool stores visitors in redis, each under its own key expiring
+// together with the visitor
+type RedisVisitorPool struct {
+	redis  *RedisClient
+	prefix string
+	lease  time.Duration
+	owner  string
+}
+
+func NewRedisVisitorPool(redis *RedisClient, cfg VisitorPoolConfig) *RedisVisitorPool {
+	return &RedisVisitorPool{
+		redis:  redis,
+		prefix: cfg.KeyPrefix,
+		lease:  time.Duration(cfg.FetchLease) * time.Second,
+		owner:  randomHex(8),
+	}
+}
+
+func (pool *RedisVisitorPool) key(visitor *YouTubeVisitorData) string {
+	return pool.prefix + "pool:" + visitorType(visitor.IsYouTube) + ":" + hashVisitorId(visitor.VisitorID())
+}
+
+func (pool *RedisVisitorPool) Load(ctx context.Context) ([]*YouTubeVisitorData, error) {
+	keys, err := pool.redis.Keys(ctx, pool.prefix+"pool:*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list shared visitors: %w", err)
+	}
+	values, err := pool.redis.MGet(ctx, keys...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load shared visitors: %w", err)
+	}
+	visitors := make([]*YouTubeVisitorData, 0, len(values))
+	for _, value := range values {
+		var visitor YouTubeVisitorData
+		if err := json.Unmarshal([]byte(value), &visitor); err != nil {
+			slog.Error("Failed to unmarshal shared visitor", "error", err)
+			continue
+		}
+		if !visitor.IsExpired() {
+			visitors = append(visitors, &visitor)
+		}
+	}
+	return visitors, nil
+}
+
+func (pool *RedisVisitorPool) Publish(ctx context.Context, visitor *YouTubeVisitorData) error {
+	data, err := json.Marshal(visitor)
+	if err != nil {
+		return err
+	}
+	ttl := visitorLifetime - time.Since(visitor.CreatedAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return pool.redis.Set(ctx, pool.key(visitor), string(data), ttl)
+}
+
+// AcquireLease claims fetching visitors of a type, the returned func gives the lease back
+func (pool *RedisVisitorPool) AcquireLease(ctx context.Context, isYouTube bool) (func(), bool, error) {
+	key := pool.prefix + "lease:" + visitorType(isYouTube)
+	acquired, err := pool.redis.SetNX(ctx, key, pool.owner, pool.lease)
+	if err != nil || !acquired {
+		return nil, false, err
+	}
+	return func() {
+		if err := pool.redis.Release(context.WithoutCancel(ctx), key, pool.owner); err != nil {
+			slog.Error("Failed to release visitor lease", "error", err)
+		}
+	}, true, nil
+}
+
+func (pool *RedisVisitorPool) Clear(ctx context.Context) error {
+	keys, err := pool.redis.Keys(ctx, pool.prefix+"pool:*")
+	if err != nil {
+		return err
+	}
+	return pool.redis.Del(ctx, keys...)
+}
+
+// fetchSharedVisitor fetches and publishes a visitor while holding the lease
+// of its type, returning nil when another replica holds it
+func (srv *Server) fetchSharedVisitor(ctx context.Context, isYouTube bool) (*YouTubeVisitorData, error) {
+	release, acquired, err := srv.sharedVisitors.AcquireLease(ctx, isYouTube)
+	if err != nil || !acquired {
+		return nil, err
+	}
+	defer release()
+
+	visitor, err := srv.fetchInnertubeContext(ctx, isYouTube)
+	if err != nil {
+		srv.mu.Lock()
+		srv.faultCount++
+		srv.mu.Unlock()
+		return nil, err
+	}
+	if err := srv.sharedVisitors.Publish(ctx, visitor); err != nil {
+		return nil, fmt.Errorf("failed to publish visitor: %w", err)
+	}
+	slog.Info("Published new shared visitor", "isYouTube", isYouTube)
+	return visitor, nil
+}
+
+// syncSharedVisitors replaces the local copy of the pool with the shared one,
+// first filling the shared pool up to max_visitor_count
+func (srv *Server) syncSharedVisitors(ctx context.Context) error {
+	visitors, err := srv.sharedVisitors.Load(ctx)
+	if err != nil {
+		return err
+	}
+
+	counts := map[bool]int{}
+	for _, visitor := range visitors {
+		counts[visitor.IsYouTube]++
+	}
+	targets := map[bool]int{
+		true:  srv.Cfg.MaxVisitorCount / 2,
+		false: srv.Cfg.MaxVisitorCount - srv.Cfg.MaxVisitorCount/2,
+	}
+	srv.mu.RLock()
+	canFetch := srv.faultCount < srv.Cfg.MaxVisitorCount*4
+	srv.mu.RUnlock()
+	for isYouTube, target := range targets {
+		for counts[isYouTube] < target && canFetch {
+			visitor, err := srv.fetchSharedVisitor(ctx, isYouTube)
+			recordVisitorRotation(isYouTube, err)
+			if err != nil {
+				slog.Error("Failed to fetch shared visitor", "error", err)
+			}
+			if visitor == nil {
+				break
+			}
+			visitors = append(visitors, visitor)
+			counts[isYouTube]++
+		}
+	}
+
+	srv.mu.Lock()
+	srv.visitors = visitors
+	srv.mu.Unlock()
+	return nil
+}
+
+func (srv *Server) SyncSharedVisitors(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(srv.Cfg.VisitorPool.SyncInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Stopping shared visitor sync")
+			return
+		case <-ticker.C:
+			if err := srv.syncSharedVisitors(ctx); err != nil {
+				slog.Error("Failed to sync shared visitors", "error", err)
+			}
+		}
+	}
+}
+
+func (srv *Server) randomSharedVisitor(ctx context.Context, isYouTube bool) *YouTubeVisitorData {
+	pick := func() *YouTubeVisitorData {
+		srv.mu.RLock()
+		defer srv.mu.RUnlock()
+		var filtered []*YouTubeVisitorData
+		for _, visitor := range srv.visitors {
+			if visitor.IsYouTube == isYouTube && !visitor.IsExpired() {
+				filtered = append(filtered, visitor)
+			}
+		}
+		if len(filtered) == 0 {
+			return nil
+		}
+		return filtered[rand.IntN(len(filtered))]
+	}
+	if visitor := pick(); visitor != nil {
+		return visitor
+	}
+	if err := srv.syncSharedVisitors(ctx); err != nil {
+		LoggerFromContext(ctx).Error("Failed to sync shared visitors", "error", err)
+	}
+	return pick()
+}